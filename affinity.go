@@ -0,0 +1,13 @@
+package bufioprop
+
+import "os"
+
+// touchPages writes into every memory page of a freshly allocated buffer, so that
+// under the kernel's first touch policy the pages get backed by memory local to
+// the NUMA node of the calling thread.
+func touchPages(buf []byte) {
+	page := os.Getpagesize()
+	for i := 0; i < len(buf); i += page {
+		buf[i] = 0
+	}
+}
@@ -0,0 +1,40 @@
+package bufioprop
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// cpuMask is a CPU set as used by the sched_{get,set}affinity syscalls.
+type cpuMask [1024 / 64]uint64
+
+// pinThread locks the calling goroutine to its OS thread and restricts the thread
+// to the given CPU, returning a function to restore the thread's original CPU set
+// and unlock it. If the affinity cannot be changed, the goroutine is only locked
+// to its thread.
+func pinThread(cpu int) (unpin func()) {
+	runtime.LockOSThread()
+
+	var old, mask cpuMask
+	if cpu < 0 || cpu >= len(mask)*64 || schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &old) != nil {
+		return runtime.UnlockOSThread
+	}
+	mask[cpu/64] |= 1 << (cpu % 64)
+	if schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &mask) != nil {
+		return runtime.UnlockOSThread
+	}
+	return func() {
+		schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &old)
+		runtime.UnlockOSThread()
+	}
+}
+
+// schedAffinity retrieves or sets the CPU set of the calling thread.
+func schedAffinity(trap uintptr, mask *cpuMask) error {
+	_, _, errno := syscall.RawSyscall(trap, 0, unsafe.Sizeof(*mask), uintptr(unsafe.Pointer(mask)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
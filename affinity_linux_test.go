@@ -0,0 +1,34 @@
+package bufioprop
+
+import (
+	"bytes"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// Tests that pinned copies work, and restore the CPU set of the calling thread.
+func TestCopyAffinity(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var before, after cpuMask
+	if err := schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &before); err != nil {
+		t.Skipf("cpu affinity unavailable: %v", err)
+	}
+	for _, cpus := range [][2]int{{0, 0}, {0, runtime.NumCPU() - 1}, {-1, 0}, {0, -1}} {
+		out := new(bytes.Buffer)
+		if _, err := Copy(out, bytes.NewBuffer(testData[:16*1024*1024]), 64*1024, WithAffinity(cpus[0], cpus[1])); err != nil {
+			t.Fatalf("cpus %v: failed to copy: %v", cpus, err)
+		}
+		if !bytes.Equal(out.Bytes(), testData[:16*1024*1024]) {
+			t.Fatalf("cpus %v: data mismatch", cpus)
+		}
+		if err := schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &after); err != nil {
+			t.Fatalf("cpus %v: failed to retrieve affinity: %v", cpus, err)
+		}
+		if after != before {
+			t.Fatalf("cpus %v: affinity not restored: have %x, want %x", cpus, after, before)
+		}
+	}
+}
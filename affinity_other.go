@@ -0,0 +1,12 @@
+//go:build !linux
+
+package bufioprop
+
+import "runtime"
+
+// pinThread locks the calling goroutine to its OS thread, returning a function to
+// unlock it. CPU affinity is not supported on this platform, so cpu is ignored.
+func pinThread(cpu int) (unpin func()) {
+	runtime.LockOSThread()
+	return runtime.UnlockOSThread
+}
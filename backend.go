@@ -0,0 +1,10 @@
+//go:build !js && !wasip1 && !appengine && !bufioprop_portable
+
+package bufioprop
+
+// maxSpin is the number of times to yield the processor while waiting for the
+// other side, before going down into a deep sleep on the wake signal.
+const maxSpin = 16 // Spin lock prevent going down to channel syncs
+
+// defaultWake is the wake strategy used when not explicitly configured.
+const defaultWake = WakeEdge
@@ -0,0 +1,15 @@
+//go:build js || wasip1 || appengine || bufioprop_portable
+
+package bufioprop
+
+// On single threaded or sandboxed platforms (js/wasm, appengine), yielding the
+// processor in a spin loop either starves the other side or burns quota, so the
+// portable backend never spins and parks on a mutex + condition variable pair
+// right away. It can be forced on any platform via the bufioprop_portable tag.
+
+// maxSpin is the number of times to yield the processor while waiting for the
+// other side, before going down into a deep sleep on the wake signal.
+const maxSpin = 0
+
+// defaultWake is the wake strategy used when not explicitly configured.
+const defaultWake = WakeLevel
@@ -0,0 +1,104 @@
+package bufioprop
+
+// A Barrier tracks the delivery of all the data written into a pipe before the
+// barrier was requested, permitting the producer to order external side effects
+// (e.g. deleting the source of the data) after the data was handed downstream.
+type Barrier struct {
+	target uint64        // Number of bytes to be read out of the pipe to pass the barrier
+	done   chan struct{} // Channel closed when the barrier is passed or failed
+	err    error         // Failure if the reader terminated before passing the barrier
+}
+
+// Done returns a channel which is closed when all the data written before the
+// barrier has been read out of the pipe (i.e. handed to the destination writer in
+// WriteTo or a copy), or the reader terminated before that happened.
+func (b *Barrier) Done() <-chan struct{} {
+	return b.done
+}
+
+// Err returns nil if the barrier was passed, ErrClosedPipe if the reader was closed
+// before reading all the data written ahead of it. It must only be called after
+// the channel returned by Done is closed.
+func (b *Barrier) Err() error {
+	return b.err
+}
+
+// Barrier requests a barrier behind all the data written into the pipe so far,
+// whose Done channel is closed once the reader has consumed all of it. A view
+// returned by Next counts as consumed only once it's released by the reader's
+// next call to any of its read methods (including Next itself).
+func (w *PipeWriter) Barrier() *Barrier {
+	return w.p.barrier()
+}
+
+// barrier creates a barrier at the current write position, queueing it up for
+// the reader to pass, or passing it right away if everything was already read.
+func (p *pipe) barrier() *Barrier {
+	b := &Barrier{
+		target: p.head.Load(),
+		done:   make(chan struct{}),
+	}
+	p.barrierLock.Lock()
+	switch {
+	case p.tail.Load() >= b.target:
+		close(b.done)
+	case closed(p.outQuit):
+		b.err = ErrClosedPipe
+		close(b.done)
+	default:
+		if len(p.barriers) == 0 {
+			p.barrierNext.Store(b.target)
+		}
+		p.barriers = append(p.barriers, b)
+	}
+	p.barrierLock.Unlock()
+
+	// The reader might have passed the barrier before seeing it queued up
+	if tail := p.tail.Load(); tail >= b.target {
+		p.passBarriers(tail)
+	}
+	return b
+}
+
+// checkBarriers passes any queued barriers which the reader reached after moving
+// the read counter to tail. It is called on every read advance, so it only takes
+// the lock if a barrier is due.
+func (p *pipe) checkBarriers(tail uint64) {
+	if next := p.barrierNext.Load(); next != 0 && tail >= next {
+		p.passBarriers(tail)
+	}
+}
+
+// passBarriers releases all the queued barriers behind the read counter.
+func (p *pipe) passBarriers(tail uint64) {
+	p.barrierLock.Lock()
+	defer p.barrierLock.Unlock()
+
+	var passed int
+	for passed < len(p.barriers) && p.barriers[passed].target <= tail {
+		close(p.barriers[passed].done)
+		passed++
+	}
+	p.barriers = p.barriers[passed:]
+	if len(p.barriers) == 0 {
+		p.barrierNext.Store(0)
+	} else {
+		p.barrierNext.Store(p.barriers[0].target)
+	}
+}
+
+// failBarriers releases all the queued barriers after the reader terminated,
+// failing the ones it never reached.
+func (p *pipe) failBarriers() {
+	p.passBarriers(p.tail.Load())
+
+	p.barrierLock.Lock()
+	defer p.barrierLock.Unlock()
+
+	for _, b := range p.barriers {
+		b.err = ErrClosedPipe
+		close(b.done)
+	}
+	p.barriers = nil
+	p.barrierNext.Store(0)
+}
@@ -0,0 +1,89 @@
+package bufioprop
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// passed checks whether a barrier has already been released.
+func passed(b *Barrier) bool {
+	select {
+	case <-b.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// Tests that barriers are passed only once all the data written before them has
+// been read out, in order, and fail if the reader terminates before.
+func TestPipeBarrier(t *testing.T) {
+	r, w := Pipe(64)
+
+	if b := w.Barrier(); !passed(b) || b.Err() != nil {
+		t.Fatalf("empty pipe barrier mismatch: have (%v, %v), want (true, nil)", passed(b), b.Err())
+	}
+	w.Write([]byte("0123456789"))
+	b1 := w.Barrier()
+	w.Write([]byte("abcdefghij"))
+	b2 := w.Barrier()
+
+	buf := make([]byte, 5)
+	for i, want := range [][2]bool{{false, false}, {false, false}, {true, false}, {true, false}, {true, true}} {
+		if passed(b1) != want[0] || passed(b2) != want[1] {
+			t.Fatalf("step %d: barriers mismatch: have (%v, %v), want (%v, %v)", i, passed(b1), passed(b2), want[0], want[1])
+		}
+		if i < 4 {
+			if _, err := io.ReadFull(r, buf); err != nil {
+				t.Fatalf("step %d: failed to read: %v", i, err)
+			}
+		}
+	}
+	if b1.Err() != nil || b2.Err() != nil {
+		t.Fatalf("passed barrier errors: %v, %v", b1.Err(), b2.Err())
+	}
+	// Barriers not reached by the reader should fail upon its termination
+	w.Write([]byte("0123456789"))
+	b3 := w.Barrier()
+	r.Close()
+
+	select {
+	case <-b3.Done():
+		if b3.Err() != ErrClosedPipe {
+			t.Fatalf("failed barrier error mismatch: have %v, want %v", b3.Err(), ErrClosedPipe)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("barrier not released on reader termination")
+	}
+	if b := w.Barrier(); !passed(b) || b.Err() != ErrClosedPipe {
+		t.Fatalf("closed pipe barrier mismatch: have (%v, %v), want (true, %v)", passed(b), b.Err(), ErrClosedPipe)
+	}
+}
+
+// Tests that barriers are passed only after the data is handed to the destination
+// of a concurrent WriteTo.
+func TestPipeBarrierWriteTo(t *testing.T) {
+	r, w := Pipe(1024)
+
+	dst := new(syncBuffer)
+	go r.WriteTo(dst)
+
+	for i := 1; i <= 100; i++ {
+		w.Write(testData[:1000])
+		b := w.Barrier()
+
+		select {
+		case <-b.Done():
+			if b.Err() != nil {
+				t.Fatalf("barrier %d failed: %v", i, b.Err())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("barrier %d not passed", i)
+		}
+		if have := len(dst.String()); have != i*1000 {
+			t.Fatalf("barrier %d passed early: have %d bytes, want %d", i, have, i*1000)
+		}
+	}
+	w.Close()
+}
@@ -0,0 +1,49 @@
+package bufioprop
+
+// signalOutput wakes the reader after the writer advanced count bytes, moving
+// the written byte counter to head. If wake batching is enabled, the reader is
+// signaled only once enough bytes accumulate, or if the buffer was empty before
+// (i.e. the reader may be asleep waiting for any data).
+func (p *pipe) signalOutput(count int, head uint64) {
+	if p.wakeBatch > 0 {
+		if p.inPending += count; p.inPending < p.wakeBatch && head-uint64(count) != p.tail.Load() {
+			return
+		}
+		p.inPending = 0
+	}
+	p.outWake.Signal()
+}
+
+// signalInput wakes the writer after the reader advanced count bytes, moving the
+// read byte counter to tail. If wake batching is enabled, the writer is signaled
+// only once enough bytes accumulate, or if the buffer was full before (i.e. the
+// writer may be asleep waiting for any space).
+func (p *pipe) signalInput(count int, tail uint64) {
+	if p.wakeBatch > 0 {
+		if p.outPending += count; p.outPending < p.wakeBatch && p.head.Load()-(tail-uint64(count)) != uint64(p.size) {
+			return
+		}
+		p.outPending = 0
+	}
+	p.inWake.Signal()
+}
+
+// flushOutputSignal wakes the reader if the writer has any unsignaled advances,
+// called before the writer goes to sleep so the reader doesn't wait on a batch
+// which may never fill up.
+func (p *pipe) flushOutputSignal() {
+	if p.inPending > 0 {
+		p.inPending = 0
+		p.outWake.Signal()
+	}
+}
+
+// flushInputSignal wakes the writer if the reader has any unsignaled advances,
+// called before the reader goes to sleep so the writer doesn't wait on a batch
+// which may never fill up.
+func (p *pipe) flushInputSignal() {
+	if p.outPending > 0 {
+		p.outPending = 0
+		p.inWake.Signal()
+	}
+}
@@ -0,0 +1,228 @@
+package bufioprop
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrVarintOverflow is returned by ReadUvarint and ReadVarint if the encoded value
+// doesn't fit into 64 bits.
+var ErrVarintOverflow = errors.New("bufio: varint overflows a 64-bit integer")
+
+// ReadUvarint reads an unsigned varint, as encoded by binary.PutUvarint, straight
+// out of the pipe's internal buffer. If the stream ends midway through the value,
+// io.ErrUnexpectedEOF is returned.
+func (r *PipeReader) ReadUvarint() (uint64, error) {
+	r.p.outOwner.acquire("ReadUvarint")
+	defer r.p.outOwner.release()
+
+	r.p.release()
+
+	x, err := r.p.readUvarint()
+	return x, r.p.readError(err)
+}
+
+// ReadVarint reads a signed varint, as encoded by binary.PutVarint, straight out
+// of the pipe's internal buffer. If the stream ends midway through the value,
+// io.ErrUnexpectedEOF is returned.
+func (r *PipeReader) ReadVarint() (int64, error) {
+	r.p.outOwner.acquire("ReadVarint")
+	defer r.p.outOwner.release()
+
+	r.p.release()
+
+	ux, err := r.p.readUvarint()
+	x := int64(ux >> 1)
+	if ux&1 != 0 {
+		x = ^x
+	}
+	return x, r.p.readError(err)
+}
+
+// ReadUint16 reads a 16 bit unsigned integer of the given byte order straight out
+// of the pipe's internal buffer. If the stream ends midway through the value,
+// io.ErrUnexpectedEOF is returned.
+func (r *PipeReader) ReadUint16(order binary.ByteOrder) (v uint16, err error) {
+	r.p.outOwner.acquire("ReadUint16")
+	defer r.p.outOwner.release()
+
+	r.p.release()
+
+	err = r.p.readFixed(2, func(b []byte) { v = order.Uint16(b) })
+	return v, r.p.readError(err)
+}
+
+// ReadUint32 reads a 32 bit unsigned integer of the given byte order straight out
+// of the pipe's internal buffer. If the stream ends midway through the value,
+// io.ErrUnexpectedEOF is returned.
+func (r *PipeReader) ReadUint32(order binary.ByteOrder) (v uint32, err error) {
+	r.p.outOwner.acquire("ReadUint32")
+	defer r.p.outOwner.release()
+
+	r.p.release()
+
+	err = r.p.readFixed(4, func(b []byte) { v = order.Uint32(b) })
+	return v, r.p.readError(err)
+}
+
+// ReadUint64 reads a 64 bit unsigned integer of the given byte order straight out
+// of the pipe's internal buffer. If the stream ends midway through the value,
+// io.ErrUnexpectedEOF is returned.
+func (r *PipeReader) ReadUint64(order binary.ByteOrder) (v uint64, err error) {
+	r.p.outOwner.acquire("ReadUint64")
+	defer r.p.outOwner.release()
+
+	r.p.release()
+
+	err = r.p.readFixed(8, func(b []byte) { v = order.Uint64(b) })
+	return v, r.p.readError(err)
+}
+
+// WriteUvarint writes x into the pipe as an unsigned varint, as encoded by
+// binary.PutUvarint, blocking until the whole value is written.
+func (w *PipeWriter) WriteUvarint(x uint64) error {
+	w.p.inOwner.acquire("WriteUvarint")
+	defer w.p.inOwner.release()
+
+	n := binary.PutUvarint(w.p.inScratch[:], x)
+	_, err := w.p.write(w.p.inScratch[:n])
+	return w.p.writeError(err)
+}
+
+// WriteVarint writes x into the pipe as a signed varint, as encoded by
+// binary.PutVarint, blocking until the whole value is written.
+func (w *PipeWriter) WriteVarint(x int64) error {
+	w.p.inOwner.acquire("WriteVarint")
+	defer w.p.inOwner.release()
+
+	n := binary.PutVarint(w.p.inScratch[:], x)
+	_, err := w.p.write(w.p.inScratch[:n])
+	return w.p.writeError(err)
+}
+
+// WriteUint16 writes v into the pipe as a 16 bit unsigned integer of the given
+// byte order, blocking until the whole value is written.
+func (w *PipeWriter) WriteUint16(order binary.ByteOrder, v uint16) error {
+	w.p.inOwner.acquire("WriteUint16")
+	defer w.p.inOwner.release()
+
+	order.PutUint16(w.p.inScratch[:2], v)
+	_, err := w.p.write(w.p.inScratch[:2])
+	return w.p.writeError(err)
+}
+
+// WriteUint32 writes v into the pipe as a 32 bit unsigned integer of the given
+// byte order, blocking until the whole value is written.
+func (w *PipeWriter) WriteUint32(order binary.ByteOrder, v uint32) error {
+	w.p.inOwner.acquire("WriteUint32")
+	defer w.p.inOwner.release()
+
+	order.PutUint32(w.p.inScratch[:4], v)
+	_, err := w.p.write(w.p.inScratch[:4])
+	return w.p.writeError(err)
+}
+
+// WriteUint64 writes v into the pipe as a 64 bit unsigned integer of the given
+// byte order, blocking until the whole value is written.
+func (w *PipeWriter) WriteUint64(order binary.ByteOrder, v uint64) error {
+	w.p.inOwner.acquire("WriteUint64")
+	defer w.p.inOwner.release()
+
+	order.PutUint64(w.p.inScratch[:8], v)
+	_, err := w.p.write(w.p.inScratch[:8])
+	return w.p.writeError(err)
+}
+
+// ReadUvarint decodes an unsigned varint directly from the internal buffer, one
+// contiguous segment of buffered data at a time.
+func (p *pipe) readUvarint() (uint64, error) {
+	// Short circuit if the output was already closed
+	select {
+	case <-p.outQuit:
+		return 0, ErrClosedPipe
+	default:
+	}
+	var (
+		x     uint64
+		shift uint
+		read  int
+	)
+	for {
+		// Wait until some (more) data becomes available
+		safeFree, err := p.outputWait()
+		if err != nil {
+			if read > 0 && err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		limit := p.outPos + p.size - safeFree
+		if limit > p.size {
+			limit = p.size
+		}
+		// Decode the value until its last byte, or the end of the segment
+		var consumed int
+		for _, b := range p.buffer[p.outPos:limit] {
+			consumed++
+			read++
+
+			if read == binary.MaxVarintLen64 && b > 1 {
+				p.outputAdvance(consumed)
+				return 0, ErrVarintOverflow
+			}
+			if b < 0x80 {
+				p.outputAdvance(consumed)
+				return x | uint64(b)<<shift, nil
+			}
+			x |= uint64(b&0x7f) << shift
+			shift += 7
+		}
+		p.outputAdvance(consumed)
+	}
+}
+
+// ReadFixed waits until n bytes become available in the internal buffer and
+// passes them to decode as a single slice, consuming them afterwards. Values not
+// wrapping around the end of the ring are decoded in place, others are gathered
+// into the reader's scratch space first.
+func (p *pipe) readFixed(n int, decode func(b []byte)) error {
+	// Short circuit if the output was already closed
+	select {
+	case <-p.outQuit:
+		return ErrClosedPipe
+	default:
+	}
+	var staged int
+	for {
+		// Wait until the rest of the value becomes available, or as much as fits
+		need := int32(n - staged)
+		if need > p.size {
+			need = p.size
+		}
+		safeFree, err := p.outputWaitN(need)
+		if err != nil {
+			if staged > 0 && err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		limit := p.outPos + p.size - safeFree
+		if limit > p.size {
+			limit = p.size
+		}
+		// Decode in place if the whole value is contiguous, stage it otherwise
+		if staged == 0 && int(limit-p.outPos) >= n {
+			decode(p.buffer[p.outPos : p.outPos+int32(n)])
+			p.outputAdvance(n)
+			return nil
+		}
+		nr := copy(p.outScratch[staged:n], p.buffer[p.outPos:limit])
+		p.outputAdvance(nr)
+
+		if staged += nr; staged == n {
+			decode(p.outScratch[:n])
+			return nil
+		}
+	}
+}
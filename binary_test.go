@@ -0,0 +1,100 @@
+package bufioprop
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Tests that integers written via the binary helpers are read back intact, also
+// when wrapping around the ring, or when not even fitting into it whole.
+func TestBinaryRoundtrip(t *testing.T) {
+	for _, buffer := range []int{3, 7, 13, 1024} {
+		// Generate a random mix of values, including the extremes
+		rng := rand.New(rand.NewSource(int64(buffer)))
+
+		values := []uint64{0, 1, 127, 128, math.MaxUint16, math.MaxUint32, math.MaxUint64}
+		for i := 0; i < 1000; i++ {
+			values = append(values, rng.Uint64()>>rng.Intn(64))
+		}
+		r, w := Pipe(buffer)
+		go func() {
+			for i, v := range values {
+				switch order := []binary.ByteOrder{binary.BigEndian, binary.LittleEndian}[i%2]; i % 5 {
+				case 0:
+					w.WriteUvarint(v)
+				case 1:
+					w.WriteVarint(int64(v))
+				case 2:
+					w.WriteUint16(order, uint16(v))
+				case 3:
+					w.WriteUint32(order, uint32(v))
+				case 4:
+					w.WriteUint64(order, v)
+				}
+			}
+			w.Close()
+		}()
+		for i, want := range values {
+			var (
+				have uint64
+				err  error
+			)
+			switch order := []binary.ByteOrder{binary.BigEndian, binary.LittleEndian}[i%2]; i % 5 {
+			case 0:
+				have, err = r.ReadUvarint()
+			case 1:
+				var x int64
+				x, err = r.ReadVarint()
+				have = uint64(x)
+			case 2:
+				var x uint16
+				x, err = r.ReadUint16(order)
+				have, want = uint64(x), uint64(uint16(want))
+			case 3:
+				var x uint32
+				x, err = r.ReadUint32(order)
+				have, want = uint64(x), uint64(uint32(want))
+			case 4:
+				have, err = r.ReadUint64(order)
+			}
+			if err != nil {
+				t.Fatalf("buffer %d, value %d: failed to read: %v", buffer, i, err)
+			}
+			if have != want {
+				t.Fatalf("buffer %d, value %d: mismatch: have %d, want %d", buffer, i, have, want)
+			}
+		}
+		if _, err := r.ReadUvarint(); err != io.EOF {
+			t.Fatalf("buffer %d: end of stream mismatch: have %v, want %v", buffer, err, io.EOF)
+		}
+		r.Close()
+	}
+}
+
+// Tests that malformed or truncated integers are reported as such.
+func TestBinaryFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		read func(r *PipeReader) error
+		err  error
+	}{
+		{"uvarint truncated", []byte{0x80, 0x80}, func(r *PipeReader) error { _, err := r.ReadUvarint(); return err }, io.ErrUnexpectedEOF},
+		{"uvarint overflow", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02}, func(r *PipeReader) error { _, err := r.ReadUvarint(); return err }, ErrVarintOverflow},
+		{"uint32 truncated", []byte{1, 2, 3}, func(r *PipeReader) error { _, err := r.ReadUint32(binary.BigEndian); return err }, io.ErrUnexpectedEOF},
+		{"uint64 empty", nil, func(r *PipeReader) error { _, err := r.ReadUint64(binary.BigEndian); return err }, io.EOF},
+	}
+	for _, tt := range tests {
+		r, w := Pipe(1024)
+		w.Write(tt.data)
+		go w.Close()
+
+		if err := tt.read(r); err != tt.err {
+			t.Errorf("%s: error mismatch: have %v, want %v", tt.name, err, tt.err)
+		}
+		r.Close()
+	}
+}
@@ -0,0 +1,74 @@
+package bufioprop
+
+import (
+	"io"
+	"unsafe"
+)
+
+// maxBlockAlign is the maximum memory alignment guaranteed for block writes.
+const maxBlockAlign = 4096
+
+// blockBuffer rounds a requested buffer size up to a multiple of the block size,
+// large enough to hold at least two blocks.
+func blockBuffer(buffer int, block int) int {
+	if buffer < 2*block {
+		return 2 * block
+	}
+	return (buffer + block - 1) / block * block
+}
+
+// alignedBuffer allocates a byte slice of the given size, with its start aligned
+// to the block size (or the maximum supported alignment, whichever is smaller).
+func alignedBuffer(size int, block int) []byte {
+	align := maxBlockAlign
+	for align > 1 && block%align != 0 {
+		align >>= 1
+	}
+	memory := make([]byte, size+align)
+
+	offset := 0
+	if rem := int(uintptr(unsafe.Pointer(&memory[0])) & uintptr(align-1)); rem != 0 {
+		offset = align - rem
+	}
+	return memory[offset : offset+size : offset+size]
+}
+
+// WriteBlocks keeps pushing fixed size blocks into the writer until the source
+// is closed or fails. Since the buffer is a multiple of the block size and only
+// whole blocks are consumed, blocks are always contiguous in memory.
+func (p *pipe) writeBlocks(w io.Writer) (written int64, err error) {
+	for {
+		// Wait until a full block (or the final partial one) becomes available
+		safeFree, err := p.outputWaitN(p.block)
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return written, err
+		}
+		limit := p.outPos + p.block
+		if limit > p.size {
+			limit = p.size
+		}
+		consumed := limit - p.outPos
+		if avail := p.size - safeFree; avail < consumed {
+			// Final partial block, pad it with zeroes if requested
+			consumed = avail
+			if !p.blockPad {
+				limit = p.outPos + avail
+			} else {
+				tail := p.buffer[p.outPos+avail : limit]
+				for i := range tail {
+					tail[i] = 0
+				}
+			}
+		}
+		nw, err := p.writeOut(w, p.buffer[p.outPos:limit])
+		written += int64(nw)
+		if err != nil {
+			return written, err
+		}
+		// Update the pipe output state, only discarding real data
+		p.outputAdvance(int(consumed))
+	}
+}
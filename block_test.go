@@ -0,0 +1,60 @@
+package bufioprop
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+)
+
+// blockRecorder is a writer that checks the size and alignment of all writes.
+type blockRecorder struct {
+	bytes.Buffer
+	sizes     []int
+	unaligned int
+}
+
+func (r *blockRecorder) Write(b []byte) (int, error) {
+	r.sizes = append(r.sizes, len(b))
+	if uintptr(unsafe.Pointer(&b[0]))%512 != 0 {
+		r.unaligned++
+	}
+	return r.Buffer.Write(b)
+}
+
+// Tests that block mode only ever writes aligned, fixed size blocks.
+func TestCopyBlockWrites(t *testing.T) {
+	tests := []struct {
+		pad  bool
+		size int
+		last int
+	}{
+		{false, 1024*1024 + 100, 100},
+		{true, 1024*1024 + 100, 512},
+		{false, 1024 * 1024, 512},
+		{true, 1024 * 1024, 512},
+	}
+	for i, tt := range tests {
+		dst := new(blockRecorder)
+		n, err := Copy(dst, bytes.NewReader(testData[:tt.size]), 3333, WithBlockWrites(512, tt.pad))
+		if err != nil {
+			t.Fatalf("test %d: failed to copy data: %v", i, err)
+		}
+		if int(n) != dst.Len() {
+			t.Errorf("test %d: written count mismatch: have %d, want %d", i, n, dst.Len())
+		}
+		if !bytes.Equal(dst.Bytes()[:tt.size], testData[:tt.size]) {
+			t.Errorf("test %d: data mismatch", i)
+		}
+		for j, size := range dst.sizes[:len(dst.sizes)-1] {
+			if size != 512 {
+				t.Fatalf("test %d: write %d size mismatch: have %d, want %d", i, j, size, 512)
+			}
+		}
+		if last := dst.sizes[len(dst.sizes)-1]; last != tt.last {
+			t.Errorf("test %d: final write size mismatch: have %d, want %d", i, last, tt.last)
+		}
+		if dst.unaligned != 0 {
+			t.Errorf("test %d: %d unaligned writes", i, dst.unaligned)
+		}
+	}
+}
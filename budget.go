@@ -0,0 +1,83 @@
+package bufioprop
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrBudgetExhausted is returned when creating a pipe whose buffer doesn't fit
+// into its memory budget.
+var ErrBudgetExhausted = errors.New("bufio: buffer budget exhausted")
+
+// A BufferBudget caps the aggregate buffer memory allocated by all the pipes (or
+// copies) sharing it. When the budget is exhausted, creating new pipes either
+// blocks until enough memory is released, or fails with ErrBudgetExhausted.
+type BufferBudget struct {
+	limit int64 // Maximum memory allowed to be allocated
+	used  int64 // Memory currently allocated by live pipes
+	block bool  // Whether to wait for memory instead of failing
+
+	freed chan struct{} // Channel closed (and replaced) whenever memory is released
+	lock  sync.Mutex    // Lock protecting the used memory counter and the channel
+}
+
+// NewBufferBudget creates a memory budget of limit bytes. If block is set, pipes
+// wait for memory to be released if the budget is exhausted, otherwise they fail.
+func NewBufferBudget(limit int64, block bool) *BufferBudget {
+	return &BufferBudget{
+		limit: limit,
+		block: block,
+		freed: make(chan struct{}),
+	}
+}
+
+// Used returns the amount of memory currently allocated from the budget.
+func (b *BufferBudget) Used() int64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.used
+}
+
+// acquire allocates size bytes from the budget, waiting or failing if there's
+// not enough available. Requests exceeding the entire budget always fail. If the
+// copy is canceled while waiting, the cancellation error is returned.
+func (b *BufferBudget) acquire(size int, cancel *canceler) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if int64(size) > b.limit {
+		return ErrBudgetExhausted
+	}
+	var done <-chan struct{}
+	if cancel != nil {
+		done = cancel.done
+	}
+	for b.used+int64(size) > b.limit {
+		if !b.block {
+			return ErrBudgetExhausted
+		}
+		freed := b.freed
+
+		b.lock.Unlock()
+		select {
+		case <-freed:
+			b.lock.Lock()
+		case <-done:
+			b.lock.Lock()
+			return cancel.err()
+		}
+	}
+	b.used += int64(size)
+	return nil
+}
+
+// release returns size bytes to the budget, waking up any waiting pipes.
+func (b *BufferBudget) release(size int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.used -= int64(size)
+	close(b.freed)
+	b.freed = make(chan struct{})
+}
@@ -0,0 +1,99 @@
+package bufioprop
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// Tests that a non-blocking budget rejects pipes exceeding it, and reclaims the
+// memory of terminated pipes.
+func TestBudgetReject(t *testing.T) {
+	budget := NewBufferBudget(1000, false)
+
+	r1, w1, err := NewPipe(600, WithBudget(budget))
+	if err != nil {
+		t.Fatalf("failed to create first pipe: %v", err)
+	}
+	if _, _, err := NewPipe(600, WithBudget(budget)); err != ErrBudgetExhausted {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrBudgetExhausted)
+	}
+	if used := budget.Used(); used != 600 {
+		t.Fatalf("used memory mismatch: have %d, want %d", used, 600)
+	}
+	w1.Close()
+	if used := budget.Used(); used != 600 {
+		t.Fatalf("memory released on half close: have %d, want %d", used, 600)
+	}
+	r1.Close()
+	if used := budget.Used(); used != 0 {
+		t.Fatalf("memory not released: have %d, want %d", used, 0)
+	}
+	// Ensure copies account against the budget too
+	if _, err := Copy(new(bytes.Buffer), bytes.NewReader(testData[:4096]), 1001, WithBudget(budget)); err != ErrBudgetExhausted {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrBudgetExhausted)
+	}
+	if _, err := Copy(new(bytes.Buffer), bytes.NewReader(testData[:4096]), 1000, WithBudget(budget)); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+	if used := budget.Used(); used != 0 {
+		t.Fatalf("memory not released: have %d, want %d", used, 0)
+	}
+}
+
+// Tests that a blocking budget waits for memory to be released.
+func TestBudgetBlock(t *testing.T) {
+	budget := NewBufferBudget(1000, true)
+
+	r1, w1 := Pipe(600, WithBudget(budget))
+
+	created := make(chan struct{})
+	go func() {
+		Pipe(600, WithBudget(budget))
+		close(created)
+	}()
+	select {
+	case <-created:
+		t.Fatalf("pipe created over budget")
+	case <-time.After(50 * time.Millisecond):
+	}
+	r1.Close()
+	w1.Close()
+
+	select {
+	case <-created:
+	case <-time.After(time.Second):
+		t.Fatalf("pipe not created after memory release")
+	}
+}
+
+// Tests that a copy waiting on an exhausted budget observes its cancellation.
+func TestBudgetBlockCancel(t *testing.T) {
+	budget := NewBufferBudget(1000, true)
+
+	r, w := Pipe(600, WithBudget(budget))
+	defer w.Close()
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := CopyContext(ctx, ioutil.Discard, bytes.NewReader(testData[:600]), 600, WithBudget(budget))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("canceled copy stuck waiting for the budget")
+	}
+	if used := budget.Used(); used != 600 {
+		t.Fatalf("budget usage mismatch: have %d, want %d", used, 600)
+	}
+}
@@ -1,7 +1,31 @@
 // Package bufioprop contains extension functions to the bufio package.
 package bufioprop
 
-import "io"
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"runtime/debug"
+	"runtime/pprof"
+	"strconv"
+	"sync/atomic"
+)
+
+// copyCounter is the source of the unique identifiers of the copy operations.
+var copyCounter atomic.Uint64
+
+// copyLabels assigns a new unique identifier to a copy operation, returning a
+// generator for the profiler labels of its goroutines, keyed by their side.
+func copyLabels(name string) func(side string) []string {
+	id := strconv.FormatUint(copyCounter.Add(1), 10)
+	return func(side string) []string {
+		labels := []string{"bufio.copy", id, "bufio.side", side}
+		if name != "" {
+			labels = append(labels, "bufio.name", name)
+		}
+		return labels
+	}
+}
 
 // Copy copies from src to dst until either EOF is reached on src or an error
 // occurs. It returns the number of bytes copied and the first error encountered
@@ -13,23 +37,145 @@ import "io"
 //
 // Internally, one goroutine is reading the src, moving the data into an internal
 // buffer, and another moving from the buffer to the writer. This permits both
-// endpoints to run simultaneously, without one blocking the other.
-func Copy(dst io.Writer, src io.Reader, buffer int) (written int64, err error) {
-	pr, pw := Pipe(buffer)
-
-	// Run one copy to push data into the buffered pipe
-	errc := make(chan error)
-	go func() {
-		_, err := io.Copy(pw, src)
-		pw.Close()
-		errc <- err
-	}()
+// endpoints to run simultaneously, without one blocking the other. If src panics
+// on the internal goroutine, the panic is recovered and returned as a *PanicError.
+//
+// A buffer of 0 uses DefaultBufferSize, see RecommendBuffer for sizing it to the
+// link being copied over. If the remaining length of src is known (it's an
+// *io.LimitedReader or a Sizer), the internal buffer is capped to it. Sizers with
+// at most 4KB remaining are copied synchronously, without spawning a goroutine,
+// unless opts request behavior depending on the internal pipe (e.g. a bandwidth
+// scheduler, a budget, profiler labels or a report).
+//
+// Optional behavior of the internal pipe can be configured through opts.
+func Copy(dst io.Writer, src io.Reader, buffer int, opts ...Option) (written int64, err error) {
+	c := newConfig(opts)
+	if size, ok := tinySource(src, c); ok {
+		return copyTiny(dst, src, size, buffer, c)
+	}
+	if c.double {
+		return copyDouble(dst, src, buffer, c)
+	}
+	if c.chunk > 0 {
+		return copyChunked(dst, src, buffer, c)
+	}
+	if c.resident && c.retry == nil {
+		return copyResident(dst, src, buffer, c)
+	}
+	return copyPipe(dst, src, buffer, c, func(pr *PipeReader) (int64, error) {
+		return io.Copy(dst, pr)
+	})
+}
+
+// copyPipe runs the producer side of a buffered copy, feeding src into a newly
+// created pipe on a separate goroutine, and streams the pipe's output through the
+// consumer callback on the calling goroutine.
+func copyPipe(dst io.Writer, src io.Reader, buffer int, c *config, consume func(pr *PipeReader) (int64, error)) (written int64, err error) {
+	defer closeOwned(dst, src, c, &err)
+
+	// Pin the consumer before creating the ring, so its memory is local to it
+	if c.pinConsumer >= 0 {
+		defer pinThread(c.pinConsumer)()
+	}
+	pr, pw, err := newPipe(copyBuffer(src, buffer), c)
+	if err != nil {
+		return 0, err
+	}
+	if c.pinConsumer >= 0 {
+		touchPages(pr.p.buffer)
+	}
+	if c.meter != nil {
+		if remaining, ok := sourceLen(src); ok {
+			c.meter.Expect(remaining)
+		}
+	}
+	labels := copyLabels(c.name)
+
+	// If the copy is cancelable, tear everything down on cancellation
+	if c.cancel != nil {
+		done := make(chan struct{})
+		defer close(done)
+
+		go func() {
+			select {
+			case <-c.cancel.done:
+				pr.CloseWithError(c.cancel.err())
+				c.cancel.interrupt(src, dst)
+			case <-done:
+			}
+		}()
+	}
+
+	// Run one copy to push data into the buffered pipe, converting any panic of the
+	// source into an error tearing the pipe down
+	var (
+		reporter copyReporter
+		read     int64
+	)
+	errc := make(chan error, 1)
+	producer := func() {
+		if c.pinProducer >= 0 {
+			defer pinThread(c.pinProducer)()
+		}
+		pprof.Do(context.Background(), pprof.Labels(labels("producer")...), func(context.Context) {
+			defer func() {
+				if r := recover(); r != nil {
+					err := &PanicError{Value: r, Stack: debug.Stack()}
+					reporter.done(SideRead)
+					pw.CloseWithError(err)
+					errc <- err
+				}
+			}()
+			var err error
+			if c.retry != nil {
+				read, err = pw.p.readFromRetry(src, c.retry)
+			} else if c.squash != nil {
+				_, err = pw.ReadFrom(c.squash)
+				read = c.squash.read
+			} else {
+				read, err = pw.ReadFrom(src)
+			}
+			reporter.done(SideRead)
+			pw.Close()
+			errc <- err
+		})
+	}
+	if c.group != nil {
+		c.group.Go(func() error { producer(); return nil })
+	} else {
+		go producer()
+	}
 	// Run another copy to stream data out into the sink
-	written, errOut := io.Copy(dst, pr)
+	var errOut error
+	pprof.Do(context.Background(), pprof.Labels(labels("consumer")...), func(context.Context) {
+		defer pr.Close() // unblock the producer if the consumer bailed out early (or panicked)
 
+		written, errOut = consume(pr)
+		reporter.done(SideWrite)
+		if errOut != nil && c.drain {
+			// Destination failed, but the source should be read to completion
+			pr.p.writeChunks(ioutil.Discard)
+		}
+	})
 	errIn := <-errc
-	if errOut != nil {
-		return written, errOut
+	if errOut == nil && errIn == nil && (c.flushDone || c.closeDone) {
+		errOut = finalizeOut(dst, c)
+	}
+	if c.report != nil {
+		*c.report = CopyReport{
+			Read:     read,
+			Written:  written,
+			ReadErr:  errIn,
+			WriteErr: errOut,
+			First:    Side(reporter.first.Load()),
+		}
+	}
+	side, err := SideWrite, errOut
+	if err == nil {
+		side, err = SideRead, errIn
+	}
+	if c.cancel != nil && closed(c.cancel.done) && err != nil {
+		err = c.cancel.err()
 	}
-	return written, errIn
+	return written, c.filterErr(side, err)
 }
@@ -2,9 +2,14 @@ package bufioprop
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"io/ioutil"
 	"math/rand"
+	"runtime/pprof"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Big random test data.
@@ -34,12 +39,48 @@ func TestCopyBuffer333333B(t *testing.T) {
 	testCopy(333333, t)
 }
 
+// Tests that the condition variable wake strategy works too.
+func TestCopyLevelWake3333B(t *testing.T) {
+	testCopy(3333, t, WithWakeStrategy(WakeLevel))
+}
+
+func TestCopyLevelWake333333B(t *testing.T) {
+	testCopy(333333, t, WithWakeStrategy(WakeLevel))
+}
+
+// Tests that batching the wake signals works with both strategies.
+func TestCopyWakeBatch3333B(t *testing.T) {
+	testCopy(3333, t, WithWakeBatch(1000))
+}
+
+func TestCopyLevelWakeBatch3333B(t *testing.T) {
+	testCopy(3333, t, WithWakeStrategy(WakeLevel), WithWakeBatch(1000))
+}
+
+// Tests that the double buffered engine works too.
+func TestCopyDoubleBuffer3333B(t *testing.T) {
+	testCopy(3333, t, WithDoubleBuffer())
+}
+
+func TestCopyDoubleBuffer333333B(t *testing.T) {
+	testCopy(333333, t, WithDoubleBuffer())
+}
+
+// Tests that the pooled chunk engine works too.
+func TestCopyChunkPool3333B(t *testing.T) {
+	testCopy(3333, t, WithChunkPool(1000))
+}
+
+func TestCopyChunkPool333333B(t *testing.T) {
+	testCopy(333333, t, WithChunkPool(32*1024))
+}
+
 // Tests that a simple copy works
-func testCopy(buffer int, t *testing.T) {
+func testCopy(buffer int, t *testing.T, opts ...Option) {
 	rb := bytes.NewBuffer(testData)
 	wb := new(bytes.Buffer)
 
-	if n, err := Copy(wb, rb, buffer); err != nil { // weird buffer size to catch index bugs
+	if n, err := Copy(wb, rb, buffer, opts...); err != nil { // weird buffer size to catch index bugs
 		t.Fatalf("failed to copy data: %v.", err)
 	} else if int(n) != len(testData) {
 		t.Fatalf("data length mismatch: have %d, want %d.", n, len(testData))
@@ -91,15 +132,439 @@ func BenchmarkCopy128MbData1MbBuf(b *testing.B) {
 	benchmarkCopy(128*1024*1024, 1024*1024, b)
 }
 
+// Benchmarks of the condition variable wake strategy.
+func BenchmarkCopyLevelWake1KbData1KbBuf(b *testing.B) {
+	benchmarkCopy(1024, 1024, b, WithWakeStrategy(WakeLevel))
+}
+
+func BenchmarkCopyLevelWake1MbData1KbBuf(b *testing.B) {
+	benchmarkCopy(1024*1024, 1024, b, WithWakeStrategy(WakeLevel))
+}
+
+func BenchmarkCopyLevelWake128MbData1MbBuf(b *testing.B) {
+	benchmarkCopy(128*1024*1024, 1024*1024, b, WithWakeStrategy(WakeLevel))
+}
+
 // BenchmarkCopy measures the performance of the buffered copying for a given
 // buffer size.
-func benchmarkCopy(data int, buffer int, b *testing.B) {
+func benchmarkCopy(data int, buffer int, b *testing.B, opts ...Option) {
 	blob := random(data)
 
 	b.SetBytes(int64(data))
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		Copy(ioutil.Discard, bytes.NewBuffer(blob), buffer)
+		Copy(ioutil.Discard, bytes.NewBuffer(blob), buffer, opts...)
 	}
 }
+
+// Benchmarks of the pipe's own methods, independent of Copy.
+func BenchmarkPipeReadWrite1BChunk64KbBuf(b *testing.B) {
+	benchmarkPipeReadWrite(1, 64*1024, b)
+}
+
+func BenchmarkPipeReadWrite16BChunk64KbBuf(b *testing.B) {
+	benchmarkPipeReadWrite(16, 64*1024, b)
+}
+
+func BenchmarkPipeReadWrite1KbChunk64KbBuf(b *testing.B) {
+	benchmarkPipeReadWrite(1024, 64*1024, b)
+}
+
+func BenchmarkPipeReadWrite32KbChunk64KbBuf(b *testing.B) {
+	benchmarkPipeReadWrite(32*1024, 64*1024, b)
+}
+
+func BenchmarkPipeReadWrite32KbChunk1MbBuf(b *testing.B) {
+	benchmarkPipeReadWrite(32*1024, 1024*1024, b)
+}
+
+func BenchmarkPipeReadWrite16BChunk64KbBufWakeBatch(b *testing.B) {
+	benchmarkPipeReadWrite(16, 64*1024, b, WithWakeBatch(4096))
+}
+
+func BenchmarkPipeReadFrom1KbChunk64KbBuf(b *testing.B) {
+	benchmarkPipeReadFrom(1024, 64*1024, b)
+}
+
+func BenchmarkPipeReadFrom32KbChunk1MbBuf(b *testing.B) {
+	benchmarkPipeReadFrom(32*1024, 1024*1024, b)
+}
+
+func BenchmarkPipeWriteTo1KbChunk64KbBuf(b *testing.B) {
+	benchmarkPipeWriteTo(1024, 64*1024, b)
+}
+
+func BenchmarkPipeWriteTo32KbChunk1MbBuf(b *testing.B) {
+	benchmarkPipeWriteTo(32*1024, 1024*1024, b)
+}
+
+func BenchmarkPipeParallel16BChunk64KbBuf(b *testing.B) {
+	benchmarkPipeParallel(16, 64*1024, b)
+}
+
+func BenchmarkPipeParallel1KbChunk64KbBuf(b *testing.B) {
+	benchmarkPipeParallel(1024, 64*1024, b)
+}
+
+func BenchmarkPipeParallel32KbChunk1MbBuf(b *testing.B) {
+	benchmarkPipeParallel(32*1024, 1024*1024, b)
+}
+
+// pipeWriteChunks writes b.N chunks into the pipe and closes it, failing the
+// benchmark on error.
+func pipeWriteChunks(w *PipeWriter, chunk []byte, n int, b *testing.B) {
+	for i := 0; i < n; i++ {
+		if _, err := w.Write(chunk); err != nil {
+			b.Errorf("failed to write: %v", err)
+			break
+		}
+	}
+	w.Close()
+}
+
+// BenchmarkPipeReadWrite measures the performance of moving fixed size chunks
+// through a pipe via plain Write and Read calls.
+func benchmarkPipeReadWrite(chunk int, buffer int, b *testing.B, opts ...Option) {
+	r, w := Pipe(buffer, opts...)
+	data, sink := make([]byte, chunk), make([]byte, chunk)
+
+	b.SetBytes(int64(chunk))
+	b.ResetTimer()
+
+	go pipeWriteChunks(w, data, b.N, b)
+	for {
+		if _, err := r.Read(sink); err != nil {
+			if err != io.EOF {
+				b.Fatalf("failed to read: %v", err)
+			}
+			break
+		}
+	}
+}
+
+// chunkReader is a source yielding at most a fixed number of bytes per read,
+// until a total limit is reached.
+type chunkReader struct {
+	chunk int
+	left  int64
+}
+
+func (r *chunkReader) Read(b []byte) (int, error) {
+	if r.left == 0 {
+		return 0, io.EOF
+	}
+	n := r.chunk
+	if n > len(b) {
+		n = len(b)
+	}
+	if int64(n) > r.left {
+		n = int(r.left)
+	}
+	r.left -= int64(n)
+	return n, nil
+}
+
+// BenchmarkPipeReadFrom measures the performance of filling a pipe via ReadFrom
+// from a source yielding fixed size chunks, drained via plain Read calls.
+func benchmarkPipeReadFrom(chunk int, buffer int, b *testing.B) {
+	r, w := Pipe(buffer)
+	sink := make([]byte, chunk)
+
+	b.SetBytes(int64(chunk))
+	b.ResetTimer()
+
+	go func() {
+		if _, err := w.ReadFrom(&chunkReader{chunk: chunk, left: int64(chunk) * int64(b.N)}); err != nil {
+			b.Errorf("failed to fill pipe: %v", err)
+		}
+		w.Close()
+	}()
+	for {
+		if _, err := r.Read(sink); err != nil {
+			if err != io.EOF {
+				b.Fatalf("failed to read: %v", err)
+			}
+			break
+		}
+	}
+}
+
+// BenchmarkPipeWriteTo measures the performance of draining a pipe via WriteTo,
+// filled with fixed size chunks via plain Write calls.
+func benchmarkPipeWriteTo(chunk int, buffer int, b *testing.B) {
+	r, w := Pipe(buffer)
+
+	b.SetBytes(int64(chunk))
+	b.ResetTimer()
+
+	go pipeWriteChunks(w, make([]byte, chunk), b.N, b)
+	if _, err := r.WriteTo(ioutil.Discard); err != nil {
+		b.Fatalf("failed to drain pipe: %v", err)
+	}
+}
+
+// BenchmarkPipeParallel measures the performance of many independent pipes used
+// concurrently, each with its own reader and writer, exposing contention in the
+// wakeup paths and the runtime scheduler.
+func benchmarkPipeParallel(chunk int, buffer int, b *testing.B) {
+	b.SetBytes(int64(chunk))
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		r, w := Pipe(buffer)
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := r.WriteTo(ioutil.Discard)
+			done <- err
+		}()
+		data := make([]byte, chunk)
+		for pb.Next() {
+			if _, err := w.Write(data); err != nil {
+				b.Errorf("failed to write: %v", err)
+				break
+			}
+		}
+		w.Close()
+		if err := <-done; err != nil {
+			b.Errorf("failed to drain pipe: %v", err)
+		}
+	})
+}
+
+// failingWriter is a destination that fails after accepting a given amount.
+type failingWriter struct {
+	limit int
+	err   error
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if len(b) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, w.err
+	}
+	w.limit -= len(b)
+	return len(b), nil
+}
+
+// Tests that on destination failure the source is either aborted or drained
+// depending on the configuration.
+func TestCopyDrainOnError(t *testing.T) {
+	fail := errors.New("destination failed")
+
+	for _, drain := range []bool{false, true} {
+		src := bytes.NewReader(testData[:16*1024*1024])
+		dst := &failingWriter{limit: 1024 * 1024, err: fail}
+
+		n, err := Copy(dst, src, 4096, WithDrainOnError(drain))
+		if err != fail {
+			t.Errorf("drain %v: error mismatch: have %v, want %v", drain, err, fail)
+		}
+		if n != 1024*1024 {
+			t.Errorf("drain %v: written mismatch: have %d, want %d", drain, n, 1024*1024)
+		}
+		if remaining := src.Len(); drain && remaining != 0 {
+			t.Errorf("drain %v: source not drained: %d bytes left", drain, remaining)
+		} else if !drain && remaining == 0 {
+			t.Errorf("drain %v: source drained", drain)
+		}
+	}
+}
+
+// labelRecorder is a writer snapshotting the goroutine profile on its first write,
+// capturing the profiler labels of the running copies.
+type labelRecorder struct {
+	profile bytes.Buffer
+}
+
+func (r *labelRecorder) Write(b []byte) (int, error) {
+	if r.profile.Len() == 0 {
+		pprof.Lookup("goroutine").WriteTo(&r.profile, 1)
+	}
+	return len(b), nil
+}
+
+// Tests that the goroutines of a copy are labelled for the profiler.
+func TestCopyLabels(t *testing.T) {
+	dst := new(labelRecorder)
+	if _, err := Copy(dst, bytes.NewReader(testData[:1024]), 128, WithName("test")); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+	profile := dst.profile.String()
+	for _, label := range []string{`"bufio.side":"consumer"`, `"bufio.name":"test"`, `"bufio.copy":`} {
+		if !strings.Contains(profile, label) {
+			t.Fatalf("label %s missing from profile:\n%s", label, profile)
+		}
+	}
+}
+
+// Tests that the copy report attributes the termination to the correct side and
+// accounts the bytes processed by each.
+func TestCopyReport(t *testing.T) {
+	// Successful copy, the read side finishes first and nothing is left in flight
+	var report CopyReport
+	if _, err := Copy(ioutil.Discard, bytes.NewReader(testData[:1024*1024]), 4096, WithReport(&report)); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+	if report.First != SideRead || report.Read != 1024*1024 || report.Written != 1024*1024 || report.InFlight() != 0 {
+		t.Fatalf("report mismatch: have %+v", report)
+	}
+	// Failing destination, the write side finishes first with data still in flight
+	report = CopyReport{}
+	_, err := Copy(&failingWriter{limit: 1000, err: errors.New("sink failure")}, bytes.NewReader(testData[:1024*1024]), 4096, WithReport(&report))
+	if err == nil {
+		t.Fatalf("copy succeeded into failing writer")
+	}
+	if report.First != SideWrite || report.WriteErr != err || report.ReadErr != ErrClosedPipe {
+		t.Fatalf("report mismatch: have %+v", report)
+	}
+	if report.Written != 1000 || report.InFlight() <= 0 {
+		t.Fatalf("byte counts mismatch: have %+v", report)
+	}
+}
+
+// Tests that the error filter sees the failures of the copy's sides, across all
+// the copy engines, and that its result is returned instead.
+func TestCopyErrorFilter(t *testing.T) {
+	var (
+		errSink   = errors.New("sink failure")
+		errSource = errors.New("source failure")
+		errMapped = errors.New("mapped failure")
+	)
+	engines := map[string][]Option{
+		"ring":    nil,
+		"double":  {WithDoubleBuffer()},
+		"chunked": {WithChunkPool(1024)},
+	}
+	for name, opts := range engines {
+		tests := []struct {
+			dst  io.Writer
+			src  io.Reader
+			side Side
+			err  error
+		}{
+			{ioutil.Discard, bytes.NewReader(testData[:1024*1024]), 0, nil},
+			{&failingWriter{limit: 1000, err: errSink}, bytes.NewReader(testData[:1024*1024]), SideWrite, errSink},
+			{ioutil.Discard, &errDataReader{data: testData[:1024*1024], chunk: 4096, err: errSource}, SideRead, errSource},
+			{&failingWriter{limit: 10, err: errSink}, bytes.NewReader(testData[:100]), SideWrite, errSink}, // tiny
+		}
+		for i, tt := range tests {
+			var (
+				side Side
+				seen error
+			)
+			filter := WithErrorFilter(func(s Side, err error) error {
+				side, seen = s, err
+				return errMapped
+			})
+			_, err := Copy(tt.dst, tt.src, 4096, append(opts, filter)...)
+			if tt.err == nil {
+				if err != nil || seen != nil {
+					t.Fatalf("%s, test %d: successful copy filtered: have %v (seen %v)", name, i, err, seen)
+				}
+				continue
+			}
+			if side != tt.side || seen != tt.err || err != errMapped {
+				t.Fatalf("%s, test %d: filter mismatch: have (%v, %v -> %v), want (%v, %v -> %v)", name, i, side, seen, err, tt.side, tt.err, errMapped)
+			}
+		}
+	}
+}
+
+// Tests that copies from sources of known length don't allocate buffers larger
+// than the remaining data.
+func TestCopySizedSource(t *testing.T) {
+	budget := NewBufferBudget(100, false)
+
+	sources := []io.Reader{
+		bytes.NewReader(testData[:100]),
+		strings.NewReader(string(testData[:50])),
+		bytes.NewBuffer(testData[:10]),
+		&io.LimitedReader{R: bytes.NewReader(testData), N: 100},
+		bytes.NewReader(nil),
+	}
+	for i, src := range sources {
+		if _, err := Copy(ioutil.Discard, src, 16*1024*1024, WithBudget(budget)); err != nil {
+			t.Fatalf("source %d: failed to copy data: %v", i, err)
+		}
+	}
+	if _, err := Copy(ioutil.Discard, bytes.NewReader(testData[:101]), 16*1024*1024, WithBudget(budget)); err != ErrBudgetExhausted {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrBudgetExhausted)
+	}
+}
+
+// Tests that pipes and copies requested with a 0 buffer use the default size, and
+// that sized sources still cap it.
+func TestDefaultBuffer(t *testing.T) {
+	budget := NewBufferBudget(1<<30, false)
+
+	r, w := Pipe(0, WithBudget(budget))
+	if used := budget.Used(); used != DefaultBufferSize {
+		t.Fatalf("pipe buffer mismatch: have %d, want %d", used, DefaultBufferSize)
+	}
+	r.Close()
+	w.Close()
+
+	out := new(bytes.Buffer)
+	if _, err := Copy(out, bytes.NewReader(testData[:1000000]), 0); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), testData[:1000000]) {
+		t.Fatalf("data mismatch")
+	}
+	small := NewBufferBudget(100, false)
+	if _, err := Copy(ioutil.Discard, bytes.NewReader(testData[:100]), 0, WithBudget(small)); err != nil {
+		t.Fatalf("failed to copy sized source: %v", err)
+	}
+}
+
+// Tests the buffer sizes recommended for various links.
+func TestRecommendBuffer(t *testing.T) {
+	tests := []struct {
+		bandwidth int64
+		latency   time.Duration
+		want      int
+	}{
+		{0, time.Millisecond, DefaultBufferSize},                // unknown bandwidth
+		{1 << 20, 0, DefaultBufferSize},                         // unknown latency
+		{1 << 20, time.Microsecond, 4 * 1024},                   // tiny product, clamped up
+		{125 * 1000 * 1000, 10 * time.Millisecond, 2502656},     // 1Gbps, 10ms: 2.5MB rounded to pages
+		{10 * 125 * 1000 * 1000, time.Second, 64 * 1024 * 1024}, // huge product, clamped down
+	}
+	for i, tt := range tests {
+		if have := RecommendBuffer(tt.bandwidth, tt.latency); have != tt.want {
+			t.Errorf("test %d: buffer mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that panics of the source on the internal goroutine are returned as errors
+// carrying the stack, after all the data read before is delivered.
+func TestCopySourcePanic(t *testing.T) {
+	dst := new(bytes.Buffer)
+	n, err := Copy(dst, &panickingReader{left: 5000}, 1024)
+
+	perr, ok := err.(*PanicError)
+	if !ok {
+		t.Fatalf("error type mismatch: have %T, want %T", err, perr)
+	}
+	if perr.Value != "source exploded" || !strings.Contains(string(perr.Stack), "panickingReader") {
+		t.Fatalf("panic details mismatch: have %v\n%s", perr.Value, perr.Stack)
+	}
+	if n != 5000 || dst.Len() != 5000 {
+		t.Fatalf("delivered data mismatch: have (%d, %d), want 5000", n, dst.Len())
+	}
+	// Panics with errors should be unwrappable
+	errBoom := errors.New("boom")
+	_, err = Copy(io.Discard, readerFunc(func([]byte) (int, error) { panic(errBoom) }), 1024)
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("unwrapped error mismatch: have %v, want %v", err, errBoom)
+	}
+}
+
+// readerFunc adapts a function into an io.Reader.
+type readerFunc func(b []byte) (int, error)
+
+func (f readerFunc) Read(b []byte) (int, error) { return f(b) }
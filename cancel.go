@@ -0,0 +1,67 @@
+package bufioprop
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// readDeadliner is a source whose blocking reads can be interrupted by expiring
+// its deadline, such as a net.Conn or a pollable *os.File.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// writeDeadliner is a sink whose blocking writes can be interrupted by expiring
+// its deadline, such as a net.Conn or a pollable *os.File.
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// canceler describes how a copy is canceled and how its endpoints are unblocked.
+type canceler struct {
+	done  <-chan struct{} // Channel closed when the copy is canceled
+	err   func() error    // Error to report for the canceled copy
+	close bool            // Whether to close the endpoints implementing io.Closer
+}
+
+// interrupt unblocks any operations pending on the endpoints of a canceled copy,
+// expiring their deadlines if supported, or closing them if requested.
+func (c *canceler) interrupt(src io.Reader, dst io.Writer) {
+	expired := time.Unix(1, 0)
+
+	if rd, ok := src.(readDeadliner); !ok || rd.SetReadDeadline(expired) != nil {
+		if closer, ok := src.(io.Closer); ok && c.close {
+			closer.Close()
+		}
+	}
+	if wd, ok := dst.(writeDeadliner); !ok || wd.SetWriteDeadline(expired) != nil {
+		if closer, ok := dst.(io.Closer); ok && c.close {
+			closer.Close()
+		}
+	}
+}
+
+// CopyContext copies from src to dst similarly to Copy, but aborts the copy when
+// the context is canceled, returning the context's error.
+//
+// Cancellation tears down the internal pipe, and to unblock any read or write
+// stuck in a system call, it expires the deadlines of the endpoints supporting
+// them (e.g. net.Conn). Such endpoints are left with expired deadlines, which
+// need to be reset before reusing them. Endpoints without deadline support may
+// keep the copy blocked until their pending operation returns.
+func CopyContext(ctx context.Context, dst io.Writer, src io.Reader, buffer int, opts ...Option) (written int64, err error) {
+	c := newConfig(opts)
+	if err := ctx.Err(); err != nil {
+		closeOwned(dst, src, c, &err)
+		return 0, err
+	}
+	c.cancel = &canceler{done: ctx.Done(), err: ctx.Err}
+	if tag, ok := ctx.Value(tagKey{}).(string); ok && c.tag == "" {
+		c.tag = tag
+	}
+
+	return copyPipe(dst, src, buffer, c, func(pr *PipeReader) (int64, error) {
+		return io.Copy(dst, pr)
+	})
+}
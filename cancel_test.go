@@ -0,0 +1,57 @@
+package bufioprop
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// Tests that canceling a context aborts a copy blocked on its source, expiring the
+// deadline of the endpoint to unblock the pending read.
+func TestCopyContextStuckSource(t *testing.T) {
+	src, feed := net.Pipe()
+	defer feed.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	runTimeout(t, func() {
+		if _, err := CopyContext(ctx, ioutil.Discard, src, 1024); err != context.DeadlineExceeded {
+			t.Errorf("error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+// Tests that canceling a context aborts a copy blocked on its destination.
+func TestCopyContextStuckSink(t *testing.T) {
+	dst, drain := net.Pipe()
+	defer drain.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	runTimeout(t, func() {
+		if _, err := CopyContext(ctx, dst, bytes.NewReader(testData[:1024*1024]), 1024); err != context.Canceled {
+			t.Errorf("error mismatch: have %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+// Tests that uncanceled context copies behave like regular ones.
+func TestCopyContext(t *testing.T) {
+	dst := new(bytes.Buffer)
+	if _, err := CopyContext(context.Background(), dst, bytes.NewReader(testData[:1024*1024]), 4096); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+	if !bytes.Equal(dst.Bytes(), testData[:1024*1024]) {
+		t.Fatalf("data mismatch")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := CopyContext(ctx, dst, bytes.NewReader(testData), 4096); err != context.Canceled {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build bufioprop_checked
+
+package bufioprop
+
+import "fmt"
+
+// The checked build (enabled via the bufioprop_checked tag) validates the ring's
+// invariants on every index advance, panicking with the pipe's state on the first
+// violation. It's meant to catch index arithmetic bugs close to their source while
+// developing new features, at the cost of some throughput.
+
+// checkInputAdvance validates that the writer may advance its index by count.
+// Since the reader can only free up space concurrently, the free space computed
+// by the writer is a lower bound, so it must cover the advance.
+func (p *pipe) checkInputAdvance(count int) {
+	free := p.freeSpace()
+	if count < 0 || int32(count) > free || free > p.size || p.inPos < 0 || p.inPos >= p.size {
+		panic(fmt.Sprintf("bufio: ring invariant violated: input advance %d, free %d, size %d, inPos %d", count, free, p.size, p.inPos))
+	}
+}
+
+// checkOutputAdvance validates that the reader may advance its index by count.
+// Since the writer can only fill up space concurrently, the data derived from the
+// free space computed by the reader is a lower bound, so it must cover the advance.
+func (p *pipe) checkOutputAdvance(count int) {
+	free := p.freeSpace()
+	if count < 0 || int32(count) > p.size-free || free < 0 || p.outPos < 0 || p.outPos >= p.size {
+		panic(fmt.Sprintf("bufio: ring invariant violated: output advance %d, free %d, size %d, outPos %d", count, free, p.size, p.outPos))
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !bufioprop_checked
+
+package bufioprop
+
+// checkInputAdvance validates the writer's index advance in checked builds only.
+func (p *pipe) checkInputAdvance(count int) {}
+
+// checkOutputAdvance validates the reader's index advance in checked builds only.
+func (p *pipe) checkOutputAdvance(count int) {}
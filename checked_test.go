@@ -0,0 +1,177 @@
+//go:build bufioprop_checked
+
+package bufioprop
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Tests that the checked build catches advances breaking the ring invariants.
+func TestCheckedAdvance(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(p *pipe)
+	}{
+		{"input overflow", func(p *pipe) { p.inputAdvance(17) }},
+		{"input negative", func(p *pipe) { p.inputAdvance(-1) }},
+		{"output underflow", func(p *pipe) { p.inputAdvance(4); p.outputAdvance(5) }},
+		{"output corrupt", func(p *pipe) { p.inputAdvance(4); p.outPos = 16; p.outputAdvance(1) }},
+	}
+	for _, tt := range tests {
+		r, _ := Pipe(16)
+		func() {
+			defer func() {
+				if msg, ok := recover().(string); !ok || !strings.Contains(msg, "ring invariant violated") {
+					t.Errorf("%s: panic mismatch: have %v", tt.name, msg)
+				}
+			}()
+			tt.fn(r.p)
+		}()
+	}
+}
+
+// Tests that random sequences of writes, reservations, reads, views and closes
+// keep the ring's head, tail and positions consistent with a model of the buffered
+// data, on top of the advance checks of the checked build.
+func TestCheckedRandomOps(t *testing.T) {
+	for seed := int64(0); seed < 256; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		r, w := Pipe(1 + rng.Intn(64))
+		size := int(r.p.size)
+
+		var (
+			model   []byte // Data written into the pipe, not yet consumed
+			viewed  int    // Bytes at the start of model handed out by Next
+			wclosed bool   // Whether the writer was closed
+			rclosed bool   // Whether the reader was closed
+		)
+		// check validates the ring's state against the model
+		check := func(step int, op string) {
+			head, tail := r.p.head.Load(), r.p.tail.Load()
+			if head-tail != uint64(len(model)) {
+				t.Fatalf("seed %d, step %d, %s: buffered mismatch: have %d, want %d", seed, step, op, head-tail, len(model))
+			}
+			if int(r.p.inPos) != int(head%uint64(size)) || int(r.p.outPos) != int(tail%uint64(size)) {
+				t.Fatalf("seed %d, step %d, %s: position mismatch: have (%d, %d), want (%d, %d)", seed, step, op, r.p.inPos, r.p.outPos, head%uint64(size), tail%uint64(size))
+			}
+			if r.p.viewed != viewed {
+				t.Fatalf("seed %d, step %d, %s: view mismatch: have %d, want %d", seed, step, op, r.p.viewed, viewed)
+			}
+		}
+		// consume drops the view from the model, as released by any read method
+		consume := func() {
+			model, viewed = model[viewed:], 0
+		}
+		for step := 0; step < 1000 && !rclosed; step++ {
+			switch op := rng.Intn(20); {
+			case op < 6:
+				data := make([]byte, rng.Intn(2*size))
+				rng.Read(data)
+
+				n, ok := w.TryWrite(data)
+				want := size - len(model)
+				if want > len(data) {
+					want = len(data)
+				}
+				if wclosed {
+					want = 0
+				}
+				if n != want || ok != (!wclosed && n == len(data)) {
+					t.Fatalf("seed %d, step %d: try-write mismatch: have (%d, %v), want (%d, %v)", seed, step, n, ok, want, !wclosed && want == len(data))
+				}
+				model = append(model, data[:n]...)
+				check(step, "try-write")
+
+			case op < 9:
+				if wclosed || len(model) == size {
+					continue // Reserve would fail or block
+				}
+				space, err := w.Reserve(1 + rng.Intn(size))
+				if err != nil || len(space) == 0 {
+					t.Fatalf("seed %d, step %d: reservation failed: (%d, %v)", seed, step, len(space), err)
+				}
+				rng.Read(space)
+				n := rng.Intn(len(space) + 1)
+				model = append(model, space[:n]...)
+				if err := w.Commit(n); err != nil {
+					t.Fatalf("seed %d, step %d: commit failed: %v", seed, step, err)
+				}
+				check(step, "reserve")
+
+			case op < 15:
+				consume()
+				buf := make([]byte, rng.Intn(2*size))
+
+				n, ok, err := r.TryRead(buf)
+				switch {
+				case len(model) == 0 && wclosed:
+					if !ok || err != io.EOF {
+						t.Fatalf("seed %d, step %d: drained try-read mismatch: have (%d, %v, %v), want (0, true, EOF)", seed, step, n, ok, err)
+					}
+					rclosed = true
+				case len(model) == 0:
+					if n != 0 || ok || err != nil {
+						t.Fatalf("seed %d, step %d: empty try-read mismatch: have (%d, %v, %v), want (0, false, nil)", seed, step, n, ok, err)
+					}
+				default:
+					want := len(model)
+					if want > len(buf) {
+						want = len(buf)
+					}
+					if n != want || !ok || err != nil || !bytes.Equal(buf[:n], model[:n]) {
+						t.Fatalf("seed %d, step %d: try-read mismatch: have (%d, %v, %v), want (%d, true, nil)", seed, step, n, ok, err, want)
+					}
+					model = model[n:]
+				}
+				check(step, "try-read")
+
+			case op < 18:
+				if len(model) == viewed {
+					continue // Next would block or terminate
+				}
+				consume()
+				view, err := r.Next(1 + rng.Intn(size))
+				if err != nil || len(view) == 0 || !bytes.Equal(view, model[:len(view)]) {
+					t.Fatalf("seed %d, step %d: view mismatch: have (%x, %v), want prefix of %x", seed, step, view, err, model)
+				}
+				viewed = len(view)
+				check(step, "next")
+
+			case op < 19:
+				// Closing the writer waits for the buffer to drain, which would
+				// deadlock a single goroutine while anything is buffered
+				if !wclosed && len(model) == 0 {
+					w.Close()
+					wclosed = true
+				}
+
+			default:
+				if rng.Intn(10) == 0 {
+					r.Close()
+					rclosed = true
+
+					if _, err := w.Write([]byte{0}); err != ErrClosedPipe {
+						t.Fatalf("seed %d, step %d: write after reader close mismatch: have %v, want %v", seed, step, err, ErrClosedPipe)
+					}
+				}
+			}
+		}
+		if rclosed {
+			continue
+		}
+		// Close the writer and ensure all the remaining data is delivered
+		go w.Close()
+		consume()
+
+		rest, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(rest, model) {
+			t.Fatalf("seed %d: trailing data mismatch: have (%x, %v), want (%x, nil)", seed, rest, err, model)
+		}
+		model = nil
+		check(-1, "drain")
+	}
+}
@@ -0,0 +1,133 @@
+package bufioprop
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// requestRecorder is a source tracking the largest read requested from it.
+type requestRecorder struct {
+	io.Reader
+	largest int
+}
+
+func (r *requestRecorder) Read(b []byte) (int, error) {
+	if len(b) > r.largest {
+		r.largest = len(b)
+	}
+	return r.Reader.Read(b)
+}
+
+// Tests that source reads can be capped to a maximum chunk size.
+func TestReadChunk(t *testing.T) {
+	for _, chunk := range []int{0, 1000, 16 * 1024} {
+		src := &requestRecorder{Reader: bytes.NewReader(testData[:1024*1024])}
+		out := new(bytes.Buffer)
+
+		if _, err := Copy(out, src, 64*1024, WithReadChunk(chunk)); err != nil {
+			t.Fatalf("chunk %d: failed to copy: %v", chunk, err)
+		}
+		if !bytes.Equal(out.Bytes(), testData[:1024*1024]) {
+			t.Fatalf("chunk %d: data mismatch", chunk)
+		}
+		want := chunk
+		if want == 0 {
+			want = 64 * 1024
+		}
+		if src.largest != want {
+			t.Fatalf("chunk %d: largest read mismatch: have %d, want %d", chunk, src.largest, want)
+		}
+	}
+}
+
+// Benchmarks of capping source reads at various chunk sizes, compared to offering
+// the source the whole free region of the buffer.
+func BenchmarkReadChunkFullBuffer(b *testing.B)  { benchmarkReadChunkBuffer(0, b) }
+func BenchmarkReadChunk16KbBuffer(b *testing.B)  { benchmarkReadChunkBuffer(16*1024, b) }
+func BenchmarkReadChunk64KbBuffer(b *testing.B)  { benchmarkReadChunkBuffer(64*1024, b) }
+func BenchmarkReadChunk256KbBuffer(b *testing.B) { benchmarkReadChunkBuffer(256*1024, b) }
+
+func BenchmarkReadChunkFullFile(b *testing.B)  { benchmarkReadChunkFile(0, b) }
+func BenchmarkReadChunk16KbFile(b *testing.B)  { benchmarkReadChunkFile(16*1024, b) }
+func BenchmarkReadChunk64KbFile(b *testing.B)  { benchmarkReadChunkFile(64*1024, b) }
+func BenchmarkReadChunk256KbFile(b *testing.B) { benchmarkReadChunkFile(256*1024, b) }
+
+func BenchmarkReadChunkFullSocket(b *testing.B)  { benchmarkReadChunkSocket(0, b) }
+func BenchmarkReadChunk16KbSocket(b *testing.B)  { benchmarkReadChunkSocket(16*1024, b) }
+func BenchmarkReadChunk64KbSocket(b *testing.B)  { benchmarkReadChunkSocket(64*1024, b) }
+func BenchmarkReadChunk256KbSocket(b *testing.B) { benchmarkReadChunkSocket(256*1024, b) }
+
+// Data size and buffer size of the chunk benchmarks.
+const (
+	chunkBenchData   = 16 * 1024 * 1024
+	chunkBenchBuffer = 1024 * 1024
+)
+
+// BenchmarkReadChunkBuffer measures copying out of an in-memory bytes.Buffer.
+func benchmarkReadChunkBuffer(chunk int, b *testing.B) {
+	b.SetBytes(chunkBenchData)
+	for i := 0; i < b.N; i++ {
+		if _, err := Copy(ioutil.Discard, bytes.NewBuffer(testData[:chunkBenchData]), chunkBenchBuffer, WithReadChunk(chunk)); err != nil {
+			b.Fatalf("failed to copy: %v", err)
+		}
+	}
+}
+
+// BenchmarkReadChunkFile measures copying out of a (most probably cached) file.
+func benchmarkReadChunkFile(chunk int, b *testing.B) {
+	path := filepath.Join(b.TempDir(), "data")
+	if err := ioutil.WriteFile(path, testData[:chunkBenchData], 0o600); err != nil {
+		b.Fatalf("failed to create source file: %v", err)
+	}
+	b.SetBytes(chunkBenchData)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(path)
+		if err != nil {
+			b.Fatalf("failed to open source file: %v", err)
+		}
+		if _, err := Copy(ioutil.Discard, f, chunkBenchBuffer, WithReadChunk(chunk)); err != nil {
+			b.Fatalf("failed to copy: %v", err)
+		}
+		f.Close()
+	}
+}
+
+// BenchmarkReadChunkSocket measures copying out of a loopback TCP connection.
+func benchmarkReadChunkSocket(chunk int, b *testing.B) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write(testData[:chunkBenchData])
+			conn.Close()
+		}
+	}()
+	b.SetBytes(chunkBenchData)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			b.Fatalf("failed to dial: %v", err)
+		}
+		if _, err := Copy(ioutil.Discard, conn, chunkBenchBuffer, WithReadChunk(chunk)); err != nil {
+			b.Fatalf("failed to copy: %v", err)
+		}
+		conn.Close()
+	}
+}
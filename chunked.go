@@ -0,0 +1,125 @@
+package bufioprop
+
+import (
+	"io"
+	"runtime/debug"
+	"sync"
+)
+
+// chunkPools are the process wide pools of chunks used by chunked copies, one for
+// every chunk size in use, shared by all the copies running concurrently.
+var chunkPools sync.Map // map[int]*sync.Pool
+
+// chunkPool retrieves the shared pool of chunks of the given size.
+func chunkPool(size int) *sync.Pool {
+	if pool, ok := chunkPools.Load(size); ok {
+		return pool.(*sync.Pool)
+	}
+	pool, _ := chunkPools.LoadOrStore(size, &sync.Pool{
+		New: func() interface{} {
+			buf := make([]byte, size)
+			return &buf
+		},
+	})
+	return pool.(*sync.Pool)
+}
+
+// chunk is a pooled buffer holding a single read of the source.
+type chunk struct {
+	buf *[]byte // Pooled buffer the data was read into
+	n   int     // Number of bytes read into the buffer
+}
+
+// copyChunked copies from src to dst by passing pooled, fixed size chunks through
+// a channel, instead of via a dedicated ring. At most buffer bytes worth of chunks
+// are queued up, and chunks are returned to the pool as soon as they're written,
+// so idle memory is shared between all chunked copies.
+func copyChunked(dst io.Writer, src io.Reader, buffer int, c *config) (written int64, err error) {
+	defer closeOwned(dst, src, c, &err)
+
+	buffer = copyBuffer(src, buffer)
+	if err := checkBuffer(buffer); err != nil {
+		return 0, err
+	}
+	size := c.chunk
+	if size > buffer {
+		size = buffer
+	}
+	inflight := buffer / size
+	if c.budget != nil {
+		if err := c.budget.acquire(inflight*size, c.cancel); err != nil {
+			return 0, err
+		}
+		defer c.budget.release(inflight * size)
+	}
+	var (
+		pool   = chunkPool(size)
+		chunks = make(chan chunk, inflight)
+		quit   = make(chan struct{})
+		errIn  error
+	)
+	go func() {
+		defer close(chunks)
+		errIn = produceChunks(src, &sourceReads{stats: c.stats, limit: c.emptyReads}, pool, chunks, quit)
+	}()
+	stopped := false
+	defer func() {
+		if !stopped {
+			close(quit) // unblock the producer if the consumer panicked
+		}
+	}()
+	// Write out the chunks as they arrive, discarding them after a failure
+	var errOut error
+	for ch := range chunks {
+		if errOut == nil {
+			var n int
+			n, errOut = writeFull(dst, (*ch.buf)[:ch.n])
+			written += int64(n)
+
+			if errOut != nil && !c.drain {
+				stopped = true
+				close(quit)
+			}
+		}
+		pool.Put(ch.buf)
+	}
+	stopped = true
+	if errOut != nil {
+		return written, c.filterErr(SideWrite, errOut)
+	}
+	if errIn != nil {
+		return written, c.filterErr(SideRead, errIn)
+	}
+	return written, c.filterErr(SideWrite, finalizeOut(dst, c))
+}
+
+// produceChunks keeps reading the source into pooled chunks, passing them to the
+// consumer, until the source is exhausted, fails or the consumer bails out.
+func produceChunks(src io.Reader, reads *sourceReads, pool *sync.Pool, chunks chan<- chunk, quit <-chan struct{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	for {
+		buf := pool.Get().(*[]byte)
+
+		n, err := src.Read(*buf)
+		if n > 0 {
+			select {
+			case chunks <- chunk{buf: buf, n: n}:
+			case <-quit:
+				pool.Put(buf)
+				return nil
+			}
+		} else {
+			pool.Put(buf)
+		}
+		if err = reads.track(n, err); err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
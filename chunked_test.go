@@ -0,0 +1,93 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// Tests that the pooled chunk engine reports failures like the ring does.
+func TestCopyChunkPoolFailures(t *testing.T) {
+	fail := errors.New("failure")
+
+	// Data returned alongside a source failure is delivered first
+	out := new(bytes.Buffer)
+	src := &errDataReader{data: testData[:100000], chunk: 3000, err: fail}
+	if n, err := Copy(out, src, 4096, WithChunkPool(1024)); n != 100000 || err != fail || !bytes.Equal(out.Bytes(), testData[:100000]) {
+		t.Fatalf("source failure mismatch: have (%d, %v), want (100000, %v)", n, err, fail)
+	}
+	// Destination failures abort or drain the source as requested
+	for _, drain := range []bool{false, true} {
+		src := bytes.NewReader(testData[:16*1024*1024])
+		dst := &failingWriter{limit: 1024 * 1024, err: fail}
+
+		n, err := Copy(dst, src, 4096, WithChunkPool(1024), WithDrainOnError(drain))
+		if n != 1024*1024 || err != fail {
+			t.Errorf("drain %v: result mismatch: have (%d, %v), want (%d, %v)", drain, n, err, 1024*1024, fail)
+		}
+		if remaining := src.Len(); drain != (remaining == 0) {
+			t.Errorf("drain %v: source remaining mismatch: %d bytes left", drain, remaining)
+		}
+	}
+	// Panics of the source are converted into errors
+	var perr *PanicError
+	if _, err := Copy(io.Discard, &panickingReader{left: 100000}, 4096, WithChunkPool(1024)); !errors.As(err, &perr) {
+		t.Fatalf("panic error mismatch: have %v, want *PanicError", err)
+	}
+}
+
+// Tests that the pooled chunk engine applies the empty read limit and counts the
+// source read events like the ring does.
+func TestCopyChunkPoolSourceReads(t *testing.T) {
+	src := new(stuckReader)
+	if _, err := Copy(io.Discard, src, 4096, WithChunkPool(1024), WithEmptyReadLimit(10)); err != io.ErrNoProgress {
+		t.Fatalf("error mismatch: have %v, want %v", err, io.ErrNoProgress)
+	}
+	if src.reads != 10 {
+		t.Errorf("read count mismatch: have %d, want %d", src.reads, 10)
+	}
+	var stats Stats
+
+	patho := &pathologicalReader{chunks: [][]byte{[]byte("hello"), []byte("world")}}
+	if _, err := Copy(io.Discard, patho, 4096, WithChunkPool(1024), WithEmptyReadLimit(3), WithStats(&stats)); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+	if n := stats.ZeroReads.Load(); n != 2 {
+		t.Errorf("zero read count mismatch: have %d, want %d", n, 2)
+	}
+	if n := stats.EOFWithData.Load(); n != 1 {
+		t.Errorf("EOF with data count mismatch: have %d, want %d", n, 1)
+	}
+}
+
+// Benchmarks of many concurrent copies moving little data each, comparing the
+// memory footprint of the engines.
+func BenchmarkCopyConcurrentRing(b *testing.B) {
+	benchmarkCopyConcurrent(b)
+}
+
+func BenchmarkCopyConcurrentDoubleBuffer(b *testing.B) {
+	benchmarkCopyConcurrent(b, WithDoubleBuffer())
+}
+
+func BenchmarkCopyConcurrentChunkPool(b *testing.B) {
+	benchmarkCopyConcurrent(b, WithChunkPool(16*1024))
+}
+
+// BenchmarkCopyConcurrent measures running many 64KB copies in parallel, each with
+// a 1MB buffer, on a source yielding 8KB per read.
+func benchmarkCopyConcurrent(b *testing.B, opts ...Option) {
+	b.SetBytes(64 * 1024)
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := Copy(ioutil.Discard, &chunkReader{chunk: 8 * 1024, left: 64 * 1024}, 1024*1024, opts...); err != nil {
+				b.Errorf("failed to copy: %v", err)
+				return
+			}
+		}
+	})
+}
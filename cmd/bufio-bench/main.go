@@ -0,0 +1,220 @@
+// Command bufio-bench measures the throughput of copying between real endpoints
+// (files, HTTP downloads, /dev/zero and /dev/null), comparing io.Copy against the
+// buffered bufioprop.Copy across a sweep of buffer sizes.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/karalabe/bufioprop"
+)
+
+var (
+	srcFlag     = flag.String("src", "zero", "Source to copy from: file path, http(s) URL or 'zero'")
+	dstFlag     = flag.String("dst", "null", "Destination to copy into: file path or 'null'")
+	sizeFlag    = flag.String("size", "1G", "Amount of data to copy (required for 'zero', optional cap otherwise)")
+	implFlag    = flag.String("impl", "all", "Implementation to benchmark: io.Copy, bufioprop or all")
+	buffersFlag = flag.String("buffers", "32K,256K,1M,16M", "Comma separated buffer sizes to sweep")
+	runsFlag    = flag.Int("runs", 3, "Number of runs to average for each measurement")
+	syncFlag    = flag.Bool("sync", false, "Fsync file destinations before stopping the clock")
+)
+
+// copier is a copy implementation benchmarked by the tool.
+type copier struct {
+	name string
+	copy func(dst io.Writer, src io.Reader, buffer int) (int64, error)
+}
+
+var copiers = []copier{
+	{"io.Copy", func(dst io.Writer, src io.Reader, buffer int) (int64, error) {
+		return io.CopyBuffer(dst, src, make([]byte, buffer))
+	}},
+	{"bufioprop", func(dst io.Writer, src io.Reader, buffer int) (int64, error) {
+		return bufioprop.Copy(dst, src, buffer)
+	}},
+}
+
+func main() {
+	flag.Parse()
+
+	size, err := parseSize(*sizeFlag)
+	if err != nil {
+		log.Fatalf("Invalid data size %q: %v", *sizeFlag, err)
+	}
+	var buffers []int
+	for _, field := range strings.Split(*buffersFlag, ",") {
+		buffer, err := parseSize(field)
+		if err != nil || buffer < 1 {
+			log.Fatalf("Invalid buffer size %q: %v", field, err)
+		}
+		buffers = append(buffers, int(buffer))
+	}
+	var impls []copier
+	for _, c := range copiers {
+		if *implFlag == "all" || *implFlag == c.name {
+			impls = append(impls, c)
+		}
+	}
+	if len(impls) == 0 {
+		log.Fatalf("Unknown implementation %q", *implFlag)
+	}
+	fmt.Printf("Copying %s -> %s, %d run(s) per measurement\n\n", *srcFlag, *dstFlag, *runsFlag)
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "Implementation\tBuffer\tBytes\tTime\tThroughput\t")
+	for _, buffer := range buffers {
+		for _, impl := range impls {
+			var (
+				total   time.Duration
+				written int64
+			)
+			for i := 0; i < *runsFlag; i++ {
+				n, elapsed, err := measure(impl, buffer, size)
+				if err != nil {
+					log.Fatalf("%s with %s buffer failed: %v", impl.name, formatSize(int64(buffer)), err)
+				}
+				total, written = total+elapsed, n
+			}
+			elapsed := total / time.Duration(*runsFlag)
+			if elapsed <= 0 {
+				elapsed = time.Nanosecond // avoid division by zero on coarse clocks
+			}
+			fmt.Fprintf(table, "%s\t%s\t%d\t%v\t%s/s\t\n", impl.name, formatSize(int64(buffer)), written,
+				elapsed.Round(time.Millisecond), formatSize(int64(float64(written)/elapsed.Seconds())))
+		}
+	}
+	table.Flush()
+}
+
+// measure runs a single copy between freshly opened endpoints, returning the
+// number of bytes copied and the time it took.
+func measure(impl copier, buffer int, size int64) (int64, time.Duration, error) {
+	src, err := openSource(*srcFlag, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer src.Close()
+
+	dst, err := openSink(*dstFlag)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer dst.Close()
+
+	start := time.Now()
+	n, err := impl.copy(dst, src, buffer)
+	if err != nil {
+		return n, 0, err
+	}
+	if file, ok := dst.(*os.File); ok && *syncFlag {
+		if err := file.Sync(); err != nil {
+			return n, 0, err
+		}
+	}
+	return n, time.Since(start), nil
+}
+
+// limitedSource caps a source to a given size, retaining its closer.
+type limitedSource struct {
+	io.Reader
+	io.Closer
+}
+
+// openSource opens the benchmark's data source, capped to size bytes if positive.
+func openSource(name string, size int64) (io.ReadCloser, error) {
+	var src io.ReadCloser
+	switch {
+	case name == "zero":
+		if size <= 0 {
+			return nil, fmt.Errorf("'zero' source requires a size")
+		}
+		if file, err := os.Open("/dev/zero"); err == nil {
+			src = file
+		} else {
+			src = io.NopCloser(zeroReader{}) // platforms without /dev/zero
+		}
+
+	case strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://"):
+		res, err := http.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("unexpected HTTP status: %s", res.Status)
+		}
+		src = res.Body
+
+	default:
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		src = file
+	}
+	if size > 0 {
+		return &limitedSource{io.LimitReader(src, size), src}, nil
+	}
+	return src, nil
+}
+
+// openSink opens (or truncates) the benchmark's data destination.
+func openSink(name string) (io.WriteCloser, error) {
+	if name == "null" {
+		name = os.DevNull
+	}
+	return os.Create(name)
+}
+
+// zeroReader is an infinite source of zeroes, substituting /dev/zero.
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
+
+// parseSize parses a byte size with an optional K, M or G binary suffix.
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier, s = 1<<10, strings.TrimSuffix(s, "K")
+	case strings.HasSuffix(s, "M"):
+		multiplier, s = 1<<20, strings.TrimSuffix(s, "M")
+	case strings.HasSuffix(s, "G"):
+		multiplier, s = 1<<30, strings.TrimSuffix(s, "G")
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
+
+// formatSize formats a byte size with a binary suffix.
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2fG", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.2fM", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.2fK", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
@@ -0,0 +1,55 @@
+// Command bufio-relay is a TCP port forwarder, relaying every accepted connection
+// to a target address through buffered pipes.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"time"
+
+	"github.com/karalabe/bufioprop/relay"
+)
+
+var (
+	listenFlag = flag.String("listen", "127.0.0.1:8080", "Address to accept connections on")
+	targetFlag = flag.String("target", "", "Address to forward connections to")
+	bufferFlag = flag.Int("buffer", 1024*1024, "Pipe buffer size per direction")
+	idleFlag   = flag.Duration("idle", 5*time.Minute, "Idle timeout for relayed connections (0 = none)")
+)
+
+func main() {
+	flag.Parse()
+	if *targetFlag == "" {
+		log.Fatalf("No forwarding target specified (-target)")
+	}
+	listener, err := net.Listen("tcp", *listenFlag)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", *listenFlag, err)
+	}
+	log.Printf("Relaying %s -> %s", listener.Addr(), *targetFlag)
+
+	config := relay.Config{Buffer: *bufferFlag, IdleTimeout: *idleFlag}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Fatalf("Failed to accept connection: %v", err)
+		}
+		go forward(conn, config)
+	}
+}
+
+// forward dials the target and relays an accepted connection to it.
+func forward(conn net.Conn, config relay.Config) {
+	target, err := net.Dial("tcp", *targetFlag)
+	if err != nil {
+		log.Printf("Failed to dial %s: %v", *targetFlag, err)
+		conn.Close()
+		return
+	}
+	start, stats := time.Now(), new(relay.Stats)
+	err = relay.Splice(conn, target, config, stats)
+
+	log.Printf("Relay %s done in %v: up %d bytes, down %d bytes, err %v", conn.RemoteAddr(),
+		time.Since(start), stats.AtoB.Bytes.Load(), stats.BtoA.Bytes.Load(), err)
+}
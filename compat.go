@@ -0,0 +1,94 @@
+package bufioprop
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// BufferedPipe creates an asynchronous in-memory pipe with DefaultBufferSize,
+// mimicking the semantics of io.Pipe apart from the buffering itself, so that
+// existing users of io.Pipe can switch over by only replacing the constructor:
+//
+//	r, w := io.Pipe()                // before
+//	r, w := bufioprop.BufferedPipe() // after
+//
+// The Read, Write, Close and CloseWithError methods of both halves (and the
+// io.Copy fast paths) behave as those of io.Pipe:
+//
+//   - Closed halves report io.ErrClosedPipe instead of ErrClosedPipe.
+//   - Writes after the reader was closed with an error return that error.
+//   - Reads after the end of the stream keep returning the writer's close error.
+//   - Closing the writer returns immediately, even if data is still buffered,
+//     which the reader can consume until it reaches the end of the stream.
+//   - Closing either half multiple times is permitted, the first error sticks.
+//
+// The differences which remain are inherent to buffering: writes complete as soon
+// as their data fits into the buffer, without waiting for a matching read, and
+// closing the reader discards any data still buffered. Optional behavior of the
+// pipe can be configured through opts; if it cannot be created due to the
+// configured constraints, BufferedPipe panics.
+func BufferedPipe(opts ...Option) (*PipeReader, *PipeWriter) {
+	c := newConfig(opts)
+	c.ioCompat = true
+
+	r, w, err := newPipe(0, c)
+	if err != nil {
+		panic(err)
+	}
+	return r, w
+}
+
+// ioCompat tracks the close errors of the two halves of a pipe separately, as
+// needed to mimic the error semantics of io.Pipe.
+type ioCompat struct {
+	readErr  atomic.Pointer[error] // Error the reader was closed with (nil = open)
+	writeErr atomic.Pointer[error] // Error the writer was closed with (nil = open)
+}
+
+// closeReader records the close error of the reader, returning whether this was
+// the first close of it.
+func (c *ioCompat) closeReader(err error) bool {
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+	return c.readErr.CompareAndSwap(nil, &err)
+}
+
+// closeWriter records the close error of the writer, returning whether this was
+// the first close of it.
+func (c *ioCompat) closeWriter(err error) bool {
+	if err == nil {
+		err = io.EOF
+	}
+	return c.writeErr.CompareAndSwap(nil, &err)
+}
+
+// readError translates the failure of a read into the one io.Pipe would return:
+// the writer's close error if only the writer was closed, io.ErrClosedPipe once
+// the reader was.
+func (p *pipe) readError(err error) error {
+	if p.compat == nil || err != ErrClosedPipe {
+		return err
+	}
+	if p.compat.readErr.Load() == nil {
+		if werr := p.compat.writeErr.Load(); werr != nil {
+			return *werr
+		}
+	}
+	return io.ErrClosedPipe
+}
+
+// writeError translates the failure of a write into the one io.Pipe would return:
+// the reader's close error if only the reader was closed, io.ErrClosedPipe once
+// the writer was.
+func (p *pipe) writeError(err error) error {
+	if p.compat == nil || err != ErrClosedPipe {
+		return err
+	}
+	if p.compat.writeErr.Load() == nil {
+		if rerr := p.compat.readErr.Load(); rerr != nil {
+			return *rerr
+		}
+	}
+	return io.ErrClosedPipe
+}
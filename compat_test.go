@@ -0,0 +1,122 @@
+package bufioprop
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// closablePipeEnd is the close API shared by the halves of io.Pipe and ours.
+type closablePipeEnd interface {
+	Close() error
+	CloseWithError(err error) error
+}
+
+// Tests that pipes created via BufferedPipe report the same errors as io.Pipe
+// does, across the different orders of closing the halves.
+func TestBufferedPipeErrors(t *testing.T) {
+	type result struct {
+		n   int
+		err error
+	}
+	tests := []struct {
+		name string
+		run  func(r io.Reader, w io.Writer, rc, wc closablePipeEnd) []result
+	}{
+		{"write after reader close", func(r io.Reader, w io.Writer, rc, wc closablePipeEnd) []result {
+			rc.Close()
+			n, err := w.Write([]byte("hello"))
+			return []result{{n, err}}
+		}},
+		{"write after reader close with error", func(r io.Reader, w io.Writer, rc, wc closablePipeEnd) []result {
+			rc.CloseWithError(errContract)
+			n, err := w.Write([]byte("hello"))
+			return []result{{n, err}}
+		}},
+		{"write after both closed", func(r io.Reader, w io.Writer, rc, wc closablePipeEnd) []result {
+			rc.CloseWithError(errContract)
+			wc.Close()
+			n, err := w.Write([]byte("hello"))
+			return []result{{n, err}}
+		}},
+		{"copy after reader close with error", func(r io.Reader, w io.Writer, rc, wc closablePipeEnd) []result {
+			rc.CloseWithError(errContract)
+			n, err := io.Copy(w, bytes.NewReader([]byte("hello")))
+			return []result{{int(n), err}}
+		}},
+		{"read after reader close", func(r io.Reader, w io.Writer, rc, wc closablePipeEnd) []result {
+			rc.Close()
+			n, err := r.Read(make([]byte, 1))
+			return []result{{n, err}}
+		}},
+		{"reads after writer close", func(r io.Reader, w io.Writer, rc, wc closablePipeEnd) []result {
+			wc.Close()
+			n1, err1 := r.Read(make([]byte, 1))
+			n2, err2 := r.Read(make([]byte, 1))
+			return []result{{n1, err1}, {n2, err2}}
+		}},
+		{"reads after writer close with error", func(r io.Reader, w io.Writer, rc, wc closablePipeEnd) []result {
+			wc.CloseWithError(errContract)
+			n1, err1 := r.Read(make([]byte, 1))
+			n2, err2 := r.Read(make([]byte, 1))
+			return []result{{n1, err1}, {n2, err2}}
+		}},
+		{"read after both closed", func(r io.Reader, w io.Writer, rc, wc closablePipeEnd) []result {
+			wc.CloseWithError(errContract)
+			rc.Close()
+			n, err := r.Read(make([]byte, 1))
+			return []result{{n, err}}
+		}},
+		{"repeated closes", func(r io.Reader, w io.Writer, rc, wc closablePipeEnd) []result {
+			wc.CloseWithError(errContract)
+			wc.Close()
+			n1, err1 := r.Read(make([]byte, 1))
+			rc.Close()
+			rc.CloseWithError(errContract)
+			n2, err2 := w.Write([]byte("hello"))
+			return []result{{n1, err1}, {n2, err2}}
+		}},
+		{"blocked read released by reader close", func(r io.Reader, w io.Writer, rc, wc closablePipeEnd) []result {
+			blocked, done := blocks(func() error { _, err := r.Read(make([]byte, 1)); return err })
+			if !blocked {
+				t.Fatalf("read completed on an empty pipe")
+			}
+			rc.CloseWithError(errContract)
+			return []result{{0, <-done}}
+		}},
+	}
+	for _, tt := range tests {
+		sr, sw := io.Pipe()
+		want := tt.run(sr, sw, sr, sw)
+
+		r, w := BufferedPipe()
+		have := tt.run(r, w, r, w)
+
+		if len(have) != len(want) {
+			t.Fatalf("%s: result count mismatch: have %d, want %d", tt.name, len(have), len(want))
+		}
+		for i := range want {
+			if have[i] != want[i] {
+				t.Errorf("%s: result %d mismatch: have %+v, want %+v", tt.name, i, have[i], want[i])
+			}
+		}
+	}
+}
+
+// Tests that closing the writer of a BufferedPipe returns immediately, with the
+// buffered data still delivered to the reader, as io.Pipe users expect.
+func TestBufferedPipeWriterClose(t *testing.T) {
+	r, w := BufferedPipe()
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if blocked, _ := blocks(w.Close); blocked {
+		t.Fatalf("writer close blocked with data buffered")
+	}
+	if have, err := io.ReadAll(r); err != nil || string(have) != "hello" {
+		t.Fatalf("data mismatch: have (%q, %v), want (%q, nil)", have, err, "hello")
+	}
+	if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read after end error mismatch: have %v, want %v", err, io.EOF)
+	}
+}
@@ -0,0 +1,23 @@
+package bufioprop_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/karalabe/bufioprop"
+	"github.com/karalabe/bufioprop/pipetest"
+)
+
+// Tests that the buffered pipe conforms to the io.Pipe semantics.
+func TestPipeConformance(t *testing.T) {
+	pipetest.TestPipe(t, func(buffer int) (io.ReadCloser, io.WriteCloser, error) {
+		return bufioprop.NewPipe(buffer)
+	})
+}
+
+// Tests that the buffered copy conforms to the io.Copy semantics.
+func TestCopyConformance(t *testing.T) {
+	pipetest.TestCopy(t, func(dst io.Writer, src io.Reader, buffer int) (int64, error) {
+		return bufioprop.Copy(dst, src, buffer)
+	})
+}
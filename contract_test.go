@@ -0,0 +1,200 @@
+package bufioprop
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// The tests in this file mirror the io.Pipe test cases of the standard library,
+// pinning down where the buffered pipe behaves the same and where it diverges.
+// Every divergence is checked against io.Pipe too, so that the documented stdlib
+// behavior is enforced alongside ours.
+
+// errContract is the failure the pipe halves are closed with in the tests.
+var errContract = errors.New("contract failure")
+
+// blocks checks whether fn is still running after a short while, returning the
+// channel it reports its result on when it eventually does.
+func blocks(fn func() error) (bool, chan error) {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+
+	select {
+	case err := <-done:
+		done <- err
+		return false, done
+	case <-time.After(20 * time.Millisecond):
+		return true, done
+	}
+}
+
+// Divergence: writes fitting into the buffer complete without a matching read,
+// whereas io.Pipe blocks every write until it's fully consumed.
+func TestContractWriteBuffered(t *testing.T) {
+	sr, sw := io.Pipe()
+	defer sr.Close()
+	if blocked, _ := blocks(func() error { _, err := sw.Write([]byte("hello")); return err }); !blocked {
+		t.Fatalf("io.Pipe: write completed without a reader")
+	}
+	r, w := Pipe(16)
+	defer r.Close()
+	if blocked, done := blocks(func() error { _, err := w.Write([]byte("hello")); return err }); blocked {
+		t.Fatalf("bufio: write blocked despite fitting into the buffer")
+	} else if err := <-done; err != nil {
+		t.Fatalf("bufio: failed to write: %v", err)
+	}
+	// Writes overflowing the buffer block until the reader makes room
+	blocked, done := blocks(func() error { _, err := w.Write(make([]byte, 16)); return err })
+	if !blocked {
+		t.Fatalf("bufio: write completed despite overflowing the buffer")
+	}
+	if _, err := io.ReadFull(r, make([]byte, 8)); err != nil {
+		t.Fatalf("bufio: failed to read: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("bufio: failed to write: %v", err)
+	}
+}
+
+// Divergence: closing the writer blocks until the buffered data is consumed (or
+// the reader is closed), whereas io.Pipe's Close returns immediately.
+func TestContractWriterCloseBlocks(t *testing.T) {
+	_, sw := io.Pipe()
+	if blocked, _ := blocks(sw.Close); blocked {
+		t.Fatalf("io.Pipe: writer close blocked")
+	}
+	r, w := Pipe(16)
+	w.Write([]byte("hello"))
+
+	blocked, done := blocks(w.Close)
+	if !blocked {
+		t.Fatalf("bufio: writer close returned with data buffered")
+	}
+	if have, err := io.ReadAll(r); err != nil || string(have) != "hello" {
+		t.Fatalf("bufio: data mismatch: have (%q, %v), want (%q, nil)", have, err, "hello")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("bufio: failed to close writer: %v", err)
+	}
+	// Closing the reader discards the buffered data and releases the writer
+	r, w = Pipe(16)
+	w.Write([]byte("hello"))
+
+	blocked, done = blocks(w.Close)
+	if !blocked {
+		t.Fatalf("bufio: writer close returned with data buffered")
+	}
+	r.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("bufio: failed to close writer: %v", err)
+	}
+}
+
+// Same: reads return the writer's close error (or EOF) once the pipe is drained,
+// regardless of whether the close happened before or during the read.
+func TestContractReadAfterWriterClose(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		for _, closeErr := range []error{nil, errContract} {
+			r, w := Pipe(16)
+			w.Write([]byte("hi"))
+
+			closer := func() { w.CloseWithError(closeErr) }
+			if async {
+				go func() { time.Sleep(time.Millisecond); closer() }()
+			} else {
+				go closer() // blocks until the data is read
+			}
+			buf := make([]byte, 16)
+			if n, err := r.Read(buf); n != 2 || err != nil {
+				t.Fatalf("async %v, close %v: buffered read mismatch: have (%d, %v), want (2, nil)", async, closeErr, n, err)
+			}
+			want := closeErr
+			if want == nil {
+				want = io.EOF
+			}
+			if n, err := r.Read(buf); n != 0 || err != want {
+				t.Fatalf("async %v, close %v: final read mismatch: have (%d, %v), want (0, %v)", async, closeErr, n, err, want)
+			}
+			if err := r.Close(); err != nil {
+				t.Fatalf("async %v, close %v: failed to close reader: %v", async, closeErr, err)
+			}
+		}
+	}
+}
+
+// Divergence: reads after the end of the stream was already reported fail with
+// ErrClosedPipe, whereas io.Pipe keeps returning the writer's close error.
+func TestContractReadAfterEOF(t *testing.T) {
+	sr, sw := io.Pipe()
+	sw.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := sr.Read(make([]byte, 1)); err != io.EOF {
+			t.Fatalf("io.Pipe: read %d error mismatch: have %v, want %v", i, err, io.EOF)
+		}
+	}
+	r, w := Pipe(16)
+	w.Close()
+	if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("bufio: first read error mismatch: have %v, want %v", err, io.EOF)
+	}
+	if _, err := r.Read(make([]byte, 1)); err != ErrClosedPipe {
+		t.Fatalf("bufio: second read error mismatch: have %v, want %v", err, ErrClosedPipe)
+	}
+}
+
+// Same: reads on a closed reader fail with ErrClosedPipe, also unblocking any
+// read in progress.
+func TestContractReadAfterReaderClose(t *testing.T) {
+	r, w := Pipe(16)
+	defer w.Close()
+
+	blocked, done := blocks(func() error { _, err := r.Read(make([]byte, 1)); return err })
+	if !blocked {
+		t.Fatalf("read completed on an empty pipe")
+	}
+	r.CloseWithError(errContract)
+	if err := <-done; err != ErrClosedPipe {
+		t.Fatalf("blocked read error mismatch: have %v, want %v", err, ErrClosedPipe)
+	}
+	if _, err := r.Read(make([]byte, 1)); err != ErrClosedPipe {
+		t.Fatalf("read error mismatch: have %v, want %v", err, ErrClosedPipe)
+	}
+}
+
+// Divergence: writes after the reader was closed with an error fail with
+// ErrClosedPipe, whereas io.Pipe returns the reader's close error.
+func TestContractWriteAfterReaderClose(t *testing.T) {
+	sr, sw := io.Pipe()
+	sr.CloseWithError(errContract)
+	if _, err := sw.Write([]byte("hello")); err != errContract {
+		t.Fatalf("io.Pipe: write error mismatch: have %v, want %v", err, errContract)
+	}
+	r, w := Pipe(16)
+	r.CloseWithError(errContract)
+	if n, err := w.Write([]byte("hello")); n != 0 || err != ErrClosedPipe {
+		t.Fatalf("bufio: write mismatch: have (%d, %v), want (0, %v)", n, err, ErrClosedPipe)
+	}
+	// Blocked writes are released the same way
+	r, w = Pipe(4)
+	blocked, done := blocks(func() error { _, err := w.Write(make([]byte, 8)); return err })
+	if !blocked {
+		t.Fatalf("bufio: write completed despite overflowing the buffer")
+	}
+	r.CloseWithError(errContract)
+	if err := <-done; err != ErrClosedPipe {
+		t.Fatalf("bufio: blocked write error mismatch: have %v, want %v", err, ErrClosedPipe)
+	}
+}
+
+// Same: writes after the writer itself was closed fail with ErrClosedPipe.
+func TestContractWriteAfterWriterClose(t *testing.T) {
+	r, w := Pipe(16)
+	defer r.Close()
+
+	w.CloseWithError(errContract)
+	if n, err := w.Write([]byte("hello")); n != 0 || err != ErrClosedPipe {
+		t.Fatalf("write mismatch: have (%d, %v), want (0, %v)", n, err, ErrClosedPipe)
+	}
+}
@@ -0,0 +1,262 @@
+package bufioprop
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// sealChunk is the maximum plaintext size of a single encrypted record.
+const sealChunk = 64 * 1024
+
+var (
+	// ErrDecrypt is returned if an encrypted stream fails authentication.
+	ErrDecrypt = errors.New("bufio: stream decryption failed")
+
+	// errNonceSize is returned if the AEAD's nonce is too short to hold both a
+	// random prefix and the record counter.
+	errNonceSize = errors.New("bufio: AEAD nonce too short")
+
+	// errStreamTooLong is returned if the record counter would overflow.
+	errStreamTooLong = errors.New("bufio: encrypted stream too long")
+)
+
+// CopyEncrypt copies from src to dst until either EOF is reached on src or an
+// error occurs, encrypting the data with the given AEAD as it flows through. It
+// returns the number of encrypted bytes written and the first error encountered.
+//
+// The stream is split into records of 64KB plaintext each, sealed individually
+// under a nonce made up of a random per-stream prefix (written as a header), a
+// record counter and a final record flag, so reordering, truncation or extension
+// of the records are all detected by CopyDecrypt.
+//
+// Encryption runs on the consumer goroutine of the copy, overlapping the crypto
+// with reading the source.
+func CopyEncrypt(dst io.Writer, src io.Reader, buffer int, aead cipher.AEAD, opts ...Option) (written int64, err error) {
+	s, err := newSealer(aead)
+	if err != nil {
+		return 0, err
+	}
+	return CopyFunc(dst, src, buffer, s.transform, opts...)
+}
+
+// CopyDecrypt copies from src to dst until either EOF is reached on src or an
+// error occurs, decrypting a stream produced by CopyEncrypt as it flows through.
+// It returns the number of plaintext bytes written and the first error hit.
+//
+// Note, plaintext is released record by record, so a failure in a later record
+// may be reported after earlier, authentic records were already written to dst.
+func CopyDecrypt(dst io.Writer, src io.Reader, buffer int, aead cipher.AEAD, opts ...Option) (written int64, err error) {
+	o, err := newOpener(aead)
+	if err != nil {
+		return 0, err
+	}
+	return CopyFunc(dst, src, buffer, o.transform, opts...)
+}
+
+// CopyStream copies from src to dst until either EOF is reached on src or an
+// error occurs, XORing the data with the key stream (e.g. AES-CTR). It returns
+// the number of bytes written and the first error encountered.
+//
+// Note, stream ciphers don't authenticate the data, prefer CopyEncrypt.
+func CopyStream(dst io.Writer, src io.Reader, buffer int, stream cipher.Stream, opts ...Option) (written int64, err error) {
+	return CopyFunc(dst, src, buffer, func(dst, src []byte) (int, int, error) {
+		if len(src) > len(dst) {
+			src = src[:len(dst)]
+		}
+		stream.XORKeyStream(dst, src)
+		return len(src), len(src), nil
+	}, opts...)
+}
+
+// A recordNonce generates the per-record nonces of a chunked AEAD stream.
+type recordNonce struct {
+	nonce   []byte // Random prefix || record counter || final flag
+	counter uint32 // Index of the next record to seal or open
+}
+
+// newRecordNonce creates a nonce generator for the given AEAD.
+func newRecordNonce(aead cipher.AEAD) (*recordNonce, error) {
+	if aead.NonceSize() < 12 {
+		return nil, errNonceSize
+	}
+	return &recordNonce{nonce: make([]byte, aead.NonceSize())}, nil
+}
+
+// prefix returns the random per-stream portion of the nonce.
+func (n *recordNonce) prefix() []byte {
+	return n.nonce[:len(n.nonce)-5]
+}
+
+// next returns the nonce for the next record, advancing the counter.
+func (n *recordNonce) next(final bool) ([]byte, error) {
+	if n.counter == ^uint32(0) {
+		return nil, errStreamTooLong
+	}
+	binary.BigEndian.PutUint32(n.nonce[len(n.nonce)-5:], n.counter)
+	n.nonce[len(n.nonce)-1] = 0
+	if final {
+		n.nonce[len(n.nonce)-1] = 1
+	}
+	n.counter++
+	return n.nonce, nil
+}
+
+// A sealer is a stream transformation encrypting chunked AEAD records.
+type sealer struct {
+	aead  cipher.AEAD
+	nonce *recordNonce
+
+	plain  []byte // Plaintext accumulated for the next record
+	sealed []byte // Scratch space for sealing a record
+	out    []byte // Encrypted data pending output
+	done   bool   // Whether the final record was sealed
+}
+
+// newSealer creates an encrypting transformation, generating a random nonce
+// prefix to be emitted as the stream header.
+func newSealer(aead cipher.AEAD) (*sealer, error) {
+	nonce, err := newRecordNonce(aead)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, nonce.prefix()); err != nil {
+		return nil, err
+	}
+	s := &sealer{
+		aead:   aead,
+		nonce:  nonce,
+		plain:  make([]byte, 0, sealChunk),
+		sealed: make([]byte, 0, sealChunk+aead.Overhead()),
+	}
+	s.out = append(s.out, nonce.prefix()...)
+	return s, nil
+}
+
+// seal encrypts the accumulated plaintext into a record pending output.
+func (s *sealer) seal(final bool) error {
+	nonce, err := s.nonce.next(final)
+	if err != nil {
+		return err
+	}
+	s.out = s.aead.Seal(s.sealed[:0], nonce, s.plain, nil)
+	s.plain = s.plain[:0]
+	return nil
+}
+
+// transform implements TransformFunc. A full record is only sealed when more
+// input arrives, so that the last one can always be flagged as final.
+func (s *sealer) transform(dst, src []byte) (nDst, nSrc int, err error) {
+	for {
+		// Drain any pending encrypted data first
+		n := copy(dst[nDst:], s.out)
+		nDst, s.out = nDst+n, s.out[n:]
+		if len(s.out) > 0 {
+			return nDst, nSrc, nil
+		}
+		// If the input ran dry, seal the final record on flush or wait for more
+		if nSrc == len(src) {
+			if len(src) == 0 && !s.done {
+				s.done = true
+				if err := s.seal(true); err != nil {
+					return nDst, nSrc, err
+				}
+				continue
+			}
+			return nDst, nSrc, nil
+		}
+		// Otherwise seal a full record or accumulate more plaintext
+		if len(s.plain) == sealChunk {
+			if err := s.seal(false); err != nil {
+				return nDst, nSrc, err
+			}
+			continue
+		}
+		n = copy(s.plain[len(s.plain):sealChunk], src[nSrc:])
+		s.plain, nSrc = s.plain[:len(s.plain)+n], nSrc+n
+	}
+}
+
+// An opener is a stream transformation decrypting chunked AEAD records.
+type opener struct {
+	aead  cipher.AEAD
+	nonce *recordNonce
+
+	header int    // Number of nonce prefix bytes already read
+	sealed []byte // Ciphertext accumulated for the next record
+	plain  []byte // Scratch space for opening a record
+	out    []byte // Decrypted data pending output
+	done   bool   // Whether the final record was opened
+}
+
+// newOpener creates a decrypting transformation.
+func newOpener(aead cipher.AEAD) (*opener, error) {
+	nonce, err := newRecordNonce(aead)
+	if err != nil {
+		return nil, err
+	}
+	return &opener{
+		aead:   aead,
+		nonce:  nonce,
+		sealed: make([]byte, 0, sealChunk+aead.Overhead()),
+		plain:  make([]byte, 0, sealChunk),
+	}, nil
+}
+
+// open decrypts the accumulated ciphertext into plaintext pending output.
+func (o *opener) open(final bool) error {
+	nonce, err := o.nonce.next(final)
+	if err != nil {
+		return err
+	}
+	if o.out, err = o.aead.Open(o.plain[:0], nonce, o.sealed, nil); err != nil {
+		return ErrDecrypt
+	}
+	o.sealed = o.sealed[:0]
+	return nil
+}
+
+// transform implements TransformFunc. A full record is only opened when more
+// input arrives, so that the last one can always be verified as final.
+func (o *opener) transform(dst, src []byte) (nDst, nSrc int, err error) {
+	prefix := o.nonce.prefix()
+	for {
+		// Drain any pending decrypted data first
+		n := copy(dst[nDst:], o.out)
+		nDst, o.out = nDst+n, o.out[n:]
+		if len(o.out) > 0 {
+			return nDst, nSrc, nil
+		}
+		// If the input ran dry, open the final record on flush or wait for more
+		if nSrc == len(src) {
+			if len(src) == 0 && !o.done {
+				if o.header < len(prefix) {
+					return nDst, nSrc, io.ErrUnexpectedEOF
+				}
+				o.done = true
+				if err := o.open(true); err != nil {
+					return nDst, nSrc, err
+				}
+				continue
+			}
+			return nDst, nSrc, nil
+		}
+		// Otherwise consume the header, open a full record or accumulate more
+		switch {
+		case o.header < len(prefix):
+			n = copy(prefix[o.header:], src[nSrc:])
+			o.header, nSrc = o.header+n, nSrc+n
+
+		case len(o.sealed) == cap(o.sealed):
+			if err := o.open(false); err != nil {
+				return nDst, nSrc, err
+			}
+
+		default:
+			n = copy(o.sealed[len(o.sealed):cap(o.sealed)], src[nSrc:])
+			o.sealed, nSrc = o.sealed[:len(o.sealed)+n], nSrc+n
+		}
+	}
+}
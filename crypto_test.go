@@ -0,0 +1,90 @@
+package bufioprop
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+)
+
+// newTestAEAD creates an AES-GCM cipher with a fixed key for testing.
+func newTestAEAD(t *testing.T) cipher.AEAD {
+	block, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("failed to create block cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("failed to create AEAD: %v", err)
+	}
+	return aead
+}
+
+// Tests that encrypting and decrypting streams of various sizes round trips,
+// especially around record boundaries.
+func TestCopyEncryptDecrypt(t *testing.T) {
+	aead := newTestAEAD(t)
+	for _, size := range []int{0, 1, sealChunk - 1, sealChunk, sealChunk + 1, 3*sealChunk + 77} {
+		enc := new(bytes.Buffer)
+		if _, err := CopyEncrypt(enc, bytes.NewReader(testData[:size]), 3333, aead); err != nil {
+			t.Fatalf("size %d: failed to encrypt: %v", size, err)
+		}
+		dec := new(bytes.Buffer)
+		if n, err := CopyDecrypt(dec, enc, 4444, aead); err != nil {
+			t.Fatalf("size %d: failed to decrypt: %v", size, err)
+		} else if int(n) != size {
+			t.Fatalf("size %d: decrypted length mismatch: have %d, want %d", size, n, size)
+		}
+		if !bytes.Equal(dec.Bytes(), testData[:size]) {
+			t.Fatalf("size %d: round trip data mismatch", size)
+		}
+	}
+}
+
+// Tests that modified, truncated or extended streams are rejected.
+func TestCopyDecryptTampered(t *testing.T) {
+	aead := newTestAEAD(t)
+	size := 2*sealChunk + 100
+
+	enc := new(bytes.Buffer)
+	if _, err := CopyEncrypt(enc, bytes.NewReader(testData[:size]), 3333, aead); err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	stream := enc.Bytes()
+	record := sealChunk + aead.Overhead()
+
+	flipped := append([]byte{}, stream...)
+	flipped[len(flipped)/2] ^= 0x01
+
+	tests := map[string][]byte{
+		"flipped":   flipped,
+		"truncated": stream[:len(stream)-(100+aead.Overhead())],
+		"extended":  append(append([]byte{}, stream...), stream[len(stream)-record:]...),
+		"header":    stream[:3],
+	}
+	for name, data := range tests {
+		if _, err := CopyDecrypt(new(bytes.Buffer), bytes.NewReader(data), 1024, aead); err == nil {
+			t.Errorf("%s: tampered stream accepted", name)
+		}
+	}
+}
+
+// Tests that the stream cipher copy round trips.
+func TestCopyStream(t *testing.T) {
+	block, _ := aes.NewCipher(make([]byte, 32))
+	iv := make([]byte, block.BlockSize())
+
+	data := testData[:1024*1024+13]
+
+	enc := new(bytes.Buffer)
+	if _, err := CopyStream(enc, bytes.NewReader(data), 3333, cipher.NewCTR(block, iv)); err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	dec := new(bytes.Buffer)
+	if _, err := CopyStream(dec, enc, 4444, cipher.NewCTR(block, iv)); err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	if !bytes.Equal(dec.Bytes(), data) {
+		t.Fatalf("round trip data mismatch")
+	}
+}
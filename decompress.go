@@ -0,0 +1,99 @@
+package bufioprop
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+)
+
+// ErrUnsupportedCompression is returned by CopyDecompress if the source is in a
+// recognized compression format, but no decompressor was provided for it.
+var ErrUnsupportedCompression = errors.New("bufio: unsupported compression format")
+
+// A Decompressor wraps a compressed stream into a reader of its decompressed
+// content.
+type Decompressor func(r io.Reader) (io.Reader, error)
+
+// compression is a stream format recognized by its leading magic bytes.
+type compression struct {
+	magic  []byte       // Leading bytes identifying the format
+	decomp Decompressor // Decompressor of the format (nil = unsupported)
+}
+
+// compressions are the formats recognized by default. Zstandard has no standard
+// library implementation, so its decompressor needs to be provided by the user.
+var compressions = []compression{
+	{magic: []byte{0x1f, 0x8b}, decomp: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+	{magic: []byte("BZh"), decomp: func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil }},
+	{magic: []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+// CopyDecompress copies from src to dst until either EOF is reached on src or an
+// error occurs, transparently decompressing the stream if it starts with the
+// magic bytes of a known compression format (gzip, bzip2 or any registered via
+// WithDecompressor), otherwise passing it through unchanged. It returns the number
+// of (decompressed) bytes written into dst and the first error encountered.
+//
+// The magic bytes are peeked directly inside the pipe's internal buffer, and the
+// decompression runs on the consumer goroutine of the copy. A buffer shorter than
+// the magic bytes of a format can never hold them, so it won't detect it.
+func CopyDecompress(dst io.Writer, src io.Reader, buffer int, opts ...Option) (written int64, err error) {
+	c := newConfig(opts)
+	formats := append(c.compressions, compressions...)
+
+	return copyPipe(dst, src, buffer, c, func(pr *PipeReader) (int64, error) {
+		// Peek enough bytes from the start of the stream to identify it
+		var need int
+		for _, format := range formats {
+			if len(format.magic) > need {
+				need = len(format.magic)
+			}
+		}
+		magic := make([]byte, need)
+		n, err := pr.p.peek(magic)
+		if err == io.EOF {
+			return 0, nil // Empty stream, nothing to decompress
+		}
+		if err != nil {
+			return 0, err
+		}
+		// Insert the decompressor of a matching format, or pass through
+		for _, format := range formats {
+			if !bytes.HasPrefix(magic[:n], format.magic) {
+				continue
+			}
+			if format.decomp == nil {
+				return 0, ErrUnsupportedCompression
+			}
+			r, err := format.decomp(pr)
+			if err != nil {
+				return 0, err
+			}
+			return io.Copy(dst, r)
+		}
+		return io.Copy(dst, pr)
+	})
+}
+
+// Peek waits until len(b) bytes become available in the internal buffer, or the
+// input is closed, and copies them into b without consuming them.
+func (p *pipe) peek(b []byte) (int, error) {
+	need := int32(len(b))
+	if need > p.size {
+		need = p.size
+	}
+	safeFree, err := p.outputWaitN(need)
+	if err != nil {
+		return 0, err
+	}
+	avail := int(p.size - safeFree)
+	if avail > len(b) {
+		avail = len(b)
+	}
+	n := copy(b[:avail], p.buffer[p.outPos:])
+	copy(b[n:avail], p.buffer)
+
+	return avail, nil
+}
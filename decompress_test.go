@@ -0,0 +1,76 @@
+package bufioprop
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"testing"
+)
+
+// Tests that compressed streams are detected and decompressed, whereas anything
+// else is passed through unchanged.
+func TestCopyDecompress(t *testing.T) {
+	data := testData[:1024*1024]
+
+	zipped := new(bytes.Buffer)
+	zw := gzip.NewWriter(zipped)
+	zw.Write(data)
+	zw.Close()
+
+	tests := []struct {
+		name string
+		src  []byte
+	}{
+		{"gzip", zipped.Bytes()},
+		{"plain", data},
+	}
+	for _, tt := range tests {
+		for _, buffer := range []int{3, 333, 64 * 1024} {
+			dst := new(bytes.Buffer)
+			n, err := CopyDecompress(dst, bytes.NewReader(tt.src), buffer)
+			if err != nil {
+				t.Fatalf("%s/%d: failed to copy: %v", tt.name, buffer, err)
+			}
+			if int(n) != len(data) || !bytes.Equal(dst.Bytes(), data) {
+				t.Fatalf("%s/%d: data mismatch: have %d bytes, want %d", tt.name, buffer, n, len(data))
+			}
+		}
+	}
+	// Ensure that empty and too short streams are handled
+	for _, src := range [][]byte{nil, {0x1f}} {
+		dst := new(bytes.Buffer)
+		if _, err := CopyDecompress(dst, bytes.NewReader(src), 1024); err != nil {
+			t.Fatalf("failed to copy short stream %x: %v", src, err)
+		}
+		if !bytes.Equal(dst.Bytes(), src) {
+			t.Fatalf("short stream mismatch: have %x, want %x", dst.Bytes(), src)
+		}
+	}
+}
+
+// Tests that user decompressors are inserted for their formats, and recognized
+// formats without a decompressor are rejected.
+func TestCopyDecompressCustom(t *testing.T) {
+	data := testData[:1024*1024]
+
+	zipped := new(bytes.Buffer)
+	zw := zlib.NewWriter(zipped)
+	zw.Write(data)
+	zw.Close()
+
+	dst := new(bytes.Buffer)
+	_, err := CopyDecompress(dst, bytes.NewReader(zipped.Bytes()), 4096, WithDecompressor(zipped.Bytes()[:2], func(r io.Reader) (io.Reader, error) {
+		return zlib.NewReader(r)
+	}))
+	if err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+	if !bytes.Equal(dst.Bytes(), data) {
+		t.Fatalf("data mismatch")
+	}
+	zstd := append([]byte{0x28, 0xb5, 0x2f, 0xfd}, data[:1024]...)
+	if _, err := CopyDecompress(new(bytes.Buffer), bytes.NewReader(zstd), 4096); err != ErrUnsupportedCompression {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrUnsupportedCompression)
+	}
+}
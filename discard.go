@@ -0,0 +1,25 @@
+package bufioprop
+
+import "io"
+
+// Discard reads from src until an error or EOF, dropping all the data read, and
+// returns the number of bytes discarded. A successful call returns err == nil,
+// not err == EOF.
+//
+// It is meant for draining sources to completion, e.g. an HTTP response body to
+// allow reusing the connection. Unlike io.Copy(io.Discard, src), the source is
+// read ahead on a separate goroutine (see Copy), so the latency of one read does
+// not hold back issuing the next one.
+func Discard(src io.Reader, buffer int, opts ...Option) (int64, error) {
+	return Copy(discarder{}, src, buffer, opts...)
+}
+
+// discarder is a writer accepting and dropping everything. As opposed to
+// io.Discard, it does not implement io.ReaderFrom, so the consumer releases the
+// buffered data straight from the ring, without copying it out first.
+type discarder struct{}
+
+// Write implements io.Writer, dropping the data.
+func (discarder) Write(b []byte) (int, error) {
+	return len(b), nil
+}
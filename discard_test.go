@@ -0,0 +1,29 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// Tests that Discard drains sources in full, reporting the bytes dropped, and
+// surfaces failures along with the number of bytes preceding them.
+func TestDiscard(t *testing.T) {
+	for _, size := range []int{0, 1, 4096, 100000, 10 * 1024 * 1024} {
+		src := bytes.NewReader(testData[:size])
+		if n, err := Discard(src, 64*1024); err != nil || n != int64(size) {
+			t.Fatalf("size %d, known length: discard mismatch: have (%d, %v), want (%d, nil)", size, n, err, size)
+		}
+		if src.Len() != 0 {
+			t.Fatalf("size %d, known length: source not drained: %d bytes left", size, src.Len())
+		}
+		if n, err := Discard(&errDataReader{data: testData[:size], chunk: 1000, err: io.EOF}, 64*1024); err != nil || n != int64(size) {
+			t.Fatalf("size %d, unknown length: discard mismatch: have (%d, %v), want (%d, nil)", size, n, err, size)
+		}
+	}
+	errBoom := errors.New("boom")
+	if n, err := Discard(&errDataReader{data: testData[:5000], chunk: 1000, err: errBoom}, 1024); err != errBoom || n != 5000 {
+		t.Fatalf("failing source discard mismatch: have (%d, %v), want (5000, %v)", n, err, errBoom)
+	}
+}
@@ -0,0 +1,172 @@
+package bufioprop
+
+import (
+	"io"
+	"runtime/debug"
+	"sync"
+)
+
+// A doubleBuffer is the shared state of a double buffered copy, an alternative
+// engine to the ring buffered pipe. The producer fills one buffer front to back
+// while the consumer drains the other (or trails the producer within the same
+// one), the two swapping once the producer reaches the end of its buffer. Every
+// source read is offered the full remaining contiguous space of its buffer, with
+// no wraparound splitting it, which favors large sequential transfers.
+//
+// The consumer drains data as soon as it's read, instead of waiting for a full
+// buffer, so a copy never strands data while the producer is blocked on its next
+// read (unlike whole-buffer swapping, which deadlocks request/reply streams).
+type doubleBuffer struct {
+	bufs   [2][]byte // Buffers alternately filled by the producer
+	filled [2]int    // Number of bytes filled into each buffer
+	copied [2]int    // Number of bytes drained out of each buffer
+
+	in  int // Index of the buffer being filled by the producer
+	out int // Index of the buffer being drained by the consumer
+
+	inDone  bool  // Whether the producer terminated
+	inErr   error // Failure of the source, if any
+	outDone bool  // Whether the consumer terminated (without draining the source)
+
+	lock sync.Mutex // Lock protecting the buffer positions and termination
+	cond *sync.Cond // Signaler of progress on either side
+}
+
+// copyDouble copies from src to dst via a pair of swapped buffers, each of the
+// given size, instead of a ring.
+func copyDouble(dst io.Writer, src io.Reader, buffer int, c *config) (written int64, err error) {
+	defer closeOwned(dst, src, c, &err)
+
+	buffer = copyBuffer(src, buffer)
+	if err := checkBuffer(buffer); err != nil {
+		return 0, err
+	}
+	if c.budget != nil {
+		if err := c.budget.acquire(2*buffer, c.cancel); err != nil {
+			return 0, err
+		}
+		defer c.budget.release(2 * buffer)
+	}
+	d := &doubleBuffer{bufs: [2][]byte{make([]byte, buffer), make([]byte, buffer)}}
+	d.cond = sync.NewCond(&d.lock)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.produce(src, &sourceReads{stats: c.stats, limit: c.emptyReads})
+	}()
+	defer d.stop() // unblock the producer if the consumer panicked
+
+	written, errOut := d.consume(dst)
+	if errOut != nil && c.drain {
+		// Destination failed, but the source should be read to completion
+		d.consume(io.Discard)
+	}
+	d.stop()
+	<-done
+
+	if errOut != nil {
+		return written, c.filterErr(SideWrite, errOut)
+	}
+	if d.inErr != nil {
+		return written, c.filterErr(SideRead, d.inErr)
+	}
+	return written, c.filterErr(SideWrite, finalizeOut(dst, c))
+}
+
+// stop marks the consumer terminated, releasing the producer.
+func (d *doubleBuffer) stop() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.outDone = true
+	d.cond.Broadcast()
+}
+
+// produce keeps reading the source into the buffers until it's exhausted, fails
+// or the consumer terminates.
+func (d *doubleBuffer) produce(src io.Reader, reads *sourceReads) {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+		d.lock.Lock()
+		d.inDone, d.inErr = true, err
+		d.cond.Broadcast()
+		d.lock.Unlock()
+	}()
+	for {
+		// Wait for space in the current buffer, or for the other to be drained
+		d.lock.Lock()
+		for !d.outDone && d.filled[d.in] == len(d.bufs[d.in]) {
+			if d.out == d.in {
+				// Consumer is done with the other buffer, switch over to it
+				d.in ^= 1
+				d.filled[d.in], d.copied[d.in] = 0, 0
+				break
+			}
+			d.cond.Wait()
+		}
+		if d.outDone {
+			d.lock.Unlock()
+			return
+		}
+		buf := d.bufs[d.in][d.filled[d.in]:]
+		d.lock.Unlock()
+
+		// Read into the free space and publish whatever arrived
+		var n int
+		n, err = src.Read(buf)
+		if n > 0 {
+			d.lock.Lock()
+			d.filled[d.in] += n
+			d.cond.Broadcast()
+			d.lock.Unlock()
+		}
+		if err = reads.track(n, err); err == io.EOF {
+			err = nil
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// consume keeps draining the buffers into the destination until the producer
+// terminates and everything's written, or the destination fails.
+func (d *doubleBuffer) consume(dst io.Writer) (written int64, err error) {
+	for {
+		// Wait for some data to become available
+		d.lock.Lock()
+		for d.copied[d.out] == d.filled[d.out] {
+			if d.out != d.in {
+				// Producer moved on from an exhausted buffer, follow it
+				d.out ^= 1
+				d.cond.Broadcast()
+				continue
+			}
+			if d.inDone {
+				d.lock.Unlock()
+				return written, nil
+			}
+			d.cond.Wait()
+		}
+		chunk := d.bufs[d.out][d.copied[d.out]:d.filled[d.out]]
+		d.lock.Unlock()
+
+		// Push the data out and release it back to the producer
+		n, err := writeFull(dst, chunk)
+		written += int64(n)
+
+		d.lock.Lock()
+		d.copied[d.out] += n
+		d.cond.Broadcast()
+		d.lock.Unlock()
+
+		if err != nil {
+			return written, err
+		}
+	}
+}
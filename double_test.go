@@ -0,0 +1,104 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// Tests that the double buffered engine hands data over as soon as it's read,
+// without waiting for a buffer to fill up.
+func TestCopyDoubleBufferLatency(t *testing.T) {
+	ir, iw := io.Pipe()
+	or, ow := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Copy(ow, ir, 1024*1024, WithDoubleBuffer())
+		ow.Close()
+		done <- err
+	}()
+	// Ping-pong single bytes through the copy, which would deadlock if stranded
+	for i := 0; i < 3000; i++ { // enough to swap the buffers a few times over
+		errc := make(chan error, 1)
+		go func() {
+			_, err := iw.Write(testData[i : i+1000])
+			errc <- err
+		}()
+		buf := make([]byte, 1000)
+		if _, err := io.ReadFull(or, buf); err != nil {
+			t.Fatalf("round %d: failed to read: %v", i, err)
+		}
+		if !bytes.Equal(buf, testData[i:i+1000]) {
+			t.Fatalf("round %d: data mismatch", i)
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("round %d: failed to write: %v", i, err)
+		}
+	}
+	iw.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("copy didn't terminate")
+	}
+}
+
+// Tests that the double buffered engine reports failures like the ring does.
+func TestCopyDoubleBufferFailures(t *testing.T) {
+	fail := errors.New("failure")
+
+	// Data returned alongside a source failure is delivered first
+	out := new(bytes.Buffer)
+	src := &errDataReader{data: testData[:100000], chunk: 3000, err: fail}
+	if n, err := Copy(out, src, 4096, WithDoubleBuffer()); n != 100000 || err != fail || !bytes.Equal(out.Bytes(), testData[:100000]) {
+		t.Fatalf("source failure mismatch: have (%d, %v), want (100000, %v)", n, err, fail)
+	}
+	// Destination failures abort or drain the source as requested
+	for _, drain := range []bool{false, true} {
+		src := bytes.NewReader(testData[:16*1024*1024])
+		dst := &failingWriter{limit: 1024 * 1024, err: fail}
+
+		n, err := Copy(dst, src, 4096, WithDoubleBuffer(), WithDrainOnError(drain))
+		if n != 1024*1024 || err != fail {
+			t.Errorf("drain %v: result mismatch: have (%d, %v), want (%d, %v)", drain, n, err, 1024*1024, fail)
+		}
+		if remaining := src.Len(); drain != (remaining == 0) {
+			t.Errorf("drain %v: source remaining mismatch: %d bytes left", drain, remaining)
+		}
+	}
+	// Panics of the source are converted into errors
+	var perr *PanicError
+	if _, err := Copy(io.Discard, &panickingReader{left: 100000}, 4096, WithDoubleBuffer()); !errors.As(err, &perr) {
+		t.Fatalf("panic error mismatch: have %v, want *PanicError", err)
+	}
+}
+
+// Tests that the double buffered engine applies the empty read limit and counts
+// the source read events like the ring does.
+func TestCopyDoubleBufferSourceReads(t *testing.T) {
+	src := new(stuckReader)
+	if _, err := Copy(io.Discard, src, 128, WithDoubleBuffer(), WithEmptyReadLimit(10)); err != io.ErrNoProgress {
+		t.Fatalf("error mismatch: have %v, want %v", err, io.ErrNoProgress)
+	}
+	if src.reads != 10 {
+		t.Errorf("read count mismatch: have %d, want %d", src.reads, 10)
+	}
+	var stats Stats
+
+	patho := &pathologicalReader{chunks: [][]byte{[]byte("hello"), []byte("world")}}
+	if _, err := Copy(io.Discard, patho, 128, WithDoubleBuffer(), WithEmptyReadLimit(3), WithStats(&stats)); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+	if n := stats.ZeroReads.Load(); n != 2 {
+		t.Errorf("zero read count mismatch: have %d, want %d", n, 2)
+	}
+	if n := stats.EOFWithData.Load(); n != 1 {
+		t.Errorf("EOF with data count mismatch: have %d, want %d", n, 1)
+	}
+}
@@ -0,0 +1,182 @@
+package bufioprop
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// durableMagic identifies the files backing durable pipes.
+const durableMagic = "BUFPIPE1"
+
+// durableHeader is the size of the file header preceding the ring buffer, a full
+// page to keep the buffer page aligned.
+const durableHeader = 4096
+
+var (
+	// errDurableCorrupt is returned if a durable pipe's file header is invalid.
+	errDurableCorrupt = errors.New("bufio: corrupt durable pipe file")
+
+	// errDurableSize is returned if an existing durable pipe's file was created
+	// with a different buffer size than requested.
+	errDurableSize = errors.New("bufio: durable pipe size mismatch")
+
+	// errDurableLocked is returned if a durable pipe's file is already opened by
+	// another durable pipe, possibly in a different process.
+	errDurableLocked = errors.New("bufio: durable pipe file in use")
+
+	// errDurableOption is returned if a durable pipe is opened with options that
+	// need to manage the pipe's memory, which lives in the file instead.
+	errDurableOption = errors.New("bufio: option not supported by durable pipes")
+
+	// errDurableUnsupported is returned when opening a durable pipe on a platform
+	// without memory mapped file support.
+	errDurableUnsupported = errors.New("bufio: durable pipes not supported on this platform")
+)
+
+// A journal persists the stream positions of a pipe across process restarts.
+// The counters are monotonic, so a full and an empty buffer are distinguishable.
+// They're stored little endian like the rest of the header, keeping the files
+// portable, and each is only ever updated by its own half of the pipe.
+type journal struct {
+	head []byte // Total number of bytes ever written into the pipe
+	tail []byte // Total number of bytes ever consumed from the pipe
+}
+
+// advanceCounter increments a persisted stream counter by count.
+func advanceCounter(counter []byte, count int) {
+	binary.LittleEndian.PutUint64(counter, binary.LittleEndian.Uint64(counter)+uint64(count))
+}
+
+// A DurablePipe is a pipe whose internal buffer lives in a memory mapped file,
+// alongside the persisted positions of its two halves. If the process crashes
+// or is restarted, reopening the pipe resumes with all the data written but not
+// yet consumed, effectively turning it into a single node persistent queue.
+//
+// Data reaches the file as soon as it's written, surviving process crashes. To
+// also survive operating system crashes, call Sync at appropriate checkpoints.
+// Note, closing the halves is not persisted; a reopened pipe is always open.
+//
+// The file is locked while the pipe is open, so only a single durable pipe (in
+// any process) can use it at a time.
+type DurablePipe struct {
+	file   *os.File
+	memory []byte
+
+	reader *PipeReader
+	writer *PipeWriter
+}
+
+// OpenDurablePipe opens the durable pipe backed by the file at path, creating
+// it with a buffer of the requested size if it doesn't exist yet. A buffer of 0
+// uses DefaultBufferSize.
+//
+// As the buffer lives in the file, options managing the pipe's memory (block
+// writes, buffer budgets and idle releases) are rejected.
+func OpenDurablePipe(path string, buffer int, opts ...Option) (*DurablePipe, error) {
+	c := newConfig(opts)
+	if c.block > 0 || c.budget != nil || c.idle > 0 {
+		return nil, errDurableOption
+	}
+	buffer = bufferSize(buffer)
+	if err := checkBuffer(buffer); err != nil {
+		return nil, err
+	}
+	if !durableSupported {
+		return nil, errDurableUnsupported
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// Claim the file before inspecting it, an open pipe may be mid-write
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	fresh := info.Size() == 0
+	if fresh {
+		err = file.Truncate(int64(durableHeader + buffer))
+	} else if info.Size() != int64(durableHeader+buffer) {
+		err = errDurableSize
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	memory, err := mapFile(file, durableHeader+buffer)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	// Initialize or validate the header, restoring the pipe positions
+	header := memory[:durableHeader]
+	if fresh {
+		copy(header, durableMagic)
+		binary.LittleEndian.PutUint64(header[8:], uint64(buffer))
+	} else if string(header[:8]) != durableMagic || binary.LittleEndian.Uint64(header[8:]) != uint64(buffer) {
+		unmapFile(memory)
+		file.Close()
+		return nil, errDurableCorrupt
+	}
+	j := &journal{
+		head: header[16:24],
+		tail: header[24:32],
+	}
+	head, tail := binary.LittleEndian.Uint64(j.head), binary.LittleEndian.Uint64(j.tail)
+	if tail > head || head-tail > uint64(buffer) {
+		unmapFile(memory)
+		file.Close()
+		return nil, errDurableCorrupt
+	}
+	r, w := newPipeMemory(memory[durableHeader:], c)
+
+	p := r.p
+	p.journal = j
+	p.inPos = int32(head % uint64(buffer))
+	p.outPos = int32(tail % uint64(buffer))
+	p.head.Store(head - tail)
+
+	return &DurablePipe{
+		file:   file,
+		memory: memory,
+		reader: r,
+		writer: w,
+	}, nil
+}
+
+// Reader returns the read half of the durable pipe.
+func (d *DurablePipe) Reader() *PipeReader {
+	return d.reader
+}
+
+// Writer returns the write half of the durable pipe.
+func (d *DurablePipe) Writer() *PipeWriter {
+	return d.writer
+}
+
+// Sync flushes the buffered data and the pipe positions to stable storage.
+func (d *DurablePipe) Sync() error {
+	return syncFile(d.memory)
+}
+
+// Close terminates both halves of the pipe, flushes everything to stable storage
+// and releases the backing file. Unconsumed data is retained for the next open.
+func (d *DurablePipe) Close() error {
+	d.reader.Close()
+	d.writer.Close()
+
+	err := syncFile(d.memory)
+	if uerr := unmapFile(d.memory); err == nil {
+		err = uerr
+	}
+	if cerr := d.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
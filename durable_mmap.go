@@ -0,0 +1,43 @@
+//go:build linux || darwin
+
+package bufioprop
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// durableSupported reports whether durable pipes can be opened on this platform.
+const durableSupported = true
+
+// lockFile takes an exclusive lock on a file, released when it's closed, failing
+// if it's already locked by someone else.
+func lockFile(file *os.File) error {
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if err == syscall.EWOULDBLOCK {
+			return errDurableLocked
+		}
+		return err
+	}
+	return nil
+}
+
+// mapFile maps the first size bytes of a file into memory, shared with it.
+func mapFile(file *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+// unmapFile releases a memory mapping created by mapFile.
+func unmapFile(memory []byte) error {
+	return syscall.Munmap(memory)
+}
+
+// syncFile flushes a memory mapping created by mapFile to stable storage.
+func syncFile(memory []byte) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&memory[0])), uintptr(len(memory)), syscall.MS_SYNC)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
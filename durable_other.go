@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package bufioprop
+
+import "os"
+
+// durableSupported reports whether durable pipes can be opened on this platform.
+const durableSupported = false
+
+func lockFile(file *os.File) error                    { return errDurableUnsupported }
+func mapFile(file *os.File, size int) ([]byte, error) { return nil, errDurableUnsupported }
+func unmapFile(memory []byte) error                   { return errDurableUnsupported }
+func syncFile(memory []byte) error                    { return errDurableUnsupported }
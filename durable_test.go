@@ -0,0 +1,199 @@
+//go:build linux || darwin
+
+package bufioprop
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Tests that a durable pipe retains unconsumed data across reopens, including
+// when the stream wraps around the end of the buffer.
+func TestDurablePipe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe")
+
+	pipe, err := OpenDurablePipe(path, 16)
+	if err != nil {
+		t.Fatalf("failed to create durable pipe: %v", err)
+	}
+	// Push some data through, leaving part of it unconsumed
+	if _, err := pipe.Writer().Write([]byte("hello world, ")); err != nil {
+		t.Fatalf("failed to write data: %v", err)
+	}
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(pipe.Reader(), buf); err != nil || string(buf) != "hello " {
+		t.Fatalf("read mismatch: have %q/%v, want %q", buf, err, "hello ")
+	}
+	if err := pipe.Close(); err != nil {
+		t.Fatalf("failed to close durable pipe: %v", err)
+	}
+	// Reopen and append more data, wrapping the buffer
+	if pipe, err = OpenDurablePipe(path, 16); err != nil {
+		t.Fatalf("failed to reopen durable pipe: %v", err)
+	}
+	if _, err := pipe.Writer().Write([]byte("bye!")); err != nil {
+		t.Fatalf("failed to write data: %v", err)
+	}
+	pipe.Close()
+
+	if pipe, err = OpenDurablePipe(path, 16); err != nil {
+		t.Fatalf("failed to reopen durable pipe: %v", err)
+	}
+	defer pipe.Close()
+
+	buf = make([]byte, 11)
+	if _, err := io.ReadFull(pipe.Reader(), buf); err != nil || string(buf) != "world, bye!" {
+		t.Fatalf("read mismatch: have %q/%v, want %q", buf, err, "world, bye!")
+	}
+}
+
+// Tests that reopening a durable pipe with a different size is rejected.
+func TestDurablePipeSizeMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe")
+
+	pipe, err := OpenDurablePipe(path, 16)
+	if err != nil {
+		t.Fatalf("failed to create durable pipe: %v", err)
+	}
+	pipe.Close()
+
+	if _, err := OpenDurablePipe(path, 32); err != errDurableSize {
+		t.Fatalf("error mismatch: have %v, want %v", err, errDurableSize)
+	}
+}
+
+// Tests that invalid buffer sizes are rejected before touching the file system.
+func TestDurablePipeInvalidSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe")
+
+	for _, buffer := range []int{-1, -4096} {
+		if _, err := OpenDurablePipe(path, buffer); err != ErrInvalidBuffer {
+			t.Fatalf("buffer %d: error mismatch: have %v, want %v", buffer, err, ErrInvalidBuffer)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("buffer %d: file created for invalid pipe: %v", buffer, err)
+		}
+	}
+}
+
+// Tests that a zero buffer size creates the durable pipe with the default size.
+func TestDurablePipeDefaultSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe")
+
+	pipe, err := OpenDurablePipe(path, 0)
+	if err != nil {
+		t.Fatalf("failed to create durable pipe: %v", err)
+	}
+	if size := pipe.Writer().Cap(); size != DefaultBufferSize {
+		t.Fatalf("buffer size mismatch: have %d, want %d", size, DefaultBufferSize)
+	}
+	pipe.Close()
+
+	// Reopening with the explicit default size should match the file
+	if pipe, err = OpenDurablePipe(path, DefaultBufferSize); err != nil {
+		t.Fatalf("failed to reopen durable pipe: %v", err)
+	}
+	pipe.Close()
+}
+
+// Tests that durable pipes with secure wiping only wipe the consumed data, keeping
+// the unread data across reopens.
+func TestDurablePipeSecureWipe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe")
+
+	pipe, err := OpenDurablePipe(path, 32, WithSecureWipe())
+	if err != nil {
+		t.Fatalf("failed to create durable pipe: %v", err)
+	}
+	if _, err := pipe.Writer().Write([]byte("secret hello world")); err != nil {
+		t.Fatalf("failed to write data: %v", err)
+	}
+	buf := make([]byte, 7)
+	if _, err := io.ReadFull(pipe.Reader(), buf); err != nil || string(buf) != "secret " {
+		t.Fatalf("read mismatch: have %q/%v, want %q", buf, err, "secret ")
+	}
+	pipe.Close()
+
+	// The consumed data should be gone from the file, the rest retained
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read pipe file: %v", err)
+	}
+	if string(blob[durableHeader:durableHeader+18]) != "\x00\x00\x00\x00\x00\x00\x00hello world" {
+		t.Fatalf("file contents mismatch: have %q", blob[durableHeader:durableHeader+18])
+	}
+	if pipe, err = OpenDurablePipe(path, 32, WithSecureWipe()); err != nil {
+		t.Fatalf("failed to reopen durable pipe: %v", err)
+	}
+	defer pipe.Close()
+
+	buf = make([]byte, 11)
+	if _, err := io.ReadFull(pipe.Reader(), buf); err != nil || string(buf) != "hello world" {
+		t.Fatalf("reopened read mismatch: have %q/%v, want %q", buf, err, "hello world")
+	}
+}
+
+// Tests that a durable pipe's file can't be opened by a second pipe while in use,
+// and that it's released on close.
+func TestDurablePipeLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe")
+
+	pipe, err := OpenDurablePipe(path, 16)
+	if err != nil {
+		t.Fatalf("failed to create durable pipe: %v", err)
+	}
+	if _, err := OpenDurablePipe(path, 16); err != errDurableLocked {
+		t.Fatalf("error mismatch: have %v, want %v", err, errDurableLocked)
+	}
+	pipe.Close()
+
+	if pipe, err = OpenDurablePipe(path, 16); err != nil {
+		t.Fatalf("failed to reopen durable pipe: %v", err)
+	}
+	pipe.Close()
+}
+
+// Tests that the stream positions are persisted little endian, independent of the
+// host's byte order.
+func TestDurablePipeEndianness(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe")
+
+	pipe, err := OpenDurablePipe(path, 16)
+	if err != nil {
+		t.Fatalf("failed to create durable pipe: %v", err)
+	}
+	if _, err := pipe.Writer().Write([]byte("hello world")); err != nil {
+		t.Fatalf("failed to write data: %v", err)
+	}
+	if _, err := io.ReadFull(pipe.Reader(), make([]byte, 6)); err != nil {
+		t.Fatalf("failed to read data: %v", err)
+	}
+	pipe.Close()
+
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read pipe file: %v", err)
+	}
+	if head, tail := binary.LittleEndian.Uint64(blob[16:]), binary.LittleEndian.Uint64(blob[24:]); head != 11 || tail != 6 {
+		t.Fatalf("position mismatch: have (%d, %d), want (%d, %d)", head, tail, 11, 6)
+	}
+}
+
+// Tests that options managing the pipe's memory are rejected before touching the
+// file system.
+func TestDurablePipeOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe")
+
+	for i, opt := range []Option{WithBlockWrites(4, false), WithBudget(NewBufferBudget(1024, false)), WithIdleRelease(time.Second)} {
+		if _, err := OpenDurablePipe(path, 16, opt); err != errDurableOption {
+			t.Fatalf("option %d: error mismatch: have %v, want %v", i, err, errDurableOption)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("option %d: file created for invalid pipe: %v", i, err)
+		}
+	}
+}
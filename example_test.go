@@ -0,0 +1,77 @@
+package bufioprop_test
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"github.com/karalabe/bufioprop"
+)
+
+// Event is a sample message streamed through the pipe by the examples.
+type Event struct {
+	ID   int
+	Name string
+}
+
+// Decouples gob serialization from its consumer. The pipe implements io.ByteReader
+// so the decoder reads it directly, without an extra layer of buffering.
+func ExamplePipe_gob() {
+	r, w := bufioprop.Pipe(64 * 1024)
+
+	go func() {
+		enc := gob.NewEncoder(w)
+		for i := 0; i < 3; i++ {
+			if err := enc.Encode(&Event{ID: i, Name: fmt.Sprintf("event-%d", i)}); err != nil {
+				w.CloseWithError(err)
+				return
+			}
+		}
+		w.Close()
+	}()
+	dec := gob.NewDecoder(r)
+	for {
+		var event Event
+		if err := dec.Decode(&event); err != nil {
+			break
+		}
+		fmt.Println(event.ID, event.Name)
+	}
+	r.Close()
+
+	// Output:
+	// 0 event-0
+	// 1 event-1
+	// 2 event-2
+}
+
+// Decouples JSON serialization from its consumer, streaming newline delimited
+// values through the pipe.
+func ExamplePipe_json() {
+	r, w := bufioprop.Pipe(64 * 1024)
+
+	go func() {
+		enc := json.NewEncoder(w)
+		for i := 0; i < 3; i++ {
+			if err := enc.Encode(&Event{ID: i, Name: fmt.Sprintf("event-%d", i)}); err != nil {
+				w.CloseWithError(err)
+				return
+			}
+		}
+		w.Close()
+	}()
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		var event Event
+		if err := dec.Decode(&event); err != nil {
+			break
+		}
+		fmt.Println(event.ID, event.Name)
+	}
+	r.Close()
+
+	// Output:
+	// 0 event-0
+	// 1 event-1
+	// 2 event-2
+}
@@ -0,0 +1,85 @@
+package bufioprop
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrShortTransfer is wrapped by the TransferError returned by CopyExpect if
+	// the source ran dry before delivering the expected number of bytes.
+	ErrShortTransfer = errors.New("bufio: short transfer")
+
+	// ErrLongTransfer is wrapped by the TransferError returned by CopyExpect if
+	// the source had more data than the expected number of bytes.
+	ErrLongTransfer = errors.New("bufio: long transfer")
+)
+
+// TransferError is returned by CopyExpect when the length of the source doesn't
+// match the expected one. It wraps either ErrShortTransfer or ErrLongTransfer.
+type TransferError struct {
+	Transferred int64 // Number of bytes delivered by the source (stopping one past the expected)
+	Expected    int64 // Number of bytes expected to be delivered
+}
+
+// Error implements the error interface.
+func (e *TransferError) Error() string {
+	return fmt.Sprintf("bufio: transferred %d bytes, expected %d", e.Transferred, e.Expected)
+}
+
+// Unwrap returns ErrShortTransfer or ErrLongTransfer, depending on the direction
+// of the mismatch, making the error checkable via errors.Is.
+func (e *TransferError) Unwrap() error {
+	if e.Transferred < e.Expected {
+		return ErrShortTransfer
+	}
+	return ErrLongTransfer
+}
+
+// CopyExpect copies exactly expected bytes from src to dst, verifying that the
+// source holds neither less nor more, as when downloading content of a known
+// length. The internal buffer is capped to the expected length.
+//
+// No more than expected bytes are ever written into dst. If the source ends short
+// or has data beyond the expected length, a *TransferError is returned. Any other
+// failure during the copy is returned as is.
+//
+// If WithUnexpectedEOF is set, a source ending short is reported the same way as
+// by io.ReadFull instead: io.EOF if it held no data at all, io.ErrUnexpectedEOF
+// otherwise.
+func CopyExpect(dst io.Writer, src io.Reader, expected int64, buffer int, opts ...Option) (written int64, err error) {
+	c := newConfig(opts)
+	if c.ownSrc {
+		// The source is probed for excess data after the copy, close it only then
+		defer closeReader(src)
+		opts = append(opts[:len(opts):len(opts)], func(c *config) { c.ownSrc = false })
+	}
+	limited := &io.LimitedReader{R: src, N: expected}
+	if written, err = Copy(dst, limited, buffer, opts...); err != nil {
+		return written, err
+	}
+	if written < expected {
+		if c.unexpectedEOF {
+			if written == 0 {
+				return 0, io.EOF
+			}
+			return written, io.ErrUnexpectedEOF
+		}
+		return written, &TransferError{Transferred: written, Expected: expected}
+	}
+	// Source delivered the expected amount, ensure there's nothing more
+	for empty := 0; empty < defaultEmptyReads; empty++ {
+		n, err := src.Read(make([]byte, 1))
+		if n > 0 {
+			return written, &TransferError{Transferred: written + int64(n), Expected: expected}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, io.ErrNoProgress
+}
@@ -0,0 +1,66 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// Tests that copies of an expected length verify the source's length.
+func TestCopyExpect(t *testing.T) {
+	data := testData[:1024*1024]
+
+	// Exact length, all data copied
+	dst := new(bytes.Buffer)
+	if n, err := CopyExpect(dst, bytes.NewReader(data), int64(len(data)), 4096); err != nil || n != int64(len(data)) {
+		t.Fatalf("result mismatch: have (%d, %v), want (%d, nil)", n, err, len(data))
+	}
+	if !bytes.Equal(dst.Bytes(), data) {
+		t.Fatalf("data mismatch")
+	}
+	// Short source, all data copied, but the transfer flagged
+	dst.Reset()
+	n, err := CopyExpect(dst, bytes.NewReader(data[:1000]), 1001, 4096)
+	if !errors.Is(err, ErrShortTransfer) {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrShortTransfer)
+	}
+	if terr := err.(*TransferError); terr.Transferred != 1000 || terr.Expected != 1001 || n != 1000 {
+		t.Fatalf("transfer mismatch: have %+v (%d written)", terr, n)
+	}
+	// Long source, only the expected data copied, and the transfer flagged
+	dst.Reset()
+	n, err = CopyExpect(dst, bytes.NewReader(data[:1001]), 1000, 4096)
+	if !errors.Is(err, ErrLongTransfer) {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrLongTransfer)
+	}
+	if n != 1000 || !bytes.Equal(dst.Bytes(), data[:1000]) {
+		t.Fatalf("data mismatch: have %d bytes, want %d", n, 1000)
+	}
+}
+
+// Tests that short sources can be reported with io.ReadFull semantics.
+func TestCopyExpectUnexpectedEOF(t *testing.T) {
+	data := testData[:1000]
+
+	tests := []struct {
+		size     int
+		expected int64
+		want     error
+	}{
+		{0, 1000, io.EOF},
+		{999, 1000, io.ErrUnexpectedEOF},
+		{1000, 1000, nil},
+		{0, 0, nil},
+	}
+	for i, tt := range tests {
+		n, err := CopyExpect(io.Discard, bytes.NewReader(data[:tt.size]), tt.expected, 4096, WithUnexpectedEOF())
+		if n != int64(tt.size) || err != tt.want {
+			t.Errorf("test %d: result mismatch: have (%d, %v), want (%d, %v)", i, n, err, tt.size, tt.want)
+		}
+	}
+	// Long sources are still flagged as such
+	if _, err := CopyExpect(io.Discard, bytes.NewReader(data), 999, 4096, WithUnexpectedEOF()); !errors.Is(err, ErrLongTransfer) {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrLongTransfer)
+	}
+}
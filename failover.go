@@ -0,0 +1,108 @@
+package bufioprop
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNoDestinations is returned by CopyFailover if it's given no destinations.
+var ErrNoDestinations = errors.New("bufio: no destinations to copy into")
+
+// CopyFailover copies from src into the first of dsts until either EOF is reached
+// on src or an error occurs, switching over to the next destination whenever the
+// active one fails (or accepts a short write). It returns the number of bytes of
+// the stream delivered and the failure of the last destination if all of them
+// failed, or the source's error.
+//
+// The bytes not accepted by a failed destination are written into the next one.
+// As a failing destination may have lost data it reported accepted, the tail of
+// the stream it was sent can be replayed into the next one via
+// WithFailoverReplay, and the offset each destination resumes from observed via
+// WithFailoverHook.
+func CopyFailover(dsts []io.Writer, src io.Reader, buffer int, opts ...Option) (written int64, err error) {
+	if len(dsts) == 0 {
+		return 0, ErrNoDestinations
+	}
+	c := newConfig(opts)
+
+	f := &failoverWriter{dsts: dsts, hook: c.failHook}
+	if c.failReplay > 0 {
+		f.tail = make([]byte, 0, c.failReplay)
+	}
+	return copyPipe(f, src, buffer, c, func(pr *PipeReader) (int64, error) {
+		return io.Copy(f, pr)
+	})
+}
+
+// failoverWriter is a writer forwarding into a list of destinations, switching to
+// the next one on failure, retaining the tail of the stream for replaying it.
+type failoverWriter struct {
+	dsts   []io.Writer // Destinations to write into, in order of preference
+	active int         // Index of the destination currently written into
+	offset int64       // Number of stream bytes accepted so far
+
+	tail []byte                                    // Most recently written bytes, replayed on failover
+	hook func(failed int, err error, offset int64) // Callback notified of switchovers (nil = none)
+}
+
+// Write forwards data into the active destination, failing over to the next ones
+// until it's accepted or all destinations are exhausted.
+func (f *failoverWriter) Write(b []byte) (written int, err error) {
+	for {
+		n, err := writeFull(f.dsts[f.active], b)
+		f.retain(b[:n])
+		f.offset += int64(n)
+
+		written, b = written+n, b[n:]
+		if err == nil {
+			return written, nil
+		}
+		if err = f.failover(err); err != nil {
+			return written, err
+		}
+	}
+}
+
+// failover switches to the next live destination, replaying the retained tail of
+// the stream into it. It returns the last failure if none remain.
+func (f *failoverWriter) failover(err error) error {
+	for f.active+1 < len(f.dsts) {
+		f.active++
+		if f.hook != nil {
+			f.hook(f.active-1, err, f.offset-int64(len(f.tail)))
+		}
+		if _, err = writeFull(f.dsts[f.active], f.tail); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// retain appends a chunk of written data into the replay tail, discarding the
+// oldest data beyond the tail's capacity.
+func (f *failoverWriter) retain(b []byte) {
+	window := cap(f.tail)
+	if window == 0 {
+		return
+	}
+	if len(b) >= window {
+		f.tail = append(f.tail[:0], b[len(b)-window:]...)
+		return
+	}
+	if drop := len(f.tail) + len(b) - window; drop > 0 {
+		f.tail = f.tail[:copy(f.tail, f.tail[drop:])]
+	}
+	f.tail = append(f.tail, b...)
+}
+
+// writeFull writes a chunk into w, converting short writes into failures.
+func writeFull(w io.Writer, b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	n, err := w.Write(b)
+	if err == nil && n < len(b) {
+		err = &ShortWriteError{Written: n, Wanted: len(b)}
+	}
+	return n, err
+}
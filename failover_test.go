@@ -0,0 +1,66 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// Tests that copies fail over to the next destination, replaying the retained
+// tail of the stream into it.
+func TestCopyFailover(t *testing.T) {
+	for _, window := range []int{0, 100, 10000} {
+		var (
+			primary   = errors.New("primary failure")
+			secondary = errors.New("secondary failure")
+			mirror    = new(bytes.Buffer)
+			offsets   []int64
+			failures  []error
+		)
+		dsts := []io.Writer{
+			&failingWriter{limit: 3000, err: primary},
+			&failingWriter{limit: 50000, err: secondary},
+			mirror,
+		}
+		hook := func(failed int, err error, offset int64) {
+			if failed != len(failures) {
+				t.Errorf("window %d: failed destination mismatch: have %d, want %d", window, failed, len(failures))
+			}
+			offsets, failures = append(offsets, offset), append(failures, err)
+		}
+		data := testData[:1000000]
+		n, err := CopyFailover(dsts, bytes.NewReader(data), 1024, WithFailoverReplay(window), WithFailoverHook(hook))
+		if err != nil {
+			t.Fatalf("window %d: failed to copy: %v", window, err)
+		}
+		if n != int64(len(data)) {
+			t.Fatalf("window %d: written mismatch: have %d, want %d", window, n, len(data))
+		}
+		if len(failures) != 2 || failures[0] != primary || failures[1] != secondary {
+			t.Fatalf("window %d: failures mismatch: have %v", window, failures)
+		}
+		// Each destination resumes the stream from the replayed tail of the failed one
+		first := int64(3000 - min(window, 3000))
+		want := []int64{first, first + int64(50000-min(window, 50000))}
+		if offsets[0] != want[0] || offsets[1] != want[1] {
+			t.Fatalf("window %d: offsets mismatch: have %v, want %v", window, offsets, want)
+		}
+		if !bytes.Equal(mirror.Bytes(), data[offsets[1]:]) {
+			t.Fatalf("window %d: mirror data mismatch: have %d bytes, want %d", window, mirror.Len(), int64(len(data))-offsets[1])
+		}
+	}
+}
+
+// Tests that copies fail once all the destinations failed.
+func TestCopyFailoverExhausted(t *testing.T) {
+	fail := errors.New("destination failure")
+
+	dsts := []io.Writer{&failingWriter{limit: 1000, err: errors.New("primary failure")}, &failingWriter{limit: 1000, err: fail}}
+	if n, err := CopyFailover(dsts, bytes.NewReader(testData[:100000]), 1024); n != 2000 || err != fail {
+		t.Fatalf("result mismatch: have (%d, %v), want (2000, %v)", n, err, fail)
+	}
+	if _, err := CopyFailover(nil, bytes.NewReader(testData[:100]), 1024); err != ErrNoDestinations {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrNoDestinations)
+	}
+}
@@ -0,0 +1,67 @@
+package bufioprop
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrSameFile is returned by CopyFile, wrapped into an *os.PathError, if the
+// source and destination paths refer to the same file.
+var ErrSameFile = errors.New("bufio: source and destination are the same file")
+
+// CopyFile copies the contents of the file at path src into the file at path dst
+// through a buffered copy, returning the number of bytes copied and the first
+// error encountered. The destination is created if needed (truncated otherwise),
+// and its permission bits are set to those of the source.
+//
+// The internal buffer is capped to the size of regular source files. Filesystem
+// errors are returned as is, i.e. as *os.PathError detailing the operation and
+// the file it failed on. On failure, the destination is left partially written.
+//
+// The destination is synced to stable storage before returning if WithFileSync is
+// set, and io_uring is used for the transfer if WithIOUring is.
+func CopyFile(dst, src string, buffer int, opts ...Option) (written int64, err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if dinfo, err := os.Stat(dst); err == nil && os.SameFile(info, dinfo) {
+		return 0, &os.PathError{Op: "copy", Path: dst, Err: ErrSameFile}
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	// The creation mode only applies to new files and is subject to the umask
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		return 0, err
+	}
+	c := newConfig(opts)
+	if info.Mode().IsRegular() {
+		buffer = capBuffer(info.Size(), buffer)
+		if c.meter != nil {
+			c.meter.Expect(info.Size())
+		}
+	}
+	c.ownSrc, c.ownDst = false, false // files are closed above
+
+	written, err = copyPipe(out, in, buffer, c, func(pr *PipeReader) (int64, error) {
+		return io.Copy(out, pr)
+	})
+	if err == nil && c.fileSync {
+		err = out.Sync()
+	}
+	return written, err
+}
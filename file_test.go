@@ -0,0 +1,50 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Tests that files are copied along with their permissions.
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+
+	data := testData[:1000000]
+	if err := os.WriteFile(src, data, 0o640); err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+	// Existing destinations should be truncated and get the source's permissions
+	if err := os.WriteFile(dst, testData[:2000000], 0o600); err != nil {
+		t.Fatalf("failed to create destination: %v", err)
+	}
+	n, err := CopyFile(dst, src, 64*1024, WithFileSync())
+	if err != nil {
+		t.Fatalf("failed to copy file: %v", err)
+	}
+	have, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("failed to read destination: %v", err)
+	}
+	if n != int64(len(data)) || !bytes.Equal(have, data) {
+		t.Fatalf("data mismatch: have %d bytes (reported %d), want %d", len(have), n, len(data))
+	}
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(dst); err != nil || info.Mode().Perm() != 0o640 {
+			t.Fatalf("permission mismatch: have %v (%v), want %v", info.Mode().Perm(), err, os.FileMode(0o640))
+		}
+	}
+	// Copying a file onto itself should be refused
+	if _, err := CopyFile(src, src, 1024); !errors.Is(err, ErrSameFile) {
+		t.Fatalf("same file error mismatch: have %v, want %v", err, ErrSameFile)
+	}
+	// Missing sources should be reported with their path
+	var perr *os.PathError
+	if _, err := CopyFile(dst, filepath.Join(dir, "missing"), 1024); !errors.As(err, &perr) || !os.IsNotExist(err) {
+		t.Fatalf("missing source error mismatch: have %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package bufioprop
+
+import (
+	"bytes"
+	"io"
+)
+
+// A flusher is a destination buffering data internally until explicitly flushed,
+// such as a *bufio.Writer.
+type flusher interface {
+	Flush() error
+}
+
+// FlushInto attaches the flusher of the destination to the pipe, if it supports
+// flushing and a flush policy was configured.
+func (p *pipe) flushInto(w io.Writer) {
+	if !p.flushIdle && p.flushDelim < 0 {
+		return
+	}
+	if f, ok := w.(flusher); ok {
+		p.flush = f.Flush
+	}
+}
+
+// FlushWritten records that b was successfully written into a flushable
+// destination, flushing it if b contains a record boundary.
+func (p *pipe) flushWritten(b []byte) error {
+	p.dirty = true
+	if p.flushDelim >= 0 && bytes.IndexByte(b, byte(p.flushDelim)) >= 0 {
+		return p.flushOut()
+	}
+	return nil
+}
+
+// finalizeOut flushes and/or closes the destination of a successful copy, if it
+// supports it and it was requested.
+func finalizeOut(w io.Writer, c *config) error {
+	if f, ok := w.(flusher); ok && c.flushDone {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	if cl, ok := w.(io.Closer); ok && c.closeDone {
+		return cl.Close()
+	}
+	return nil
+}
+
+// FlushOut flushes the destination, pushing out any data held in its buffer.
+func (p *pipe) flushOut() error {
+	p.dirty = false
+	return p.flush()
+}
@@ -0,0 +1,137 @@
+package bufioprop
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes and reads.
+type syncBuffer struct {
+	buf  bytes.Buffer
+	lock sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+// waitContent polls a buffer until it contains the wanted content or times out.
+func waitContent(t *testing.T, buf *syncBuffer, want string) {
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		if buf.String() == want {
+			return
+		}
+	}
+	t.Fatalf("content mismatch: have %q, want %q", buf.String(), want)
+}
+
+// Tests that buffered destinations are flushed when the source stalls.
+func TestCopyFlushOnIdle(t *testing.T) {
+	sink := new(syncBuffer)
+	src, feed := io.Pipe()
+
+	errc := make(chan error)
+	go func() {
+		_, err := Copy(bufio.NewWriter(sink), src, 1024, WithFlushOnIdle())
+		errc <- err
+	}()
+	feed.Write([]byte("hello"))
+	waitContent(t, sink, "hello")
+
+	feed.Write([]byte(" world"))
+	waitContent(t, sink, "hello world")
+
+	feed.Close()
+	if err := <-errc; err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+}
+
+// Tests that buffered destinations are flushed after record boundaries.
+func TestCopyFlushOnDelim(t *testing.T) {
+	sink := new(syncBuffer)
+	src, feed := io.Pipe()
+
+	errc := make(chan error)
+	go func() {
+		_, err := CopyLines(bufio.NewWriter(sink), src, 1024, func(line []byte) ([]byte, error) {
+			return line, nil
+		}, WithFlushOnDelim('\n'))
+		errc <- err
+	}()
+	feed.Write([]byte("first\nsec"))
+	waitContent(t, sink, "first\n")
+
+	feed.Write([]byte("ond\n"))
+	waitContent(t, sink, "first\nsecond\n")
+
+	feed.Close()
+	if err := <-errc; err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+}
+
+// Tests that destinations are flushed and closed after successful copies, but not
+// after failed ones.
+func TestCopyFinalizeOnSuccess(t *testing.T) {
+	data := testData[:100000]
+
+	// Buffered writers should be flushed (hide the sink's ReadFrom, otherwise the
+	// buffered writer would pass the data straight through)
+	sink := new(bytes.Buffer)
+	if _, err := Copy(bufio.NewWriterSize(struct{ io.Writer }{sink}, 64*1024), bytes.NewReader(data), 1024, WithFlushOnSuccess()); err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+	if !bytes.Equal(sink.Bytes(), data) {
+		t.Fatalf("flushed data mismatch: have %d bytes, want %d", sink.Len(), len(data))
+	}
+	// Compressors should be closed, emitting their trailers
+	sink.Reset()
+	if _, err := Copy(gzip.NewWriter(sink), bytes.NewReader(data), 1024, WithCloseOnSuccess()); err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+	zr, err := gzip.NewReader(sink)
+	if err != nil {
+		t.Fatalf("failed to open compressed stream: %v", err)
+	}
+	if have, err := io.ReadAll(zr); err != nil || !bytes.Equal(have, data) {
+		t.Fatalf("compressed data mismatch: have (%d bytes, %v), want (%d bytes, nil)", len(have), err, len(data))
+	}
+	// Failed copies should leave the destination alone
+	sink.Reset()
+	errSource := errors.New("source failure")
+	if _, err := Copy(bufio.NewWriterSize(struct{ io.Writer }{sink}, 64*1024), io.MultiReader(bytes.NewReader(data[:1000]), iotest.ErrReader(errSource)), 1024, WithFlushOnSuccess()); err != errSource {
+		t.Fatalf("error mismatch: have %v, want %v", err, errSource)
+	}
+	if sink.Len() != 0 {
+		t.Fatalf("failed copy flushed %d bytes", sink.Len())
+	}
+	// Finalization failures should be reported
+	errFlush := errors.New("flush failure")
+	if _, err := Copy(&failingFlusher{err: errFlush}, bytes.NewReader(data), 1024, WithFlushOnSuccess()); err != errFlush {
+		t.Fatalf("flush error mismatch: have %v, want %v", err, errFlush)
+	}
+}
+
+// failingFlusher is a destination accepting all writes, but failing to flush.
+type failingFlusher struct {
+	err error
+}
+
+func (f *failingFlusher) Write(b []byte) (int, error) { return len(b), nil }
+func (f *failingFlusher) Flush() error                { return f.err }
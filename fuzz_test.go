@@ -0,0 +1,145 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+var errFuzz = errors.New("fuzz failure")
+
+// Fuzzes the pipe by driving its two halves concurrently with random chunk sizes
+// and termination modes, verifying that no bytes are lost, duplicated or reordered
+// and that the correct errors are reported:
+//
+//   - mode 0: the writer closes cleanly, the reader must see all data and EOF
+//   - mode 1: the writer closes with an error, the reader must see all data and it
+//   - mode 2: the reader bails out early, the writer must see ErrClosedPipe (if
+//     it still had data to write) and the reader a prefix of the data
+func FuzzPipe(f *testing.F) {
+	f.Add(uint16(0), []byte{0}, []byte{0}, uint8(0))
+	f.Add(uint16(6), []byte{1, 2, 3, 255}, []byte{3, 2, 1}, uint8(1))
+	f.Add(uint16(333), []byte{255, 255, 255, 7}, []byte{17, 1}, uint8(2))
+
+	f.Fuzz(func(t *testing.T, buffer uint16, writes []byte, reads []byte, mode uint8) {
+		if len(writes) == 0 || len(reads) == 0 {
+			return
+		}
+		mode %= 3
+
+		var total int
+		for _, size := range writes {
+			total += int(size) + 1
+		}
+		data := testData[:total]
+
+		r, w := Pipe(1 + int(buffer)%4096)
+
+		errc := make(chan error, 1)
+		go func() {
+			var failure error
+			for rest, i := data, 0; len(rest) > 0; i++ {
+				size := int(writes[i]) + 1
+				if _, err := w.Write(rest[:size]); err != nil {
+					failure = err
+					break
+				}
+				rest = rest[size:]
+			}
+			if mode == 1 {
+				w.CloseWithError(errFuzz)
+			} else {
+				w.Close()
+			}
+			errc <- failure
+		}()
+		var (
+			have  []byte
+			chunk = make([]byte, 256)
+			err   error
+		)
+		for i := 0; ; i++ {
+			if mode == 2 && i == len(reads) {
+				r.Close()
+				break
+			}
+			var n int
+			n, err = r.Read(chunk[:int(reads[i%len(reads)])+1])
+			have = append(have, chunk[:n]...)
+			if err != nil {
+				break
+			}
+		}
+		werr := <-errc
+
+		if !bytes.Equal(have, data[:len(have)]) {
+			t.Fatalf("corrupt data on the output")
+		}
+		switch mode {
+		case 0, 1:
+			want := io.EOF
+			if mode == 1 {
+				want = errFuzz
+			}
+			if err != want {
+				t.Fatalf("read error mismatch: have %v, want %v", err, want)
+			}
+			if len(have) != len(data) {
+				t.Fatalf("data length mismatch: have %d, want %d", len(have), len(data))
+			}
+			if werr != nil {
+				t.Fatalf("failed to write: %v", werr)
+			}
+		case 2:
+			if werr != nil && werr != ErrClosedPipe {
+				t.Fatalf("write error mismatch: have %v, want %v", werr, ErrClosedPipe)
+			}
+		}
+	})
+}
+
+// chunkedReader is a reader returning data in chunks of scripted sizes.
+type chunkedReader struct {
+	data   []byte
+	chunks []byte
+	next   int
+}
+
+func (r *chunkedReader) Read(b []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	size := int(r.chunks[r.next%len(r.chunks)]) + 1
+	r.next++
+
+	if size < len(b) {
+		b = b[:size]
+	}
+	n := copy(b, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// Fuzzes the buffered copy with random buffer sizes and source chunking, verifying
+// that all the data arrives intact.
+func FuzzCopy(f *testing.F) {
+	f.Add(uint16(0), uint32(1024), []byte{0})
+	f.Add(uint16(333), uint32(100000), []byte{1, 255, 17})
+
+	f.Fuzz(func(t *testing.T, buffer uint16, length uint32, chunks []byte) {
+		if len(chunks) == 0 {
+			return
+		}
+		data := testData[:length%(1024*1024)]
+
+		dst := new(bytes.Buffer)
+		n, err := Copy(dst, &chunkedReader{data: data, chunks: chunks}, 1+int(buffer)%65536)
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		if n != int64(len(data)) || !bytes.Equal(dst.Bytes(), data) {
+			t.Fatalf("data mismatch: have %d bytes, want %d", n, len(data))
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package bufioprop
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrCopyCanceled is returned by the copies of a group which were interrupted by
+// a cancellation before completing.
+var ErrCopyCanceled = errors.New("bufio: copy canceled")
+
+// CopyResult is the outcome of a single copy started within a group.
+type CopyResult struct {
+	Name    string // Name of the copy, as set via WithName
+	Written int64  // Number of bytes written into the destination
+	Err     error  // Failure of the copy, if any
+	Done    bool   // Whether the copy terminated (false = still running)
+}
+
+// A CopyGroup tracks a collection of concurrently running copies, permitting all
+// of them to be canceled at once and waited on, collecting their results. It is
+// meant to implement the graceful shutdown of servers relaying many streams.
+type CopyGroup struct {
+	results []*CopyResult  // Outcomes of all the copies, in their start order
+	cancel  chan struct{}  // Channel closed to cancel all the copies
+	pending sync.WaitGroup // Copies still in progress
+
+	lock sync.Mutex // Lock protecting the results and the cancellation
+}
+
+// NewCopyGroup creates an empty group of copies.
+func NewCopyGroup() *CopyGroup {
+	return &CopyGroup{
+		cancel: make(chan struct{}),
+	}
+}
+
+// Go starts copying from src to dst on a new goroutine, tracked by the group. The
+// semantics are the same as for Copy. If the group was already canceled, the copy
+// is not started and fails with ErrCopyCanceled.
+func (g *CopyGroup) Go(dst io.Writer, src io.Reader, buffer int, opts ...Option) {
+	c := newConfig(opts)
+	c.cancel = &canceler{
+		done:  g.cancel,
+		err:   func() error { return ErrCopyCanceled },
+		close: true,
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	res := &CopyResult{Name: c.name}
+	g.results = append(g.results, res)
+
+	if closed(g.cancel) {
+		res.Err, res.Done = ErrCopyCanceled, true
+		return
+	}
+	g.pending.Add(1)
+	go func() {
+		defer g.pending.Done()
+
+		written, err := copyPipe(dst, src, buffer, c, func(pr *PipeReader) (int64, error) {
+			return io.Copy(dst, pr)
+		})
+		g.lock.Lock()
+		res.Written, res.Err, res.Done = written, err, true
+		g.lock.Unlock()
+	}()
+}
+
+// Cancel interrupts all the running copies of the group, and any started later.
+// The internal pipes are torn down, and the endpoints are unblocked from pending
+// reads or writes by expiring their deadlines if supported (e.g. net.Conn), or
+// closing them if they implement io.Closer. Canceled copies terminate with
+// ErrCopyCanceled, whereas the completed ones retain their results.
+func (g *CopyGroup) Cancel() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if !closed(g.cancel) {
+		close(g.cancel)
+	}
+}
+
+// Wait blocks until all the copies of the group terminate, or the timeout expires
+// (0 = wait indefinitely). It returns the results of all the copies in the order
+// they were started, the ones still running marked as not done, along with the
+// flag whether all copies have completed.
+func (g *CopyGroup) Wait(timeout time.Duration) ([]CopyResult, bool) {
+	done := make(chan struct{})
+	go func() {
+		g.pending.Wait()
+		close(done)
+	}()
+	var expire <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expire = timer.C
+	}
+	select {
+	case <-done:
+	case <-expire:
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	results, complete := make([]CopyResult, len(g.results)), true
+	for i, res := range g.results {
+		results[i] = *res
+		complete = complete && res.Done
+	}
+	return results, complete
+}
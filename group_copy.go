@@ -0,0 +1,30 @@
+package bufioprop
+
+import "io"
+
+// A Spawner runs goroutines on behalf of a copy, owning their lifetimes. It is
+// satisfied by *errgroup.Group from golang.org/x/sync, and any other structured
+// concurrency primitive tracking the goroutines it starts.
+type Spawner interface {
+	Go(fn func() error)
+}
+
+// CopyWithGroup copies from src to dst similarly to Copy, but starts the producer
+// goroutine reading the source through the given spawner (e.g. an errgroup), so
+// its lifetime is tracked by the caller's group instead of being left orphaned.
+// The consumer runs on the calling goroutine, as with Copy.
+//
+// The copy's error is returned to the caller only, the spawned goroutine always
+// reports success to the group; return the copy's error from a goroutine of the
+// group to cancel it on failure.
+//
+// As with all copies, a panic in the source is recovered on the producer goroutine
+// and returned as a *PanicError, so the group never sees it.
+func CopyWithGroup(g Spawner, dst io.Writer, src io.Reader, buffer int, opts ...Option) (written int64, err error) {
+	c := newConfig(opts)
+	c.group = g
+
+	return copyPipe(dst, src, buffer, c, func(pr *PipeReader) (int64, error) {
+		return io.Copy(dst, pr)
+	})
+}
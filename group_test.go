@@ -0,0 +1,153 @@
+package bufioprop
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Tests that a group collects the results of its copies in their start order.
+func TestCopyGroupWait(t *testing.T) {
+	group := NewCopyGroup()
+
+	dsts := make([]*bytes.Buffer, 4)
+	for i := range dsts {
+		dsts[i] = new(bytes.Buffer)
+		group.Go(dsts[i], bytes.NewReader(testData[:(i+1)*1024*1024]), 64*1024, WithName(string(rune('a'+i))))
+	}
+	results, done := group.Wait(0)
+	if !done {
+		t.Fatalf("group not done after unbounded wait")
+	}
+	for i, res := range results {
+		if res.Err != nil || !res.Done {
+			t.Fatalf("copy %d: failed: %+v", i, res)
+		}
+		if want := string(rune('a' + i)); res.Name != want {
+			t.Fatalf("copy %d: name mismatch: have %s, want %s", i, res.Name, want)
+		}
+		if res.Written != int64((i+1)*1024*1024) || !bytes.Equal(dsts[i].Bytes(), testData[:(i+1)*1024*1024]) {
+			t.Fatalf("copy %d: data mismatch: written %d", i, res.Written)
+		}
+	}
+}
+
+// Tests that canceling a group interrupts copies blocked on their endpoints, as
+// long as those are closable, and that later copies fail outright.
+func TestCopyGroupCancel(t *testing.T) {
+	group := NewCopyGroup()
+
+	src, sink := io.Pipe()
+	group.Go(new(bytes.Buffer), src, 1024)
+
+	if _, err := sink.Write(testData[:100]); err != nil {
+		t.Fatalf("failed to feed source: %v", err)
+	}
+	if _, done := group.Wait(50 * time.Millisecond); done {
+		t.Fatalf("group done with a stalled source")
+	}
+	group.Cancel()
+	group.Go(new(bytes.Buffer), bytes.NewReader(testData[:100]), 1024)
+
+	results, done := group.Wait(time.Second)
+	if !done {
+		t.Fatalf("group not done after cancellation")
+	}
+	for i, res := range results {
+		if res.Err != ErrCopyCanceled {
+			t.Fatalf("copy %d: error mismatch: have %v, want %v", i, res.Err, ErrCopyCanceled)
+		}
+	}
+	if results[0].Written != 100 {
+		t.Fatalf("written mismatch: have %d, want %d", results[0].Written, 100)
+	}
+}
+
+// waitSpawner is a minimal structured concurrency group, akin to errgroup.
+type waitSpawner struct {
+	pending sync.WaitGroup
+	started int
+}
+
+func (s *waitSpawner) Go(fn func() error) {
+	s.started++
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		fn()
+	}()
+}
+
+// waitTimeout waits for all goroutines of the spawner, failing after a timeout.
+func (s *waitSpawner) waitTimeout(t *testing.T) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("spawned goroutines leaked")
+	}
+}
+
+// panickingReader is a source which panics after yielding some data.
+type panickingReader struct {
+	left int
+}
+
+func (r *panickingReader) Read(b []byte) (int, error) {
+	if r.left == 0 {
+		panic("source exploded")
+	}
+	if len(b) > r.left {
+		b = b[:r.left]
+	}
+	r.left -= len(b)
+	return len(b), nil
+}
+
+// panickingWriter is a destination which panics on the first write.
+type panickingWriter struct{}
+
+func (panickingWriter) Write(b []byte) (int, error) { panic("sink exploded") }
+
+// Tests that copies run their producer within the caller's group, and that panics
+// on either side surface to the caller without leaking the producer.
+func TestCopyWithGroup(t *testing.T) {
+	group := new(waitSpawner)
+
+	dst := new(bytes.Buffer)
+	if n, err := CopyWithGroup(group, dst, bytes.NewReader(testData[:100000]), 1024); n != 100000 || err != nil {
+		t.Fatalf("result mismatch: have (%d, %v), want (%d, nil)", n, err, 100000)
+	}
+	if group.started != 1 {
+		t.Fatalf("spawned goroutine count mismatch: have %d, want 1", group.started)
+	}
+	group.waitTimeout(t)
+
+	// Source panics should be converted to errors
+	_, err := CopyWithGroup(group, io.Discard, &panickingReader{left: 5000}, 1024)
+	if perr, ok := err.(*PanicError); !ok || perr.Value != "source exploded" {
+		t.Fatalf("source panic mismatch: have %v, want %v", err, "source exploded")
+	}
+	group.waitTimeout(t)
+
+	// Sink panics should tear down the pipe, releasing an endless producer
+	recovered := func(fn func()) (r interface{}) {
+		defer func() { r = recover() }()
+		fn()
+		return nil
+	}
+	r := recovered(func() { CopyWithGroup(group, panickingWriter{}, &chunkReader{chunk: 1024, left: math.MaxInt64}, 1024) })
+	if r != "sink exploded" {
+		t.Fatalf("sink panic mismatch: have %v, want %v", r, "sink exploded")
+	}
+	group.waitTimeout(t)
+}
@@ -0,0 +1,224 @@
+// Package httpfetch downloads HTTP resources through buffered pipes, decoupling
+// the network from the destination, and resuming interrupted transfers via range
+// requests instead of starting over.
+package httpfetch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/karalabe/bufioprop"
+)
+
+var (
+	// ErrChecksum is returned if the downloaded content doesn't match the checksum
+	// configured via WithChecksum.
+	ErrChecksum = errors.New("httpfetch: checksum mismatch")
+
+	// ErrNoResume is returned if a transfer was interrupted, but the server doesn't
+	// support resuming it via range requests, doesn't provide a validator for the
+	// content, or the content changed since the transfer started.
+	ErrNoResume = errors.New("httpfetch: server cannot resume transfer")
+)
+
+// StatusError is returned if the server responds with an unexpected status.
+type StatusError struct {
+	Status string // Status line returned by the server
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("httpfetch: unexpected status: %s", e.Status)
+}
+
+// An Option configures optional behavior of a download.
+type Option func(*config)
+
+// config is the collection of tunables assembled from the user's options.
+type config struct {
+	client *http.Client // HTTP client to issue the requests with
+
+	progress func(written, total int64) // Callback to report the download progress to
+
+	hash hash.Hash // Hasher to feed the downloaded content into (nil = none)
+	sum  []byte    // Expected checksum of the content (nil = don't verify)
+
+	retries int           // Number of consecutive resumption attempts without progress
+	backoff time.Duration // Delay before the first resumption attempt
+
+	copts []bufioprop.Option // Options to pass to the underlying copy
+}
+
+// WithClient sets the HTTP client to issue the requests with. The default is
+// http.DefaultClient.
+func WithClient(client *http.Client) Option {
+	return func(c *config) {
+		c.client = client
+	}
+}
+
+// WithProgress sets a callback to report the download progress to, invoked after
+// every write into the destination with the number of bytes written so far and
+// the total length of the content (-1 if unknown).
+func WithProgress(fn func(written, total int64)) Option {
+	return func(c *config) {
+		c.progress = fn
+	}
+}
+
+// WithChecksum feeds the downloaded content into the hasher and, if sum is not
+// nil, verifies the final digest against it, failing with ErrChecksum otherwise.
+func WithChecksum(hasher hash.Hash, sum []byte) Option {
+	return func(c *config) {
+		c.hash, c.sum = hasher, sum
+	}
+}
+
+// WithRetries sets the number of consecutive attempts to resume an interrupted
+// transfer without making progress, and the initial delay between them (doubled
+// on every attempt). The default is 3 attempts with a 500ms initial delay.
+func WithRetries(attempts int, backoff time.Duration) Option {
+	return func(c *config) {
+		c.retries, c.backoff = attempts, backoff
+	}
+}
+
+// WithCopyOptions sets options to configure the underlying buffered copy with.
+func WithCopyOptions(opts ...bufioprop.Option) Option {
+	return func(c *config) {
+		c.copts = append(c.copts, opts...)
+	}
+}
+
+// FetchTo downloads the content at url into w, streaming it through a buffered
+// pipe so that the network and the destination run concurrently. It returns the
+// number of bytes written into w and the first error encountered.
+//
+// If the transfer is interrupted, it's resumed via a range request from where it
+// broke off, as long as the server supports it. Resumption is conditioned on the
+// content's ETag (or Last-Modified time, lacking one) via If-Range, so a changed
+// resource is never spliced onto the old one; without either validator, the
+// transfer can't be resumed. If the server announces the content length, the
+// download is verified to match it.
+func FetchTo(w io.Writer, url string, buffer int, opts ...Option) (int64, error) {
+	c := &config{
+		client:  http.DefaultClient,
+		retries: 3,
+		backoff: 500 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	res, err := c.client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return 0, &StatusError{Status: res.Status}
+	}
+	// Track the live response, closing whichever one remains at the end
+	body := res.Body
+	defer func() { body.Close() }()
+
+	// Pin down the version of the content to resume, weak tags are not usable
+	validator := res.Header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = res.Header.Get("Last-Modified")
+	}
+	policy := &bufioprop.RetryPolicy{
+		Reconnect: func(offset int64) (io.Reader, error) {
+			if validator == "" {
+				return nil, ErrNoResume
+			}
+			res, err := c.resume(url, validator, res.ContentLength, offset)
+			if err != nil {
+				return nil, err
+			}
+			body = res.Body
+			return body, nil
+		},
+		IsRetryable: func(err error) bool {
+			var status *StatusError
+			return err != ErrNoResume && !errors.As(err, &status)
+		},
+		MaxAttempts: c.retries,
+		Backoff:     c.backoff,
+	}
+	// Assemble the destination, hashing and reporting progress as requested
+	dst := w
+	if c.hash != nil {
+		dst = io.MultiWriter(dst, c.hash)
+	}
+	if c.progress != nil {
+		dst = &progressWriter{w: dst, total: res.ContentLength, report: c.progress}
+	}
+	copts := append([]bufioprop.Option{bufioprop.WithRetry(policy)}, c.copts...)
+
+	written, err := bufioprop.Copy(dst, res.Body, buffer, copts...)
+	if err != nil {
+		return written, err
+	}
+	if res.ContentLength >= 0 && written != res.ContentLength {
+		return written, &bufioprop.TransferError{Transferred: written, Expected: res.ContentLength}
+	}
+	if c.sum != nil && !bytes.Equal(c.hash.Sum(nil), c.sum) {
+		return written, ErrChecksum
+	}
+	return written, nil
+}
+
+// resume requests the content at url from the given offset onward, as long as it
+// still matches the validator and total length (-1 = unknown) of the original.
+func (c *config) resume(url, validator string, length, offset int64) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	req.Header.Set("If-Range", validator)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case res.StatusCode == http.StatusOK:
+		res.Body.Close()
+		return nil, ErrNoResume
+
+	case res.StatusCode != http.StatusPartialContent:
+		res.Body.Close()
+		return nil, &StatusError{Status: res.Status}
+
+	case !strings.HasPrefix(res.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)):
+		res.Body.Close()
+		return nil, ErrNoResume
+
+	case length >= 0 && !strings.HasSuffix(res.Header.Get("Content-Range"), fmt.Sprintf("/%d", length)):
+		res.Body.Close()
+		return nil, ErrNoResume
+	}
+	return res, nil
+}
+
+// progressWriter is a writer reporting the number of bytes written through it.
+type progressWriter struct {
+	w       io.Writer
+	written int64
+	total   int64
+	report  func(written, total int64)
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.written += int64(n)
+	w.report(w.written, w.total)
+	return n, err
+}
@@ -0,0 +1,194 @@
+package httpfetch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// abortingWriter is a response writer aborting the connection after a limited
+// number of bytes written.
+type abortingWriter struct {
+	http.ResponseWriter
+	left int
+}
+
+func (w *abortingWriter) Write(b []byte) (int, error) {
+	if len(b) > w.left {
+		w.ResponseWriter.Write(b[:w.left])
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.left -= len(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// version is a revision of the content served, along with its validators.
+type version struct {
+	content []byte
+	etag    string    // Entity tag of the content (empty = none)
+	modtime time.Time // Modification time of the content (zero = none)
+}
+
+// newFlakyServer creates a server for the content, which aborts every response
+// after a limited number of bytes, and optionally supports range requests.
+func newFlakyServer(content []byte, limit int, ranges bool) (*httptest.Server, *atomic.Int32) {
+	return newVersionedServer(limit, ranges, func(int32) version {
+		return version{content: content, etag: `"v1"`}
+	})
+}
+
+// newVersionedServer creates a flaky server, serving whichever version of the
+// content is current at the given request (counted from 1).
+func newVersionedServer(limit int, ranges bool, current func(request int32) version) (*httptest.Server, *atomic.Int32) {
+	requests := new(atomic.Int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := current(requests.Add(1))
+		if !ranges {
+			r.Header.Del("Range")
+		}
+		if v.etag != "" {
+			w.Header().Set("ETag", v.etag)
+		}
+		http.ServeContent(&abortingWriter{ResponseWriter: w, left: limit}, r, "", v.modtime, bytes.NewReader(v.content))
+	}))
+	return server, requests
+}
+
+// Tests that interrupted downloads are resumed where they broke off, and that the
+// content is verified against its checksum.
+func TestFetchResume(t *testing.T) {
+	content := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(0)).Read(content)
+	sum := sha256.Sum256(content)
+
+	server, requests := newFlakyServer(content, 300*1024, true)
+	defer server.Close()
+
+	var progress int64
+	dst := new(bytes.Buffer)
+	n, err := FetchTo(dst, server.URL, 64*1024,
+		WithRetries(3, time.Millisecond),
+		WithChecksum(sha256.New(), sum[:]),
+		WithProgress(func(written, total int64) {
+			if total != int64(len(content)) {
+				t.Errorf("total mismatch: have %d, want %d", total, len(content))
+			}
+			progress = written
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to fetch: %v", err)
+	}
+	if n != int64(len(content)) || progress != n || !bytes.Equal(dst.Bytes(), content) {
+		t.Fatalf("content mismatch: have %d bytes (%d reported), want %d", n, progress, len(content))
+	}
+	if have := requests.Load(); have != 4 {
+		t.Fatalf("request count mismatch: have %d, want %d", have, 4)
+	}
+	// Ensure a corrupted checksum is detected
+	server2, _ := newFlakyServer(content, len(content)+1, true)
+	defer server2.Close()
+
+	if _, err := FetchTo(new(bytes.Buffer), server2.URL, 64*1024, WithChecksum(sha256.New(), make([]byte, 32))); err != ErrChecksum {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrChecksum)
+	}
+}
+
+// Tests that interrupted downloads fail if the server can't resume them.
+func TestFetchNoResume(t *testing.T) {
+	content := make([]byte, 1024*1024)
+
+	server, requests := newFlakyServer(content, 300*1024, false)
+	defer server.Close()
+
+	if _, err := FetchTo(new(bytes.Buffer), server.URL, 64*1024, WithRetries(3, time.Millisecond)); err != ErrNoResume {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrNoResume)
+	}
+	if have := requests.Load(); have != 2 {
+		t.Fatalf("request count mismatch: have %d, want %d", have, 2)
+	}
+}
+
+// Tests that interrupted downloads are resumed based on the modification time of
+// the content, if the server doesn't tag it.
+func TestFetchResumeModified(t *testing.T) {
+	content := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(0)).Read(content)
+
+	modtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	server, requests := newVersionedServer(300*1024, true, func(int32) version {
+		return version{content: content, modtime: modtime}
+	})
+	defer server.Close()
+
+	dst := new(bytes.Buffer)
+	if _, err := FetchTo(dst, server.URL, 64*1024, WithRetries(3, time.Millisecond)); err != nil {
+		t.Fatalf("failed to fetch: %v", err)
+	}
+	if !bytes.Equal(dst.Bytes(), content) {
+		t.Fatalf("content mismatch: have %d bytes, want %d", dst.Len(), len(content))
+	}
+	if have := requests.Load(); have != 4 {
+		t.Fatalf("request count mismatch: have %d, want %d", have, 4)
+	}
+}
+
+// Tests that interrupted downloads are not resumed if the content changed in the
+// meantime, or if it cannot be validated at all.
+func TestFetchResumeChanged(t *testing.T) {
+	content := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(0)).Read(content)
+
+	tests := []struct {
+		name     string
+		current  func(request int32) version
+		requests int32
+	}{
+		{
+			name: "retagged",
+			current: func(request int32) version {
+				return version{content: content, etag: fmt.Sprintf(`"v%d"`, request)}
+			},
+			requests: 2,
+		},
+		{
+			name: "resized",
+			current: func(request int32) version {
+				return version{content: content[:len(content)-int(request)], etag: `"v1"`}
+			},
+			requests: 2,
+		},
+		{
+			name: "weak",
+			current: func(int32) version {
+				return version{content: content, etag: `W/"v1"`}
+			},
+			requests: 1,
+		},
+		{
+			name: "untagged",
+			current: func(int32) version {
+				return version{content: content}
+			},
+			requests: 1,
+		},
+	}
+	for _, tt := range tests {
+		server, requests := newVersionedServer(300*1024, true, tt.current)
+		defer server.Close()
+
+		if _, err := FetchTo(new(bytes.Buffer), server.URL, 64*1024, WithRetries(3, time.Millisecond)); err != ErrNoResume {
+			t.Errorf("%s: error mismatch: have %v, want %v", tt.name, err, ErrNoResume)
+		}
+		if have := requests.Load(); have != tt.requests {
+			t.Errorf("%s: request count mismatch: have %d, want %d", tt.name, have, tt.requests)
+		}
+	}
+}
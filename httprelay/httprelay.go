@@ -0,0 +1,170 @@
+// Package httprelay contains an http.Handler relaying requests to an upstream
+// server, streaming both request and response bodies through buffered pipes.
+package httprelay
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/karalabe/bufioprop"
+)
+
+// DefaultBuffer is the pipe buffer size used if none is configured.
+const DefaultBuffer = 256 * 1024
+
+// hopHeaders are the hop-by-hop headers which must not be forwarded by proxies.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Stats contains the counters of a relay. All fields are updated atomically and
+// may be read while the relay is serving requests.
+type Stats struct {
+	Requests atomic.Uint64 // Number of requests served
+	Failures atomic.Uint64 // Number of requests failing upstream or mid-stream
+
+	BytesUp   atomic.Uint64 // Request body bytes relayed to the upstream server
+	BytesDown atomic.Uint64 // Response body bytes relayed to the client
+
+	Pipes bufioprop.Stats // Aggregated events of all the relay's pipes
+}
+
+// Relay is an http.Handler forwarding all requests to an upstream server. The
+// request and response bodies are streamed through buffered pipes, so reading
+// from one side and writing to the other run concurrently.
+type Relay struct {
+	Target    *url.URL          // Upstream server to relay the requests to
+	Transport http.RoundTripper // Transport to reach upstream (nil = http.DefaultTransport)
+
+	RequestBuffer  int // Pipe buffer size for request bodies (0 = DefaultBuffer)
+	ResponseBuffer int // Pipe buffer size for response bodies (0 = DefaultBuffer)
+
+	Stats Stats // Live counters of the relayed traffic
+}
+
+// New creates a relay forwarding requests to target, with both request and
+// response bodies passing through pipes of the given buffer size.
+func New(target *url.URL, buffer int) *Relay {
+	return &Relay{
+		Target:         target,
+		RequestBuffer:  buffer,
+		ResponseBuffer: buffer,
+	}
+}
+
+// ServeHTTP implements http.Handler, relaying a single request upstream.
+func (r *Relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Stats.Requests.Add(1)
+
+	// Assemble the upstream request, streaming the body through a pipe
+	out := req.Clone(req.Context())
+	out.RequestURI = ""
+	out.URL.Scheme = r.Target.Scheme
+	out.URL.Host = r.Target.Host
+	out.URL.Path = singleJoiningSlash(r.Target.Path, req.URL.Path)
+	out.Host = r.Target.Host
+	removeHopHeaders(out.Header)
+
+	if req.Body != nil && req.Body != http.NoBody {
+		pr, pw := bufioprop.Pipe(bufferSize(r.RequestBuffer), bufioprop.WithStats(&r.Stats.Pipes))
+		go func() {
+			n, err := pw.ReadFrom(req.Body)
+			r.Stats.BytesUp.Add(uint64(n))
+			pw.CloseWithError(err)
+		}()
+		defer pr.Close()
+		out.Body = pr
+	}
+	// Execute the request and relay the response back to the client
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	res, err := transport.RoundTrip(out)
+	if err != nil {
+		r.Stats.Failures.Add(1)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+
+	removeHopHeaders(res.Header)
+	for key, values := range res.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(res.StatusCode)
+
+	// Flush the response whenever upstream stalls, so streamed bodies (e.g. server
+	// sent events) aren't held back in the writer's buffer
+	dst := io.Writer(w)
+	if ctrl := http.NewResponseController(w); ctrl.Flush() == nil {
+		dst = &flushWriter{ResponseWriter: w, ctrl: ctrl}
+	}
+	n, err := bufioprop.Copy(dst, res.Body, bufferSize(r.ResponseBuffer), bufioprop.WithStats(&r.Stats.Pipes), bufioprop.WithFlushOnIdle())
+	r.Stats.BytesDown.Add(uint64(n))
+	if err != nil {
+		r.Stats.Failures.Add(1)
+	}
+}
+
+// flushWriter is a response writer exposing the flushing of the underlying one in
+// the error returning form the pipes recognize, which http.Flusher lacks.
+type flushWriter struct {
+	http.ResponseWriter
+	ctrl *http.ResponseController
+}
+
+// Flush sends any buffered response data to the client.
+func (w *flushWriter) Flush() error {
+	return w.ctrl.Flush()
+}
+
+// bufferSize returns the configured buffer size, or the default if unset.
+func bufferSize(buffer int) int {
+	if buffer <= 0 {
+		return DefaultBuffer
+	}
+	return buffer
+}
+
+// removeHopHeaders deletes the hop-by-hop headers from a header set, including
+// any additional ones listed in the Connection header.
+func removeHopHeaders(header http.Header) {
+	for _, value := range header["Connection"] {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				header.Del(field)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// singleJoiningSlash joins two URL paths with exactly one slash between them.
+func singleJoiningSlash(a, b string) string {
+	aslash, bslash := strings.HasSuffix(a, "/"), strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// Ensure the relay is a valid handler.
+var _ http.Handler = (*Relay)(nil)
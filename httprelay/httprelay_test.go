@@ -0,0 +1,119 @@
+package httprelay
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Tests that request and response bodies are relayed intact, together with the
+// headers and the accounting.
+func TestRelay(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// HTTP/1 handlers can't stream the response while reading the request
+		body, _ := ioutil.ReadAll(r.Body)
+
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Header().Set("Connection", "close")
+		w.Write(body)
+	}))
+	defer upstream.Close()
+
+	target, _ := url.Parse(upstream.URL + "/base")
+	relay := New(target, 3333)
+
+	proxy := httptest.NewServer(relay)
+	defer proxy.Close()
+
+	body := make([]byte, 4*1024*1024+17)
+	rand.New(rand.NewSource(0)).Read(body)
+
+	res, err := http.Post(proxy.URL+"/echo", "application/octet-stream", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to execute relayed request: %v", err)
+	}
+	defer res.Body.Close()
+
+	reply, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read relayed response: %v", err)
+	}
+	if !bytes.Equal(reply, body) {
+		t.Fatalf("relayed body mismatch")
+	}
+	if path := res.Header.Get("X-Path"); path != "/base/echo" {
+		t.Errorf("upstream path mismatch: have %s, want %s", path, "/base/echo")
+	}
+	if n := relay.Stats.Requests.Load(); n != 1 {
+		t.Errorf("request count mismatch: have %d, want %d", n, 1)
+	}
+	if n := relay.Stats.BytesUp.Load(); n != uint64(len(body)) {
+		t.Errorf("upstream bytes mismatch: have %d, want %d", n, len(body))
+	}
+	if n := relay.Stats.BytesDown.Load(); n != uint64(len(body)) {
+		t.Errorf("downstream bytes mismatch: have %d, want %d", n, len(body))
+	}
+}
+
+// Tests that unreachable upstream servers are reported as bad gateways.
+func TestRelayUnreachable(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	target, _ := url.Parse(upstream.URL)
+	upstream.Close()
+
+	relay := New(target, 0)
+	rec := httptest.NewRecorder()
+	relay.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status mismatch: have %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+	if n := relay.Stats.Failures.Load(); n != 1 {
+		t.Errorf("failure count mismatch: have %d, want %d", n, 1)
+	}
+}
+
+// Tests that streamed responses are flushed to the client whenever upstream stalls,
+// instead of waiting for the relay's buffers to fill up.
+func TestRelayFlush(t *testing.T) {
+	received := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Errorf("streamed data not flushed to the client")
+		}
+		w.Write([]byte(" world"))
+	}))
+	defer upstream.Close()
+
+	target, _ := url.Parse(upstream.URL)
+	proxy := httptest.NewServer(New(target, 0))
+	defer proxy.Close()
+
+	res, err := http.Get(proxy.URL)
+	if err != nil {
+		t.Fatalf("failed to execute relayed request: %v", err)
+	}
+	defer res.Body.Close()
+
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(res.Body, head); err != nil || string(head) != "hello" {
+		t.Fatalf("streamed head mismatch: have (%q, %v), want (%q, nil)", head, err, "hello")
+	}
+	close(received)
+
+	rest, err := ioutil.ReadAll(res.Body)
+	if err != nil || string(rest) != " world" {
+		t.Fatalf("streamed tail mismatch: have (%q, %v), want (%q, nil)", rest, err, " world")
+	}
+}
@@ -0,0 +1,95 @@
+package bufioprop
+
+import (
+	"sync"
+	"time"
+)
+
+// An idler releases the internal buffer of a pipe after its writer has been idle
+// and the reader has drained all data for a configured period, reallocating it on
+// the next write. The writer entry points bracket their buffer accesses with wake
+// and sleep, which is the only place the lock is taken, so the reader's hot path
+// remains lock free.
+type idler struct {
+	timeout time.Duration // Idle period after which to release the buffer
+	alloc   func() []byte // Allocator to recreate the buffer with
+
+	busy  bool        // Whether the writer is currently accessing the buffer
+	last  time.Time   // Time the writer last finished accessing the buffer
+	timer *time.Timer // Timer to check for idleness with (nil = not yet armed)
+	quit  bool        // Whether the pipe terminated and the timer should stop
+
+	lock sync.Mutex // Lock protecting the buffer swaps and the idle state
+}
+
+// wakeBuffer marks the writer busy, reallocating the internal buffer if it was
+// released during an idle period.
+func (p *pipe) wakeBuffer() {
+	if p.idle == nil {
+		return
+	}
+	p.idle.lock.Lock()
+	defer p.idle.lock.Unlock()
+
+	p.idle.busy = true
+	if p.buffer == nil {
+		p.buffer = p.idle.alloc()
+	}
+}
+
+// sleepBuffer marks the writer done with the internal buffer for now, arming the
+// timer to release it if the pipe stays idle.
+func (p *pipe) sleepBuffer() {
+	if p.idle == nil {
+		return
+	}
+	p.idle.lock.Lock()
+	defer p.idle.lock.Unlock()
+
+	p.idle.busy, p.idle.last = false, time.Now()
+	if p.idle.quit {
+		return
+	}
+	if p.idle.timer == nil {
+		p.idle.timer = time.AfterFunc(p.idle.timeout, p.shrinkBuffer)
+	} else {
+		p.idle.timer.Reset(p.idle.timeout)
+	}
+}
+
+// shrinkBuffer releases the internal buffer if the writer has been idle for long
+// enough and the reader has consumed everything, otherwise it rechecks later.
+func (p *pipe) shrinkBuffer() {
+	p.idle.lock.Lock()
+	defer p.idle.lock.Unlock()
+
+	if p.idle.busy || p.idle.quit || p.buffer == nil {
+		return
+	}
+	if wait := p.idle.timeout - time.Since(p.idle.last); wait > 0 {
+		p.idle.timer.Reset(wait)
+		return
+	}
+	// The reader only touches the buffer while there's data in it, so an empty
+	// buffer can be swapped out from under it
+	if p.freeSpace() != p.size || p.reserved > 0 {
+		p.idle.timer.Reset(p.idle.timeout)
+		return
+	}
+	p.buffer = nil
+	p.stats.IdleReleases.Add(1)
+}
+
+// stopIdle disarms the idle timer of a terminated pipe.
+func (p *pipe) stopIdle() {
+	if p.idle == nil {
+		return
+	}
+	p.idle.lock.Lock()
+	defer p.idle.lock.Unlock()
+
+	p.idle.quit = true
+	if p.idle.timer != nil {
+		p.idle.timer.Stop()
+	}
+}
@@ -0,0 +1,40 @@
+package bufioprop
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// Tests that an idle, drained pipe releases its buffer and reallocates it on the
+// next write, without losing or corrupting data.
+func TestIdleRelease(t *testing.T) {
+	stats := new(Stats)
+	r, w := Pipe(16, WithIdleRelease(10*time.Millisecond), WithStats(stats))
+
+	buf := make([]byte, 16)
+	for i := 0; i < 3; i++ {
+		if _, err := w.Write([]byte("hello")); err != nil {
+			t.Fatalf("burst %d: failed to write: %v", i, err)
+		}
+		// Undrained data must keep the buffer alive
+		time.Sleep(30 * time.Millisecond)
+		if n := stats.IdleReleases.Load(); n != uint64(i) {
+			t.Fatalf("burst %d: buffer released with pending data: %d releases", i, n)
+		}
+		if n, err := io.ReadFull(r, buf[:5]); err != nil || string(buf[:n]) != "hello" {
+			t.Fatalf("burst %d: read mismatch: have (%q, %v), want (%q, nil)", i, buf[:n], err, "hello")
+		}
+		// Drained pipe should release the buffer after the idle period
+		for start := time.Now(); stats.IdleReleases.Load() != uint64(i+1); {
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("burst %d: buffer not released", i)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	go w.Close()
+	if n, err := r.Read(buf); n != 0 || err != io.EOF {
+		t.Fatalf("close mismatch: have (%d, %v), want (0, %v)", n, err, io.EOF)
+	}
+}
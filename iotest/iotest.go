@@ -0,0 +1,143 @@
+// Package iotest implements readers and writers simulating slow and faulty
+// endpoints, with configurable chunk sizes, delays and failure schedules, for
+// testing code moving data through buffered pipes and copies.
+//
+// The throughput of a simulated endpoint is its chunk size over its delay, e.g.
+// 10KB chunks every millisecond stream at 10MBps, whereas 10MB chunks every second
+// stream at the same rate, but in bursts.
+package iotest
+
+import (
+	"io"
+	"time"
+)
+
+// A Fault is a failure injected into a stream at a given offset.
+type Fault struct {
+	Offset    int64 // Number of bytes to deliver before failing
+	Err       error // Failure to inject
+	Eager     bool  // Whether a reader returns the failure alongside the data preceding it
+	Transient bool  // Whether the stream resumes after the failure (false = fails permanently)
+}
+
+// A Reader streams the data of an underlying reader in chunks of bounded size,
+// pausing between chunks and failing according to a schedule. It is not safe
+// for concurrent use.
+type Reader struct {
+	R      io.Reader     // Underlying source of the data
+	Chunk  int           // Number of bytes made available at once (0 = unbounded)
+	Delay  time.Duration // Pause between making subsequent chunks available
+	Faults []Fault       // Failures to inject, in increasing offset order
+
+	offset int64 // Number of bytes delivered so far
+	left   int   // Number of bytes remaining from the current chunk
+	failed error // Permanent failure already injected (nil = none)
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(b []byte) (int, error) {
+	if r.failed != nil {
+		return 0, r.failed
+	}
+	// If a fault is due, inject it before delivering anything more
+	if len(r.Faults) > 0 && r.Faults[0].Offset <= r.offset {
+		return 0, r.fail()
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	// Start a new chunk if the previous one was consumed, waiting for it to arrive
+	if r.left == 0 {
+		if r.offset > 0 && r.Delay > 0 {
+			time.Sleep(r.Delay)
+		}
+		r.left = r.Chunk
+	}
+	if r.Chunk > 0 && len(b) > r.left {
+		b = b[:r.left]
+	}
+	if len(r.Faults) > 0 && int64(len(b)) > r.Faults[0].Offset-r.offset {
+		b = b[:r.Faults[0].Offset-r.offset]
+	}
+	n, err := r.R.Read(b)
+	r.offset += int64(n)
+	if r.Chunk > 0 {
+		r.left -= n
+	}
+	// Deliver any eager fault reached alongside the data
+	if err == nil && len(r.Faults) > 0 && r.Faults[0].Eager && r.Faults[0].Offset == r.offset {
+		err = r.fail()
+	}
+	return n, err
+}
+
+// fail injects the next scheduled fault, retaining it if it's permanent.
+func (r *Reader) fail() error {
+	fault := r.Faults[0]
+	r.Faults = r.Faults[1:]
+	if !fault.Transient {
+		r.failed = fault.Err
+	}
+	return fault.Err
+}
+
+// A Writer consumes data into an underlying writer in chunks of bounded size,
+// pausing after each chunk and failing according to a schedule. It is not safe
+// for concurrent use.
+type Writer struct {
+	W      io.Writer     // Underlying sink of the data (nil = discard)
+	Chunk  int           // Number of bytes consumed at once (0 = unbounded)
+	Delay  time.Duration // Pause after consuming each chunk
+	Faults []Fault       // Failures to inject, in increasing offset order
+
+	offset int64 // Number of bytes accepted so far
+	used   int   // Number of bytes consumed from the current chunk
+	failed error // Permanent failure already injected (nil = none)
+}
+
+// Write implements io.Writer.
+func (w *Writer) Write(b []byte) (written int, err error) {
+	if w.failed != nil {
+		return 0, w.failed
+	}
+	for len(b) > 0 {
+		// If a fault is due, inject it before accepting anything more
+		if len(w.Faults) > 0 && w.Faults[0].Offset <= w.offset {
+			return written, w.fail()
+		}
+		// Consume either a full chunk or up to the next fault
+		chunk := b
+		if w.Chunk > 0 && len(chunk) > w.Chunk-w.used {
+			chunk = chunk[:w.Chunk-w.used]
+		}
+		if len(w.Faults) > 0 && int64(len(chunk)) > w.Faults[0].Offset-w.offset {
+			chunk = chunk[:w.Faults[0].Offset-w.offset]
+		}
+		n := len(chunk)
+		if w.W != nil {
+			if n, err = w.W.Write(chunk); err != nil {
+				return written + n, err
+			}
+		}
+		b, written, w.offset = b[n:], written+n, w.offset+int64(n)
+
+		// Wait a while if a chunk was fully consumed
+		if w.used += n; w.Chunk == 0 || w.used == w.Chunk {
+			w.used = 0
+			if w.Delay > 0 {
+				time.Sleep(w.Delay)
+			}
+		}
+	}
+	return written, nil
+}
+
+// fail injects the next scheduled fault, retaining it if it's permanent.
+func (w *Writer) fail() error {
+	fault := w.Faults[0]
+	w.Faults = w.Faults[1:]
+	if !fault.Transient {
+		w.failed = fault.Err
+	}
+	return fault.Err
+}
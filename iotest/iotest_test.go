@@ -0,0 +1,91 @@
+package iotest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+var (
+	errFirst  = errors.New("first failure")
+	errSecond = errors.New("second failure")
+)
+
+// readStep is a single read from a simulated source and its expected outcome.
+type readStep struct {
+	buffer int
+	n      int
+	err    error
+}
+
+// Tests that readers split the stream into chunks and inject the scheduled faults
+// at their exact offsets.
+func TestReader(t *testing.T) {
+	tests := []struct {
+		chunk  int
+		faults []Fault
+		steps  []readStep
+	}{
+		// Chunks should bound reads, but not be delivered all at once
+		{chunk: 4, steps: []readStep{{10, 4, nil}, {2, 2, nil}, {10, 2, nil}, {10, 2, nil}, {10, 0, io.EOF}}},
+
+		// Lazy faults should be returned after the data, eager ones alongside
+		{faults: []Fault{{Offset: 3, Err: errFirst}}, steps: []readStep{{10, 3, nil}, {10, 0, errFirst}, {10, 0, errFirst}}},
+		{faults: []Fault{{Offset: 3, Err: errFirst, Eager: true}}, steps: []readStep{{10, 3, errFirst}, {10, 0, errFirst}}},
+		{faults: []Fault{{Offset: 0, Err: errFirst}}, steps: []readStep{{10, 0, errFirst}}},
+
+		// Transient faults should let the stream resume, up to the next fault
+		{
+			chunk:  4,
+			faults: []Fault{{Offset: 2, Err: errFirst, Transient: true}, {Offset: 7, Err: errSecond, Eager: true}},
+			steps:  []readStep{{10, 2, nil}, {10, 0, errFirst}, {10, 2, nil}, {10, 3, errSecond}, {10, 0, errSecond}},
+		},
+	}
+	for i, tt := range tests {
+		r := &Reader{R: bytes.NewReader(make([]byte, 10)), Chunk: tt.chunk, Faults: tt.faults}
+		for j, step := range tt.steps {
+			if n, err := r.Read(make([]byte, step.buffer)); n != step.n || err != step.err {
+				t.Errorf("test %d, step %d: result mismatch: have (%d, %v), want (%d, %v)", i, j, n, err, step.n, step.err)
+				break
+			}
+		}
+	}
+}
+
+// Tests that writers accept data up to the scheduled faults, and that transient
+// ones let the stream resume.
+func TestWriter(t *testing.T) {
+	sink := new(bytes.Buffer)
+	w := &Writer{W: sink, Chunk: 3, Faults: []Fault{{Offset: 5, Err: errFirst, Transient: true}, {Offset: 8, Err: errSecond}}}
+
+	if n, err := w.Write([]byte("abcdefg")); n != 5 || err != errFirst {
+		t.Fatalf("first write mismatch: have (%d, %v), want (5, %v)", n, err, errFirst)
+	}
+	if n, err := w.Write([]byte("fghij")); n != 3 || err != errSecond {
+		t.Fatalf("second write mismatch: have (%d, %v), want (3, %v)", n, err, errSecond)
+	}
+	if n, err := w.Write([]byte("ij")); n != 0 || err != errSecond {
+		t.Fatalf("third write mismatch: have (%d, %v), want (0, %v)", n, err, errSecond)
+	}
+	if have := sink.String(); have != "abcdefgh" {
+		t.Fatalf("sink mismatch: have %q, want %q", have, "abcdefgh")
+	}
+}
+
+// Tests that the delays throttle the endpoints to their chunk size over delay.
+func TestThrottle(t *testing.T) {
+	const chunk, delay = 1024, 10 * time.Millisecond
+
+	start := time.Now()
+	src := &Reader{R: bytes.NewReader(make([]byte, 5*chunk)), Chunk: chunk, Delay: delay}
+	dst := &Writer{Chunk: chunk, Delay: delay}
+	if n, err := io.Copy(dst, src); n != 5*chunk || err != nil {
+		t.Fatalf("copy mismatch: have (%d, %v), want (%d, nil)", n, err, 5*chunk)
+	}
+	// Reader pauses between its 5 chunks, writer after each of them
+	if elapsed := time.Since(start); elapsed < 9*delay {
+		t.Fatalf("throttling too weak: copy took %v, want at least %v", elapsed, 9*delay)
+	}
+}
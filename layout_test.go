@@ -0,0 +1,29 @@
+package bufioprop
+
+import (
+	"testing"
+	"unsafe"
+)
+
+// Tests that the pipe fields written by different goroutines on the hot path are
+// kept at least a padding apart, so the two sides don't falsely share cache lines.
+func TestPipeLayout(t *testing.T) {
+	var p pipe
+
+	groups := []struct {
+		name  string
+		start uintptr
+		end   uintptr
+	}{
+		{"config", unsafe.Offsetof(p.buffer), unsafe.Offsetof(p.tag) + unsafe.Sizeof(p.tag)},
+		{"writer", unsafe.Offsetof(p.head), unsafe.Offsetof(p.inSpin) + unsafe.Sizeof(p.inSpin)},
+		{"reader", unsafe.Offsetof(p.tail), unsafe.Offsetof(p.outSpin) + unsafe.Sizeof(p.outSpin)},
+		{"signals", unsafe.Offsetof(p.inWake), unsafe.Sizeof(p)},
+	}
+	for i := 1; i < len(groups); i++ {
+		prev, next := groups[i-1], groups[i]
+		if gap := next.start - prev.end; next.start < prev.end || gap < cacheLinePad {
+			t.Errorf("%s -> %s: gap too small: have %d, want >= %d", prev.name, next.name, int(next.start)-int(prev.end), cacheLinePad)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package bufioprop
+
+import (
+	"errors"
+	"math"
+	"sync/atomic"
+)
+
+var (
+	// ErrBufferTooLarge is returned when creating a pipe (or copy) with a buffer
+	// exceeding the process wide limit set via SetMaxBuffer, or the 2GB limit of
+	// the internal indexing.
+	ErrBufferTooLarge = errors.New("bufio: buffer exceeds limit")
+
+	// ErrInvalidBuffer is returned when creating a pipe (or copy) with a buffer of
+	// a negative size.
+	ErrInvalidBuffer = errors.New("bufio: invalid buffer size")
+)
+
+// maxBuffer is the process wide upper limit of pipe buffers (0 = unlimited).
+var maxBuffer atomic.Int64
+
+// SetMaxBuffer sets a process wide upper limit on the size of the buffer of any
+// single pipe (or copy), returning the previous limit. Creating pipes with larger
+// buffers fails with ErrBufferTooLarge instead of allocating them, guarding
+// services taking buffer sizes from untrusted configurations. A limit of 0
+// removes the cap.
+//
+// The limit applies to the final buffer size, after any block alignment. The
+// aggregate memory of many pipes can be capped via a BufferBudget.
+func SetMaxBuffer(limit int) int {
+	return int(maxBuffer.Swap(int64(limit)))
+}
+
+// checkBuffer validates a buffer size against the process wide constraints.
+func checkBuffer(buffer int) error {
+	if buffer < 1 {
+		return ErrInvalidBuffer
+	}
+	if int64(buffer) > math.MaxInt32 {
+		return ErrBufferTooLarge
+	}
+	if limit := maxBuffer.Load(); limit > 0 && int64(buffer) > limit {
+		return ErrBufferTooLarge
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package bufioprop
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Tests that pipes and copies exceeding the process wide buffer limit, or having
+// nonsensical buffer sizes, fail instead of being allocated.
+func TestMaxBuffer(t *testing.T) {
+	defer SetMaxBuffer(SetMaxBuffer(1024))
+
+	if _, _, err := NewPipe(1025); err != ErrBufferTooLarge {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrBufferTooLarge)
+	}
+	if _, _, err := NewPipe(512, WithBlockWrites(512, false)); err != nil {
+		t.Fatalf("failed to create aligned pipe: %v", err)
+	}
+	if _, _, err := NewPipe(1024, WithBlockWrites(768, false)); err != ErrBufferTooLarge {
+		t.Fatalf("aligned error mismatch: have %v, want %v", err, ErrBufferTooLarge)
+	}
+	if _, err := Copy(new(bytes.Buffer), bytes.NewReader(testData[:4096]), 4096); err != ErrBufferTooLarge {
+		t.Fatalf("copy error mismatch: have %v, want %v", err, ErrBufferTooLarge)
+	}
+	if _, err := Copy(new(bytes.Buffer), bytes.NewReader(testData[:1024]), 4096); err != nil {
+		t.Fatalf("failed to copy sized source: %v", err)
+	}
+	if _, _, err := NewPipe(-1); err != ErrInvalidBuffer {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrInvalidBuffer)
+	}
+}
@@ -0,0 +1,119 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// MaxLineLength is the default maximum length of the lines CopyLines assembles,
+// including their terminating newline. It may be changed via WithMaxLineLength.
+const MaxLineLength = 1024 * 1024
+
+// ErrLineTooLong is returned by CopyLines if a line exceeds the maximum length.
+var ErrLineTooLong = errors.New("bufio: line too long")
+
+// CopyLines copies from src to dst until either EOF is reached on src or an error
+// occurs, splitting the stream into lines and passing each through fn, writing
+// whatever it returns into dst (nil to drop the line). It returns the number of
+// bytes written into dst and the first error encountered, including any returned
+// by fn.
+//
+// Lines are handed to fn including their terminating newline, apart from a final
+// unterminated one. Lines contiguous in the internal buffer are passed as views
+// into it, valid only until fn returns; lines wrapping around the end of the ring
+// or not fitting into it at all are assembled into a separate scratch buffer. To
+// bound that buffer, lines longer than MaxLineLength (or the limit configured via
+// WithMaxLineLength) fail the copy with ErrLineTooLong.
+//
+// The callback runs on the consumer goroutine of the copy, so the source keeps
+// being read concurrently while the lines are processed.
+func CopyLines(dst io.Writer, src io.Reader, buffer int, fn func(line []byte) ([]byte, error), opts ...Option) (written int64, err error) {
+	c := newConfig(opts)
+	limit := c.maxLine
+	if limit <= 0 {
+		limit = MaxLineLength
+	}
+	return copyPipe(dst, src, buffer, c, func(pr *PipeReader) (int64, error) {
+		return pr.p.linesTo(dst, fn, limit)
+	})
+}
+
+// LinesTo keeps splitting the buffered data into lines, pushing them through the
+// callback and into the writer until the source is closed or fails, or a line
+// exceeds the maximum length.
+func (p *pipe) linesTo(w io.Writer, fn func(line []byte) ([]byte, error), maxLine int) (written int64, err error) {
+	p.flushInto(w)
+
+	var (
+		partial []byte     // Line segments carried over a wrap-around or a full buffer
+		scanned int        // Number of bytes already checked for a newline
+		need    int32  = 1 // Number of bytes to wait for before scanning again
+	)
+	emit := func(line []byte) error {
+		out, err := fn(line)
+		if len(out) > 0 {
+			nw, err := p.writeOut(w, out)
+			written += int64(nw)
+			if err != nil {
+				return err
+			}
+		}
+		return err
+	}
+	for {
+		// Wait until some (more) data becomes available
+		safeFree, err := p.outputWaitN(need)
+		if err != nil {
+			if err == io.EOF {
+				if err = nil; len(partial) > 0 {
+					err = emit(partial)
+				}
+			}
+			return written, err
+		}
+		limit := p.outPos + p.size - safeFree
+		if limit > p.size {
+			limit = p.size
+		}
+		// Pass all the complete lines through the callback
+		chunk := p.buffer[p.outPos:limit]
+		for {
+			i := bytes.IndexByte(chunk[scanned:], '\n')
+			if i < 0 {
+				break
+			}
+			line := chunk[:scanned+i+1]
+			if len(partial)+len(line) > maxLine {
+				return written, ErrLineTooLong
+			}
+			if len(partial) > 0 {
+				partial = append(partial, line...)
+				line = partial
+			}
+			if err := emit(line); err != nil {
+				return written, err
+			}
+			partial = partial[:0]
+
+			p.outputAdvance(scanned + i + 1)
+			chunk, scanned = chunk[scanned+i+1:], 0
+		}
+		need, scanned = 1, len(chunk)
+		if len(chunk) == 0 {
+			continue
+		}
+		if len(partial)+len(chunk) > maxLine {
+			return written, ErrLineTooLong
+		}
+		// Unterminated data remains, wait for the rest of the line if it can still
+		// arrive in place, otherwise move it out of the way
+		if p.outPos+int32(len(chunk)) < p.size && !closed(p.inQuit) {
+			need = int32(len(chunk)) + 1
+			continue
+		}
+		partial = append(partial, chunk...)
+		p.outputAdvance(len(chunk))
+		scanned = 0
+	}
+}
@@ -0,0 +1,93 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Tests that lines are split correctly regardless of how they straddle the ring,
+// including lines longer than the entire buffer.
+func TestCopyLines(t *testing.T) {
+	var text strings.Builder
+	for i := 0; i < 10000; i++ {
+		text.WriteString(strings.Repeat("x", i%97))
+		text.WriteString("\n")
+	}
+	text.WriteString("unterminated")
+
+	for _, buffer := range []int{1, 7, 64, 333, 64 * 1024} {
+		var lines []string
+		dst := new(bytes.Buffer)
+		_, err := CopyLines(dst, strings.NewReader(text.String()), buffer, func(line []byte) ([]byte, error) {
+			lines = append(lines, string(line))
+			return bytes.ToUpper(line), nil
+		})
+		if err != nil {
+			t.Fatalf("buffer %d: failed to copy: %v", buffer, err)
+		}
+		if len(lines) != 10001 {
+			t.Fatalf("buffer %d: line count mismatch: have %d, want %d", buffer, len(lines), 10001)
+		}
+		for i, line := range lines[:10000] {
+			if want := strings.Repeat("x", i%97) + "\n"; line != want {
+				t.Fatalf("buffer %d: line %d mismatch: have %q, want %q", buffer, i, line, want)
+			}
+		}
+		if have := dst.String(); have != strings.ToUpper(text.String()) {
+			t.Fatalf("buffer %d: output mismatch", buffer)
+		}
+	}
+}
+
+// Tests that lines can be filtered out and that callback failures abort the copy.
+func TestCopyLinesFilter(t *testing.T) {
+	text := "keep\ndrop\nkeep\nfail\nkeep\n"
+	fail := errors.New("callback failure")
+
+	dst := new(bytes.Buffer)
+	n, err := CopyLines(dst, strings.NewReader(text), 8, func(line []byte) ([]byte, error) {
+		switch string(line) {
+		case "drop\n":
+			return nil, nil
+		case "fail\n":
+			return nil, fail
+		}
+		return line, nil
+	})
+	if err != fail {
+		t.Fatalf("error mismatch: have %v, want %v", err, fail)
+	}
+	if have, want := dst.String(), "keep\nkeep\n"; have != want || int(n) != len(want) {
+		t.Fatalf("output mismatch: have %q (%d), want %q", have, n, want)
+	}
+}
+
+// Tests that lines exceeding the maximum length fail the copy, whether they fit
+// into the ring or not, and that lines at the limit are still passed through.
+func TestCopyLinesTooLong(t *testing.T) {
+	for _, buffer := range []int{7, 64, 64 * 1024} {
+		for _, text := range []string{"short\n" + strings.Repeat("x", 16) + "\n", "short\n" + strings.Repeat("x", 17)} {
+			var lines int
+			_, err := CopyLines(new(bytes.Buffer), strings.NewReader(text), buffer, func(line []byte) ([]byte, error) {
+				lines++
+				return line, nil
+			}, WithMaxLineLength(16))
+			if err != ErrLineTooLong {
+				t.Fatalf("buffer %d, text %q: error mismatch: have %v, want %v", buffer, text, err, ErrLineTooLong)
+			}
+			if lines != 1 {
+				t.Fatalf("buffer %d, text %q: line count mismatch: have %d, want %d", buffer, text, lines, 1)
+			}
+		}
+		text := strings.Repeat("x", 15) + "\n" + strings.Repeat("y", 16)
+
+		dst := new(bytes.Buffer)
+		if _, err := CopyLines(dst, strings.NewReader(text), buffer, func(line []byte) ([]byte, error) {
+			return line, nil
+		}, WithMaxLineLength(16)); err != nil || dst.String() != text {
+			t.Fatalf("buffer %d: limit line mismatch: have (%q, %v), want (%q, nil)", buffer, dst.String(), err, text)
+		}
+	}
+}
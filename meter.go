@@ -0,0 +1,137 @@
+package bufioprop
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// meterSamples is the number of samples a meter aims to retain within its window,
+// bounding the memory of callers polling it in a tight loop.
+const meterSamples = 16
+
+// A Meter measures the throughput of a pipe (or a copy) over a sliding window of
+// time, for dashboards wanting the current transfer rate instead of cumulative
+// totals. It's attached via WithMeter and is safe for concurrent use.
+//
+// The pipe's progress is sampled lazily whenever the meter is queried, so there
+// is no cost on the data path and no background goroutine. If the meter is queried
+// less often than its window, the rate spans the period since the previous query.
+//
+// If the size of the transfer is known, the meter also estimates its remaining
+// time. Copies set it automatically for sources of known length (including the
+// ones of CopyExpect and regular files in CopyFile), otherwise see Expect.
+type Meter struct {
+	window   time.Duration  // Period of time to measure the rate across
+	progress *atomic.Uint64 // Counter of bytes read out of the metered pipe (nil = unattached)
+	samples  []meterSample  // Progress samples taken within the window, oldest first
+	expected int64          // Total number of bytes expected to be moved (0 = unknown)
+
+	lock sync.Mutex // Lock protecting the progress counter and samples
+}
+
+// meterSample is the progress of a metered pipe at a given point in time.
+type meterSample struct {
+	time  time.Time
+	total uint64
+}
+
+// NewMeter creates a meter measuring throughput over the given window of time.
+func NewMeter(window time.Duration) *Meter {
+	return &Meter{window: window}
+}
+
+// attach binds the meter to the progress counter of a new pipe, restarting its
+// measurement.
+func (m *Meter) attach(progress *atomic.Uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.progress = progress
+	m.samples = append(m.samples[:0], meterSample{time: time.Now(), total: progress.Load()})
+}
+
+// Total returns the number of bytes moved through the metered pipe so far, or 0
+// if the meter isn't attached to any.
+func (m *Meter) Total() int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.progress == nil {
+		return 0
+	}
+	return int64(m.progress.Load())
+}
+
+// Expect sets the total number of bytes the metered transfer is expected to move
+// (0 = unknown), used to estimate its remaining time. The size is retained until
+// changed, even if the meter is attached to a new pipe.
+func (m *Meter) Expect(size int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.expected = size
+}
+
+// Rate returns the throughput of the metered pipe over the meter's window, in
+// bytes per second, or 0 if the meter isn't attached to any.
+func (m *Meter) Rate() float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.progress == nil {
+		return 0
+	}
+	rate, _ := m.sample()
+	return rate
+}
+
+// ETA returns the estimated time remaining until the expected size is moved at
+// the throughput observed over the meter's window, or 0 if it already has been.
+// If the expected size is unknown or there was no progress within the window, the
+// remaining time can't be estimated and ETA returns -1.
+func (m *Meter) ETA() time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.progress == nil || m.expected <= 0 {
+		return -1
+	}
+	rate, total := m.sample()
+
+	remaining := m.expected - int64(total)
+	switch {
+	case remaining <= 0:
+		return 0
+	case rate == 0:
+		return -1
+	default:
+		return time.Duration(float64(remaining) / rate * float64(time.Second))
+	}
+}
+
+// sample records the current progress of the metered pipe, returning it along
+// with the rate over the window. The lock must be held and the meter attached.
+func (m *Meter) sample() (float64, uint64) {
+	now := meterSample{time: time.Now(), total: m.progress.Load()}
+
+	// Drop the samples which slid out of the window, retaining at least one
+	cutoff := now.time.Add(-m.window)
+
+	var drop int
+	for drop < len(m.samples)-1 && m.samples[drop].time.Before(cutoff) {
+		drop++
+	}
+	m.samples = append(m.samples[:0], m.samples[drop:]...)
+	base := m.samples[0]
+
+	// Record the current progress, unless the last sample is recent enough
+	if now.time.Sub(m.samples[len(m.samples)-1].time) >= m.window/meterSamples {
+		m.samples = append(m.samples, now)
+	}
+	elapsed := now.time.Sub(base.time)
+	if elapsed <= 0 {
+		return 0, now.total
+	}
+	return float64(now.total-base.total) / elapsed.Seconds(), now.total
+}
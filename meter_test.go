@@ -0,0 +1,84 @@
+package bufioprop
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// Tests that meters track the total bytes moved through a pipe, and measure the
+// rate over their window only.
+func TestMeter(t *testing.T) {
+	meter := NewMeter(100 * time.Millisecond)
+	if total, rate := meter.Total(), meter.Rate(); total != 0 || rate != 0 {
+		t.Fatalf("unattached meter mismatch: have (%d, %f), want (0, 0)", total, rate)
+	}
+	// Move some data through the pipe and ensure the rate is sane
+	start := time.Now()
+	r, w := Pipe(64*1024, WithMeter(meter))
+
+	go w.Write(testData[:1024*1024])
+	if _, err := io.ReadFull(r, make([]byte, 1024*1024)); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if total := meter.Total(); total != 1024*1024 {
+		t.Fatalf("total mismatch: have %d, want %d", total, 1024*1024)
+	}
+	rate := meter.Rate()
+	if min := float64(1024*1024) / time.Since(start).Seconds(); rate < min {
+		t.Fatalf("rate too low: have %f, want >= %f", rate, min)
+	}
+	// Idle past the window and ensure the rate drops, whilst the total is kept
+	time.Sleep(150 * time.Millisecond)
+	if rate := meter.Rate(); rate != 0 {
+		t.Fatalf("idle rate mismatch: have %f, want 0", rate)
+	}
+	if total := meter.Total(); total != 1024*1024 {
+		t.Fatalf("idle total mismatch: have %d, want %d", total, 1024*1024)
+	}
+	// Copies should feed the meter too, restarting its measurement
+	if _, err := Copy(io.Discard, &chunkReader{chunk: 1024, left: 100}, 1024, WithMeter(meter)); err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+	if total := meter.Total(); total != 100 {
+		t.Fatalf("copy total mismatch: have %d, want %d", total, 100)
+	}
+}
+
+// Tests that meters estimate the remaining time of transfers of known size, and
+// that copies of sources with known lengths set the expected size.
+func TestMeterETA(t *testing.T) {
+	meter := NewMeter(time.Second)
+	r, w := Pipe(64*1024, WithMeter(meter))
+	go w.Write(testData[:2*1024*1024])
+
+	if _, err := io.ReadFull(r, make([]byte, 1024*1024)); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if eta := meter.ETA(); eta != -1 {
+		t.Fatalf("unknown size eta mismatch: have %v, want -1", eta)
+	}
+	// Pending transfers should be estimated at the observed rate, which moved the
+	// first two thirds well within the window
+	if _, err := io.ReadFull(r, make([]byte, 1024*1024)); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	meter.Expect(3 * 1024 * 1024)
+	if eta := meter.ETA(); eta <= 0 || eta > time.Second {
+		t.Fatalf("eta out of bounds: have %v, want (0, %v]", eta, time.Second)
+	}
+	meter.Expect(2 * 1024 * 1024)
+	if eta := meter.ETA(); eta != 0 {
+		t.Fatalf("finished eta mismatch: have %v, want 0", eta)
+	}
+	// Expected copies should set the size automatically
+	meter.Expect(0)
+	if _, err := CopyExpect(io.Discard, &chunkReader{chunk: 1024, left: 100000}, 100000, 4096, WithMeter(meter)); err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+	if eta := meter.ETA(); eta != 0 {
+		t.Fatalf("expected copy eta mismatch: have %v, want 0", eta)
+	}
+}
@@ -0,0 +1,207 @@
+package bufioprop
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	// ErrInvalidQuorum is returned when creating a MirrorWriter with a quorum not
+	// satisfiable by its destinations.
+	ErrInvalidQuorum = errors.New("bufio: invalid mirror quorum")
+
+	// ErrQuorumLost is returned by a MirrorWriter once too many of its destinations
+	// failed for the rest to form a quorum.
+	ErrQuorumLost = errors.New("bufio: mirror quorum lost")
+)
+
+// A MirrorWriter replicates a stream into multiple destinations, each fed from its
+// own buffered pipe on a separate goroutine. A Write is acknowledged once quorum
+// of the destinations have accepted it, while the stragglers catch up from their
+// buffers in the background.
+//
+// A straggler falling behind by more than its buffer blocks Writes until it makes
+// room again, bounding the memory of the catch-up. Failed destinations drop out
+// of the replication; once fewer than quorum remain, the writer fails with
+// ErrQuorumLost.
+type MirrorWriter struct {
+	quorum  int       // Number of destinations needed to acknowledge a write
+	mirrors []*mirror // Destinations with their pipes and progress
+	live    int       // Number of destinations not yet failed
+
+	pos    int64 // Number of bytes written into the stream
+	err    error // Failure terminating the writer, if any
+	closed bool  // Whether the writer was already closed
+
+	lock sync.Mutex // Lock protecting the progress and failures of the mirrors
+	cond *sync.Cond // Signaler of progress or failure in any destination
+}
+
+// mirror is a single destination of a MirrorWriter.
+type mirror struct {
+	dst  io.Writer     // Destination to replicate the stream into
+	pw   *PipeWriter   // Write half of the pipe feeding the destination
+	left []byte        // Data of the current write not yet fitting into the pipe
+	done chan struct{} // Channel closed when the replication terminates
+
+	acked int64 // Number of bytes accepted by the destination
+	err   error // Failure of the destination, if any
+}
+
+// NewMirrorWriter creates a writer replicating into dsts, acknowledging writes
+// once quorum of them accepted the data. Every destination is fed through a pipe
+// of the given buffer size, configured by opts.
+func NewMirrorWriter(dsts []io.Writer, quorum int, buffer int, opts ...Option) (*MirrorWriter, error) {
+	if quorum < 1 || quorum > len(dsts) {
+		return nil, ErrInvalidQuorum
+	}
+	w := &MirrorWriter{
+		quorum:  quorum,
+		mirrors: make([]*mirror, len(dsts)),
+		live:    len(dsts),
+	}
+	w.cond = sync.NewCond(&w.lock)
+
+	c := newConfig(opts)
+	for i, dst := range dsts {
+		pr, pw, err := newPipe(buffer, c)
+		if err != nil {
+			for _, m := range w.mirrors[:i] {
+				m.pw.CloseWithError(err)
+			}
+			return nil, err
+		}
+		w.mirrors[i] = &mirror{dst: dst, pw: pw, done: make(chan struct{})}
+		go w.replicate(w.mirrors[i], pr)
+	}
+	return w, nil
+}
+
+// replicate streams the contents of a mirror's pipe into its destination, keeping
+// track of its progress.
+func (w *MirrorWriter) replicate(m *mirror, pr *PipeReader) {
+	defer close(m.done)
+
+	_, err := io.Copy(&mirrorAcker{w: w, m: m}, pr)
+	pr.CloseWithError(err)
+
+	if err != nil {
+		w.lock.Lock()
+		m.err = err
+		w.live--
+		w.cond.Broadcast()
+		w.lock.Unlock()
+	}
+}
+
+// mirrorAcker is a writer forwarding into a mirror's destination, accounting the
+// accepted bytes as acknowledged.
+type mirrorAcker struct {
+	w *MirrorWriter
+	m *mirror
+}
+
+// Write forwards data into the destination and signals the acknowledgement.
+func (a *mirrorAcker) Write(b []byte) (int, error) {
+	n, err := a.m.dst.Write(b)
+
+	a.w.lock.Lock()
+	a.m.acked += int64(n)
+	a.w.cond.Broadcast()
+	a.w.lock.Unlock()
+
+	return n, err
+}
+
+// Write replicates data into all the live destinations, returning once quorum of
+// them accepted it.
+func (w *MirrorWriter) Write(data []byte) (n int, err error) {
+	if err := w.failure(); err != nil {
+		return 0, err
+	}
+	// Buffer the data into all the pipes with room first, so that the healthy
+	// destinations don't wait on the stragglers to start writing
+	for _, m := range w.mirrors {
+		nw, _ := m.pw.TryWrite(data)
+		m.left = data[nw:]
+	}
+	for _, m := range w.mirrors {
+		if len(m.left) > 0 {
+			m.pw.Write(m.left) // failures are reported by the replicator
+		}
+		m.left = nil
+	}
+	// Wait until enough destinations acknowledge the data
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.pos += int64(len(data))
+	for {
+		if w.live < w.quorum {
+			w.err = ErrQuorumLost
+			return 0, w.err
+		}
+		var acks int
+		for _, m := range w.mirrors {
+			if m.err == nil && m.acked >= w.pos {
+				acks++
+			}
+		}
+		if acks >= w.quorum {
+			return len(data), nil
+		}
+		w.cond.Wait()
+	}
+}
+
+// failure returns the error a Write should fail with, if any.
+func (w *MirrorWriter) failure() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return ErrClosedPipe
+	}
+	return w.err
+}
+
+// Errors returns the failures of the individual destinations, in the order they
+// were given. Healthy destinations have a nil entry.
+func (w *MirrorWriter) Errors() []error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	errs := make([]error, len(w.mirrors))
+	for i, m := range w.mirrors {
+		errs[i] = m.err
+	}
+	return errs
+}
+
+// Close closes the writer, waiting for all the live destinations to catch up with
+// the stream. It returns ErrQuorumLost if fewer than quorum of the destinations
+// received the entire stream.
+func (w *MirrorWriter) Close() error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return ErrClosedPipe
+	}
+	w.closed = true
+	w.lock.Unlock()
+
+	for _, m := range w.mirrors {
+		m.pw.Close()
+	}
+	for _, m := range w.mirrors {
+		<-m.done
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.live < w.quorum {
+		return ErrQuorumLost
+	}
+	return nil
+}
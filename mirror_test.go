@@ -0,0 +1,89 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// gatedWriter is a destination blocking all writes until its gate is opened.
+type gatedWriter struct {
+	gate chan struct{}
+	buf  syncBuffer
+}
+
+func (w *gatedWriter) Write(b []byte) (int, error) {
+	<-w.gate
+	return w.buf.Write(b)
+}
+
+// Tests that writes are acknowledged by a quorum of the destinations, with the
+// stragglers catching up in the background.
+func TestMirrorWriter(t *testing.T) {
+	var (
+		fast     = new(syncBuffer)
+		straggle = &gatedWriter{gate: make(chan struct{})}
+		failing  = &failingWriter{limit: 1000, err: errors.New("destination failure")}
+	)
+	w, err := NewMirrorWriter([]io.Writer{fast, straggle, failing}, 1, 64*1024)
+	if err != nil {
+		t.Fatalf("failed to create mirror writer: %v", err)
+	}
+	// Writes fitting into the straggler's buffer should not wait for it
+	data := testData[:32*1024]
+	for i := 0; i < len(data); i += 1024 {
+		done := make(chan error, 1)
+		go func() {
+			_, err := w.Write(data[i : i+1024])
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("write blocked on the straggler")
+		}
+	}
+	close(straggle.gate)
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if fast.String() != string(data) || straggle.buf.String() != string(data) {
+		t.Fatalf("data mismatch: have %d and %d bytes, want %d", len(fast.String()), len(straggle.buf.String()), len(data))
+	}
+	if errs := w.Errors(); errs[0] != nil || errs[1] != nil || errs[2] == nil {
+		t.Fatalf("destination failures mismatch: have %v", errs)
+	}
+	if _, err := w.Write(data); err != ErrClosedPipe {
+		t.Fatalf("closed write error mismatch: have %v, want %v", err, ErrClosedPipe)
+	}
+}
+
+// Tests that the writer fails once too few destinations remain for a quorum.
+func TestMirrorWriterQuorumLost(t *testing.T) {
+	if _, err := NewMirrorWriter([]io.Writer{new(bytes.Buffer)}, 2, 1024); err != ErrInvalidQuorum {
+		t.Fatalf("quorum error mismatch: have %v, want %v", err, ErrInvalidQuorum)
+	}
+	w, err := NewMirrorWriter([]io.Writer{new(syncBuffer), &failingWriter{limit: 1000, err: errors.New("destination failure")}}, 2, 1024)
+	if err != nil {
+		t.Fatalf("failed to create mirror writer: %v", err)
+	}
+	for i := 0; ; i += 100 {
+		if i >= len(testData) {
+			t.Fatalf("quorum loss not detected")
+		}
+		if _, err := w.Write(testData[i : i+100]); err != nil {
+			if err != ErrQuorumLost {
+				t.Fatalf("write error mismatch: have %v, want %v", err, ErrQuorumLost)
+			}
+			break
+		}
+	}
+	if err := w.Close(); err != ErrQuorumLost {
+		t.Fatalf("close error mismatch: have %v, want %v", err, ErrQuorumLost)
+	}
+}
@@ -0,0 +1,56 @@
+package bufioprop
+
+import "io"
+
+// CopyMulti copies the concatenation of srcs to dst until either EOF is reached
+// on the last source or an error occurs. It returns the number of bytes written
+// into dst and the first error encountered, upon which the remaining sources are
+// not read.
+//
+// It behaves like copying from an io.MultiReader, but as the producer keeps
+// reading ahead into the shared buffer across source boundaries, the pipeline
+// stays primed between segments (e.g. the parts of a chunked download), instead
+// of draining at the end of every source. If the lengths of all sources are known
+// (see Copy), the internal buffer is capped to their sum.
+//
+// Any retry policy set via WithRetry sees the offset into the concatenated stream,
+// not into the failed source.
+func CopyMulti(dst io.Writer, srcs []io.Reader, buffer int, opts ...Option) (written int64, err error) {
+	c := newConfig(opts)
+
+	var total int64
+	for _, src := range srcs {
+		remaining, ok := sourceLen(src)
+		if !ok {
+			total = -1
+			break
+		}
+		total += remaining
+	}
+	if total >= 0 {
+		buffer = capBuffer(total, buffer)
+		if c.meter != nil {
+			c.meter.Expect(total)
+		}
+	}
+	src := io.MultiReader(srcs...)
+	if c.ownSrc {
+		src = &multiCloser{Reader: src, srcs: srcs}
+	}
+	return Copy(dst, src, buffer, opts...)
+}
+
+// multiCloser is the concatenation of owned sources, closing all of them when
+// the copy is done, not just the ones already read.
+type multiCloser struct {
+	io.Reader
+	srcs []io.Reader
+}
+
+// Close implements io.Closer, closing all the sources implementing it.
+func (m *multiCloser) Close() error {
+	for _, src := range m.srcs {
+		closeReader(src)
+	}
+	return nil
+}
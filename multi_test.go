@@ -0,0 +1,52 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// Tests that multiple sources are copied in order, back to back.
+func TestCopyMulti(t *testing.T) {
+	var (
+		srcs []io.Reader
+		want []byte
+	)
+	for i, size := range []int{0, 1, 333, 4096, 100000, 0, 7} {
+		part := testData[i*100000 : i*100000+size]
+		srcs = append(srcs, iotest.HalfReader(bytes.NewReader(part)))
+		want = append(want, part...)
+	}
+	dst := new(bytes.Buffer)
+	n, err := CopyMulti(dst, srcs, 1024)
+	if err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+	if n != int64(len(want)) || !bytes.Equal(dst.Bytes(), want) {
+		t.Fatalf("data mismatch: have %d bytes, want %d", n, len(want))
+	}
+	// Failures should abort the copy without touching the remaining sources
+	errSource := errors.New("source failure")
+	rest := bytes.NewReader([]byte("rest"))
+
+	dst.Reset()
+	srcs = []io.Reader{bytes.NewReader([]byte("head")), iotest.ErrReader(errSource), rest}
+	if n, err := CopyMulti(dst, srcs, 1024); n != 4 || err != errSource {
+		t.Fatalf("result mismatch: have (%d, %v), want (4, %v)", n, err, errSource)
+	}
+	if rest.Len() != 4 {
+		t.Fatalf("source after failure was read")
+	}
+}
+
+// Tests that the buffer is capped to the total length of sized sources.
+func TestCopyMultiBufferCap(t *testing.T) {
+	srcs := []io.Reader{bytes.NewReader(make([]byte, 10)), bytes.NewReader(make([]byte, 20))}
+
+	budget := NewBufferBudget(30, false)
+	if _, err := CopyMulti(io.Discard, srcs, 1024*1024, WithBudget(budget)); err != nil {
+		t.Fatalf("failed to copy with capped buffer: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package bufioprop
+
+import "errors"
+
+// ErrNegativeCount is returned when requesting a view or reservation of a
+// negative number of bytes.
+var ErrNegativeCount = errors.New("bufio: negative count")
+
+// Next returns a view of up to n contiguous bytes buffered in the pipe, blocking
+// until at least one is available. Parsers can run directly over the returned
+// slice, without copying the data into scratch buffers of their own.
+//
+// The view aliases the pipe's internal buffer, so its bytes are only consumed
+// (and the space released to the writer) at the next call to any of the read
+// methods; it must not be retained past that. Fewer than n bytes are returned if
+// less are buffered, or if the data wraps around the end of the ring. At the end
+// of the stream, Next returns io.EOF (or the writer's close error).
+func (r *PipeReader) Next(n int) ([]byte, error) {
+	r.p.outOwner.acquire("Next")
+	defer r.p.outOwner.release()
+
+	return r.p.next(n)
+}
+
+// Next consumes the previously returned view and returns a new one of up to n
+// contiguous bytes from the internal buffer.
+func (p *pipe) next(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, ErrNegativeCount
+	}
+	p.release()
+
+	// Short circuit if the output was already closed
+	select {
+	case <-p.outQuit:
+		return nil, ErrClosedPipe
+	default:
+	}
+	// Wait until some data becomes available
+	safeFree, err := p.outputWait()
+	if err != nil {
+		return nil, err
+	}
+	limit := p.outPos + p.size - safeFree
+	if limit > p.size {
+		limit = p.size
+	}
+	if limit > p.outPos+int32(n) {
+		limit = p.outPos + int32(n)
+	}
+	view := p.buffer[p.outPos:limit:limit]
+	p.viewed = len(view)
+
+	return view, nil
+}
+
+// Release consumes the data of the last view returned by Next, if any.
+func (p *pipe) release() {
+	if p.viewed > 0 {
+		p.outputAdvance(p.viewed)
+		p.viewed = 0
+	}
+}
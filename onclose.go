@@ -0,0 +1,66 @@
+package bufioprop
+
+// CloseInfo is the final state of a terminated pipe, passed to the callbacks set
+// via OnClose.
+type CloseInfo struct {
+	Err     error // Terminal error of the pipe, as reported by PipeReader.Err
+	Written int64 // Number of bytes written into the pipe
+	Read    int64 // Number of bytes read out of the pipe
+}
+
+// OnClose registers a callback to be invoked exactly once, when both halves of
+// the pipe have been closed. If the pipe has already terminated, the callback is
+// invoked immediately on the calling goroutine, otherwise on the goroutine which
+// closes the last half.
+func (r *PipeReader) OnClose(fn func(CloseInfo)) {
+	r.p.addOnClose(fn)
+}
+
+// OnClose registers a callback to be invoked exactly once, when both halves of
+// the pipe have been closed. If the pipe has already terminated, the callback is
+// invoked immediately on the calling goroutine, otherwise on the goroutine which
+// closes the last half.
+func (w *PipeWriter) OnClose(fn func(CloseInfo)) {
+	w.p.addOnClose(fn)
+}
+
+// addOnClose queues up a termination callback, or runs it if the pipe's already
+// been torn down.
+func (p *pipe) addOnClose(fn func(CloseInfo)) {
+	p.doneLock.Lock()
+	if !p.done {
+		p.onClose = append(p.onClose, fn)
+		p.doneLock.Unlock()
+		return
+	}
+	p.doneLock.Unlock()
+
+	fn(p.closeInfo())
+}
+
+// runOnClose marks the pipe terminated and invokes all the registered callbacks.
+// It must only be called once, after both halves have been closed.
+func (p *pipe) runOnClose() {
+	p.doneLock.Lock()
+	callbacks := p.onClose
+	p.onClose, p.done = nil, true
+	p.doneLock.Unlock()
+
+	if len(callbacks) == 0 {
+		return
+	}
+	info := p.closeInfo()
+	for _, fn := range callbacks {
+		fn(info)
+	}
+}
+
+// closeInfo assembles the final state of a terminated pipe.
+func (p *pipe) closeInfo() CloseInfo {
+	read := p.tail.Load()
+	return CloseInfo{
+		Err:     p.termErr(),
+		Written: int64(p.head.Load()),
+		Read:    int64(read),
+	}
+}
@@ -0,0 +1,591 @@
+package bufioprop
+
+import (
+	"hash"
+	"time"
+)
+
+// An Option configures optional behavior of a pipe or a buffered copy.
+type Option func(*config)
+
+// defaultEmptyReads is the number of consecutive empty reads tolerated from the
+// source before giving up, matching the limit of bufio.Reader.
+const defaultEmptyReads = 100
+
+// Config is the collection of tunables assembled from the user's options.
+type config struct {
+	wake      WakeStrategy // Signaling mode used to wake up a sleeping side
+	wakeBatch int          // Bytes to advance before signaling the other side (0 = always)
+	spin      SpinPolicy   // Whether to spin before parking, adaptively or always
+
+	block    int  // Fixed size of the blocks to write out (0 = arbitrary)
+	blockPad bool // Whether to zero pad the final partial block
+
+	emptyReads   int // Consecutive empty source reads tolerated in ReadFrom
+	shortRetries int // Consecutive stalled short writes retried in WriteTo
+	readChunk    int // Maximum number of bytes requested per source read (0 = all free)
+
+	stats *Stats // Counters to accumulate the pipe's events into
+	meter *Meter // Throughput meter to attach to the pipe (nil = none)
+
+	drain         bool // Whether Copy drains the source after a destination failure
+	uring         bool // Whether to transfer file endpoints via io_uring (Linux only)
+	discard       bool // Whether writes are silently dropped after the reader closes
+	resident      bool // Whether Copy keeps the data resident in its buffer compressed
+	residentLevel int  // Flate compression level of the resident data
+	abortOnError  bool // Whether a writer failure drops the buffered data instead of draining it
+	wipe          bool // Whether the pipe zeroes consumed data and its buffer on close
+	double        bool // Whether Copy uses the double buffered engine instead of a ring
+	chunk         int  // Chunk size of Copy's pooled chunk engine (0 = use a ring)
+
+	sched  *Scheduler // Bandwidth scheduler to join (nil = unlimited)
+	weight int        // Weight of the pipe within the scheduler
+
+	budget *BufferBudget // Memory budget to account the buffer against (nil = none)
+
+	name string // Name of the copy to label its goroutines with for profiling
+	tag  string // Tag to account the pipe's traffic under (empty = none)
+
+	cancel *canceler // Cancellation of the copy by its group or context (nil = none)
+	squash *squasher // Compressing source of a resident compressed copy (nil = none)
+	group  Spawner   // Spawner to start the copy's producer goroutine with (nil = go)
+
+	pinProducer int // CPU to pin the producer goroutine's thread to (-1 = none)
+	pinConsumer int // CPU to pin the consumer goroutine's thread to (-1 = none)
+
+	compressions []compression // User formats recognized by CopyDecompress
+
+	segmentHash func() hash.Hash // Constructor of the digest of CopySegments (nil = none)
+	maxLine     int              // Maximum length of the lines of CopyLines (0 = MaxLineLength)
+
+	flushIdle  bool // Whether to flush the destination when the pipe runs dry
+	flushDelim int  // Record delimiter to flush the destination after (-1 = none)
+	flushDone  bool // Whether to flush the destination after a successful copy
+	closeDone  bool // Whether to close the destination after a successful copy
+	fileSync   bool // Whether CopyFile syncs the destination to stable storage
+
+	ownSrc bool // Whether the copy closes its source when done
+	ownDst bool // Whether the copy closes its destination when done
+
+	unexpectedEOF bool // Whether CopyExpect reports short sources like io.ReadFull
+	ioCompat      bool // Whether the pipe mimics the error semantics of io.Pipe
+	ownerChecks   bool // Whether concurrent calls on the same pipe half panic
+
+	retry      *RetryPolicy      // Policy to recover copies from source failures (nil = none)
+	writeRetry *WriteRetryPolicy // Policy to ride out transient destination failures (nil = none)
+
+	failReplay int                                       // Stream tail to replay into failover destinations
+	failHook   func(failed int, err error, offset int64) // Callback notified of failovers (nil = none)
+
+	sim *simHooks // Scheduling hooks injected by tests (nil = none)
+
+	report    *CopyReport                      // Report to fill in with the copy's termination details (nil = none)
+	errFilter func(side Side, err error) error // Translator of the errors a copy returns (nil = none)
+
+	idle time.Duration // Idle period after which to release the buffer (0 = never)
+
+	lowMark  int // Occupancy to resume reading the source at in ReadFrom
+	highMark int // Occupancy to stop reading the source at in ReadFrom (0 = never)
+}
+
+// newConfig assembles a configuration from the defaults and the user options.
+func newConfig(opts []Option) *config {
+	c := &config{
+		wake:       defaultWake,
+		emptyReads: defaultEmptyReads,
+		flushDelim: -1,
+
+		pinProducer: -1,
+		pinConsumer: -1,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.stats == nil {
+		c.stats = new(Stats)
+	}
+	if c.ownDst {
+		c.closeDone = false // owned destinations are closed on every exit path
+	}
+	return c
+}
+
+// WithWakeStrategy sets the signaling mode used to wake up a side of the pipe
+// which went to sleep waiting for the other one. The default is WakeEdge, apart
+// from the portable backend (js/wasm, appengine) which defaults to WakeLevel.
+func WithWakeStrategy(strategy WakeStrategy) Option {
+	return func(c *config) {
+		c.wake = strategy
+	}
+}
+
+// WithSpinPolicy sets whether a side of the pipe waiting for the other one spins
+// before parking. The default is SpinAdaptive, skipping the spinning after long
+// waits; SpinAlways restores the unconditional spinning, trading CPU for the
+// lowest wake latency on endpoints with erratic timing.
+func WithSpinPolicy(policy SpinPolicy) Option {
+	return func(c *config) {
+		c.spin = policy
+	}
+}
+
+// WithWakeBatch makes each side of the pipe signal the other only after advancing
+// at least bytes since the last signal, instead of on every advance. This cuts the
+// signaling overhead of very small reads and writes. A side is still signaled right
+// away if the buffer was empty (or full) before, since it may be asleep waiting for
+// any progress, and all pending progress is signaled before a side goes to sleep.
+//
+// A reader waiting for more data than already buffered (e.g. the rest of a line in
+// CopyLines) may be woken late, once the batch fills up, or the writer blocks or
+// closes.
+func WithWakeBatch(bytes int) Option {
+	return func(c *config) {
+		c.wakeBatch = bytes
+	}
+}
+
+// WithBlockWrites switches the pipe's WriteTo (and thus Copy) into block mode,
+// where the destination is always handed fixed size chunks of block bytes, read
+// directly from memory aligned to the block size (up to a 4KB page). This suits
+// alignment sensitive sinks like O_DIRECT files and tape devices.
+//
+// The internal buffer is rounded up to a multiple of the block size, holding at
+// least two blocks so the producer can fill one while the other is written out.
+// The final partial block is either zero padded to full size if pad is set, or
+// written out short otherwise. Any padding is included in the written counts.
+//
+// Note, mixing Read calls with WriteTo on a block mode pipe voids alignment.
+func WithBlockWrites(block int, pad bool) Option {
+	return func(c *config) {
+		c.block = block
+		c.blockPad = pad
+	}
+}
+
+// WithStats sets the counters into which the pipe accumulates notable events. It
+// permits observing the internals of a Copy while it's running, and the same
+// stats may be shared by multiple pipes to aggregate their events.
+func WithStats(stats *Stats) Option {
+	return func(c *config) {
+		c.stats = stats
+	}
+}
+
+// WithEmptyReadLimit sets the number of consecutive reads returning no data and
+// no error that ReadFrom (and thus Copy) tolerates from the source before giving
+// up with io.ErrNoProgress. A non-positive limit disables the check, retrying
+// the source indefinitely. The default is 100.
+func WithEmptyReadLimit(limit int) Option {
+	return func(c *config) {
+		c.emptyReads = limit
+	}
+}
+
+// WithDrainOnError sets whether Copy keeps reading the source to completion after
+// the destination failed, discarding the remaining data, instead of aborting the
+// source immediately. Draining allows reusing connections (e.g. HTTP keepalive)
+// even if the sink broke down. The destination's error is returned either way.
+func WithDrainOnError(drain bool) Option {
+	return func(c *config) {
+		c.drain = drain
+	}
+}
+
+// WithShortWriteRetries makes WriteTo (and thus Copy) retry writing the remainder
+// of a chunk after the destination accepted only part of it without an error,
+// as some writers (e.g. rate limiters) expect the caller to loop. Retrying goes
+// on while progress is made, giving up with a *ShortWriteError after the given
+// number of consecutive writes accepting nothing. The default of 0 disables any
+// retries, failing on the first short write.
+func WithShortWriteRetries(retries int) Option {
+	return func(c *config) {
+		c.shortRetries = retries
+	}
+}
+
+// WithIOUring opts into the experimental io_uring backend on Linux. If the source
+// of ReadFrom or the destination of WriteTo is a regular *os.File (not a pipe or
+// socket, which stay on the interruptible poller), the free (or filled)
+// segments of a wrapped buffer are transferred with a single linked submission,
+// halving the syscalls per cycle. If io_uring is not available (old kernel, other
+// platform, disabled via sysctl), the regular read/write loops are used.
+func WithIOUring() Option {
+	return func(c *config) {
+		c.uring = true
+	}
+}
+
+// WithScheduler makes the pipe (or copy) join a scheduler, receiving a share of
+// its total bandwidth proportional to weight (minimum 1) relative to the other
+// active pipes. A pipe leaves the scheduler when its write half is closed.
+func WithScheduler(sched *Scheduler, weight int) Option {
+	return func(c *config) {
+		c.sched = sched
+		c.weight = weight
+	}
+}
+
+// WithBudget accounts the pipe's (or copy's) buffer against a memory budget
+// shared with other pipes. The memory is returned to the budget once both halves
+// of the pipe are closed.
+func WithBudget(budget *BufferBudget) Option {
+	return func(c *config) {
+		c.budget = budget
+	}
+}
+
+// WithName sets the name of a copy, attached as the "bufio.name" profiler label
+// to its goroutines, next to the "bufio.copy" unique identifier and the
+// "bufio.side" (producer or consumer) labels always present.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithTag accounts the bytes moving through the pipe (or the copy's internal pipe)
+// under a tag, aggregated with all other pipes of the same tag in a package-wide
+// registry, e.g. to meter the traffic of the tenants of a proxy. See Tagged and
+// AllTagged for retrieving the counts, and ForgetTag for releasing them.
+//
+// Copies running without a pipe (WithDoubleBuffer, WithChunkPool) are not
+// accounted.
+func WithTag(tag string) Option {
+	return func(c *config) {
+		c.tag = tag
+	}
+}
+
+// WithDecompressor registers an additional compression format recognized by the
+// magic bytes its streams start with, for CopyDecompress to transparently insert
+// its decompressor. User formats take precedence over the builtin ones, so this
+// is also the way to supply a decompressor for Zstandard.
+func WithDecompressor(magic []byte, decomp Decompressor) Option {
+	return func(c *config) {
+		c.compressions = append(c.compressions, compression{magic: magic, decomp: decomp})
+	}
+}
+
+// WithFlushOnIdle makes the pipe's WriteTo (and thus the copies) flush destinations
+// implementing Flush() error, such as a *bufio.Writer, whenever the pipe runs dry,
+// so that data doesn't sit in the destination's buffer while the source stalls.
+//
+// Flushed destinations are written to directly, even if they implement
+// io.ReaderFrom, as their own copy loop would hold data back.
+func WithFlushOnIdle() Option {
+	return func(c *config) {
+		c.flushIdle = true
+	}
+}
+
+// WithFlushOnDelim makes the pipe's WriteTo (and thus the copies) flush destinations
+// implementing Flush() error after every write containing the delim record boundary
+// (e.g. a newline), so that complete records are passed on without delay.
+func WithFlushOnDelim(delim byte) Option {
+	return func(c *config) {
+		c.flushDelim = int(delim)
+	}
+}
+
+// WithFlushOnSuccess makes copies flush destinations implementing Flush() error,
+// such as a *bufio.Writer, once all data was written successfully, so that the
+// tail of the stream isn't left behind in the destination's buffer. Any failure
+// of the flush is returned as the copy's error.
+func WithFlushOnSuccess() Option {
+	return func(c *config) {
+		c.flushDone = true
+	}
+}
+
+// WithCloseOnSuccess makes copies close destinations implementing io.Closer, such
+// as a *gzip.Writer, once all data was written successfully, so that any trailers
+// are emitted. If flushing on success is also enabled, the destination is flushed
+// before being closed. Any failure of the close is returned as the copy's error.
+//
+// Destinations are left open if the copy fails, so the caller can still abort or
+// inspect them.
+func WithCloseOnSuccess() Option {
+	return func(c *config) {
+		c.closeDone = true
+	}
+}
+
+// WithWatermarks throttles the pipe's ReadFrom (and thus the copies) to keep the
+// buffer's occupancy between two marks. Instead of reading from the source into
+// every free byte, the producer stops once high bytes are buffered and only resumes
+// when the reader drained the buffer down to low bytes. This bounds the data read
+// ahead from the source and batches the reads when the consumer is slow.
+//
+// The high mark is capped to the buffer size and the low mark to below the high
+// one. Watermarks take precedence over WithIOUring, reading files in plain.
+func WithWatermarks(low, high int) Option {
+	return func(c *config) {
+		c.lowMark, c.highMark = low, high
+	}
+}
+
+// WithDiscardOnClose makes writes into the pipe silently succeed, dropping their
+// data, once the reader is closed, instead of failing with ErrClosedPipe. It suits
+// fire-and-forget producers (e.g. telemetry) not caring whether anyone listens.
+// ReadFrom keeps draining its source into the void until EOF. Writes after the
+// writer itself was closed still fail.
+func WithDiscardOnClose() Option {
+	return func(c *config) {
+		c.discard = true
+	}
+}
+
+// WithUnexpectedEOF makes CopyExpect report a source ending before the expected
+// length the way io.ReadFull does, with io.EOF if no data was read at all and
+// io.ErrUnexpectedEOF otherwise, instead of a *TransferError. It lets callers
+// verifying content lengths handle truncation like any other short read.
+func WithUnexpectedEOF() Option {
+	return func(c *config) {
+		c.unexpectedEOF = true
+	}
+}
+
+// WithReadChunk caps the number of bytes ReadFrom (and thus Copy) requests from the
+// source in a single read, instead of offering it the entire free region of the
+// buffer. Smaller reads hand data to the reader sooner, larger ones amortize the
+// cost of the source's calls; the default is to offer all the free space. The cap
+// does not apply to io_uring transfers.
+func WithReadChunk(size int) Option {
+	return func(c *config) {
+		c.readChunk = size
+	}
+}
+
+// WithDoubleBuffer makes Copy move the data through two swapped buffers of the
+// given buffer size each (so twice the memory), instead of a ring. Every source
+// read is offered the entire remaining space of a buffer without wraparound
+// splitting it, which can favor large sequential transfers (e.g. file to file).
+//
+// The engine honors the buffer budget, WithDrainOnError, WithEmptyReadLimit and
+// the flush and close on success options, but none of the ones tuning the ring
+// itself. Of the counters collected via WithStats, only the source read ones are
+// updated, the write side and stall counters are specific to the ring.
+func WithDoubleBuffer() Option {
+	return func(c *config) {
+		c.double = true
+	}
+}
+
+// WithChunkPool makes Copy pass the data through a channel of fixed size chunks
+// taken from a process wide pool, instead of a dedicated ring. At most buffer
+// bytes worth of chunks are queued up, and they're returned to the pool as soon as
+// written, so many concurrent copies moving little data share their memory
+// instead of each holding onto a full sized buffer.
+//
+// Every source read fills at most a single chunk, so chunks should be sized to
+// the typical read of the source. As with WithDoubleBuffer, the options tuning
+// the ring itself have no effect, and only the source read counters of WithStats
+// are updated.
+func WithChunkPool(size int) Option {
+	return func(c *config) {
+		c.chunk = size
+	}
+}
+
+// WithAffinity pins the producer and consumer goroutines of a copy to their OS
+// threads, restricting the threads to the given CPUs (on Linux; elsewhere they're
+// only locked to their threads). The ring is allocated after pinning the consumer
+// and its pages touched from there, so on NUMA machines its memory is local to
+// the consumer. A negative CPU leaves that side unpinned.
+//
+// Pinning can help saturating multi-socket machines with few, very high volume
+// copies, but it hurts when the CPUs are shared with other work; measure first.
+func WithAffinity(producer, consumer int) Option {
+	return func(c *config) {
+		c.pinProducer, c.pinConsumer = producer, consumer
+	}
+}
+
+// WithOwnership hands the ownership of the copied source and/or destination over
+// to the copy, which closes them (if they implement io.Closer) on all exit paths:
+// success, failure, cancellation and panics alike. It saves callers from leaking
+// endpoints such as HTTP response bodies when the copy fails.
+//
+// A failure closing an owned destination is returned as the copy's error if the
+// copy succeeded otherwise, subsuming WithCloseOnSuccess. Failures closing the
+// source are ignored. CopyFile manages its files itself, ignoring the option.
+func WithOwnership(src, dst bool) Option {
+	return func(c *config) {
+		c.ownSrc, c.ownDst = src, dst
+	}
+}
+
+// WithMeter attaches a throughput meter to the pipe (or the copy's internal pipe),
+// measuring the bytes read out of it. Attaching the meter to a new pipe restarts
+// its measurement. The double buffered and chunk pool copy engines don't feed
+// meters.
+func WithMeter(meter *Meter) Option {
+	return func(c *config) {
+		c.meter = meter
+	}
+}
+
+// WithSegmentHash makes CopySegments digest every segment with a fresh hash from
+// the given constructor (e.g. sha256.New), passing the sum to its callback.
+func WithSegmentHash(fn func() hash.Hash) Option {
+	return func(c *config) {
+		c.segmentHash = fn
+	}
+}
+
+// WithMaxLineLength sets the maximum length of the lines CopyLines passes to its
+// callback, including the terminating newline, beyond which the copy fails with
+// ErrLineTooLong. A non-positive length restores the default of MaxLineLength.
+func WithMaxLineLength(length int) Option {
+	return func(c *config) {
+		c.maxLine = length
+	}
+}
+
+// WithAbortOnError makes closing the writer with a non-nil error surface it to
+// the reader right away, dropping any data still buffered, instead of letting the
+// reader drain that data first. It suits protocols where a failed producer voids
+// the whole stream (e.g. a transaction), whereas the default suits ones where any
+// data delivered before the failure is still usable (e.g. a log). A plain Close
+// always lets the reader drain the buffer before seeing EOF.
+func WithAbortOnError() Option {
+	return func(c *config) {
+		c.abortOnError = true
+	}
+}
+
+// WithOwnerChecks makes the pipe detect parallel calls to the methods of the same
+// half (e.g. two concurrent Reads or a Write racing a ReadFrom), which are not
+// safe and would otherwise silently corrupt the stream. The offending call panics
+// with a *MisuseError carrying the call stacks of both methods. Closing either half
+// remains safe in parallel with anything.
+//
+// The checks cost an allocation and a stack capture per call, so they're meant for
+// debugging and tests rather than production hot paths.
+func WithOwnerChecks() Option {
+	return func(c *config) {
+		c.ownerChecks = true
+	}
+}
+
+// WithSecureWipe makes the pipe zero out the data in its internal buffer as soon
+// as it's consumed by the reader, and the whole buffer once both halves are closed
+// (including any data left unread), so pipes carrying secrets don't leave copies
+// of them lingering in memory. The wiping costs an extra pass over the data.
+//
+// Durable pipes only wipe the consumed data, as the unread data in their file is
+// retained for when the pipe is reopened.
+//
+// Only the pipe's own buffer is wiped, not the slices passed to or returned from
+// its methods. Copies running without a pipe (WithDoubleBuffer, WithChunkPool) or
+// compressing it (WithResidentCompression) don't wipe their internal buffers.
+func WithSecureWipe() Option {
+	return func(c *config) {
+		c.wipe = true
+	}
+}
+
+// WithResidentCompression makes Copy keep the data resident in its internal buffer
+// compressed with the given compress/flate level, trading CPU for more effective
+// buffer capacity, e.g. when buffering highly compressible logs ahead of a slow
+// sink in a memory constrained environment. The data is compressed as it's read
+// from the source and decompressed as it's written into the destination.
+//
+// The option is experimental and only honored by Copy running its ring buffer
+// engine, not combined with WithRetry. Counters observing the pipe (meters, tags
+// and stats) see the compressed stream. An invalid level fails the copy.
+func WithResidentCompression(level int) Option {
+	return func(c *config) {
+		c.resident, c.residentLevel = true, level
+	}
+}
+
+// WithFileSync makes CopyFile sync the destination file to stable storage after a
+// successful copy, so the data survives a crash once it returns.
+func WithFileSync() Option {
+	return func(c *config) {
+		c.fileSync = true
+	}
+}
+
+// WithFailoverReplay makes CopyFailover retain the last window bytes written into
+// the active destination, replaying them into the next one if it fails. It guards
+// against destinations losing data they acknowledged before failing.
+func WithFailoverReplay(window int) Option {
+	return func(c *config) {
+		c.failReplay = window
+	}
+}
+
+// WithFailoverHook sets a callback CopyFailover notifies whenever a destination
+// fails, with the index of the failed destination, its failure, and the stream
+// offset the next destination receives data from (including any replayed tail).
+func WithFailoverHook(fn func(failed int, err error, offset int64)) Option {
+	return func(c *config) {
+		c.failHook = fn
+	}
+}
+
+// WithRetry makes copies recover from failures of their source according to the
+// given policy, reconnecting and resuming the stream where it broke off instead
+// of failing the entire copy.
+func WithRetry(policy *RetryPolicy) Option {
+	return func(c *config) {
+		c.retry = policy
+	}
+}
+
+// WithWriteRetry makes copies ride out transient failures of their destination
+// (by default timeouts, e.g. from write deadlines on a flaky connection) according
+// to the given policy, retrying the failed write after a backoff instead of failing
+// the entire copy. Only once the retries run out is the failure returned.
+//
+// Destinations implementing io.ReaderFrom are written to directly instead of via
+// their ReadFrom, as its failures can't be retried from outside. Copies running
+// without a pipe (WithDoubleBuffer, WithChunkPool) don't retry their writes.
+func WithWriteRetry(policy *WriteRetryPolicy) Option {
+	return func(c *config) {
+		c.writeRetry = policy
+	}
+}
+
+// WithReport sets the report into which a copy records, upon returning, how its
+// two sides terminated: which one finished first, the bytes each processed and
+// their individual errors. It permits telling whether data read from the source
+// was still buffered in flight when the destination failed or was canceled.
+func WithReport(report *CopyReport) Option {
+	return func(c *config) {
+		c.report = report
+	}
+}
+
+// WithErrorFilter sets a callback through which a copy passes the error it is
+// about to return, along with the side it originated from, returning the error to
+// report instead (possibly nil, to suppress it). It permits translating internal
+// errors at the copy boundary (e.g. ErrClosedPipe into context.Canceled), without
+// wrapping every call.
+//
+// Only the failures of the two sides are filtered, errors setting up the copy (e.g.
+// an invalid buffer size) are returned as is. A WithReport report records the
+// errors prior to filtering.
+func WithErrorFilter(fn func(side Side, err error) error) Option {
+	return func(c *config) {
+		c.errFilter = fn
+	}
+}
+
+// WithIdleRelease makes the pipe release its internal buffer once the writer has
+// been idle and all data was consumed for the given period, reallocating it upon
+// the next write. It suits long-lived pipes bursting rarely, such as those kept
+// in connection pools, trading an allocation per burst for not holding on to the
+// memory. Any budget set via WithBudget keeps accounting for the buffer, so that
+// the reallocation can't fail.
+//
+// A writer blocked within ReadFrom (and thus Copy) reads directly into the buffer,
+// holding on to it for the entire call; release works with the producers writing
+// into the pipe in bursts via Write, TryWrite or Reserve.
+func WithIdleRelease(timeout time.Duration) Option {
+	return func(c *config) {
+		c.idle = timeout
+	}
+}
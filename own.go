@@ -0,0 +1,30 @@
+package bufioprop
+
+import "io"
+
+// closeOwned closes the endpoints of a finished copy which it was handed the
+// ownership of, if they implement io.Closer. The destination's close failure is
+// reported as the copy's error if it succeeded otherwise, the source's is never.
+func closeOwned(dst io.Writer, src io.Reader, c *config, err *error) {
+	if c.ownSrc {
+		closeReader(src)
+	}
+	if c.ownDst {
+		if cl, ok := dst.(io.Closer); ok {
+			if cerr := cl.Close(); *err == nil {
+				*err = cerr
+			}
+		}
+	}
+}
+
+// closeReader closes a source if it implements io.Closer, unwrapping limited
+// readers to close the underlying one.
+func closeReader(src io.Reader) {
+	if lr, ok := src.(*io.LimitedReader); ok {
+		src = lr.R
+	}
+	if cl, ok := src.(io.Closer); ok {
+		cl.Close()
+	}
+}
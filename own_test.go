@@ -0,0 +1,138 @@
+package bufioprop
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+)
+
+// ownedReader is a source tracking whether it was closed.
+type ownedReader struct {
+	io.Reader
+	closed atomic.Bool
+}
+
+func (r *ownedReader) Close() error { r.closed.Store(true); return nil }
+
+// ownedSizer is a source of known length tracking whether it was closed.
+type ownedSizer struct {
+	*bytes.Reader
+	closed atomic.Bool
+}
+
+func (r *ownedSizer) Close() error { r.closed.Store(true); return nil }
+
+// ownedWriter is a destination tracking whether it was closed, failing the close
+// with err.
+type ownedWriter struct {
+	io.Writer
+	closed atomic.Bool
+	err    error
+}
+
+func (w *ownedWriter) Close() error { w.closed.Store(true); return w.err }
+
+// Tests that copies owning their endpoints close them on all exit paths, across
+// all the copy engines, and leave them open otherwise.
+func TestCopyOwnership(t *testing.T) {
+	errBoom := errors.New("boom")
+	engines := []struct {
+		name string
+		opts []Option
+	}{
+		{"ring", nil},
+		{"double", []Option{WithDoubleBuffer()}},
+		{"chunked", []Option{WithChunkPool(1024)}},
+	}
+	for _, engine := range engines {
+		opts := append([]Option{WithOwnership(true, true)}, engine.opts...)
+
+		// Successful copies should close both ends, reporting destination failures
+		src := &ownedReader{Reader: bytes.NewReader(testData[:100000])}
+		dst := &ownedWriter{Writer: io.Discard, err: errBoom}
+		if _, err := Copy(dst, src, 4096, opts...); err != errBoom {
+			t.Errorf("%s: success error mismatch: have %v, want %v", engine.name, err, errBoom)
+		}
+		if !src.closed.Load() || !dst.closed.Load() {
+			t.Errorf("%s: success close mismatch: have (%v, %v), want (true, true)", engine.name, src.closed.Load(), dst.closed.Load())
+		}
+		// Failed copies should close both ends, retaining the original error
+		src = &ownedReader{Reader: &errDataReader{data: testData[:100000], chunk: 1000, err: errBoom}}
+		dst = &ownedWriter{Writer: io.Discard, err: errors.New("close")}
+		if _, err := Copy(dst, src, 4096, opts...); err != errBoom {
+			t.Errorf("%s: failure error mismatch: have %v, want %v", engine.name, err, errBoom)
+		}
+		if !src.closed.Load() || !dst.closed.Load() {
+			t.Errorf("%s: failure close mismatch: have (%v, %v), want (true, true)", engine.name, src.closed.Load(), dst.closed.Load())
+		}
+		// Panicking destinations should close both ends
+		src = &ownedReader{Reader: bytes.NewReader(testData[:100000])}
+		func() {
+			defer func() { recover() }()
+			Copy(&struct {
+				panickingWriter
+				io.Closer
+			}{}, src, 4096, opts...)
+		}()
+		if !src.closed.Load() {
+			t.Errorf("%s: panic left source open", engine.name)
+		}
+		// Copies not owning their ends should leave them open
+		src = &ownedReader{Reader: bytes.NewReader(testData[:100000])}
+		dst = &ownedWriter{Writer: io.Discard}
+		if _, err := Copy(dst, src, 4096, engine.opts...); err != nil {
+			t.Errorf("%s: unowned copy failed: %v", engine.name, err)
+		}
+		if src.closed.Load() || dst.closed.Load() {
+			t.Errorf("%s: unowned close mismatch: have (%v, %v), want (false, false)", engine.name, src.closed.Load(), dst.closed.Load())
+		}
+	}
+}
+
+// Tests that the copy variants not passing their endpoints straight to a copy
+// engine also close them when owned.
+func TestCopyOwnershipVariants(t *testing.T) {
+	// Tiny copies are done synchronously
+	tiny := &ownedSizer{Reader: bytes.NewReader(testData[:100])}
+	dst := &ownedWriter{Writer: io.Discard}
+	if _, err := Copy(dst, tiny, 4096, WithOwnership(true, true)); err != nil {
+		t.Fatalf("tiny copy failed: %v", err)
+	}
+	if !tiny.closed.Load() || !dst.closed.Load() {
+		t.Errorf("tiny close mismatch: have (%v, %v), want (true, true)", tiny.closed.Load(), dst.closed.Load())
+	}
+	// Expected copies wrap the source into a limited reader
+	src := &ownedReader{Reader: bytes.NewReader(testData[:100000])}
+	if _, err := CopyExpect(io.Discard, src, 100000, 4096, WithOwnership(true, false)); err != nil {
+		t.Fatalf("expected copy failed: %v", err)
+	}
+	if !src.closed.Load() {
+		t.Errorf("expected copy left source open")
+	}
+	// Multi copies should close all sources, even the unread ones
+	srcs := []*ownedReader{
+		{Reader: &errDataReader{data: testData[:1000], chunk: 100, err: errors.New("boom")}},
+		{Reader: bytes.NewReader(testData[:1000])},
+	}
+	CopyMulti(io.Discard, []io.Reader{srcs[0], srcs[1]}, 4096, WithOwnership(true, false))
+	for i, src := range srcs {
+		if !src.closed.Load() {
+			t.Errorf("multi copy left source %d open", i)
+		}
+	}
+	// Canceled copies should close both ends
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	src = &ownedReader{Reader: &chunkReader{chunk: 1024, left: 1 << 30}}
+	dst = &ownedWriter{Writer: io.Discard}
+	if _, err := CopyContext(ctx, dst, src, 4096, WithOwnership(true, true)); err != context.Canceled {
+		t.Fatalf("canceled copy error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	if !src.closed.Load() || !dst.closed.Load() {
+		t.Errorf("canceled close mismatch: have (%v, %v), want (true, true)", src.closed.Load(), dst.closed.Load())
+	}
+}
@@ -0,0 +1,89 @@
+package bufioprop
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// MisuseError is the value the methods of a pipe created with WithOwnerChecks
+// panic with when called concurrently with another method of the same half (e.g.
+// two parallel Reads), which would otherwise silently corrupt the stream.
+type MisuseError struct {
+	Half       string // Half of the pipe misused ("reader" or "writer")
+	Op         string // Method called while the half was busy
+	OwnerOp    string // Method already in progress on the half (empty = returned meanwhile)
+	Stack      string // Call stack of the method called while the half was busy
+	OwnerStack string // Call stack of the method already in progress
+}
+
+// Error implements error, including the call stacks of both methods.
+func (e *MisuseError) Error() string {
+	if e.OwnerOp == "" {
+		return fmt.Sprintf("bufio: concurrent %s %s\n\n%s", e.Half, e.Op, e.Stack)
+	}
+	return fmt.Sprintf("bufio: concurrent %s %s while %s in progress\n\n%s\n%s:\n%s", e.Half, e.Op, e.OwnerOp, e.Stack, e.OwnerOp, e.OwnerStack)
+}
+
+// owner tracks the method currently running on one half of a pipe, detecting any
+// concurrent calls. A nil owner disables the checks.
+type owner struct {
+	half   string                    // Half of the pipe guarded ("reader" or "writer")
+	holder atomic.Pointer[ownerCall] // Method currently running on the half (nil = idle)
+}
+
+// ownerCall is a method call holding the ownership of a half.
+type ownerCall struct {
+	op  string    // Name of the method called
+	pcs []uintptr // Program counters of the caller's stack
+}
+
+// newOwner creates the ownership tracker of a pipe half, if checks are enabled.
+func newOwner(half string, enabled bool) *owner {
+	if !enabled {
+		return nil
+	}
+	return &owner{half: half}
+}
+
+// acquire marks the half as owned by the calling method, panicking with a
+// *MisuseError if another method is already running on it.
+func (o *owner) acquire(op string) {
+	if o == nil {
+		return
+	}
+	pcs := make([]uintptr, 32)
+	call := &ownerCall{op: op, pcs: pcs[:runtime.Callers(3, pcs)]}
+	if o.holder.CompareAndSwap(nil, call) {
+		return
+	}
+	err := &MisuseError{Half: o.half, Op: op, Stack: formatStack(call.pcs)}
+	if prev := o.holder.Load(); prev != nil {
+		err.OwnerOp, err.OwnerStack = prev.op, formatStack(prev.pcs)
+	}
+	panic(err)
+}
+
+// release marks the half as idle after a successful acquire.
+func (o *owner) release() {
+	if o == nil {
+		return
+	}
+	o.holder.Store(nil)
+}
+
+// formatStack converts captured program counters into a readable call stack.
+func formatStack(pcs []uintptr) string {
+	var b strings.Builder
+
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s()\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
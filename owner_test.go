@@ -0,0 +1,64 @@
+package bufioprop
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that pipes with ownership checks panic on concurrent calls to the same
+// half, reporting both offending methods.
+func TestOwnerChecks(t *testing.T) {
+	r, w := Pipe(1024, WithOwnerChecks())
+
+	// Park a reader on the empty pipe and wait for it to hold the read half
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 16))
+		done <- err
+	}()
+	for r.p.outOwner.holder.Load() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	// A concurrent read should panic, a concurrent write should not
+	func() {
+		defer func() {
+			err, ok := recover().(*MisuseError)
+			if !ok {
+				t.Fatalf("panic mismatch: have %v, want *MisuseError", err)
+			}
+			if err.Half != "reader" || err.Op != "ReadByte" || err.OwnerOp != "Read" {
+				t.Errorf("misuse mismatch: have %s %s over %s, want reader ReadByte over Read", err.Half, err.Op, err.OwnerOp)
+			}
+			if !strings.Contains(err.Stack, "TestOwnerChecks") || !strings.Contains(err.OwnerStack, "TestOwnerChecks") {
+				t.Errorf("stacks missing the callers:\n%v", err)
+			}
+		}()
+		r.ReadByte()
+	}()
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	// Sequential calls after the parked one returned should be fine
+	w.Write([]byte("world"))
+	if _, err := r.Read(make([]byte, 16)); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	r.Close()
+	w.Close()
+}
+
+// Tests that copies run cleanly with ownership checks enabled.
+func TestOwnerChecksCopy(t *testing.T) {
+	out := new(bytes.Buffer)
+	if _, err := Copy(out, bytes.NewBuffer(testData[:1024*1024]), 16*1024, WithOwnerChecks()); err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), testData[:1024*1024]) {
+		t.Fatalf("copied data mismatch")
+	}
+}
@@ -0,0 +1,25 @@
+package bufioprop
+
+import "fmt"
+
+// PanicError is returned by copies whose source panicked while being read on the
+// internal producer goroutine (or synchronously, for tiny copies). The panic is
+// recovered, the pipe torn down, and the panic's value returned along with the
+// stack trace of the reading goroutine.
+type PanicError struct {
+	Value interface{} // Value the source panicked with
+	Stack []byte      // Stack trace of the reading goroutine at the panic
+}
+
+// Error implements error, including the stack trace.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("bufio: copy source panicked: %v\n\n%s", e.Value, e.Stack)
+}
+
+// Unwrap returns the value the source panicked with, if it was an error.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package bufioprop
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrInvalidPartSize is returned by the writes of a PartWriter created with a
+// part size that is not positive.
+var ErrInvalidPartSize = errors.New("bufio: invalid part size")
+
+// A Part is a consecutive section of a stream split up by a PartWriter, readable
+// concurrently with the other parts. Reading it returns io.EOF at the end of the
+// part, or the error the PartWriter was closed with.
+type Part struct {
+	*PipeReader
+
+	Number int   // Sequence number of the part, starting from 1
+	Offset int64 // Position of the part's first byte within the stream
+}
+
+// A PartWriter splits a sequential stream into fixed size parts, each delivered
+// as a reader backed by its own ring buffer. It permits uploading the parts of a
+// single source concurrently (e.g. object store multipart uploads), with memory
+// bounded by the buffers of the parts in flight instead of the part sizes.
+//
+// Writes block while the current part's buffer is full, so a part's reader needs
+// to keep consuming for the stream to progress; the next part only starts once
+// the current one has been entirely written (but not necessarily read).
+type PartWriter struct {
+	size   int64    // Number of bytes in every part (apart from the last)
+	buffer int      // Size of the ring buffer backing every part
+	opts   []Option // Options to create the parts' pipes with
+
+	parts chan *Part  // Channel delivering the parts as they start
+	cur   *PipeWriter // Write half of the current part (nil = none)
+	left  int64       // Number of bytes still to write into the current part
+	next  int         // Sequence number of the next part
+	pos   int64       // Number of bytes written into the stream
+	err   error       // Failure terminating the writer, if any
+}
+
+// NewPartWriter creates a writer splitting its stream into parts of partSize
+// bytes, each backed by a pipe of the given buffer size, configured by opts. If
+// partSize is not positive, all writes fail with ErrInvalidPartSize.
+func NewPartWriter(partSize int64, buffer int, opts ...Option) *PartWriter {
+	w := &PartWriter{
+		size:   partSize,
+		buffer: buffer,
+		opts:   opts,
+		parts:  make(chan *Part),
+		next:   1,
+	}
+	if partSize <= 0 {
+		w.err = ErrInvalidPartSize
+	}
+	return w
+}
+
+// Parts returns the channel on which the parts are delivered as they start. The
+// channel is closed when the writer is closed. Writes block until the parts are
+// received, so the channel needs to be consumed concurrently with writing.
+func (w *PartWriter) Parts() <-chan *Part {
+	return w.parts
+}
+
+// Write splits data into the parts, starting new ones as needed.
+func (w *PartWriter) Write(data []byte) (n int, err error) {
+	for len(data) > 0 {
+		if err := w.advance(); err != nil {
+			return n, err
+		}
+		chunk := data
+		if int64(len(chunk)) > w.left {
+			chunk = chunk[:w.left]
+		}
+		nw, err := w.cur.Write(chunk)
+		n, data = n+nw, data[nw:]
+		if err := w.written(int64(nw), err); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom implements io.ReaderFrom, splitting all the data from r into the parts,
+// reading directly into their ring buffers.
+func (w *PartWriter) ReadFrom(r io.Reader) (read int64, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	for {
+		// Probe the source before starting a new part, so exhausting it right at
+		// a part boundary doesn't leave an empty trailing part
+		if w.cur == nil {
+			var probe [1]byte
+			if n, err := io.ReadFull(r, probe[:]); n == 0 {
+				if err == io.EOF {
+					err = nil
+				}
+				return read, err
+			}
+			if _, err := w.Write(probe[:]); err != nil {
+				return read, err
+			}
+			if read++; w.cur == nil {
+				continue
+			}
+		}
+		left := w.left
+		nr, err := w.cur.ReadFrom(&io.LimitedReader{R: r, N: left})
+		read += nr
+		if err := w.written(nr, err); err != nil {
+			return read, err
+		}
+		if nr < left {
+			return read, nil // source exhausted mid-part
+		}
+	}
+}
+
+// Close terminates the stream, ending the current part and closing the channel
+// of parts.
+func (w *PartWriter) Close() error {
+	return w.CloseWithError(nil)
+}
+
+// CloseWithError terminates the stream, failing the current part's reads with
+// err (io.EOF if nil) and closing the channel of parts.
+func (w *PartWriter) CloseWithError(err error) error {
+	if w.err == ErrClosedPipe {
+		return nil
+	}
+	if w.cur != nil {
+		w.finish(err)
+	}
+	w.err = ErrClosedPipe
+	close(w.parts)
+	return nil
+}
+
+// advance starts a new part if there's none in progress.
+func (w *PartWriter) advance() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.cur != nil {
+		return nil
+	}
+	r, pw, err := NewPipe(w.buffer, w.opts...)
+	if err != nil {
+		w.err = err
+		return err
+	}
+	w.parts <- &Part{PipeReader: r, Number: w.next, Offset: w.pos}
+	w.cur, w.left = pw, w.size
+	w.next++
+
+	return nil
+}
+
+// written accounts for data written into the current part, ending it when full
+// and terminating the writer if the part failed.
+func (w *PartWriter) written(n int64, err error) error {
+	w.left -= n
+	w.pos += n
+
+	if err != nil {
+		w.finish(err)
+		w.err = err
+		return err
+	}
+	if w.left == 0 {
+		w.finish(nil)
+	}
+	return nil
+}
+
+// finish ends the current part. Closing a pipe waits for its buffered data to
+// be consumed, so it's done asynchronously to let the next part start meanwhile.
+func (w *PartWriter) finish(err error) {
+	go w.cur.CloseWithError(err)
+	w.cur = nil
+}
@@ -0,0 +1,134 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// collectParts concurrently consumes all the parts of a writer, returning their
+// contents and offsets once the writer is closed.
+func collectParts(w *PartWriter) func() ([][]byte, []int64) {
+	var (
+		contents [][]byte
+		offsets  []int64
+		lock     sync.Mutex
+		pend     sync.WaitGroup
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for part := range w.Parts() {
+			lock.Lock()
+			idx := len(contents)
+			contents, offsets = append(contents, nil), append(offsets, part.Offset)
+			lock.Unlock()
+
+			pend.Add(1)
+			go func(part *Part) {
+				defer pend.Done()
+
+				data, _ := io.ReadAll(part)
+				lock.Lock()
+				contents[idx] = data
+				lock.Unlock()
+			}(part)
+		}
+		pend.Wait()
+	}()
+	return func() ([][]byte, []int64) {
+		<-done
+		return contents, offsets
+	}
+}
+
+// Tests that streams are split into parts correctly, both via writes and reads.
+func TestPartWriter(t *testing.T) {
+	data := testData[:1024*1024]
+
+	tests := []struct {
+		name  string
+		size  int64
+		feed  func(w *PartWriter) error
+		parts int
+	}{
+		{"write", 300 * 1024, func(w *PartWriter) error {
+			for rest := data; len(rest) > 0; rest = rest[min(len(rest), 7777):] {
+				if _, err := w.Write(rest[:min(len(rest), 7777)]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, 4},
+		{"readfrom", 300 * 1024, func(w *PartWriter) error {
+			_, err := w.ReadFrom(bytes.NewReader(data))
+			return err
+		}, 4},
+		{"readfrom-aligned", 256 * 1024, func(w *PartWriter) error {
+			_, err := w.ReadFrom(bytes.NewReader(data))
+			return err
+		}, 4},
+	}
+	for _, tt := range tests {
+		w := NewPartWriter(tt.size, 4096)
+		wait := collectParts(w)
+
+		if err := tt.feed(w); err != nil {
+			t.Fatalf("%s: failed to feed data: %v", tt.name, err)
+		}
+		w.Close()
+
+		contents, offsets := wait()
+		if len(contents) != tt.parts {
+			t.Fatalf("%s: part count mismatch: have %d, want %d", tt.name, len(contents), tt.parts)
+		}
+		var joined []byte
+		for i, content := range contents {
+			if offsets[i] != int64(i)*tt.size {
+				t.Fatalf("%s: part %d: offset mismatch: have %d, want %d", tt.name, i, offsets[i], int64(i)*tt.size)
+			}
+			if i < len(contents)-1 && int64(len(content)) != tt.size {
+				t.Fatalf("%s: part %d: size mismatch: have %d, want %d", tt.name, i, len(content), tt.size)
+			}
+			joined = append(joined, content...)
+		}
+		if !bytes.Equal(joined, data) {
+			t.Fatalf("%s: data mismatch", tt.name)
+		}
+	}
+}
+
+// Tests that a part failing its upload aborts the writer.
+func TestPartWriterAbort(t *testing.T) {
+	w := NewPartWriter(1024, 128)
+	go func() {
+		part := <-w.Parts()
+		part.Close()
+		for range w.Parts() {
+		}
+	}()
+	if _, err := w.Write(testData[:4096]); !errors.Is(err, ErrClosedPipe) {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrClosedPipe)
+	}
+	w.Close()
+}
+
+// Tests that part writers with non-positive part sizes fail instead of spinning
+// on empty parts.
+func TestPartWriterInvalidSize(t *testing.T) {
+	for _, size := range []int64{0, -1} {
+		w := NewPartWriter(size, 1024)
+		if _, err := w.Write([]byte("hello")); err != ErrInvalidPartSize {
+			t.Fatalf("size %d: write error mismatch: have %v, want %v", size, err, ErrInvalidPartSize)
+		}
+		if _, err := w.ReadFrom(bytes.NewReader([]byte("hello"))); err != ErrInvalidPartSize {
+			t.Fatalf("size %d: read from error mismatch: have %v, want %v", size, err, ErrInvalidPartSize)
+		}
+		w.Close()
+		if _, ok := <-w.Parts(); ok {
+			t.Fatalf("size %d: part delivered", size)
+		}
+	}
+}
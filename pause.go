@@ -0,0 +1,82 @@
+package bufioprop
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Pause temporarily stops the consumption of data from the pipe, without closing
+// it or discarding anything buffered. Reads block until the reader is resumed or
+// closed, while the writer keeps filling the buffer until it's full. Pausing takes
+// effect at the next read, or in WriteTo (and thus Copy) at the next chunk; the
+// non-blocking TryRead reports no data while paused.
+func (r *PipeReader) Pause() {
+	r.p.outPause.pause()
+}
+
+// Resume restarts the consumption of data from a paused pipe.
+func (r *PipeReader) Resume() {
+	r.p.outPause.unpause()
+}
+
+// Pause temporarily stops the production of data into the pipe, without closing
+// it. Writes block until the writer is resumed or either half is closed, while the
+// reader keeps draining the buffer. Pausing takes effect at the next write, or in
+// ReadFrom at the next read from the source; the non-blocking TryWrite accepts no
+// data while paused.
+func (w *PipeWriter) Pause() {
+	w.p.inPause.pause()
+}
+
+// Resume restarts the production of data into a paused pipe.
+func (w *PipeWriter) Resume() {
+	w.p.inPause.unpause()
+}
+
+// A pauser holds back one side of the pipe while it's paused by the user.
+type pauser struct {
+	paused  atomic.Bool   // Flag whether the side is paused, checked on every wait
+	resumed chan struct{} // Channel closed when the side is resumed
+	lock    sync.Mutex    // Lock protecting the resume channel
+}
+
+// pause marks the side paused, if not already.
+func (ps *pauser) pause() {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if !ps.paused.Load() {
+		ps.resumed = make(chan struct{})
+		ps.paused.Store(true)
+	}
+}
+
+// unpause marks the side resumed, releasing anyone waiting.
+func (ps *pauser) unpause() {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if ps.paused.Load() {
+		ps.paused.Store(false)
+		close(ps.resumed)
+	}
+}
+
+// wait blocks while the side is paused, returning whether it was resumed (true)
+// or any of the quit channels got closed (false).
+func (ps *pauser) wait(quit1, quit2 <-chan struct{}) bool {
+	for ps.paused.Load() {
+		ps.lock.Lock()
+		resumed := ps.resumed
+		ps.lock.Unlock()
+
+		select {
+		case <-resumed:
+		case <-quit1:
+			return false
+		case <-quit2:
+			return false
+		}
+	}
+	return true
+}
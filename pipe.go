@@ -2,35 +2,140 @@ package bufioprop
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"os"
 	"runtime"
 	"sync"
 	"sync/atomic"
-)
+	"time"
 
-const maxSpin = 16 // Spin lock prevent going down to channel syncs
+	"github.com/karalabe/bufioprop/spsc"
+)
 
 // ErrClosedPipe is the error used for read or write operations on a closed pipe.
 var ErrClosedPipe = errors.New("bufio: read/write on closed pipe")
 
+// ShortWriteError is returned when a destination accepts fewer bytes than it was
+// given without reporting an error. It wraps io.ErrShortWrite.
+type ShortWriteError struct {
+	Written int // Number of bytes of the chunk accepted by the destination
+	Wanted  int // Number of bytes in the chunk given to the destination
+}
+
+// Error implements the error interface.
+func (e *ShortWriteError) Error() string {
+	return fmt.Sprintf("bufio: short write: %d of %d bytes", e.Written, e.Wanted)
+}
+
+// Unwrap returns io.ErrShortWrite, making the error checkable via errors.Is.
+func (e *ShortWriteError) Unwrap() error {
+	return io.ErrShortWrite
+}
+
+// cacheLinePad is the padding separating the fields of the pipe written by the
+// different sides. It spans two 64 byte cache lines, as the spatial prefetchers
+// of modern CPUs pull in adjacent line pairs, sharing them all the same.
+const cacheLinePad = 128
+
 // A pipe is the shared pipe structure underlying PipeReader and PipeWriter.
+//
+// All fields shared between the two sides are of the sync/atomic types, which
+// guarantee their own alignment, so the struct is safe on 32 bit platforms too.
+//
+// The fields are grouped by the goroutine writing them on the hot path: the read
+// mostly configuration, the writer's state and the reader's state, each separated
+// by padding so that one side's updates don't invalidate the cache lines the other
+// is working from. The occupancy of the buffer is tracked by two monotonic counters
+// (head and tail), each only ever modified by its owner side, so the two sides only
+// read each other's cache lines, never contend on writing the same one.
 type pipe struct {
 	buffer []byte // Internal buffer to pass the data through
 	size   int32  // Total size of the buffer (same as buffer arg, just cast)
-	free   int32  // Currently available space in the buffer
-
-	inPos  int32 // Position in the buffer where input should be written
-	outPos int32 // Position in the buffer from where output should be read
-
-	inWake  chan struct{} // Signaler for the reader, if it's asleep
-	outWake chan struct{} // Signaler for the writer, if it's asleep
-
-	inQuit      chan struct{} // Quit channel when the reader terminates
-	outQuit     chan struct{} // Quit channel when the writer terminates
-	outQuitLock sync.Mutex    // Lock to prevent multiple quit channel closes
 
-	inErr  error // If reader closed, error to give writes
-	outErr error // If writer closed, error to give reads
+	block    int32 // Fixed size of the blocks to write out (0 = arbitrary)
+	blockPad bool  // Whether to zero pad the final partial block
+
+	emptyReads   int   // Consecutive empty source reads tolerated in ReadFrom
+	shortRetries int   // Consecutive stalled short writes retried in WriteTo
+	readChunk    int32 // Maximum number of bytes requested per source read in ReadFrom (0 = all free)
+
+	writeRetry *WriteRetryPolicy // Policy to ride out transient destination failures (nil = none)
+
+	lowMark  int32 // Occupancy to resume reading the source at in ReadFrom
+	highMark int32 // Occupancy to stop reading the source at in ReadFrom (0 = never)
+
+	uring   bool // Whether to transfer file endpoints via io_uring (Linux only)
+	discard bool // Whether writes are silently dropped after the reader closes
+	abort   bool // Whether a writer failure drops the buffered data instead of draining it
+	wipe    bool // Whether consumed data is zeroed in the buffer, and all of it on close
+
+	flushIdle  bool // Whether to flush the destination when the pipe runs dry
+	flushDelim int  // Record delimiter to flush the destination after (-1 = none)
+
+	spin      int       // Maximum spin iterations before parking (maxSpin unless simulated)
+	sim       *simHooks // Scheduling hooks injected by tests (nil = none)
+	wakeBatch int       // Bytes to advance before signaling the other side (0 = always)
+
+	stats   *Stats   // Counters of notable events observed by the pipe
+	journal *journal // Persisted stream positions for durable pipes (nil = none)
+	share   *share   // Bandwidth share of a scheduler to throttle to (nil = none)
+
+	inOwner  *owner // Ownership tracker of the writer's methods (nil = unchecked)
+	outOwner *owner // Ownership tracker of the reader's methods (nil = unchecked)
+
+	budget *BufferBudget // Memory budget the buffer is accounted against (nil = none)
+	idle   *idler        // Releaser of the buffer during idle periods (nil = never)
+	tag    string        // Tag the pipe's traffic is accounted under (empty = none)
+
+	_         [cacheLinePad]byte
+	head      atomic.Uint64 // Total number of bytes written into the pipe
+	inPos     int32         // Position in the buffer where input should be written
+	reserved  int           // Number of bytes at inPos handed out by Reserve, not yet committed
+	reserving bool          // Whether a Reserve call is waiting to be committed
+	inPending int           // Bytes advanced by the writer, not yet signaled to the reader
+	inScratch [10]byte      // Staging space of the integers encoded by the writer (up to a varint)
+	inSpin    spinner       // Wait time history of the writer, deciding whether to spin
+
+	_          [cacheLinePad]byte
+	tail       atomic.Uint64 // Total number of bytes read out of the pipe
+	outPos     int32         // Position in the buffer from where output should be read
+	viewed     int           // Number of bytes at outPos handed out by Next, not yet consumed
+	outPending int           // Bytes advanced by the reader, not yet signaled to the writer
+	outScratch [8]byte       // Staging space of the integers wrapping around the ring
+	flush      func() error  // Flusher of the destination being written to (nil = none)
+	dirty      bool          // Whether data was written since the last flush
+	outSpin    spinner       // Wait time history of the reader, deciding whether to spin
+	_          [cacheLinePad]byte
+
+	inWake  *spsc.Waiter // Signaler for the reader, if it's asleep
+	outWake *spsc.Waiter // Signaler for the writer, if it's asleep
+
+	inPause  pauser // Holder of the writer while paused by the user
+	outPause pauser // Holder of the reader while paused by the user
+
+	inQuit      chan struct{} // Quit channel when the writer terminates
+	outQuit     chan struct{} // Quit channel when the reader terminates
+	inQuitLock  sync.Mutex    // Lock to prevent multiple writer quit channel closes
+	outQuitLock sync.Mutex    // Lock to prevent multiple reader quit channel closes
+
+	term     atomic.Pointer[termination] // Terminal state, set by the first half closed
+	aborted  atomic.Bool                 // Whether the writer failed, dropping the buffered data
+	finished sync.Once                   // Guard to run the termination cleanups only once
+
+	barriers    []*Barrier    // Barriers requested by the writer, not yet passed by the reader
+	barrierNext atomic.Uint64 // Read counter at which the first barrier is passed (0 = none)
+	barrierLock sync.Mutex    // Lock protecting the queued barriers
+
+	compat *ioCompat // Close errors of the two halves when mimicking io.Pipe (nil = native)
+
+	onClose  []func(CloseInfo) // Callbacks to invoke when the pipe terminates
+	done     bool              // Whether the pipe terminated and ran its callbacks
+	doneLock sync.Mutex        // Lock protecting the callbacks and the termination flag
+
+	state     State        // Lifecycle state last published to the subscribers
+	stateSubs []chan State // Subscribers to the lifecycle transitions
+	stateLock sync.Mutex   // Lock protecting the lifecycle state and its subscribers
 }
 
 // Pipe creates an asynchronous in-memory pipe.
@@ -43,19 +148,148 @@ type pipe struct {
 //
 // It is safe to call Read and Write in parallel with each other or with
 // Close. Close will complete once pending I/O is done. Parallel calls to
-// Read, and parallel calls to Write, are not safe!
-func Pipe(buffer int) (*PipeReader, *PipeWriter) {
+// Read, and parallel calls to Write, are not safe! WithOwnerChecks detects them.
+//
+// A buffer of 0 creates the pipe with DefaultBufferSize. Optional behavior of the
+// pipe can be configured through opts. If the pipe cannot be created due to the
+// configured constraints, Pipe panics.
+func Pipe(buffer int, opts ...Option) (*PipeReader, *PipeWriter) {
+	r, w, err := newPipe(buffer, newConfig(opts))
+	if err != nil {
+		panic(err)
+	}
+	return r, w
+}
+
+// NewPipe creates an asynchronous in-memory pipe, similarly to Pipe, but returns
+// an error instead of panicking if the configured constraints (e.g. a buffer
+// budget) don't permit creating it.
+func NewPipe(buffer int, opts ...Option) (*PipeReader, *PipeWriter, error) {
+	return newPipe(buffer, newConfig(opts))
+}
+
+// PipeWithBuffer creates an asynchronous in-memory pipe, similarly to Pipe, but
+// running it on top of the caller provided buf instead of allocating a buffer.
+// This permits placing the pipe's memory into pools, memory mapped files or any
+// larger arena the caller manages.
+//
+// The pipe owns buf until both of its halves are closed, after which it may be
+// reused (e.g. recycled from an OnClose callback). As the memory isn't allocated
+// by the pipe, it's not accounted against a buffer budget, nor released while the
+// pipe is idle. With block writes, len(buf) must be a multiple of the block size,
+// spanning at least two blocks, and aligning it is the caller's responsibility.
+//
+// If buf is not usable with the configured constraints, PipeWithBuffer panics.
+func PipeWithBuffer(buf []byte, opts ...Option) (*PipeReader, *PipeWriter) {
+	c := newConfig(opts)
+	if err := checkBuffer(len(buf)); err != nil {
+		panic(err)
+	}
+	if c.block > 0 && (len(buf)%c.block != 0 || len(buf) < 2*c.block) {
+		panic(ErrInvalidBuffer)
+	}
+	return newPipeMemory(buf[:len(buf):len(buf)], c)
+}
+
+// newPipe creates an asynchronous in-memory pipe with an already assembled set
+// of configurations.
+func newPipe(buffer int, c *config) (*PipeReader, *PipeWriter, error) {
+	buffer = bufferSize(buffer)
+	if c.block > 0 {
+		buffer = blockBuffer(buffer, c.block)
+	}
+	if err := checkBuffer(buffer); err != nil {
+		return nil, nil, err
+	}
+	if c.budget != nil {
+		if err := c.budget.acquire(buffer, c.cancel); err != nil {
+			return nil, nil, err
+		}
+	}
+	var memory []byte
+	if c.block > 0 {
+		memory = alignedBuffer(buffer, c.block)
+	} else {
+		memory = make([]byte, buffer)
+	}
+	r, w := newPipeMemory(memory, c)
+	r.p.budget = c.budget
+
+	if c.idle > 0 {
+		r.p.idle = &idler{
+			timeout: c.idle,
+			alloc: func() []byte {
+				if c.block > 0 {
+					return alignedBuffer(buffer, c.block)
+				}
+				return make([]byte, buffer)
+			},
+		}
+	}
+
+	return r, w, nil
+}
+
+// newPipeMemory creates an asynchronous pipe on top of an already allocated
+// chunk of memory, with an already assembled set of configurations.
+func newPipeMemory(memory []byte, c *config) (*PipeReader, *PipeWriter) {
 	p := &pipe{
-		buffer: make([]byte, buffer),
-		size:   int32(buffer),
-		free:   int32(buffer),
+		buffer: memory,
+		size:   int32(len(memory)),
+
+		block:    int32(c.block),
+		blockPad: c.blockPad,
+
+		emptyReads:   c.emptyReads,
+		shortRetries: c.shortRetries,
+		readChunk:    int32(c.readChunk),
+
+		writeRetry: c.writeRetry,
+
+		uring:   c.uring,
+		discard: c.discard,
+		abort:   c.abortOnError,
+		wipe:    c.wipe,
 
-		inWake:  make(chan struct{}, 1),
-		outWake: make(chan struct{}, 1),
+		flushIdle:  c.flushIdle,
+		flushDelim: c.flushDelim,
+
+		stats: c.stats,
+
+		spin:    maxSpin,
+		inSpin:  spinner{adaptive: c.spin == SpinAdaptive},
+		outSpin: spinner{adaptive: c.spin == SpinAdaptive},
+		sim:     c.sim,
+
+		wakeBatch: c.wakeBatch,
+
+		inWake:  newWaker(c.wake),
+		outWake: newWaker(c.wake),
 
 		inQuit:  make(chan struct{}),
 		outQuit: make(chan struct{}),
+
+		inOwner:  newOwner("writer", c.ownerChecks),
+		outOwner: newOwner("reader", c.ownerChecks),
+	}
+	p.lowMark, p.highMark = watermarks(c.lowMark, c.highMark, p.size)
+	if c.sim != nil && c.sim.noSpin {
+		p.spin = 0
+	}
+	if c.sched != nil {
+		p.share = c.sched.join(c.weight)
 	}
+	if c.meter != nil {
+		c.meter.attach(&p.tail)
+	}
+	if c.tag != "" {
+		p.tag = c.tag
+		attachTag(p.tag, p)
+	}
+	if c.ioCompat {
+		p.compat = new(ioCompat)
+	}
+
 	return &PipeReader{p}, &PipeWriter{p}
 }
 
@@ -67,13 +301,46 @@ type PipeReader struct {
 // Read reads data from the pipe. It returns io.EOF when the write side of the
 // pipe has been closed and all the data has been read.
 func (r *PipeReader) Read(data []byte) (n int, err error) {
-	return r.p.read(data)
+	r.p.outOwner.acquire("Read")
+	defer r.p.outOwner.release()
+
+	r.p.release()
+
+	n, err = r.p.read(data)
+	return n, r.p.readError(err)
+}
+
+// ReadByte implements io.ByteReader by reading a single byte from the pipe. It
+// permits stream decoders (e.g. encoding/gob) to consume the pipe directly,
+// without wrapping it into an additional bufio.Reader.
+func (r *PipeReader) ReadByte() (byte, error) {
+	r.p.outOwner.acquire("ReadByte")
+	defer r.p.outOwner.release()
+
+	r.p.release()
+
+	var b [1]byte
+	if _, err := r.p.read(b[:]); err != nil {
+		return 0, r.p.readError(err)
+	}
+	return b[0], nil
 }
 
 // WriteTo implements io.WriterTo by reading data from the pipe until EOF and
 // writing it to w.
 func (r *PipeReader) WriteTo(w io.Writer) (written int64, err error) {
-	return r.p.writeTo(w)
+	r.p.outOwner.acquire("WriteTo")
+	defer r.p.outOwner.release()
+
+	r.p.release()
+
+	written, err = r.p.writeTo(w)
+	return written, r.p.readError(err)
+}
+
+// Stats returns the live counters of notable events observed by the pipe.
+func (r *PipeReader) Stats() *Stats {
+	return r.p.stats
 }
 
 // Close closes the reader; subsequent writes to the write half of the pipe will
@@ -84,7 +351,13 @@ func (r *PipeReader) Close() error {
 
 // CloseWithError closes the reader; subsequent writes to the write half of the
 // pipe will return the error err.
+//
+// Only the first close of the reader has any effect, later ones (concurrent or
+// not) are no-ops and never overwrite the error of the first.
 func (r *PipeReader) CloseWithError(err error) error {
+	if r.p.compat != nil && !r.p.compat.closeReader(err) {
+		return nil
+	}
 	r.p.outputClose(err)
 	return nil
 }
@@ -97,13 +370,42 @@ type PipeWriter struct {
 // Write writes data to the pipe. It will block until all the data is written or
 // the read half is closed.
 func (w *PipeWriter) Write(data []byte) (n int, err error) {
-	return w.p.write(data)
+	w.p.inOwner.acquire("Write")
+	defer w.p.inOwner.release()
+
+	n, err = w.p.write(data)
+	return n, w.p.writeError(err)
+}
+
+// WriteString implements io.StringWriter, writing the contents of s to the pipe
+// without converting it to a byte slice first. It will block until all the data
+// is written or the read half is closed.
+func (w *PipeWriter) WriteString(s string) (n int, err error) {
+	w.p.inOwner.acquire("WriteString")
+	defer w.p.inOwner.release()
+
+	n, err = w.p.writeString(s)
+	return n, w.p.writeError(err)
 }
 
 // ReadFrom implements io.ReaderFrom by reading all the data from r and writing
 // it to the pipe.
+//
+// If a read from r returns data alongside an error (as network readers commonly
+// do), the data is placed into the pipe before the error is returned, and it's
+// included in the read count. Closing the writer afterwards with the error still
+// delivers all such data to the reader first.
 func (w *PipeWriter) ReadFrom(r io.Reader) (read int64, err error) {
-	return w.p.readFrom(r)
+	w.p.inOwner.acquire("ReadFrom")
+	defer w.p.inOwner.release()
+
+	read, err = w.p.readFrom(r)
+	return read, w.p.writeError(err)
+}
+
+// Stats returns the live counters of notable events observed by the pipe.
+func (w *PipeWriter) Stats() *Stats {
+	return w.p.stats
 }
 
 // Close closes the writer; subsequent reads from the read half of the pipe will
@@ -114,32 +416,74 @@ func (w *PipeWriter) Close() error {
 
 // CloseWithError closes the writer; subsequent reads from the read half of the
 // pipe will return no bytes and the error err.
+//
+// Only the first close of the writer has any effect, later ones (concurrent or
+// not) are no-ops and never overwrite the error of the first. All of them return
+// only once the buffered data was consumed or discarded by the reader.
 func (w *PipeWriter) CloseWithError(err error) error {
+	if w.p.compat != nil && !w.p.compat.closeWriter(err) {
+		return nil
+	}
 	w.p.inputClose(err)
 	return nil
 }
 
+// freeSpace returns the currently available space in the internal buffer. Each
+// side's own counter is exact, whereas the other's may lag behind, so the value
+// is a lower bound of the free space for the writer and of the buffered data for
+// the reader, same as a shared free counter would be.
+func (p *pipe) freeSpace() int32 {
+	tail := p.tail.Load()
+	used := p.head.Load() - tail
+	if used > uint64(p.size) {
+		// Only observable by third parties, racing a wrap around of the reader
+		used = uint64(p.size)
+	}
+	return p.size - int32(used)
+}
+
 // InputWait blocks until some space frees up in the internal buffer.
 func (p *pipe) inputWait() (int32, error) {
-	for {
-		safeFree := atomic.LoadInt32(&p.free)
+	// Hold the writer back while paused, bailing out if the pipe is torn down
+	if !p.inPause.wait(p.outQuit, p.inQuit) {
+		return 0, ErrClosedPipe
+	}
+	// Short circuit if there's space available, otherwise account the stall
+	if safeFree := p.freeSpace(); safeFree != 0 {
+		return safeFree, nil
+	}
+	defer func(start time.Time) {
+		stall := time.Since(start)
+		p.stats.WriterStall.Add(int64(stall))
+		p.inSpin.record(stall)
+	}(time.Now())
+
+	p.flushOutputSignal()
+
+	for spin := p.inSpin.spins(p.spin); ; {
+		safeFree := p.freeSpace()
 
 		// If the buffer is full, spin lock to give it another chance
-		for i := 0; safeFree == 0 && i < maxSpin; i++ {
+		for i := 0; safeFree == 0 && i < spin; i++ {
 			runtime.Gosched()
-			safeFree = atomic.LoadInt32(&p.free)
+			safeFree = p.freeSpace()
 		}
 		// If still full, go down into deep sleep
 		if safeFree == 0 {
-			select {
-			case <-p.inWake: // wake signal from output, retry
-				continue
+			if p.sim != nil && p.sim.parkInput != nil {
+				p.sim.parkInput()
+			}
+			p.inWake.Wait(&p.tail, p.head.Load()-uint64(p.size))
 
+			select {
 			case <-p.outQuit: // output dead, return
 				return safeFree, ErrClosedPipe
 
 			case <-p.inQuit: // input closed prematurely
 				return safeFree, ErrClosedPipe
+
+			default: // wake signal from output, retry
+				continue
 			}
 		}
 		return safeFree, nil
@@ -148,64 +492,112 @@ func (p *pipe) inputWait() (int32, error) {
 
 // OutputWait blocks until some data becomes available in the internal buffer.
 func (p *pipe) outputWait() (int32, error) {
-	for {
-		safeFree := atomic.LoadInt32(&p.free)
+	return p.outputWaitN(1)
+}
 
-		// If there's no data available, spin lock to give it another chance
-		for i := 0; safeFree == p.size && i < maxSpin; i++ {
+// OutputWaitN blocks until at least need bytes become available in the internal
+// buffer, or the input is closed with some data still pending.
+func (p *pipe) outputWaitN(need int32) (int32, error) {
+	// Hold the reader back while paused, keeping the data for when it resumes
+	if !p.outPause.wait(p.outQuit, nil) {
+		return p.freeSpace(), ErrClosedPipe
+	}
+	// Surface the writer's failure right away if it aborted the stream
+	if p.aborted.Load() {
+		p.outputClose(nil)
+		return p.freeSpace(), p.termErr()
+	}
+	// Short circuit if there's data available, otherwise account the stall
+	if safeFree := p.freeSpace(); p.size-safeFree >= need {
+		return safeFree, nil
+	}
+	defer func(start time.Time) {
+		stall := time.Since(start)
+		p.stats.ReaderStall.Add(int64(stall))
+		p.outSpin.record(stall)
+	}(time.Now())
+
+	p.flushInputSignal()
+
+	for spin := p.outSpin.spins(p.spin); ; {
+		safeFree := p.freeSpace()
+
+		// If there's not enough data available, spin lock to give it another chance
+		for i := 0; p.size-safeFree < need && i < spin; i++ {
 			runtime.Gosched()
-			safeFree = atomic.LoadInt32(&p.free)
+			safeFree = p.freeSpace()
 		}
-		// If still no data, go down into deep sleep
-		if safeFree == p.size {
-			select {
-			case <-p.outWake: // wake signal from input, retry
+		// If still not enough data, go down into deep sleep
+		if p.size-safeFree < need {
+			// Push out anything sitting in the destination's buffer before idling
+			if p.flushIdle && p.dirty {
+				if err := p.flushOut(); err != nil {
+					return safeFree, err
+				}
 				continue
+			}
+			if p.sim != nil && p.sim.parkOutput != nil {
+				p.sim.parkOutput()
+			}
+			p.outWake.Wait(&p.head, p.tail.Load()+uint64(p.size-safeFree))
 
+			select {
 			case <-p.inQuit: // input done, return
-				safeFree = atomic.LoadInt32(&p.free)
-				if safeFree != p.size {
+				safeFree = p.freeSpace()
+				if safeFree != p.size && !p.aborted.Load() {
 					return safeFree, nil
 				}
 				p.outputClose(nil)
-				return safeFree, p.inErr
+				return safeFree, p.termErr()
 
 			case <-p.outQuit: // output closed prematurely
 				return safeFree, ErrClosedPipe
+
+			default: // wake signal from input, retry
+				continue
 			}
 		}
 		return safeFree, nil
 	}
 }
 
-// InputAdvance updates the input index, buffer free space counter and signals
-// the output writer (if any) that space is available.
+// InputAdvance updates the input index, the written byte counter and signals the
+// output writer (if any) that data is available.
 func (p *pipe) inputAdvance(count int) {
+	p.checkInputAdvance(count)
+
 	p.inPos += int32(count)
 	if p.inPos >= p.size {
 		p.inPos -= p.size
 	}
-	atomic.AddInt32(&p.free, -int32(count))
+	if p.journal != nil {
+		advanceCounter(p.journal.head, count) // persist before publishing
+	}
+	p.signalOutput(count, p.head.Add(uint64(count)))
 
-	select {
-	case p.outWake <- struct{}{}:
-	default:
+	if p.share != nil {
+		p.share.throttle(count, p.inQuit, p.outQuit)
 	}
 }
 
-// OutputAdvance updates the output index, buffer free space counter and signals
-// the input writer (if any) that space is available.
+// OutputAdvance updates the output index, the read byte counter and signals the
+// input writer (if any) that space is available.
 func (p *pipe) outputAdvance(count int) {
+	p.checkOutputAdvance(count)
+
+	if p.wipe {
+		p.wipeConsumed(count) // before the writer may reuse the space
+	}
 	p.outPos += int32(count)
 	if p.outPos >= p.size {
 		p.outPos -= p.size
 	}
-	atomic.AddInt32(&p.free, int32(count))
-
-	select {
-	case p.inWake <- struct{}{}:
-	default:
+	if p.journal != nil {
+		advanceCounter(p.journal.tail, count) // persist before publishing
 	}
+	tail := p.tail.Add(uint64(count))
+	p.signalInput(count, tail)
+	p.checkBarriers(tail)
 }
 
 // Read fills a buffer with any available data, returning as soon as something's
@@ -238,7 +630,32 @@ func (p *pipe) read(b []byte) (int, error) {
 }
 
 // WriteTo keeps pushing data into the writer until the source is closed or fails.
+// If the writer implements io.ReaderFrom, it is handed a lightweight reader over
+// the internal buffer so that it may drive its own optimized copy loop.
 func (p *pipe) writeTo(w io.Writer) (written int64, err error) {
+	p.flushInto(w)
+	if p.block > 0 {
+		return p.writeBlocks(w)
+	}
+	if f, ok := w.(*os.File); ok && p.uring && p.writeRetry == nil {
+		if written, err, handled := p.writeChunksFile(f); handled {
+			return written, err
+		}
+	}
+	// Raw file descriptors are best driven directly via vectored writes, their
+	// ReadFrom would only fall back to a generic copy for a pipe source anyway.
+	// Flushed destinations need to stay in control of when their buffer drains,
+	// and retried ones can't have their failures buried in their own copy loop.
+	if rf, ok := w.(io.ReaderFrom); ok && vectorConn(w) == nil && p.flush == nil && p.writeRetry == nil {
+		return rf.ReadFrom(&ringReader{p})
+	}
+	return p.writeChunks(w)
+}
+
+// WriteChunks pushes the contiguous segments of the internal buffer into the
+// writer until the source is closed or fails.
+func (p *pipe) writeChunks(w io.Writer) (written int64, err error) {
+	var backoff writeBackoff
 	for {
 		// Wait until some data becomes available
 		safeFree, err := p.outputWait()
@@ -248,39 +665,119 @@ func (p *pipe) writeTo(w io.Writer) (written int64, err error) {
 			}
 			return written, err
 		}
-		// Try and write it all
+		// Try and write it all, in one go if wrapped and the writer supports it
 		limit := p.outPos + p.size - safeFree
 		if limit > p.size {
+			if nw, err, ok := writeVector(w, p.buffer[p.outPos:], p.buffer[:limit-p.size]); ok {
+				written += int64(nw)
+				if nw < int(p.size-safeFree) {
+					p.stats.ShortWrites.Add(1)
+					if err == nil && nw == 0 {
+						err = &ShortWriteError{Written: 0, Wanted: int(p.size - safeFree)}
+					}
+				}
+				if err != nil && (nw == int(p.size-safeFree) || !p.retryWrite(err, nw > 0, &backoff)) {
+					return written, err
+				}
+				p.outputAdvance(nw)
+				continue
+			}
 			limit = p.size
 		}
-		nw, err := w.Write(p.buffer[p.outPos:limit])
+		nw, err := p.writeOut(w, p.buffer[p.outPos:limit])
 		written += int64(nw)
-
-		// Update the counters and check for errors
 		if err != nil {
 			return written, err
 		}
-		if int32(nw) != limit-p.outPos {
-			return written, io.ErrShortWrite
-		}
 		// Update the pipe output state and return
 		p.outputAdvance(nw)
 	}
 }
 
+// WriteOut pushes a chunk of data into the writer, accounting for short writes
+// and either retrying them or converting them into errors.
+func (p *pipe) writeOut(w io.Writer, b []byte) (written int, err error) {
+	var backoff writeBackoff
+	for stalls := 0; ; {
+		nw, err := w.Write(b[written:])
+		if nw < len(b)-written {
+			p.stats.ShortWrites.Add(1)
+		}
+		written += nw
+
+		// Ride out transient destination failures if requested
+		if err != nil && written < len(b) && p.retryWrite(err, nw > 0, &backoff) {
+			continue
+		}
+		if err != nil || written == len(b) {
+			if err == nil && p.flush != nil {
+				err = p.flushWritten(b)
+			}
+			return written, err
+		}
+		// Short write without an error, retry if allowed and progressing
+		if nw == 0 {
+			stalls++
+		} else {
+			stalls = 0
+		}
+		if p.shortRetries == 0 || stalls > p.shortRetries {
+			return written, &ShortWriteError{Written: written, Wanted: len(b)}
+		}
+	}
+}
+
+// A ringReader is a lightweight reader over the internal buffer of a pipe, handed
+// to io.ReaderFrom destinations during WriteTo. It deliberately does not expose
+// the pipe halves, so destinations cannot recurse back into WriteTo.
+type ringReader struct {
+	p *pipe
+}
+
+// Read fills a buffer with any available data from the pipe.
+func (r *ringReader) Read(b []byte) (int, error) {
+	return r.p.read(b)
+}
+
+// WriteTo implements io.WriterTo by passing bounded views of the internal buffer
+// directly into w, so generic copy loops inside the destination's ReadFrom don't
+// need an intermediate buffer.
+func (r *ringReader) WriteTo(w io.Writer) (int64, error) {
+	return r.p.writeChunks(w)
+}
+
+// discarding reports whether writes should be silently dropped, as the reader is
+// gone but the writer is still live, and discarding was requested.
+func (p *pipe) discarding() bool {
+	return p.discard && closed(p.outQuit) && !closed(p.inQuit)
+}
+
 // Write pushes the contents of a slice into the internal data buffer.
 func (p *pipe) write(b []byte) (read int, failure error) {
-	// Short circuit if the input was already closed
+	if p.reserving {
+		return 0, ErrReservationOpen
+	}
+	// Short circuit if either side was already closed
+	if p.discarding() {
+		return len(b), nil
+	}
 	select {
 	case <-p.inQuit:
 		return 0, ErrClosedPipe
+	case <-p.outQuit:
+		return 0, ErrClosedPipe
 	default:
 	}
+	p.wakeBuffer()
+	defer p.sleepBuffer()
 
 	for len(b) > 0 {
 		// Wait until some space frees up
 		safeFree, err := p.inputWait()
 		if err != nil {
+			if p.discarding() {
+				return read + len(b), nil
+			}
 			return read, err
 		}
 		// Try to fill the buffer either till the reader position, or the end
@@ -301,23 +798,119 @@ func (p *pipe) write(b []byte) (read int, failure error) {
 	return
 }
 
+// WriteString is the string counterpart of write, copying straight out of the
+// string to avoid allocating a byte slice copy of it.
+func (p *pipe) writeString(s string) (read int, failure error) {
+	if p.reserving {
+		return 0, ErrReservationOpen
+	}
+	// Short circuit if either side was already closed
+	if p.discarding() {
+		return len(s), nil
+	}
+	select {
+	case <-p.inQuit:
+		return 0, ErrClosedPipe
+	case <-p.outQuit:
+		return 0, ErrClosedPipe
+	default:
+	}
+	p.wakeBuffer()
+	defer p.sleepBuffer()
+
+	for len(s) > 0 {
+		// Wait until some space frees up
+		safeFree, err := p.inputWait()
+		if err != nil {
+			if p.discarding() {
+				return read + len(s), nil
+			}
+			return read, err
+		}
+		// Try to fill the buffer either till the reader position, or the end
+		limit := p.inPos + safeFree
+		if limit > p.size {
+			limit = p.size
+		}
+		if limit > p.inPos+int32(len(s)) {
+			limit = p.inPos + int32(len(s))
+		}
+		nr := copy(p.buffer[p.inPos:limit], s[:limit-p.inPos])
+		s = s[nr:]
+		read += nr
+
+		// Update the pipe input state and continue
+		p.inputAdvance(nr)
+	}
+	return
+}
+
 // ReadFrom keeps fetching data from the reader and placing it into the internal
 // buffer as long as the stream is live.
 func (p *pipe) readFrom(r io.Reader) (read int64, failure error) {
-	for {
+	if p.reserving {
+		return 0, ErrReservationOpen
+	}
+	p.wakeBuffer()
+	defer p.sleepBuffer()
+
+	if f, ok := r.(*os.File); ok && p.uring && p.highMark == 0 {
+		if read, err, handled := p.readFromFile(f); handled {
+			return read, err
+		}
+	}
+	for empty := 0; ; {
 		// Wait until some space frees up
 		safeFree, err := p.inputWait()
 		if err != nil {
+			if p.discarding() {
+				n, err := io.Copy(io.Discard, r)
+				return read + n, err
+			}
 			return read, err
 		}
-		// Try to fill the buffer either till the reader position, or the end
+		if p.highMark > 0 {
+			if safeFree, err = p.inputWaitMark(safeFree); err != nil {
+				return read, err
+			}
+		}
+		if p.readChunk > 0 && safeFree > p.readChunk {
+			safeFree = p.readChunk
+		}
+		// Try to fill the buffer either till the reader position, or the end,
+		// reading both free segments in one go if wrapped and supported
+		var (
+			nr int
+			ok bool
+		)
 		limit := p.inPos + safeFree
 		if limit > p.size {
+			nr, err, ok = readVector(r, p.buffer[p.inPos:], p.buffer[:limit-p.size])
 			limit = p.size
 		}
-		nr, err := r.Read(p.buffer[p.inPos:limit])
+		if !ok {
+			nr, err = r.Read(p.buffer[p.inPos:limit])
+		}
 		read += int64(nr)
 
+		if nr == 0 && err == nil {
+			p.stats.ZeroReads.Add(1)
+
+			// Guard against sources not making any progress
+			if empty++; p.emptyReads > 0 && empty >= p.emptyReads {
+				return read, io.ErrNoProgress
+			}
+		} else {
+			empty = 0
+		}
+		if nr > 0 && err != nil {
+			if err == io.EOF {
+				p.stats.EOFWithData.Add(1)
+			} else {
+				p.stats.ErrWithData.Add(1)
+			}
+		}
+
 		// Update the pipe input state and handle any occurred errors
 		p.inputAdvance(nr)
 		if err == io.EOF {
@@ -329,31 +922,73 @@ func (p *pipe) readFrom(r io.Reader) (read int64, failure error) {
 	}
 }
 
-// OutputClose terminates the writer endpoint, notifying further reads of the
-// specified error.
+// OutputClose terminates the reader endpoint, failing any further reads and
+// writes. If the pipe is still live, err is recorded as its terminal error.
 func (p *pipe) outputClose(err error) {
 	p.outQuitLock.Lock()
-	defer p.outQuitLock.Unlock()
-
-	p.outErr = err
-	select {
-	case <-p.outQuit:
+	if closed(p.outQuit) {
+		p.outQuitLock.Unlock()
 		return
-	default:
-		close(p.outQuit)
 	}
+	p.terminate(err, true)
+	close(p.outQuit)
+	p.inWake.Close()
+	p.outWake.Close()
+	p.outQuitLock.Unlock()
+
+	p.publishState(StateReaderClosed)
+	p.failBarriers()
+	p.finish()
 }
 
-// InputClose terminates the reader endpoint, notifying any reads after the
-// buffer is flushed of it. In case of a nil close, EOF is returned.
+// InputClose terminates the writer endpoint, notifying any reads after the
+// buffer is flushed of the pipe's terminal error: err if the writer was closed
+// first, EOF in case of a nil close. Repeated closes only wait for the drain. If
+// aborting on errors was requested, a failure skips the drain altogether.
 func (p *pipe) inputClose(err error) {
-	if err == nil {
-		err = io.EOF
+	p.inQuitLock.Lock()
+	first := !closed(p.inQuit)
+	if first {
+		p.terminate(err, false)
+		if p.abort && err != nil {
+			p.aborted.Store(true)
+		}
+		close(p.inQuit)
+		p.inWake.Close()
+		p.outWake.Close()
 	}
-	p.inErr = err
+	p.inQuitLock.Unlock()
 
-	close(p.inQuit)
-	if atomic.LoadInt32(&p.free) != p.size {
+	if first {
+		p.publishState(StateWriterClosed)
+		if p.share != nil {
+			p.share.leave()
+		}
+		p.finish()
+	}
+	// Whichever close won, wait for the reader to drain the buffer
+	if p.compat == nil && !p.aborted.Load() && p.freeSpace() != p.size {
 		<-p.outQuit
 	}
 }
+
+// Finish runs the cleanups of a fully terminated pipe, once both of its halves
+// have been closed.
+func (p *pipe) finish() {
+	if !closed(p.inQuit) || !closed(p.outQuit) {
+		return
+	}
+	p.finished.Do(func() {
+		p.stopIdle()
+		if p.wipe && p.journal == nil {
+			wipe(p.buffer) // durable pipes keep the unconsumed data for reopening
+		}
+		if p.budget != nil {
+			p.budget.release(int(p.size))
+		}
+		if p.tag != "" {
+			detachTag(p.tag, p)
+		}
+		p.runOnClose()
+	})
+}
@@ -0,0 +1,46 @@
+//go:build 386 || arm || mips || mipsle
+
+package bufioprop
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+// Tests that the 64 bit counters are properly aligned on 32 bit platforms, even
+// when embedded at odd offsets into user structs.
+func TestStatsAlignment32Bit(t *testing.T) {
+	var holder struct {
+		pad   int32
+		stats Stats
+	}
+	if offset := uintptr(unsafe.Pointer(&holder.stats.ZeroReads)) % 8; offset != 0 {
+		t.Fatalf("stats counter misaligned: offset %d", offset)
+	}
+}
+
+// Tests that concurrent copies sharing a set of counters work on 32 bit platforms.
+func TestConcurrentCopy32Bit(t *testing.T) {
+	var (
+		stats Stats
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			src := &pathologicalReader{chunks: [][]byte{testData[:1024*1024], testData[:3333]}}
+			if _, err := Copy(ioutil.Discard, src, 4096, WithStats(&stats)); err != nil {
+				t.Errorf("failed to copy data: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := stats.EOFWithData.Load(); n != 8 {
+		t.Errorf("EOF with data count mismatch: have %d, want %d", n, 8)
+	}
+}
@@ -3,8 +3,11 @@
 package bufioprop
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"testing"
 	"time"
 )
@@ -298,3 +301,671 @@ func TestWriteAfterWriterClose(t *testing.T) {
 		t.Errorf("got: %q; want: %q", writeErr, ErrClosedPipe)
 	}
 }
+
+// readerFromRecorder is a writer implementing io.ReaderFrom that records whether
+// its ReadFrom method was used.
+type readerFromRecorder struct {
+	bytes.Buffer
+	called bool
+}
+
+func (r *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.called = true
+	return io.Copy(&r.Buffer, src) // goes through the ring reader's WriteTo
+}
+
+// Tests that WriteTo hands the data stream to io.ReaderFrom destinations.
+func TestWriteToReaderFrom(t *testing.T) {
+	r, w := Pipe(333)
+	go func() {
+		w.Write(testData[:100000])
+		w.Close()
+	}()
+	dst := new(readerFromRecorder)
+	n, err := r.WriteTo(dst)
+	if err != nil {
+		t.Fatalf("failed to write to destination: %v", err)
+	}
+	if n != 100000 {
+		t.Fatalf("data length mismatch: have %d, want %d", n, 100000)
+	}
+	if !dst.called {
+		t.Errorf("destination ReadFrom not invoked")
+	}
+	if !bytes.Equal(dst.Bytes(), testData[:100000]) {
+		t.Errorf("data mismatch")
+	}
+}
+
+// trickleWriter is a destination accepting at most a few bytes per write, and
+// nothing at all once its budget runs out.
+type trickleWriter struct {
+	buffer bytes.Buffer
+	chunk  int
+	budget int
+}
+
+func (w *trickleWriter) Write(b []byte) (int, error) {
+	if len(b) > w.chunk {
+		b = b[:w.chunk]
+	}
+	if len(b) > w.budget {
+		b = b[:w.budget]
+	}
+	w.budget -= len(b)
+	return w.buffer.Write(b)
+}
+
+// Tests that short writes are retried while progressing, and reported in detail
+// when the destination stalls.
+func TestWriteToShortWriteRetries(t *testing.T) {
+	// Retry a destination writing in small chunks
+	dst := &trickleWriter{chunk: 100, budget: 1 << 30}
+	if _, err := Copy(dst, bytes.NewReader(testData[:100000]), 4096, WithShortWriteRetries(1)); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+	if !bytes.Equal(dst.buffer.Bytes(), testData[:100000]) {
+		t.Fatalf("data mismatch")
+	}
+	// Ensure a stalled destination fails with the details
+	dst = &trickleWriter{chunk: 100, budget: 50}
+	n, err := Copy(dst, bytes.NewReader(testData[:100000]), 4096, WithShortWriteRetries(3))
+
+	var short *ShortWriteError
+	if !errors.As(err, &short) {
+		t.Fatalf("error mismatch: have %v, want %T", err, short)
+	}
+	if short.Written != 50 || short.Wanted != 4096 || n != 50 {
+		t.Fatalf("short write details mismatch: have %d/%d (n=%d), want %d/%d (n=%d)", short.Written, short.Wanted, n, 50, 4096, 50)
+	}
+	if !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("short write error doesn't wrap io.ErrShortWrite")
+	}
+}
+
+// Tests that non-blocking writes accept only what fits into the buffer.
+func TestPipeTryWrite(t *testing.T) {
+	r, w := Pipe(10)
+
+	if avail := w.Available(); avail != 10 {
+		t.Fatalf("available space mismatch: have %d, want %d", avail, 10)
+	}
+	if n, ok := w.TryWrite([]byte("hello")); n != 5 || !ok {
+		t.Fatalf("write mismatch: have (%d, %v), want (5, true)", n, ok)
+	}
+	if l, c := w.Len(), w.Cap(); l != 5 || c != 10 {
+		t.Fatalf("len/cap mismatch: have %d/%d, want 5/10", l, c)
+	}
+	if n, ok := w.TryWrite([]byte("wonderful world")); n != 5 || ok {
+		t.Fatalf("write mismatch: have (%d, %v), want (5, false)", n, ok)
+	}
+	if n, ok := w.TryWrite([]byte("!")); n != 0 || ok {
+		t.Fatalf("full write mismatch: have (%d, %v), want (0, false)", n, ok)
+	}
+	// Free up some space and ensure writes wrap around the ring
+	buf := make([]byte, 7)
+	if n, err := io.ReadFull(r, buf); n != 7 || err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if avail := w.Available(); avail != 7 {
+		t.Fatalf("available space mismatch: have %d, want %d", avail, 7)
+	}
+	if n, ok := w.TryWrite([]byte("derful")); n != 6 || !ok {
+		t.Fatalf("write mismatch: have (%d, %v), want (6, true)", n, ok)
+	}
+	go w.Close()
+
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if have := string(buf) + string(rest); have != "hellowondederful" {
+		t.Fatalf("data mismatch: have %q, want %q", have, "hellowondederful")
+	}
+	r.Close()
+	if n, ok := w.TryWrite([]byte("!")); n != 0 || ok {
+		t.Fatalf("closed write mismatch: have (%d, %v), want (0, false)", n, ok)
+	}
+}
+
+// Tests that strings are written through the ring intact, without allocating a
+// byte slice copy of them.
+func TestPipeWriteString(t *testing.T) {
+	r, w := Pipe(7)
+
+	var _ io.StringWriter = w
+	go func() {
+		fmt.Fprintf(w, "hello %s", "wonderful world")
+		w.WriteString("!")
+		w.Close()
+	}()
+	have, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if string(have) != "hello wonderful world!" {
+		t.Fatalf("data mismatch: have %q, want %q", have, "hello wonderful world!")
+	}
+	r.Close()
+	if n, err := w.WriteString("!"); n != 0 || err != ErrClosedPipe {
+		t.Fatalf("closed write mismatch: have (%d, %v), want (0, %v)", n, err, ErrClosedPipe)
+	}
+	// Writing large strings should not allocate
+	r, w = Pipe(1024)
+	go io.Copy(io.Discard, r)
+
+	data := string(testData[:64*1024])
+	if allocs := testing.AllocsPerRun(10, func() { w.WriteString(data) }); allocs > 0 {
+		t.Fatalf("string write allocated: %v allocs", allocs)
+	}
+	r.Close()
+}
+
+// Tests that writes into a pipe with a closed reader are silently dropped if so
+// requested, but writes after the writer was closed still fail.
+func TestPipeDiscardOnClose(t *testing.T) {
+	r, w := Pipe(4, WithDiscardOnClose())
+
+	blocked, done := blocks(func() error { _, err := w.Write([]byte("hello world")); return err })
+	if !blocked {
+		t.Fatalf("write completed despite overflowing the buffer")
+	}
+	r.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("blocked write failed: %v", err)
+	}
+	if n, err := w.Write([]byte("hello")); n != 5 || err != nil {
+		t.Fatalf("write mismatch: have (%d, %v), want (5, nil)", n, err)
+	}
+	if n, err := w.WriteString("hello"); n != 5 || err != nil {
+		t.Fatalf("string write mismatch: have (%d, %v), want (5, nil)", n, err)
+	}
+	if n, ok := w.TryWrite([]byte("hello")); n != 5 || !ok {
+		t.Fatalf("try write mismatch: have (%d, %v), want (5, true)", n, ok)
+	}
+	if n, err := w.ReadFrom(bytes.NewReader(testData[:1000])); n != 1000 || err != nil {
+		t.Fatalf("read from mismatch: have (%d, %v), want (1000, nil)", n, err)
+	}
+	w.Close()
+	if n, err := w.Write([]byte("hello")); n != 0 || err != ErrClosedPipe {
+		t.Fatalf("closed write mismatch: have (%d, %v), want (0, %v)", n, err, ErrClosedPipe)
+	}
+}
+
+// Tests that non-blocking reads return whatever is available, wrapping around the
+// ring, and report the termination of the writer.
+func TestPipeTryRead(t *testing.T) {
+	r, w := Pipe(10)
+
+	buf := make([]byte, 16)
+	if n, ok, err := r.TryRead(buf); n != 0 || ok || err != nil {
+		t.Fatalf("empty read mismatch: have (%d, %v, %v), want (0, false, nil)", n, ok, err)
+	}
+	w.Write([]byte("01234567"))
+	if n, ok, err := r.TryRead(buf[:5]); n != 5 || !ok || err != nil || string(buf[:n]) != "01234" {
+		t.Fatalf("read mismatch: have (%q, %v, %v), want (%q, true, nil)", buf[:n], ok, err, "01234")
+	}
+	w.Write([]byte("89abcd"))
+	if n, ok, err := r.TryRead(buf); n != 9 || !ok || err != nil || string(buf[:n]) != "56789abcd" {
+		t.Fatalf("wrapped read mismatch: have (%q, %v, %v), want (%q, true, nil)", buf[:n], ok, err, "56789abcd")
+	}
+	w.CloseWithError(errors.New("writer failure"))
+	if n, ok, err := r.TryRead(buf); n != 0 || !ok || err == nil || err.Error() != "writer failure" {
+		t.Fatalf("closed read mismatch: have (%d, %v, %v), want (0, true, writer failure)", n, ok, err)
+	}
+}
+
+// Tests that the pipe can be consumed byte by byte.
+func TestPipeReadByte(t *testing.T) {
+	r, w := Pipe(3)
+	go func() {
+		w.Write([]byte("hello"))
+		w.Close()
+	}()
+	var have []byte
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read byte: %v", err)
+		}
+		have = append(have, b)
+	}
+	if string(have) != "hello" {
+		t.Fatalf("data mismatch: have %q, want %q", have, "hello")
+	}
+}
+
+// Tests that zero-copy views hold onto their data until the next read call, and
+// that they're split at the end of the ring.
+func TestPipeNext(t *testing.T) {
+	r, w := Pipe(8)
+	w.Write([]byte("01234567"))
+
+	if view, err := r.Next(-1); view != nil || err != ErrNegativeCount {
+		t.Fatalf("negative view mismatch: have (%q, %v), want (nil, %v)", view, err, ErrNegativeCount)
+	}
+	view, err := r.Next(5)
+	if err != nil || string(view) != "01234" {
+		t.Fatalf("view mismatch: have (%q, %v), want (%q, nil)", view, err, "01234")
+	}
+	if n, ok := w.TryWrite([]byte("x")); n != 0 || ok {
+		t.Fatalf("viewed data released prematurely")
+	}
+	view, err = r.Next(5)
+	if err != nil || string(view) != "567" {
+		t.Fatalf("view mismatch: have (%q, %v), want (%q, nil)", view, err, "567")
+	}
+	if n, ok := w.TryWrite([]byte("89abcdef")); n != 5 || ok {
+		t.Fatalf("released space mismatch: have %d, want %d", n, 5)
+	}
+	view, err = r.Next(16)
+	if err != nil || string(view) != "89abc" {
+		t.Fatalf("wrapped view mismatch: have (%q, %v), want (%q, nil)", view, err, "89abc")
+	}
+	go w.Close()
+
+	rest, err := io.ReadAll(r)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("trailing data mismatch: have (%q, %v), want (%q, nil)", rest, err, "")
+	}
+	if _, err := r.Next(1); err != ErrClosedPipe {
+		t.Fatalf("closed view error mismatch: have %v, want %v", err, ErrClosedPipe)
+	}
+}
+
+// Tests that data can be produced in place via reservations, wrapping around the
+// end of the ring.
+func TestPipeReserveCommit(t *testing.T) {
+	r, w := Pipe(8)
+
+	space, err := w.Reserve(5)
+	if err != nil || len(space) != 5 {
+		t.Fatalf("reservation mismatch: have (%d, %v), want (5, nil)", len(space), err)
+	}
+	copy(space, "01234")
+	if err := w.Commit(6); err != ErrCommitOverflow {
+		t.Fatalf("overflow error mismatch: have %v, want %v", err, ErrCommitOverflow)
+	}
+	if err := w.Commit(5); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	buf := make([]byte, 4)
+	if n, err := io.ReadFull(r, buf); n != 4 || err != nil || string(buf) != "0123" {
+		t.Fatalf("read mismatch: have (%q, %v), want (%q, nil)", buf[:n], err, "0123")
+	}
+	// Free space wraps around, reservation should stop at the end of the ring
+	space, err = w.Reserve(16)
+	if err != nil || len(space) != 3 {
+		t.Fatalf("reservation mismatch: have (%d, %v), want (3, nil)", len(space), err)
+	}
+	copy(space, "567")
+	w.Commit(3)
+
+	space, err = w.Reserve(16)
+	if err != nil || len(space) != 4 {
+		t.Fatalf("wrapped reservation mismatch: have (%d, %v), want (4, nil)", len(space), err)
+	}
+	copy(space, "89")
+	w.Commit(2)
+	go w.Close()
+
+	rest, err := io.ReadAll(r)
+	if err != nil || string(rest) != "456789" {
+		t.Fatalf("data mismatch: have (%q, %v), want (%q, nil)", rest, err, "456789")
+	}
+}
+
+// Tests that reservations reject invalid counts, that commits need a preceding
+// reservation, and that other writes are refused while one is open.
+func TestPipeReserveMisuse(t *testing.T) {
+	r, w := Pipe(8)
+
+	if space, err := w.Reserve(-1); space != nil || err != ErrNegativeCount {
+		t.Fatalf("negative reservation mismatch: have (%d, %v), want (0, %v)", len(space), err, ErrNegativeCount)
+	}
+	if err := w.Commit(0); err != ErrNoReservation {
+		t.Fatalf("unreserved commit error mismatch: have %v, want %v", err, ErrNoReservation)
+	}
+	space, err := w.Reserve(4)
+	if err != nil || len(space) != 4 {
+		t.Fatalf("reservation mismatch: have (%d, %v), want (4, nil)", len(space), err)
+	}
+	copy(space, "0123")
+	if n, err := w.Write([]byte("x")); n != 0 || err != ErrReservationOpen {
+		t.Fatalf("reserved write mismatch: have (%d, %v), want (0, %v)", n, err, ErrReservationOpen)
+	}
+	if n, err := w.WriteString("x"); n != 0 || err != ErrReservationOpen {
+		t.Fatalf("reserved string write mismatch: have (%d, %v), want (0, %v)", n, err, ErrReservationOpen)
+	}
+	if n, err := w.ReadFrom(bytes.NewReader([]byte("x"))); n != 0 || err != ErrReservationOpen {
+		t.Fatalf("reserved read-from mismatch: have (%d, %v), want (0, %v)", n, err, ErrReservationOpen)
+	}
+	if n, ok := w.TryWrite([]byte("x")); n != 0 || ok {
+		t.Fatalf("reserved try-write mismatch: have (%d, %v), want (0, false)", n, ok)
+	}
+	if err := w.Commit(4); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if err := w.Commit(0); err != ErrNoReservation {
+		t.Fatalf("repeated commit error mismatch: have %v, want %v", err, ErrNoReservation)
+	}
+	if _, err := w.Write([]byte("4")); err != nil {
+		t.Fatalf("failed to write after commit: %v", err)
+	}
+	go w.Close()
+
+	rest, err := io.ReadAll(r)
+	if err != nil || string(rest) != "01234" {
+		t.Fatalf("data mismatch: have (%q, %v), want (%q, nil)", rest, err, "01234")
+	}
+}
+
+// Tests that the close callbacks are invoked exactly once, after both halves of
+// the pipe terminate, with the final errors and byte counts.
+func TestPipeOnClose(t *testing.T) {
+	r, w := Pipe(8)
+
+	infos := make(chan CloseInfo, 4)
+	r.OnClose(func(info CloseInfo) { infos <- info })
+	w.OnClose(func(info CloseInfo) { infos <- info })
+
+	w.Write([]byte("0123456"))
+	if _, err := io.ReadFull(r, make([]byte, 3)); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	errBoom := errors.New("boom")
+	r.CloseWithError(errBoom)
+	select {
+	case <-infos:
+		t.Fatalf("callback invoked before both halves closed")
+	default:
+	}
+	w.Close()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case info := <-infos:
+			want := CloseInfo{Err: errBoom, Written: 7, Read: 3}
+			if info != want {
+				t.Fatalf("close info mismatch: have %+v, want %+v", info, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("callback %d not invoked", i)
+		}
+	}
+	// Late registrations should be invoked immediately
+	r.OnClose(func(info CloseInfo) { infos <- info })
+	if len(infos) != 1 {
+		t.Fatalf("late callback count mismatch: have %d, want 1", len(infos))
+	}
+	<-infos
+	if len(infos) != 0 {
+		t.Fatalf("callbacks invoked multiple times")
+	}
+}
+
+// Tests that pausing either half of the pipe holds it back without losing data,
+// and that paused halves are released by closing the pipe.
+func TestPipePauseResume(t *testing.T) {
+	r, w := Pipe(8)
+
+	// Paused readers should not consume data, even if buffered
+	r.Pause()
+	w.Write([]byte("hello"))
+
+	if n, ok, err := r.TryRead(make([]byte, 8)); n != 0 || ok || err != nil {
+		t.Fatalf("paused try-read mismatch: have (%d, %v, %v), want (0, false, nil)", n, ok, err)
+	}
+	done := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 8)
+		n, _ := r.Read(buf)
+		done <- string(buf[:n])
+	}()
+	select {
+	case <-done:
+		t.Fatalf("paused reader consumed data")
+	case <-time.After(20 * time.Millisecond):
+	}
+	r.Resume()
+	if have := <-done; have != "hello" {
+		t.Fatalf("resumed read mismatch: have %q, want %q", have, "hello")
+	}
+	// Paused writers should not produce data, even if there's space
+	w.Pause()
+	if n, ok := w.TryWrite([]byte("x")); n != 0 || ok {
+		t.Fatalf("paused try-write mismatch: have (%d, %v), want (0, false)", n, ok)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := w.Write([]byte("world"))
+		errc <- err
+	}()
+	select {
+	case <-errc:
+		t.Fatalf("paused writer produced data")
+	case <-time.After(20 * time.Millisecond):
+	}
+	w.Resume()
+	if err := <-errc; err != nil {
+		t.Fatalf("resumed write failed: %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != "world" {
+		t.Fatalf("resumed write mismatch: have %q, want %q", buf, "world")
+	}
+	// Closing the reader should release a paused writer
+	w.Pause()
+	go func() {
+		_, err := w.Write([]byte("!"))
+		errc <- err
+	}()
+	r.Close()
+	if err := <-errc; err != ErrClosedPipe {
+		t.Fatalf("paused write error mismatch: have %v, want %v", err, ErrClosedPipe)
+	}
+}
+
+// Tests that batched wake signals don't stall either side when moving tiny chunks
+// through the pipe, or when the reader waits for more than what's buffered.
+func TestPipeWakeBatch(t *testing.T) {
+	for _, strategy := range []WakeStrategy{WakeEdge, WakeLevel} {
+		r, w := Pipe(64, WithWakeStrategy(strategy), WithWakeBatch(48))
+
+		data := testData[:100000]
+		go func() {
+			for rest := data; len(rest) > 0; {
+				n := 1 + len(rest)%7
+				if n > len(rest) {
+					n = len(rest)
+				}
+				w.Write(rest[:n])
+				rest = rest[n:]
+			}
+			w.Close()
+		}()
+		have := new(bytes.Buffer)
+		buf := make([]byte, 5)
+		for {
+			n, err := r.Read(buf)
+			have.Write(buf[:n])
+			if err != nil {
+				break
+			}
+		}
+		if !bytes.Equal(have.Bytes(), data) {
+			t.Fatalf("%v: data mismatch: have %d bytes, want %d", strategy, have.Len(), len(data))
+		}
+		// Lines trickling in should get through once the writer is done
+		src, feed := io.Pipe()
+		go func() {
+			for _, chunk := range []string{"fir", "st\nsec", "ond", "\n"} {
+				feed.Write([]byte(chunk))
+			}
+			feed.Close()
+		}()
+		dst := new(bytes.Buffer)
+		if _, err := CopyLines(dst, src, 64, func(line []byte) ([]byte, error) { return line, nil }, WithWakeStrategy(strategy), WithWakeBatch(48)); err != nil {
+			t.Fatalf("%v: failed to copy lines: %v", strategy, err)
+		}
+		if dst.String() != "first\nsecond\n" {
+			t.Fatalf("%v: lines mismatch: have %q, want %q", strategy, dst.String(), "first\nsecond\n")
+		}
+	}
+}
+
+// Tests that the terminal error of a pipe is decided by the first close, and is
+// reported on both halves.
+func TestPipeErr(t *testing.T) {
+	errBoom := errors.New("boom")
+	tests := []struct {
+		close func(r *PipeReader, w *PipeWriter)
+		want  error
+	}{
+		{func(r *PipeReader, w *PipeWriter) { w.Close(); r.CloseWithError(errBoom) }, io.EOF},
+		{func(r *PipeReader, w *PipeWriter) { w.CloseWithError(errBoom); r.Close() }, errBoom},
+		{func(r *PipeReader, w *PipeWriter) { r.Close(); w.CloseWithError(errBoom) }, ErrClosedPipe},
+		{func(r *PipeReader, w *PipeWriter) { r.CloseWithError(errBoom); w.Close() }, errBoom},
+	}
+	for i, tt := range tests {
+		r, w := Pipe(16)
+		if r.Err() != nil || w.Err() != nil {
+			t.Fatalf("test %d: live pipe has terminal error: %v, %v", i, r.Err(), w.Err())
+		}
+		tt.close(r, w)
+		if r.Err() != tt.want || w.Err() != tt.want {
+			t.Fatalf("test %d: terminal error mismatch: have %v, %v, want %v", i, r.Err(), w.Err(), tt.want)
+		}
+	}
+}
+
+// Tests that pipes can run on top of caller provided memory, which is handed
+// back once the pipe terminates, and that unusable buffers are rejected.
+func TestPipeWithBuffer(t *testing.T) {
+	buf := make([]byte, 8)
+	r, w := PipeWithBuffer(buf)
+
+	recycled := make(chan struct{})
+	r.OnClose(func(CloseInfo) { close(recycled) })
+
+	if _, err := w.Write([]byte("0123")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if !bytes.Equal(buf[:4], []byte("0123")) {
+		t.Fatalf("buffer content mismatch: have %q, want %q", buf[:4], "0123")
+	}
+	go func() {
+		w.Write([]byte("456789abcdef"))
+		w.Close()
+	}()
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != "0123456789abcdef" {
+		t.Fatalf("read mismatch: have (%q, %v), want (%q, nil)", data, err, "0123456789abcdef")
+	}
+	r.Close()
+	select {
+	case <-recycled:
+	case <-time.After(time.Second):
+		t.Fatalf("buffer not handed back")
+	}
+	// Buffers unusable by the pipe should be rejected
+	recovered := func(fn func()) (r interface{}) {
+		defer func() { r = recover() }()
+		fn()
+		return nil
+	}
+	if r := recovered(func() { PipeWithBuffer(nil) }); r != ErrInvalidBuffer {
+		t.Fatalf("empty buffer panic mismatch: have %v, want %v", r, ErrInvalidBuffer)
+	}
+	if r := recovered(func() { PipeWithBuffer(make([]byte, 1000), WithBlockWrites(512, false)) }); r != ErrInvalidBuffer {
+		t.Fatalf("misaligned buffer panic mismatch: have %v, want %v", r, ErrInvalidBuffer)
+	}
+	PipeWithBuffer(make([]byte, 1024), WithBlockWrites(512, false))
+}
+
+// Tests that both halves can be closed repeatedly and concurrently, and that the
+// first close decides the terminal error.
+func TestPipeCloseTwice(t *testing.T) {
+	errFirst, errSecond := errors.New("first"), errors.New("second")
+
+	// Sequential closes should keep the first error
+	r, w := Pipe(16)
+	if err := w.CloseWithError(errFirst); err != nil {
+		t.Fatalf("first writer close failed: %v", err)
+	}
+	if err := w.CloseWithError(errSecond); err != nil {
+		t.Fatalf("second writer close failed: %v", err)
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != errFirst {
+		t.Fatalf("read mismatch: have (%d, %v), want (0, %v)", n, err, errFirst)
+	}
+	r.Close()
+	r.CloseWithError(errSecond)
+	if w.Err() != errFirst {
+		t.Fatalf("terminal error mismatch: have %v, want %v", w.Err(), errFirst)
+	}
+	// Concurrent closes should all return, with one of them deciding the error
+	for i := 0; i < 100; i++ {
+		r, w := Pipe(16)
+
+		var pend sync.WaitGroup
+		for _, err := range []error{nil, errFirst, errSecond} {
+			pend.Add(2)
+			go func(err error) { defer pend.Done(); w.CloseWithError(err) }(err)
+			go func(err error) { defer pend.Done(); r.CloseWithError(err) }(err)
+		}
+		pend.Wait()
+
+		if err := r.Err(); err != io.EOF && err != ErrClosedPipe && err != errFirst && err != errSecond {
+			t.Fatalf("run %d: unexpected terminal error: %v", i, err)
+		}
+	}
+}
+
+// Tests that a writer failure is delivered after the buffered data by default,
+// but right away, dropping the data, if aborting on errors was requested.
+func TestPipeAbortOnError(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	for _, abort := range []bool{false, true} {
+		var opts []Option
+		if abort {
+			opts = append(opts, WithAbortOnError())
+		}
+		r, w := Pipe(16, opts...)
+		if _, err := w.Write([]byte("hello")); err != nil {
+			t.Fatalf("abort %v: failed to write: %v", abort, err)
+		}
+		// The writer's close only returns once the data is consumed or dropped
+		done := make(chan struct{})
+		go func() {
+			w.CloseWithError(errBoom)
+			close(done)
+		}()
+		buf := make([]byte, 16)
+		if abort {
+			<-done
+			if n, err := r.Read(buf); n != 0 || err != errBoom {
+				t.Fatalf("abort %v: read mismatch: have (%d, %v), want (0, %v)", abort, n, err, errBoom)
+			}
+			r, w := Pipe(16, opts...)
+			w.Write([]byte("hello"))
+			w.CloseWithError(errBoom)
+			if n, ok, err := r.TryRead(buf); n != 0 || !ok || err != errBoom {
+				t.Fatalf("abort %v: try read mismatch: have (%d, %v, %v), want (0, true, %v)", abort, n, ok, err, errBoom)
+			}
+			continue
+		}
+		n, err := r.Read(buf)
+		if n != 5 || err != nil {
+			t.Fatalf("abort %v: read mismatch: have (%d, %v), want (5, nil)", abort, n, err)
+		}
+		if n, err := r.Read(buf); n != 0 || err != errBoom {
+			t.Fatalf("abort %v: read mismatch: have (%d, %v), want (0, %v)", abort, n, err, errBoom)
+		}
+		<-done
+	}
+}
@@ -0,0 +1,339 @@
+// Package pipetest implements conformance tests for buffered pipe and buffered
+// copy implementations, validating their data integrity, EOF semantics, close
+// ordering and error propagation.
+package pipetest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// MakePipe creates a new buffered pipe with the given buffer size, returning its
+// read and write halves.
+type MakePipe func(buffer int) (r io.ReadCloser, w io.WriteCloser, err error)
+
+// CopyFunc copies from src to dst through an internal buffer of the given size,
+// returning the number of bytes copied and the first error encountered. Its
+// semantics must match those of io.Copy.
+type CopyFunc func(dst io.Writer, src io.Reader, buffer int) (int64, error)
+
+// errorCloser is implemented by pipe halves which can be closed with an error,
+// such as those of io.Pipe.
+type errorCloser interface {
+	CloseWithError(err error) error
+}
+
+// errTest is the failure injected into the pipes and copies to check that it's
+// propagated.
+var errTest = errors.New("pipetest: injected failure")
+
+// bufferSizes are the sizes the implementations are tested with, the odd ones
+// meant to catch index arithmetic bugs.
+var bufferSizes = []int{1, 7, 4096, 333333}
+
+// random generates a pseudo-random binary blob.
+func random(length int) []byte {
+	data := make([]byte, length)
+	rand.New(rand.NewSource(0)).Read(data)
+	return data
+}
+
+// TestPipe tests that a buffered pipe implementation conforms to the semantics of
+// io.Pipe, apart from reads and writes being decoupled by the buffer. If the pipe
+// halves implement CloseWithError, error propagation is tested too.
+func TestPipe(t *testing.T, mp MakePipe) {
+	t.Run("Integrity", func(t *testing.T) { testPipeIntegrity(t, mp) })
+	t.Run("ReadAfterWriterClose", func(t *testing.T) { testReadAfterWriterClose(t, mp) })
+	t.Run("WriteAfterReaderClose", func(t *testing.T) { testWriteAfterReaderClose(t, mp) })
+	t.Run("CloseUnblocksWriter", func(t *testing.T) { testCloseUnblocksWriter(t, mp) })
+	t.Run("CloseUnblocksReader", func(t *testing.T) { testCloseUnblocksReader(t, mp) })
+	t.Run("CloseWithError", func(t *testing.T) { testPipeCloseWithError(t, mp) })
+}
+
+// TestCopy tests that a buffered copy implementation conforms to the semantics of
+// io.Copy: all data arrives intact, EOF is not reported as a failure, and errors
+// on either endpoint are propagated.
+func TestCopy(t *testing.T, copier CopyFunc) {
+	t.Run("Integrity", func(t *testing.T) { testCopyIntegrity(t, copier) })
+	t.Run("Empty", func(t *testing.T) { testCopyEmpty(t, copier) })
+	t.Run("SourceFailure", func(t *testing.T) { testCopySourceFailure(t, copier) })
+	t.Run("SinkFailure", func(t *testing.T) { testCopySinkFailure(t, copier) })
+}
+
+// mustPipe creates a pipe or fails the test.
+func mustPipe(t *testing.T, mp MakePipe, buffer int) (io.ReadCloser, io.WriteCloser) {
+	t.Helper()
+
+	r, w, err := mp(buffer)
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	return r, w
+}
+
+// testPipeIntegrity streams data of random chunk sizes through the pipe with the
+// two sides running concurrently, checking that nothing is lost or duplicated.
+func testPipeIntegrity(t *testing.T, mp MakePipe) {
+	data := random(1024 * 1024)
+
+	for _, buffer := range bufferSizes {
+		r, w := mustPipe(t, mp, buffer)
+
+		errc := make(chan error, 1)
+		go func() {
+			rng := rand.New(rand.NewSource(1))
+			for rest := data; len(rest) > 0; {
+				n := 1 + rng.Intn(16*1024)
+				if n > len(rest) {
+					n = len(rest)
+				}
+				if _, err := w.Write(rest[:n]); err != nil {
+					errc <- err
+					return
+				}
+				rest = rest[n:]
+			}
+			errc <- w.Close()
+		}()
+		var (
+			have  []byte
+			rng   = rand.New(rand.NewSource(2))
+			chunk = make([]byte, 16*1024)
+		)
+		for {
+			n, err := r.Read(chunk[:1+rng.Intn(len(chunk))])
+			have = append(have, chunk[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("buffer %d: failed to read: %v", buffer, err)
+			}
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("buffer %d: failed to write: %v", buffer, err)
+		}
+		if !bytes.Equal(have, data) {
+			t.Fatalf("buffer %d: data mismatch: have %d bytes, want %d", buffer, len(have), len(data))
+		}
+		r.Close()
+	}
+}
+
+// testReadAfterWriterClose checks that the data written before closing the writer
+// can still be read, after which the read returns EOF. The writer is closed on a
+// separate goroutine, as buffered pipes may block the close until it's consumed.
+func testReadAfterWriterClose(t *testing.T, mp MakePipe) {
+	r, w := mustPipe(t, mp, 1024)
+	defer r.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		if _, err := w.Write([]byte("hello")); err != nil {
+			errc <- err
+			return
+		}
+		errc <- w.Close()
+	}()
+	have, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if string(have) != "hello" {
+		t.Fatalf("data mismatch: have %q, want %q", have, "hello")
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("failed to write and close: %v", err)
+	}
+}
+
+// testWriteAfterReaderClose checks that writes fail once the reader is closed.
+func testWriteAfterReaderClose(t *testing.T, mp MakePipe) {
+	r, w := mustPipe(t, mp, 1024)
+	defer w.Close()
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("failed to close reader: %v", err)
+	}
+	if _, err := w.Write([]byte("hello")); err == nil {
+		t.Fatalf("write succeeded on closed reader")
+	}
+}
+
+// testCloseUnblocksWriter checks that a writer blocked on a full buffer is woken
+// up when the reader is closed.
+func testCloseUnblocksWriter(t *testing.T, mp MakePipe) {
+	r, w := mustPipe(t, mp, 1024)
+	defer w.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := w.Write(make([]byte, 64*1024))
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	r.Close()
+
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Fatalf("blocked write succeeded on closed reader")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("blocked write not released by reader close")
+	}
+}
+
+// testCloseUnblocksReader checks that a reader blocked on an empty buffer is woken
+// up with EOF when the writer is closed.
+func testCloseUnblocksReader(t *testing.T, mp MakePipe) {
+	r, w := mustPipe(t, mp, 1024)
+	defer r.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 16))
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	w.Close()
+
+	select {
+	case err := <-errc:
+		if err != io.EOF {
+			t.Fatalf("blocked read error mismatch: have %v, want %v", err, io.EOF)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("blocked read not released by writer close")
+	}
+}
+
+// testPipeCloseWithError checks that the errors the writer is closed with reach
+// the reader after the buffered data is consumed.
+func testPipeCloseWithError(t *testing.T, mp MakePipe) {
+	r, w := mustPipe(t, mp, 1024)
+	defer r.Close()
+
+	closer, ok := w.(errorCloser)
+	if !ok {
+		t.Skip("writer doesn't support CloseWithError")
+	}
+	go func() {
+		if _, err := w.Write([]byte("hello")); err == nil {
+			closer.CloseWithError(errTest)
+		}
+	}()
+	have := make([]byte, 16)
+	if n, err := io.ReadFull(r, have[:5]); err != nil || string(have[:n]) != "hello" {
+		t.Fatalf("buffered data mismatch: have (%q, %v), want (%q, nil)", have[:n], err, "hello")
+	}
+	if _, err := r.Read(have); err != errTest {
+		t.Fatalf("error mismatch: have %v, want %v", err, errTest)
+	}
+}
+
+// testCopyIntegrity copies data through various buffer sizes, checking that it all
+// arrives intact and is accounted for.
+func testCopyIntegrity(t *testing.T, copier CopyFunc) {
+	data := random(1024 * 1024)
+	want := sha256.Sum256(data)
+
+	for _, buffer := range bufferSizes {
+		hasher := sha256.New()
+		n, err := copier(hasher, bytes.NewReader(data), buffer)
+		if err != nil {
+			t.Fatalf("buffer %d: failed to copy: %v", buffer, err)
+		}
+		if n != int64(len(data)) {
+			t.Fatalf("buffer %d: length mismatch: have %d, want %d", buffer, n, len(data))
+		}
+		if !bytes.Equal(hasher.Sum(nil), want[:]) {
+			t.Fatalf("buffer %d: corrupt data on the output", buffer)
+		}
+	}
+}
+
+// testCopyEmpty checks that copying an empty source succeeds without writes.
+func testCopyEmpty(t *testing.T, copier CopyFunc) {
+	dst := new(bytes.Buffer)
+	if n, err := copier(dst, bytes.NewReader(nil), 1024); n != 0 || err != nil {
+		t.Fatalf("result mismatch: have (%d, %v), want (0, nil)", n, err)
+	}
+}
+
+// failingReader returns some data, after which it fails.
+type failingReader struct {
+	data []byte
+}
+
+func (r *failingReader) Read(b []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errTest
+	}
+	n := copy(b, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// testCopySourceFailure checks that source errors are reported, after all data
+// read before the failure has been delivered.
+func testCopySourceFailure(t *testing.T, copier CopyFunc) {
+	data := random(64 * 1024)
+
+	dst := new(bytes.Buffer)
+	n, err := copier(dst, &failingReader{data: data}, 4096)
+	if err != errTest {
+		t.Fatalf("error mismatch: have %v, want %v", err, errTest)
+	}
+	if n != int64(len(data)) || !bytes.Equal(dst.Bytes(), data) {
+		t.Fatalf("data mismatch: have %d bytes, want %d", n, len(data))
+	}
+}
+
+// failingWriter accepts a limited amount of data, after which it fails.
+type failingWriter struct {
+	left int
+	lock sync.Mutex
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if len(b) > w.left {
+		n := w.left
+		w.left = 0
+		return n, errTest
+	}
+	w.left -= len(b)
+	return len(b), nil
+}
+
+// endlessReader is a source which never runs dry.
+type endlessReader struct{}
+
+func (endlessReader) Read(b []byte) (int, error) { return len(b), nil }
+
+// testCopySinkFailure checks that sink errors are reported, and that they abort
+// the copy even if the source is endless.
+func testCopySinkFailure(t *testing.T, copier CopyFunc) {
+	errc := make(chan error, 1)
+	go func() {
+		n, err := copier(&failingWriter{left: 100000}, endlessReader{}, 4096)
+		if err != errTest || n != 100000 {
+			t.Errorf("result mismatch: have (%d, %v), want (%d, %v)", n, err, 100000, errTest)
+		}
+		errc <- err
+	}()
+	select {
+	case <-errc:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("sink failure didn't abort the copy")
+	}
+}
@@ -0,0 +1,21 @@
+package pipetest
+
+import (
+	"io"
+	"testing"
+)
+
+// Tests that the standard library's unbuffered pipe and copy pass the suite, as
+// they define the semantics the buffered implementations must conform to.
+func TestStdlibPipe(t *testing.T) {
+	TestPipe(t, func(buffer int) (io.ReadCloser, io.WriteCloser, error) {
+		r, w := io.Pipe()
+		return r, w, nil
+	})
+}
+
+func TestStdlibCopy(t *testing.T) {
+	TestCopy(t, func(dst io.Writer, src io.Reader, buffer int) (int64, error) {
+		return io.CopyBuffer(dst, src, make([]byte, buffer))
+	})
+}
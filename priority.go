@@ -0,0 +1,164 @@
+package bufioprop
+
+import (
+	"io"
+	"runtime/debug"
+)
+
+// PrioritySource is a source feeding a pipe alongside others, see ReadFromPriority.
+type PrioritySource struct {
+	Reader   io.Reader // Source to read the chunks from
+	Priority int       // Priority of the source's chunks (higher goes first)
+}
+
+// ReadFromPriority feeds the pipe from multiple sources concurrently, reading them
+// in chunks of up to the given size (0 = the pipe's buffer size) and interleaving
+// them into the pipe at chunk granularity. Whenever multiple chunks are ready,
+// the one from the source with the highest priority is written first, and equal
+// priorities are served in arrival order.
+//
+// Every chunk returned by a single source Read is placed into the pipe contiguous
+// and whole, so sources returning entire frames (e.g. the control and bulk data
+// streams of a multiplexing protocol) can share the pipe without their frames
+// getting torn apart. Every source is read ahead by at most one chunk.
+//
+// It returns the number of bytes placed into the pipe once all sources reach EOF,
+// or the first error encountered, upon which the remaining sources are abandoned
+// after their pending reads return. As with Copy, panics of the sources are
+// recovered and returned as a *PanicError.
+func (w *PipeWriter) ReadFromPriority(srcs []PrioritySource, chunk int) (read int64, err error) {
+	w.p.inOwner.acquire("ReadFromPriority")
+	defer w.p.inOwner.release()
+
+	read, err = w.p.readFromPriority(srcs, chunk)
+	return read, w.p.writeError(err)
+}
+
+// priorityChunk is a chunk of data read from a prioritized source.
+type priorityChunk struct {
+	src  int    // Index of the source the chunk was read from
+	data []byte // Data read from the source
+	err  error  // Failure returned by the source along the data
+}
+
+// readFromPriority runs a reader goroutine for each source, and keeps writing the
+// chunks they produce into the pipe, in priority order.
+func (p *pipe) readFromPriority(srcs []PrioritySource, chunk int) (read int64, failure error) {
+	if p.reserving {
+		return 0, ErrReservationOpen
+	}
+	if chunk <= 0 {
+		chunk = int(p.size)
+	}
+	var (
+		ready  = make(chan priorityChunk)
+		resume = make([]chan struct{}, len(srcs))
+		quit   = make(chan struct{})
+	)
+	defer close(quit)
+
+	for i, src := range srcs {
+		resume[i] = make(chan struct{}, 1)
+		go p.feedPriority(i, src.Reader, chunk, ready, resume[i], quit)
+	}
+	var queued []priorityChunk
+	for live := len(srcs); live > 0; {
+		// Wait for at least one chunk and for room in the pipe, deferring the pick
+		// as late as possible so higher priority chunks can still arrive
+		if len(queued) == 0 {
+			queued = append(queued, <-ready)
+		}
+		if _, err := p.inputWait(); err != nil {
+			return read, err
+		}
+		for gathered := false; !gathered; {
+			select {
+			case c := <-ready:
+				queued = append(queued, c)
+			default:
+				gathered = true
+			}
+		}
+		// Pick the first chunk of the highest priority and push it into the pipe
+		best := 0
+		for i := 1; i < len(queued); i++ {
+			if srcs[queued[i].src].Priority > srcs[queued[best].src].Priority {
+				best = i
+			}
+		}
+		c := queued[best]
+		queued = append(queued[:best], queued[best+1:]...)
+
+		if len(c.data) > 0 {
+			n, err := p.write(c.data)
+			read += int64(n)
+			if err != nil {
+				return read, err
+			}
+		}
+		// Retire finished sources, or let them read their next chunk
+		if c.err == io.EOF {
+			live--
+			continue
+		}
+		if c.err != nil {
+			return read, c.err
+		}
+		resume[c.src] <- struct{}{}
+	}
+	return read, nil
+}
+
+// feedPriority keeps reading chunks from a source, handing each over to be written
+// into the pipe and waiting until it is, before reading the next one.
+func (p *pipe) feedPriority(src int, r io.Reader, chunk int, ready chan<- priorityChunk, resume <-chan struct{}, quit <-chan struct{}) {
+	buffer := make([]byte, chunk)
+	for empty := 0; ; {
+		c := priorityChunk{src: src}
+		c.data, c.err = readChunk(r, buffer)
+
+		if len(c.data) == 0 && c.err == nil {
+			p.stats.ZeroReads.Add(1)
+
+			// Guard against sources not making any progress
+			if empty++; p.emptyReads > 0 && empty >= p.emptyReads {
+				c.err = io.ErrNoProgress
+			} else {
+				continue
+			}
+		} else {
+			empty = 0
+		}
+		if len(c.data) > 0 && c.err != nil {
+			if c.err == io.EOF {
+				p.stats.EOFWithData.Add(1)
+			} else {
+				p.stats.ErrWithData.Add(1)
+			}
+		}
+		select {
+		case ready <- c:
+		case <-quit:
+			return
+		}
+		if c.err != nil {
+			return
+		}
+		select {
+		case <-resume:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// readChunk reads a single chunk from a source, converting any panic into an error.
+func readChunk(src io.Reader, buffer []byte) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			data, err = nil, &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	n, err := src.Read(buffer)
+	return buffer[:n], err
+}
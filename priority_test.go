@@ -0,0 +1,111 @@
+package bufioprop
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// frameReader is a source returning a fixed number of fixed size frames, one per
+// read, each tagged with the source's identifier and the frame's sequence number.
+type frameReader struct {
+	id     byte
+	frames int
+	next   int
+}
+
+func (r *frameReader) Read(b []byte) (int, error) {
+	if r.next == r.frames {
+		return 0, io.EOF
+	}
+	frame := make([]byte, 16)
+	frame[0], frame[1] = r.id, byte(r.next)
+	r.next++
+	return copy(b, frame), nil
+}
+
+// Tests that multiple sources are interleaved into the pipe with their frames
+// intact, and that high priority frames overtake the bulk ones.
+func TestReadFromPriority(t *testing.T) {
+	r, w := Pipe(16)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := w.ReadFromPriority([]PrioritySource{
+			{Reader: &frameReader{id: 'b', frames: 100}, Priority: 0},
+			{Reader: &frameReader{id: 'c', frames: 10}, Priority: 1},
+		}, 16)
+		w.Close()
+		errc <- err
+	}()
+	// Consume the frames slowly, so both sources always have their next one ready
+	var (
+		next  = map[byte]int{}
+		order []byte
+	)
+	frame := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(r, frame); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+		if int(frame[1]) != next[frame[0]] {
+			t.Fatalf("source %c: frame mismatch: have %d, want %d", frame[0], frame[1], next[frame[0]])
+		}
+		next[frame[0]]++
+		order = append(order, frame[0])
+		time.Sleep(100 * time.Microsecond)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("failed to feed pipe: %v", err)
+	}
+	if next['b'] != 100 || next['c'] != 10 {
+		t.Fatalf("frame count mismatch: have %d bulk, %d control, want 100, 10", next['b'], next['c'])
+	}
+	// The pipe and the writer may hold a few bulk frames before control ones arrive
+	for i, id := range order[15:] {
+		if id == 'c' {
+			t.Fatalf("control frame delivered late, at position %d: %s", 15+i, order)
+		}
+	}
+}
+
+// Tests that failing and panicking sources abort the feeding.
+func TestReadFromPriorityFailure(t *testing.T) {
+	fail := errors.New("source failure")
+	r, w := Pipe(1024)
+	go io.Copy(io.Discard, r)
+
+	_, err := w.ReadFromPriority([]PrioritySource{
+		{Reader: &frameReader{id: 'b', frames: 1000000}},
+		{Reader: &errDataReader{data: testData[:100], chunk: 10, err: fail}, Priority: 1},
+	}, 0)
+	if err != fail {
+		t.Fatalf("error mismatch: have %v, want %v", err, fail)
+	}
+	var perr *PanicError
+	_, err = w.ReadFromPriority([]PrioritySource{
+		{Reader: &panickingReader{left: 100}},
+	}, 16)
+	if !errors.As(err, &perr) {
+		t.Fatalf("panic error mismatch: have %v, want *PanicError", err)
+	}
+	r.Close()
+}
+
+// Tests that prioritized feeds into a pipe with io.Pipe semantics report the same
+// close errors as plain writes do.
+func TestReadFromPriorityCompat(t *testing.T) {
+	r, w := BufferedPipe()
+	r.CloseWithError(errContract)
+
+	if _, err := w.ReadFromPriority([]PrioritySource{{Reader: &frameReader{id: 'a', frames: 1}}}, 0); err != errContract {
+		t.Fatalf("error mismatch: have %v, want %v", err, errContract)
+	}
+	w.Close()
+	if _, err := w.ReadFromPriority([]PrioritySource{{Reader: &frameReader{id: 'a', frames: 1}}}, 0); err != io.ErrClosedPipe {
+		t.Fatalf("closed error mismatch: have %v, want %v", err, io.ErrClosedPipe)
+	}
+}
@@ -0,0 +1,73 @@
+package bufioprop
+
+import "io"
+
+// ReadAll reads from src until an error or EOF and returns the data it read. A
+// successful call returns err == nil, not err == EOF, same as io.ReadAll.
+//
+// Unlike io.ReadAll, the source is read ahead on a separate goroutine into the
+// internal buffer (see Copy), so slow sources don't wait for the result to be
+// reassembled. The result is collected into chunks of growing size, copied into
+// a single slice once at the end, instead of repeatedly reallocating it. If the
+// remaining length of src is known, the result is allocated upfront in one go.
+func ReadAll(src io.Reader, buffer int, opts ...Option) ([]byte, error) {
+	collector := new(chunkCollector)
+	if remaining, ok := sourceLen(src); ok {
+		collector.next = int(remaining)
+	}
+	_, err := Copy(collector, src, buffer, opts...)
+	return collector.bytes(), err
+}
+
+// Minimum and maximum sizes of the chunks ReadAll collects its result into.
+const (
+	minCollectChunk = 512
+	maxCollectChunk = 4 * 1024 * 1024
+)
+
+// chunkCollector is a writer gathering all data written into it into a list of
+// chunks of doubling size, to be concatenated when done.
+type chunkCollector struct {
+	chunks [][]byte // Chunks filled so far, the last one possibly partially
+	next   int      // Size of the next chunk to allocate (0 = start over)
+	total  int      // Total number of bytes collected
+}
+
+// Write implements io.Writer, appending the data to the collected chunks.
+func (c *chunkCollector) Write(b []byte) (int, error) {
+	written := len(b)
+	for len(b) > 0 {
+		if len(c.chunks) == 0 || len(c.chunks[len(c.chunks)-1]) == cap(c.chunks[len(c.chunks)-1]) {
+			size := c.next
+			if size < minCollectChunk {
+				size = minCollectChunk
+			}
+			c.chunks = append(c.chunks, make([]byte, 0, size))
+			if c.next = 2 * size; c.next > maxCollectChunk {
+				c.next = maxCollectChunk
+			}
+		}
+		last := &c.chunks[len(c.chunks)-1]
+
+		n := copy((*last)[len(*last):cap(*last)], b)
+		*last = (*last)[:len(*last)+n]
+		b = b[n:]
+	}
+	c.total += written
+	return written, nil
+}
+
+// bytes concatenates the collected chunks, avoiding the copy if there's only one.
+func (c *chunkCollector) bytes() []byte {
+	switch len(c.chunks) {
+	case 0:
+		return []byte{}
+	case 1:
+		return c.chunks[0]
+	}
+	res := make([]byte, 0, c.total)
+	for _, chunk := range c.chunks {
+		res = append(res, chunk...)
+	}
+	return res
+}
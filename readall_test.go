@@ -0,0 +1,44 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// Tests that ReadAll collects sources of known and unknown lengths in full, and
+// returns the data read before a failure alongside it.
+func TestReadAll(t *testing.T) {
+	for _, size := range []int{0, 1, 511, 4096, 100000, 10 * 1024 * 1024} {
+		// Sources of known length should be allocated upfront
+		data, err := ReadAll(bytes.NewReader(testData[:size]), 64*1024)
+		if err != nil || !bytes.Equal(data, testData[:size]) {
+			t.Fatalf("size %d, known length: result mismatch: have (%d bytes, %v), want (%d bytes, nil)", size, len(data), err, size)
+		}
+		if cap(data) != size && size > minCollectChunk {
+			t.Fatalf("size %d, known length: capacity mismatch: have %d, want %d", size, cap(data), size)
+		}
+		// Sources of unknown length should be collected in growing chunks
+		data, err = ReadAll(&errDataReader{data: testData[:size], chunk: 1000, err: io.EOF}, 64*1024)
+		if err != nil || !bytes.Equal(data, testData[:size]) {
+			t.Fatalf("size %d, unknown length: result mismatch: have (%d bytes, %v), want (%d bytes, nil)", size, len(data), err, size)
+		}
+		if data == nil {
+			t.Fatalf("size %d: nil result, want non-nil", size)
+		}
+	}
+	// Failures should be returned with the data preceding them
+	errBoom := errors.New("boom")
+
+	data, err := ReadAll(&errDataReader{data: testData[:5000], chunk: 1000, err: errBoom}, 1024)
+	if err != errBoom || !bytes.Equal(data, testData[:5000]) {
+		t.Fatalf("failing source result mismatch: have (%d bytes, %v), want (5000 bytes, %v)", len(data), err, errBoom)
+	}
+}
+
+func BenchmarkReadAll(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		ReadAll(&errDataReader{data: testData[:16*1024*1024], chunk: 32 * 1024, err: io.EOF}, 1024*1024)
+	}
+}
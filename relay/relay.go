@@ -0,0 +1,138 @@
+// Package relay splices two network connections together bidirectionally, with
+// each direction streaming through its own buffered copy.
+package relay
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/karalabe/bufioprop"
+)
+
+// Direction contains the counters of one direction of a relay. All fields are
+// updated atomically and may be read while the relay is running.
+type Direction struct {
+	Bytes atomic.Uint64   // Number of bytes relayed in this direction
+	Pipe  bufioprop.Stats // Events observed by this direction's pipe
+}
+
+// Stats contains the per-direction counters of a relay.
+type Stats struct {
+	AtoB Direction // Traffic flowing from the first connection to the second
+	BtoA Direction // Traffic flowing from the second connection to the first
+}
+
+// Config contains the tunables of a relay.
+type Config struct {
+	Buffer      int           // Pipe buffer size of each direction
+	IdleTimeout time.Duration // Duration without traffic after which to abort (0 = never)
+}
+
+// Splice relays data between a and b in both directions until both directions
+// finish (with a half-close forwarded, if the connections support it) or either
+// fails, in which case both connections are torn down. Both are closed before
+// returning. The first error encountered (if any) is returned.
+//
+// If stats is non-nil, the traffic is accounted into it while running.
+func Splice(a, b net.Conn, config Config, stats *Stats) error {
+	if stats == nil {
+		stats = new(Stats)
+	}
+	activity := new(atomic.Int64)
+	activity.Store(time.Now().UnixNano())
+
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		failure error
+	)
+	relay := func(dst, src net.Conn, dir *Direction) {
+		defer wg.Done()
+
+		in := &idleConn{Conn: src, timeout: config.IdleTimeout, activity: activity}
+		out := &idleConn{Conn: dst, timeout: config.IdleTimeout, activity: activity, counter: &dir.Bytes}
+
+		_, err := bufioprop.Copy(out, in, config.Buffer, bufioprop.WithStats(&dir.Pipe))
+		if err == nil {
+			// Source finished cleanly, forward the half-close if possible
+			if hc, ok := dst.(interface{ CloseWrite() error }); ok {
+				if err = hc.CloseWrite(); err == nil {
+					return
+				}
+			}
+		}
+		// Either failed or can't half-close, tear down both connections
+		errOnce.Do(func() { failure = err })
+		a.Close()
+		b.Close()
+	}
+	wg.Add(2)
+	go relay(b, a, &stats.AtoB)
+	go relay(a, b, &stats.BtoA)
+	wg.Wait()
+
+	a.Close()
+	b.Close()
+
+	if failure != nil && errors.Is(failure, net.ErrClosed) {
+		failure = nil // torn down after the other direction finished
+	}
+	return failure
+}
+
+// ErrIdleTimeout is returned if no traffic flowed in either direction of a relay
+// for the configured idle timeout.
+var ErrIdleTimeout = errors.New("relay: idle timeout")
+
+// An idleConn is a net.Conn wrapper enforcing an idle timeout shared with other
+// connections, and accounting the written bytes.
+type idleConn struct {
+	net.Conn
+	timeout  time.Duration  // Duration without traffic after which to abort
+	activity *atomic.Int64  // Time of the last traffic in either direction
+	counter  *atomic.Uint64 // Counter to account written bytes into (nil = none)
+}
+
+// Read implements io.Reader, bumping the deadline before every read. If the read
+// times out while the other direction was active, it's simply retried.
+func (c *idleConn) Read(b []byte) (int, error) {
+	for {
+		if c.timeout > 0 {
+			c.SetReadDeadline(time.Now().Add(c.timeout))
+		}
+		n, err := c.Conn.Read(b)
+		if n > 0 {
+			c.activity.Store(time.Now().UnixNano())
+		}
+		if err != nil && n == 0 && c.timeout > 0 {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				if time.Since(time.Unix(0, c.activity.Load())) < c.timeout {
+					continue
+				}
+				err = ErrIdleTimeout
+			}
+		}
+		return n, err
+	}
+}
+
+// Write implements io.Writer, bumping the deadline before every write.
+func (c *idleConn) Write(b []byte) (int, error) {
+	if c.timeout > 0 {
+		c.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.activity.Store(time.Now().UnixNano())
+		if c.counter != nil {
+			c.counter.Add(uint64(n))
+		}
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		err = ErrIdleTimeout
+	}
+	return n, err
+}
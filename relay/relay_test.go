@@ -0,0 +1,94 @@
+package relay
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+// Tests that data is relayed in both directions, with half-closes forwarded.
+func TestSplice(t *testing.T) {
+	// Create an upstream server echoing everything back
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer upstream.Close()
+	go func() {
+		conn, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		io.Copy(conn, conn)
+		conn.Close()
+	}()
+	// Create the relay forwarding to the echo server
+	front, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer front.Close()
+
+	stats := new(Stats)
+	errc := make(chan error, 1)
+	go func() {
+		a, err := front.Accept()
+		if err != nil {
+			errc <- err
+			return
+		}
+		b, err := net.Dial("tcp", upstream.Addr().String())
+		if err != nil {
+			errc <- err
+			return
+		}
+		errc <- Splice(a, b, Config{Buffer: 3333, IdleTimeout: time.Second}, stats)
+	}()
+	// Push some data through and ensure it arrives back intact
+	conn, err := net.Dial("tcp", front.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial relay: %v", err)
+	}
+	defer conn.Close()
+
+	data := make([]byte, 4*1024*1024)
+	rand.New(rand.NewSource(0)).Read(data)
+	go func() {
+		conn.Write(data)
+		conn.(*net.TCPConn).CloseWrite()
+	}()
+	reply, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("failed to read reply: %v", err)
+	}
+	if !bytes.Equal(reply, data) {
+		t.Fatalf("relayed data mismatch")
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("relay failed: %v", err)
+	}
+	if n := stats.AtoB.Bytes.Load(); n != uint64(len(data)) {
+		t.Errorf("forward bytes mismatch: have %d, want %d", n, len(data))
+	}
+	if n := stats.BtoA.Bytes.Load(); n != uint64(len(data)) {
+		t.Errorf("backward bytes mismatch: have %d, want %d", n, len(data))
+	}
+}
+
+// Tests that idle relays are torn down.
+func TestSpliceIdleTimeout(t *testing.T) {
+	a, _ := net.Pipe()
+	b, _ := net.Pipe()
+
+	start := time.Now()
+	if err := Splice(a, b, Config{Buffer: 1024, IdleTimeout: 50 * time.Millisecond}, nil); err != ErrIdleTimeout {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrIdleTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("idle timeout took too long: %v", elapsed)
+	}
+}
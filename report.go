@@ -0,0 +1,63 @@
+package bufioprop
+
+import "sync/atomic"
+
+// Side identifies one of the two halves of a copy.
+type Side int
+
+const (
+	// SideRead is the producer side of a copy, reading the source into the pipe.
+	SideRead Side = iota + 1
+
+	// SideWrite is the consumer side of a copy, writing the pipe into the sink.
+	SideWrite
+)
+
+// String implements fmt.Stringer.
+func (s Side) String() string {
+	switch s {
+	case SideRead:
+		return "read"
+	case SideWrite:
+		return "write"
+	default:
+		return "unknown"
+	}
+}
+
+// A CopyReport details how the two sides of a copy terminated, permitting the
+// reconciliation of a failed or canceled copy with its endpoints.
+type CopyReport struct {
+	Read    int64 // Number of bytes read from the source into the pipe
+	Written int64 // Number of bytes written from the pipe into the destination
+
+	ReadErr  error // Failure of the read side, if any
+	WriteErr error // Failure of the write side, if any
+
+	First Side // Side which terminated first
+}
+
+// InFlight returns the number of bytes read from the source but never handed to
+// the destination. They were buffered in the pipe when the copy terminated.
+func (r *CopyReport) InFlight() int64 {
+	return r.Read - r.Written
+}
+
+// copyReporter tracks the termination of the two sides of a copy.
+type copyReporter struct {
+	first atomic.Int32 // Side which terminated first, set only once
+}
+
+// done records the termination of one side of the copy.
+func (r *copyReporter) done(side Side) {
+	r.first.CompareAndSwap(0, int32(side))
+}
+
+// filterErr passes a failure of one side of a copy through the user's error
+// filter, if any.
+func (c *config) filterErr(side Side, err error) error {
+	if err == nil || c.errFilter == nil {
+		return err
+	}
+	return c.errFilter(side, err)
+}
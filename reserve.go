@@ -0,0 +1,105 @@
+package bufioprop
+
+import "errors"
+
+var (
+	// ErrCommitOverflow is returned when committing more data into the pipe than
+	// the space previously reserved.
+	ErrCommitOverflow = errors.New("bufio: commit exceeds reservation")
+
+	// ErrNoReservation is returned when committing data into the pipe without a
+	// preceding Reserve call.
+	ErrNoReservation = errors.New("bufio: commit without reservation")
+
+	// ErrReservationOpen is returned when writing into the pipe while a space
+	// returned by Reserve is still waiting to be committed.
+	ErrReservationOpen = errors.New("bufio: write during open reservation")
+)
+
+// Reserve returns a slice of up to n contiguous bytes of free space in the pipe,
+// blocking until at least one is available. Producers can fill the slice in place
+// (e.g. letting a decoder write straight into the ring), and then publish the
+// data to the reader via Commit, without copying from a buffer of their own.
+//
+// Fewer than n bytes are returned if less are free, or if the free space wraps
+// around the end of the ring. Reserving again without committing returns the
+// same space. Until the reservation is ended via Commit, all other writes fail
+// with ErrReservationOpen; a failed Reserve ends it too.
+func (w *PipeWriter) Reserve(n int) ([]byte, error) {
+	w.p.inOwner.acquire("Reserve")
+	defer w.p.inOwner.release()
+
+	return w.p.reserve(n)
+}
+
+// Commit publishes the first n bytes of the space returned by the last Reserve
+// call to the reader, ending the reservation.
+func (w *PipeWriter) Commit(n int) error {
+	w.p.inOwner.acquire("Commit")
+	defer w.p.inOwner.release()
+
+	return w.p.commit(n)
+}
+
+// Reserve waits for some free space in the internal buffer and returns up to n
+// contiguous bytes of it.
+func (p *pipe) reserve(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, ErrNegativeCount
+	}
+	// Short circuit if either side was already closed
+	select {
+	case <-p.inQuit:
+		p.abortReserve()
+		return nil, ErrClosedPipe
+	case <-p.outQuit:
+		p.abortReserve()
+		return nil, ErrClosedPipe
+	default:
+	}
+	// Wait until some space frees up, holding on to the buffer until committed
+	if !p.reserving {
+		p.wakeBuffer()
+		p.reserving = true
+	}
+	safeFree, err := p.inputWait()
+	if err != nil {
+		p.abortReserve()
+		return nil, err
+	}
+	limit := p.inPos + safeFree
+	if limit > p.size {
+		limit = p.size
+	}
+	if limit > p.inPos+int32(n) {
+		limit = p.inPos + int32(n)
+	}
+	space := p.buffer[p.inPos:limit:limit]
+	p.reserved = len(space)
+
+	return space, nil
+}
+
+// Commit publishes data written into the reserved space of the internal buffer.
+func (p *pipe) commit(n int) error {
+	if !p.reserving {
+		return ErrNoReservation
+	}
+	if n < 0 || n > p.reserved {
+		return ErrCommitOverflow
+	}
+	p.reserved, p.reserving = 0, false
+	if n > 0 {
+		p.inputAdvance(n)
+	}
+	p.sleepBuffer()
+	return nil
+}
+
+// abortReserve ends the open reservation, if any, without publishing its data.
+func (p *pipe) abortReserve() {
+	if p.reserving {
+		p.reserved, p.reserving = 0, false
+		p.sleepBuffer()
+	}
+}
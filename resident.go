@@ -0,0 +1,80 @@
+package bufioprop
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"io"
+)
+
+// squasher is a source compressing the data of another on the fly, flushing the
+// compressor after every read, so the consumer can decompress anything read from
+// the source right away, without waiting for a full compression block.
+type squasher struct {
+	src  io.Reader     // Source of the uncompressed data
+	comp *flate.Writer // Compressor of the data read from the source
+	out  bytes.Buffer  // Compressed data not yet handed out
+	raw  []byte        // Scratch buffer to read the uncompressed data into
+	read int64         // Number of uncompressed bytes read from the source
+	err  error         // Failure of the source, delivered after the compressed data
+}
+
+// newSquasher creates a compressing source, reading src in chunks of the given
+// size and compressing them with the given flate level.
+func newSquasher(src io.Reader, level int, chunk int) (*squasher, error) {
+	s := &squasher{src: src, raw: make([]byte, chunk)}
+
+	comp, err := flate.NewWriter(&s.out, level)
+	if err != nil {
+		return nil, err
+	}
+	s.comp = comp
+	return s, nil
+}
+
+// Read implements io.Reader, returning compressed data of the source.
+func (s *squasher) Read(b []byte) (int, error) {
+	for s.out.Len() == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		n, err := s.src.Read(s.raw)
+		s.read += int64(n)
+		if n > 0 {
+			s.comp.Write(s.raw[:n]) // can't fail, writes into memory
+		}
+		switch {
+		case err != nil:
+			// Terminate the compressed stream cleanly on any source failure, so
+			// the consumer doesn't mistake it for a corruption, then report it
+			s.comp.Close()
+			s.err = err
+
+		case n > 0:
+			s.comp.Flush()
+		}
+	}
+	return s.out.Read(b)
+}
+
+// copyResident copies from src to dst through a pipe holding its buffered data
+// compressed, see WithResidentCompression.
+func copyResident(dst io.Writer, src io.Reader, buffer int, c *config) (written int64, err error) {
+	// Read the source in chunks of at most half the buffer, so that even a poorly
+	// compressible chunk fits into the pipe without stalling mid way
+	chunk := bufferSize(buffer) / 2
+	if chunk > 64*1024 {
+		chunk = 64 * 1024
+	}
+	if chunk < 512 {
+		chunk = 512
+	}
+	if c.squash, err = newSquasher(src, c.residentLevel, chunk); err != nil {
+		closeOwned(dst, src, c, &err)
+		return 0, err
+	}
+	return copyPipe(dst, src, buffer, c, func(pr *PipeReader) (int64, error) {
+		// Buffer the decompressor's input, it would otherwise go byte by byte
+		return io.Copy(dst, flate.NewReader(bufio.NewReaderSize(pr, chunk)))
+	})
+}
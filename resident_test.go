@@ -0,0 +1,46 @@
+package bufioprop
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"testing"
+)
+
+// Tests that copies keeping their buffered data compressed deliver the source
+// intact, with the pipe only ever seeing the compressed stream.
+func TestCopyResidentCompression(t *testing.T) {
+	defer ForgetTag("resident")
+
+	logs := bytes.Repeat([]byte("2024-01-01T00:00:00Z INFO request served in 1ms\n"), 100000)
+	for i, src := range [][]byte{logs, testData[:1024*1024]} {
+		dst := new(bytes.Buffer)
+		n, err := Copy(dst, bytes.NewReader(src), 64*1024, WithResidentCompression(flate.BestSpeed), WithTag("resident"))
+		if n != int64(len(src)) || err != nil {
+			t.Fatalf("test %d: result mismatch: have (%d, %v), want (%d, nil)", i, n, err, len(src))
+		}
+		if !bytes.Equal(dst.Bytes(), src) {
+			t.Fatalf("test %d: data mismatch", i)
+		}
+		// Compressible data should shrink considerably inside the pipe
+		if counts := Tagged("resident"); i == 0 && counts.Written > int64(len(src)/10) {
+			t.Fatalf("test %d: resident data too large: have %d, want at most %d", i, counts.Written, len(src)/10)
+		}
+		ForgetTag("resident")
+	}
+	// Source failures should be reported after delivering the data preceding them
+	errBoom := errors.New("boom")
+
+	dst := new(bytes.Buffer)
+	n, err := Copy(dst, &errDataReader{data: logs[:10000], chunk: 1000, err: errBoom}, 4096, WithResidentCompression(flate.BestSpeed))
+	if n != 10000 || err != errBoom {
+		t.Fatalf("failing source result mismatch: have (%d, %v), want (10000, %v)", n, err, errBoom)
+	}
+	if !bytes.Equal(dst.Bytes(), logs[:10000]) {
+		t.Fatalf("failing source data mismatch")
+	}
+	// Invalid compression levels should fail the copy outright
+	if n, err := Copy(new(bytes.Buffer), bytes.NewReader(logs), 4096, WithResidentCompression(100)); n != 0 || err == nil {
+		t.Fatalf("invalid level result mismatch: have (%d, %v), want (0, error)", n, err)
+	}
+}
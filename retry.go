@@ -0,0 +1,157 @@
+package bufioprop
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// A RetryPolicy configures how a copy recovers from failures of its source, by
+// reconnecting to it and resuming from the position where it broke off. Since the
+// data already transferred stays in the pipe, nothing needs to be re-buffered.
+type RetryPolicy struct {
+	// Reconnect opens a new source resuming the stream at the given offset, i.e.
+	// the number of bytes already read from all the previous sources.
+	Reconnect func(offset int64) (io.Reader, error)
+
+	// IsRetryable classifies source (and reconnection) errors as retryable or
+	// fatal. If nil, all errors are considered retryable.
+	IsRetryable func(err error) bool
+
+	MaxAttempts int           // Consecutive retries without progress before giving up (0 = unlimited)
+	Backoff     time.Duration // Delay before the first retry, doubled for every subsequent one
+	MaxBackoff  time.Duration // Upper limit of the retry delay (0 = unlimited)
+}
+
+// retryable checks whether an error may be recovered from by reconnecting.
+func (r *RetryPolicy) retryable(err error) bool {
+	return r.IsRetryable == nil || r.IsRetryable(err)
+}
+
+// A WriteRetryPolicy configures how a copy rides out transient failures of its
+// destination (e.g. write timeouts on a flaky connection), by retrying the failed
+// write after a backoff instead of aborting the entire copy. The data not yet
+// accepted by the destination stays in the pipe until it is.
+type WriteRetryPolicy struct {
+	// IsRetryable classifies destination errors as transient or fatal. If nil, only
+	// timeouts and temporary errors (as reported by net.Error) are retried.
+	IsRetryable func(err error) bool
+
+	MaxAttempts int           // Consecutive retries without progress before giving up (0 = unlimited)
+	Backoff     time.Duration // Delay before the first retry, doubled for every subsequent one (0 = 1ms)
+	MaxBackoff  time.Duration // Upper limit of the retry delay (0 = unlimited)
+}
+
+// minWriteBackoff is the retry delay of write retry policies not setting one, so
+// that destinations failing permanently aren't hammered in a busy loop.
+const minWriteBackoff = time.Millisecond
+
+// retryable checks whether a destination error may be recovered from by writing
+// again.
+func (r *WriteRetryPolicy) retryable(err error) bool {
+	if r.IsRetryable != nil {
+		return r.IsRetryable(err)
+	}
+	var transient interface {
+		Timeout() bool
+		Temporary() bool
+	}
+	return errors.As(err, &transient) && (transient.Timeout() || transient.Temporary())
+}
+
+// writeBackoff tracks the consecutive retries of a failing destination write.
+type writeBackoff struct {
+	attempts int           // Retries done since the destination last made progress
+	delay    time.Duration // Delay to wait before the next retry
+}
+
+// retryWrite decides whether a failed destination write should be retried, and
+// if so, waits out the backoff. It gives up if the failure is fatal, the retries
+// are exhausted, or the reader is closed meanwhile.
+func (p *pipe) retryWrite(err error, progress bool, b *writeBackoff) bool {
+	policy := p.writeRetry
+	if policy == nil || closed(p.outQuit) || !policy.retryable(err) {
+		return false
+	}
+	if progress || b.attempts == 0 {
+		b.attempts, b.delay = 0, policy.Backoff
+		if b.delay <= 0 {
+			b.delay = minWriteBackoff
+		}
+	}
+	if b.attempts++; policy.MaxAttempts > 0 && b.attempts > policy.MaxAttempts {
+		return false
+	}
+	timer := time.NewTimer(b.delay)
+	select {
+	case <-timer.C:
+	case <-p.outQuit:
+		timer.Stop()
+		return false
+	}
+	if b.delay *= 2; policy.MaxBackoff > 0 && b.delay > policy.MaxBackoff {
+		b.delay = policy.MaxBackoff
+	}
+	p.stats.WriteRetries.Add(1)
+	return true
+}
+
+// readFromRetry keeps fetching data from the reader into the internal buffer as
+// long as the stream is live, reconnecting to the source on retryable failures.
+// Sources replaced due to failures are closed if they implement io.Closer, as
+// is the last reconnected one when done (the original is left to the caller).
+func (p *pipe) readFromRetry(src io.Reader, policy *RetryPolicy) (read int64, err error) {
+	var (
+		r        = src
+		attempts int
+		backoff  = policy.Backoff
+	)
+	defer func() {
+		if r != nil && r != src {
+			closeReader(r)
+		}
+	}()
+	for {
+		nr, err := p.readFrom(r)
+		read += nr
+
+		// Bail out if done, the pipe was torn down, or the failure is fatal
+		if err == nil || closed(p.outQuit) || !policy.retryable(err) {
+			return read, err
+		}
+		if nr > 0 {
+			attempts, backoff = 0, policy.Backoff
+		}
+		if closer, ok := r.(io.Closer); ok {
+			closer.Close()
+		}
+		r = nil
+
+		// Keep reconnecting until a new source is acquired or retries run out
+		for {
+			if attempts++; policy.MaxAttempts > 0 && attempts > policy.MaxAttempts {
+				return read, err
+			}
+			if backoff > 0 {
+				timer := time.NewTimer(backoff)
+				select {
+				case <-timer.C:
+				case <-p.outQuit:
+					timer.Stop()
+					return read, err
+				}
+				if backoff *= 2; policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+					backoff = policy.MaxBackoff
+				}
+			}
+			next, rerr := policy.Reconnect(read)
+			if rerr == nil {
+				r = next
+				break
+			}
+			if err = rerr; !policy.retryable(err) {
+				return read, err
+			}
+		}
+	}
+}
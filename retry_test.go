@@ -0,0 +1,224 @@
+package bufioprop
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+var errFlaky = errors.New("flaky failure")
+
+// flakyReader is a reader failing after a given number of bytes.
+type flakyReader struct {
+	data []byte
+	left int
+}
+
+func (r *flakyReader) Read(b []byte) (int, error) {
+	if r.left == 0 {
+		return 0, errFlaky
+	}
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	if len(b) > r.left {
+		b = b[:r.left]
+	}
+	n := copy(b, r.data)
+	r.data, r.left = r.data[n:], r.left-n
+	return n, nil
+}
+
+// Tests that failing sources are reconnected and resumed where they broke off.
+func TestCopyRetry(t *testing.T) {
+	data := testData[:1024*1024]
+
+	var offsets []int64
+	policy := &RetryPolicy{
+		Reconnect: func(offset int64) (io.Reader, error) {
+			offsets = append(offsets, offset)
+			return &flakyReader{data: data[offset:], left: 100000}, nil
+		},
+		MaxAttempts: 1,
+	}
+	dst := new(bytes.Buffer)
+	if _, err := Copy(dst, &flakyReader{data: data, left: 100000}, 4096, WithRetry(policy)); err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+	if !bytes.Equal(dst.Bytes(), data) {
+		t.Fatalf("data mismatch")
+	}
+	if len(offsets) != 10 {
+		t.Fatalf("reconnect count mismatch: have %d, want %d", len(offsets), 10)
+	}
+	for i, offset := range offsets {
+		if offset != int64(i+1)*100000 {
+			t.Fatalf("reconnect %d: offset mismatch: have %d, want %d", i, offset, (i+1)*100000)
+		}
+	}
+}
+
+// Tests that fatal errors and exhausted attempts abort the copy.
+func TestCopyRetryFail(t *testing.T) {
+	data := testData[:1024*1024]
+
+	// Ensure non retryable errors are not retried
+	policy := &RetryPolicy{
+		Reconnect: func(offset int64) (io.Reader, error) {
+			t.Fatalf("reconnected on fatal error")
+			return nil, nil
+		},
+		IsRetryable: func(err error) bool { return err != errFlaky },
+	}
+	if _, err := Copy(new(bytes.Buffer), &flakyReader{data: data, left: 1000}, 4096, WithRetry(policy)); err != errFlaky {
+		t.Fatalf("error mismatch: have %v, want %v", err, errFlaky)
+	}
+	// Ensure sources not making progress are given up on
+	var attempts int
+	policy = &RetryPolicy{
+		Reconnect: func(offset int64) (io.Reader, error) {
+			attempts++
+			return &flakyReader{data: data[offset:]}, nil
+		},
+		MaxAttempts: 3,
+	}
+	n, err := Copy(new(bytes.Buffer), &flakyReader{data: data, left: 1000}, 4096, WithRetry(policy))
+	if err != errFlaky {
+		t.Fatalf("error mismatch: have %v, want %v", err, errFlaky)
+	}
+	if n != 1000 || attempts != 3 {
+		t.Fatalf("progress mismatch: have %d bytes in %d attempts, want %d in %d", n, attempts, 1000, 3)
+	}
+}
+
+// closeCounter is a source counting how many times it was closed.
+type closeCounter struct {
+	io.Reader
+	closes *int
+}
+
+func (c *closeCounter) Close() error {
+	*c.closes++
+	return nil
+}
+
+// Tests that every reconnected source is closed exactly once, including the last
+// one, whether the copy succeeds or fails for good.
+func TestCopyRetryCloses(t *testing.T) {
+	data := testData[:1024*1024]
+
+	for _, fail := range []bool{false, true} {
+		var (
+			closes  []*int
+			sources int
+		)
+		policy := &RetryPolicy{
+			Reconnect: func(offset int64) (io.Reader, error) {
+				left := 100000
+				if fail && sources == 2 {
+					left = 0 // last source never progresses
+				}
+				closes = append(closes, new(int))
+				sources++
+				return &closeCounter{Reader: &flakyReader{data: data[offset:], left: left}, closes: closes[len(closes)-1]}, nil
+			},
+			MaxAttempts: 1,
+		}
+		_, err := Copy(new(bytes.Buffer), &flakyReader{data: data, left: 100000}, 4096, WithRetry(policy))
+		if fail != (err != nil) {
+			t.Fatalf("fail %v: error mismatch: have %v", fail, err)
+		}
+		for i, n := range closes {
+			if *n != 1 {
+				t.Fatalf("fail %v: source %d closed %d times, want once", fail, i, *n)
+			}
+		}
+	}
+}
+
+// timeoutWriter is a buffer accepting only part of every few writes, timing out
+// on the rest.
+type timeoutWriter struct {
+	bytes.Buffer
+	every int // Number of writes between timeouts (0 = always time out, accepting nothing)
+	count int // Number of writes seen so far
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	if w.count++; w.every == 0 {
+		return 0, os.ErrDeadlineExceeded
+	}
+	if w.count%w.every == 0 {
+		n, _ := w.Buffer.Write(b[:len(b)/2])
+		return n, os.ErrDeadlineExceeded
+	}
+	return w.Buffer.Write(b)
+}
+
+// Tests that destinations timing out are retried until they accept all the data,
+// and that retries are given up on once exhausted or for fatal failures.
+func TestCopyWriteRetry(t *testing.T) {
+	data := testData[:1024*1024]
+
+	// Destination blipping every few writes, retries should smooth it out
+	var (
+		stats  Stats
+		policy = &WriteRetryPolicy{MaxAttempts: 1, Backoff: time.Microsecond}
+	)
+	for _, size := range []int{100, len(data)} {
+		dst := &timeoutWriter{every: 3}
+		if _, err := Copy(dst, bytes.NewReader(data[:size]), 4096, WithWriteRetry(policy), WithStats(&stats)); err != nil {
+			t.Fatalf("size %d: failed to copy: %v", size, err)
+		}
+		if !bytes.Equal(dst.Bytes(), data[:size]) {
+			t.Fatalf("size %d: data mismatch", size)
+		}
+	}
+	if stats.WriteRetries.Load() == 0 {
+		t.Fatalf("no write retries recorded")
+	}
+	// Destination never recovering, retries should run out
+	dst := &timeoutWriter{}
+	if _, err := Copy(dst, bytes.NewReader(data), 4096, WithWriteRetry(&WriteRetryPolicy{MaxAttempts: 3})); err != os.ErrDeadlineExceeded {
+		t.Fatalf("exhausted retries error mismatch: have %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	if dst.count != 1+3 {
+		t.Fatalf("write count mismatch: have %d, want %d", dst.count, 1+3)
+	}
+	// Destination failing fatally, nothing should be retried
+	policy = &WriteRetryPolicy{IsRetryable: func(err error) bool { return false }}
+	if _, err := Copy(&failingWriter{limit: 1000, err: errFlaky}, bytes.NewReader(data), 4096, WithWriteRetry(policy)); err != errFlaky {
+		t.Fatalf("fatal failure mismatch: have %v, want %v", err, errFlaky)
+	}
+}
+
+// Tests that copies retrying writes with a zero policy still observe cancellation,
+// instead of retrying a permanently failing destination forever.
+func TestCopyWriteRetryCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var (
+		stats Stats
+		done  = make(chan error, 1)
+	)
+	go func() {
+		_, err := CopyContext(ctx, &timeoutWriter{}, bytes.NewReader(testData[:1024*1024]), 4096, WithWriteRetry(&WriteRetryPolicy{}), WithStats(&stats))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("canceled copy still retrying")
+	}
+	if retries := stats.WriteRetries.Load(); retries > 100 {
+		t.Fatalf("retries not backed off: %d within the timeout", retries)
+	}
+}
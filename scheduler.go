@@ -0,0 +1,117 @@
+package bufioprop
+
+import (
+	"sync"
+	"time"
+)
+
+// schedulerBurst is the amount of time worth of bandwidth a copy may accumulate
+// while idle, and then consume in a single burst.
+const schedulerBurst = 100 * time.Millisecond
+
+// A Scheduler shares a total bandwidth among multiple concurrent pipes (or
+// copies), proportionally to their weights. The shares are recalculated every
+// time a pipe joins or leaves, so that at any moment the active pipes split the
+// bandwidth among themselves.
+//
+// Throttling is applied on the producer side, so a pipe over its share stops
+// reading from its source instead of buffering data it can't yet pass on. The
+// memory consumed by the buffers is not accounted for by the scheduler.
+type Scheduler struct {
+	bandwidth float64 // Total bandwidth to share, in bytes per second
+
+	weights int        // Sum of the weights of the active pipes
+	lock    sync.Mutex // Lock protecting the weight sum
+}
+
+// NewScheduler creates a scheduler sharing the given total bandwidth, measured
+// in bytes per second. A bandwidth of 0 (or less) leaves the pipes unlimited.
+func NewScheduler(bandwidth int64) *Scheduler {
+	return &Scheduler{bandwidth: float64(bandwidth)}
+}
+
+// join registers a new pipe with the given weight, returning its share.
+func (s *Scheduler) join(weight int) *share {
+	if weight < 1 {
+		weight = 1
+	}
+	s.lock.Lock()
+	s.weights += weight
+	s.lock.Unlock()
+
+	return &share{
+		sched:  s,
+		weight: weight,
+		last:   time.Now(),
+	}
+}
+
+// rate calculates the current bandwidth of a share with the given weight.
+func (s *Scheduler) rate(weight int) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.weights == 0 {
+		return s.bandwidth
+	}
+	return s.bandwidth * float64(weight) / float64(s.weights)
+}
+
+// A share is a single pipe's slice of a scheduler's bandwidth, tracked with a
+// token bucket which may go into debt, blocking the producer until repaid.
+type share struct {
+	sched  *Scheduler
+	weight int
+
+	tokens float64   // Bytes available (or owed, if negative) for transfer
+	last   time.Time // Time of the last token refill
+	left   bool      // Whether the share already left the scheduler
+	lock   sync.Mutex
+}
+
+// throttle accounts for the transfer of count bytes, blocking until the share's
+// bandwidth makes up for them, or either of the quit channels is closed.
+func (s *share) throttle(count int, inQuit, outQuit <-chan struct{}) {
+	rate := s.sched.rate(s.weight)
+	if rate <= 0 {
+		return // unlimited
+	}
+
+	s.lock.Lock()
+	now := time.Now()
+	s.tokens += now.Sub(s.last).Seconds() * rate
+	if burst := rate * schedulerBurst.Seconds(); s.tokens > burst {
+		s.tokens = burst
+	}
+	s.last = now
+	s.tokens -= float64(count)
+	debt := -s.tokens
+	s.lock.Unlock()
+
+	if debt > 0 {
+		timer := time.NewTimer(time.Duration(debt / rate * float64(time.Second)))
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-inQuit:
+		case <-outQuit:
+		}
+	}
+}
+
+// leave unregisters the share from the scheduler, releasing its bandwidth to the
+// other pipes. It's safe to call multiple times.
+func (s *share) leave() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.left {
+		return
+	}
+	s.left = true
+
+	s.sched.lock.Lock()
+	s.sched.weights -= s.weight
+	s.sched.lock.Unlock()
+}
@@ -0,0 +1,69 @@
+package bufioprop
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// Tests that the bandwidth is split among the active pipes by weight.
+func TestSchedulerShares(t *testing.T) {
+	sched := NewScheduler(1000)
+
+	a := sched.join(1)
+	b := sched.join(3)
+	if rate := sched.rate(a.weight); rate != 250 {
+		t.Errorf("light share mismatch: have %v, want %v", rate, 250)
+	}
+	if rate := sched.rate(b.weight); rate != 750 {
+		t.Errorf("heavy share mismatch: have %v, want %v", rate, 750)
+	}
+	b.leave()
+	b.leave()
+	if rate := sched.rate(a.weight); rate != 1000 {
+		t.Errorf("lone share mismatch: have %v, want %v", rate, 1000)
+	}
+}
+
+// Tests that a scheduled copy is throttled to the configured bandwidth.
+func TestCopyScheduled(t *testing.T) {
+	sched := NewScheduler(8 * 1024 * 1024)
+	data := testData[:2*1024*1024]
+
+	start := time.Now()
+	if _, err := Copy(ioutil.Discard, bytes.NewReader(data), 4096, WithScheduler(sched, 1)); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("copy not throttled: took %v, want at least %v", elapsed, 200*time.Millisecond)
+	}
+	if sched.weights != 0 {
+		t.Errorf("copy didn't leave the scheduler: weights %d", sched.weights)
+	}
+}
+
+// Tests that a throttled copy can be canceled while paying off its debt, and that
+// a scheduler without bandwidth doesn't throttle at all.
+func TestCopyScheduledCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := CopyContext(ctx, ioutil.Discard, bytes.NewReader(testData[:1024*1024]), 1024*1024, WithScheduler(NewScheduler(64*1024), 1))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("canceled copy kept throttling: took %v", elapsed)
+	}
+	// Schedulers without bandwidth should leave copies unlimited
+	start = time.Now()
+	if _, err := Copy(ioutil.Discard, bytes.NewReader(testData[:1024*1024]), 4096, WithScheduler(NewScheduler(0), 1)); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("unlimited copy throttled: took %v", elapsed)
+	}
+}
@@ -0,0 +1,98 @@
+package bufioprop
+
+import (
+	"errors"
+	"hash"
+	"io"
+)
+
+// ErrInvalidSegment is returned by CopySegments if the requested segment size is
+// not positive.
+var ErrInvalidSegment = errors.New("bufio: invalid segment size")
+
+// CopySegments copies from src to dst until either EOF is reached on src or an
+// error occurs, invoking fn each time another segmentSize bytes were written into
+// dst, with the index of the segment. A final, shorter segment is reported too if
+// the stream doesn't end on a segment boundary. It returns the number of bytes
+// written into dst and the first error encountered, including any returned by fn,
+// which aborts the copy.
+//
+// If a hash was set via WithSegmentHash, sum is the digest of the segment's data,
+// valid only until fn returns; otherwise it's nil. Segments give chunked upload
+// and verification protocols their commit points, without having to split the
+// stream themselves.
+//
+// The callback runs on the consumer goroutine of the copy, so the source keeps
+// being read concurrently while the segments are committed.
+func CopySegments(dst io.Writer, src io.Reader, buffer int, segmentSize int, fn func(index int, sum []byte) error, opts ...Option) (written int64, err error) {
+	if segmentSize <= 0 {
+		return 0, ErrInvalidSegment
+	}
+	c := newConfig(opts)
+	return copyPipe(dst, src, buffer, c, func(pr *PipeReader) (int64, error) {
+		var h hash.Hash
+		if c.segmentHash != nil {
+			h = c.segmentHash()
+		}
+		return pr.p.segmentsTo(dst, int64(segmentSize), h, fn)
+	})
+}
+
+// SegmentsTo keeps writing the buffered data into the writer, stopping at every
+// segment boundary to notify the callback, until the source is closed or fails.
+func (p *pipe) segmentsTo(w io.Writer, size int64, h hash.Hash, fn func(index int, sum []byte) error) (written int64, err error) {
+	p.flushInto(w)
+
+	var (
+		index int    // Index of the segment being written
+		left  = size // Number of bytes still missing from the current segment
+		sum   []byte // Scratch space to assemble the segment digests in
+	)
+	commit := func() error {
+		if h == nil {
+			return fn(index, nil)
+		}
+		sum = h.Sum(sum[:0])
+		h.Reset()
+		return fn(index, sum)
+	}
+	for {
+		// Wait until some (more) data becomes available
+		safeFree, err := p.outputWait()
+		if err != nil {
+			if err == io.EOF {
+				if err = nil; left < size {
+					err = commit()
+				}
+			}
+			return written, err
+		}
+		// Write out either till the writer position, the end or the segment boundary
+		limit := p.outPos + p.size - safeFree
+		if limit > p.size {
+			limit = p.size
+		}
+		if int64(limit-p.outPos) > left {
+			limit = p.outPos + int32(left)
+		}
+		chunk := p.buffer[p.outPos:limit]
+
+		nw, err := p.writeOut(w, chunk)
+		if h != nil {
+			h.Write(chunk[:nw])
+		}
+		written, left = written+int64(nw), left-int64(nw)
+		p.outputAdvance(nw)
+
+		if err != nil {
+			return written, err
+		}
+		// If the segment was completed, commit it before moving on
+		if left == 0 {
+			if err := commit(); err != nil {
+				return written, err
+			}
+			index, left = index+1, size
+		}
+	}
+}
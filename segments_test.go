@@ -0,0 +1,73 @@
+package bufioprop
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+// Tests that segmented copies commit every segment after its data was written,
+// with the correct digests, including a final partial one.
+func TestCopySegments(t *testing.T) {
+	for _, length := range []int{0, 1000, 4096, 3 * 4096, 100000} {
+		for _, hashed := range []bool{false, true} {
+			var (
+				dst     = new(bytes.Buffer)
+				indexes []int
+			)
+			fn := func(index int, sum []byte) error {
+				end := (index + 1) * 4096
+				if end > length {
+					end = length
+				}
+				if dst.Len() != end {
+					t.Errorf("len %d, hashed %v: segment %d committed at %d bytes, want %d", length, hashed, index, dst.Len(), end)
+				}
+				var want []byte
+				if hashed {
+					digest := sha256.Sum256(testData[index*4096 : end])
+					want = digest[:]
+				}
+				if !bytes.Equal(sum, want) {
+					t.Errorf("len %d, hashed %v: segment %d sum mismatch: have %x, want %x", length, hashed, index, sum, want)
+				}
+				indexes = append(indexes, index)
+				return nil
+			}
+			var opts []Option
+			if hashed {
+				opts = append(opts, WithSegmentHash(sha256.New))
+			}
+			n, err := CopySegments(dst, bytes.NewReader(testData[:length]), 1024, 4096, fn, opts...)
+			if n != int64(length) || err != nil {
+				t.Fatalf("len %d, hashed %v: result mismatch: have (%d, %v), want (%d, nil)", length, hashed, n, err, length)
+			}
+			if !bytes.Equal(dst.Bytes(), testData[:length]) {
+				t.Fatalf("len %d, hashed %v: data mismatch", length, hashed)
+			}
+			if want := (length + 4095) / 4096; len(indexes) != want {
+				t.Fatalf("len %d, hashed %v: segment count mismatch: have %d, want %d", length, hashed, len(indexes), want)
+			}
+		}
+	}
+}
+
+// Tests that a failing segment callback aborts the copy, and that invalid segment
+// sizes are rejected.
+func TestCopySegmentsFailure(t *testing.T) {
+	errBoom := errors.New("boom")
+	fn := func(index int, sum []byte) error {
+		if index == 2 {
+			return errBoom
+		}
+		return nil
+	}
+	n, err := CopySegments(new(bytes.Buffer), &chunkReader{chunk: 1000, left: 100000}, 1024, 4096, fn)
+	if n != 3*4096 || err != errBoom {
+		t.Fatalf("result mismatch: have (%d, %v), want (%d, %v)", n, err, 3*4096, errBoom)
+	}
+	if _, err := CopySegments(new(bytes.Buffer), bytes.NewReader(testData), 1024, 0, fn); err != ErrInvalidSegment {
+		t.Fatalf("invalid segment error mismatch: have %v, want %v", err, ErrInvalidSegment)
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,25 +38,88 @@ func benchmarkLatency(iters int, copier contender) {
 	fmt.Printf("%20s: %7v %7d allocs %9d B.\n", copier.Name, m.Duration/time.Duration(iters), m.Allocs, m.Bytes)
 }
 
+// BenchmarkLoadedLatency measures the amount of time it takes for one single byte
+// to propagate through the copy, while concurrent high throughput copies (one for
+// every available thread) saturate the machine. It shows how the spin and sleep
+// strategies of the implementations behave when competing for the processors.
+// The sorted latencies of the individual bytes are returned.
+func benchmarkLoadedLatency(iters int, count int64, data []byte, copier contender) []time.Duration {
+	ir, iw := io.Pipe()
+	or, ow := io.Pipe()
+
+	// Start the copy and push a few values through to initialize internals
+	go copier.Copy(ow, ir, 1024)
+
+	input, output := []byte{0xff}, make([]byte, 1)
+	for i := 0; i < iters/10; i++ {
+		iw.Write(input)
+		or.Read(output)
+	}
+	// Saturate the machine with throughput copies of the same implementation
+	var (
+		stop   int32
+		moved  int64
+		loaded sync.WaitGroup
+	)
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		loaded.Add(1)
+		go func() {
+			defer loaded.Done()
+			for atomic.LoadInt32(&stop) == 0 {
+				n, _ := copier.Copy(ioutil.Discard, dataReader(count, data), 64*1024)
+				atomic.AddInt64(&moved, n)
+			}
+		}()
+	}
+	// Time every single byte, the tail being more telling than the mean
+	start, latencies := time.Now(), make([]time.Duration, iters)
+	for i := 0; i < iters; i++ {
+		sent := time.Now()
+		iw.Write(input)
+		or.Read(output)
+		latencies[i] = time.Since(sent)
+	}
+	elapsed := time.Since(start)
+
+	atomic.StoreInt32(&stop, 1)
+	loaded.Wait()
+	ow.Close()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	fmt.Printf("%20s: %7v mean %7v p50 %7v p99 %9.2f mbps load.\n", copier.Name, elapsed/time.Duration(iters),
+		latencies[iters/2], latencies[iters*99/100], float64(atomic.LoadInt64(&moved))/(1024*1024)/elapsed.Seconds())
+
+	return latencies
+}
+
 // BenchmarkThroughput runs a high throughput copy to see how implementations compete if
 // not rate limited.
-func benchmarkThroughput(count int64, data []byte, buffers []int, copier contender) (results []Measurement) {
-	// Simulate the benchmark for every buffer size, keep the best out of three
+func benchmarkThroughput(count int64, data []byte, buffers []int, copier contender) (results []Sample) {
+	// Simulate the benchmark for every buffer size, keeping all runs for the stats
 	for _, buffer := range buffers {
-		var best Measurement
+		sample := make(Sample, 0, *runsFlag)
 
-		for i := 0; i < 3; i++ {
+		for i := 0; i < *runsFlag; i++ {
 			source := dataReader(count, data)
 
 			c := NewCheckpoint()
 			copier.Copy(ioutil.Discard, source, buffer)
-			m := c.Measure()
-
-			if i == 0 || m.Duration < best.Duration {
-				best = m
-			}
+			sample = append(sample, c.Measure())
 		}
-		results = append(results, best)
+		results = append(results, sample)
+	}
+	return results
+}
+
+// BenchmarkScaling runs the same high throughput copy under each of the given
+// GOMAXPROCS settings, to see how the synchronization of the implementations
+// copes with more (or fewer) threads competing for the shared state.
+func benchmarkScaling(count int64, data []byte, procs []int, buffer int, copier contender) (results []Sample) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+
+	for _, proc := range procs {
+		runtime.GOMAXPROCS(proc)
+		results = append(results, benchmarkThroughput(count, data, []int{buffer}, copier)[0])
 	}
 	return results
 }
@@ -9,6 +9,7 @@ type Measurement struct {
 	Duration time.Duration
 	Allocs   uint64
 	Bytes    uint64
+	Switches int64 // Context switches of the process (-1 = unknown)
 }
 
 func (m *Measurement) Throughput(size int64) float64 {
@@ -16,13 +17,15 @@ func (m *Measurement) Throughput(size int64) float64 {
 }
 
 type Checkpoint struct {
-	Time  time.Time
-	Stats runtime.MemStats
-	temp  runtime.MemStats
+	Time     time.Time
+	Stats    runtime.MemStats
+	Switches int64
+	temp     runtime.MemStats
 }
 
 func (c *Checkpoint) update() {
 	runtime.ReadMemStats(&c.Stats)
+	c.Switches = contextSwitches()
 	c.Time = time.Now()
 }
 
@@ -31,15 +34,20 @@ func (c *Checkpoint) ResetTime() {
 }
 
 func (c *Checkpoint) Measure() Measurement {
-	runtime.GC() // clean up after yourself
+	switches := contextSwitches() // before the cleanup, only the copy's matter
+	runtime.GC()                  // clean up after yourself
 
 	duration := time.Since(c.Time)
 	runtime.ReadMemStats(&c.temp)
 
+	if switches >= 0 {
+		switches -= c.Switches
+	}
 	return Measurement{
 		Duration: duration,
 		Allocs:   c.temp.Mallocs - c.Stats.Mallocs,
 		Bytes:    c.temp.TotalAlloc - c.Stats.TotalAlloc,
+		Switches: switches,
 	}
 }
 
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// chartColors is the palette the series of a chart are drawn with, in order.
+var chartColors = []string{
+	"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd",
+	"#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf",
+}
+
+// series is a named line of a chart, with one value for every label of it.
+type series struct {
+	Name   string
+	Values []float64
+}
+
+// chart is a line chart of multiple series over a shared set of labeled points,
+// evenly spaced along the horizontal axis.
+type chart struct {
+	Title  string
+	XLabel string
+	YLabel string
+	Labels []string
+	Series []series
+	LogY   bool // Whether to plot the values on a logarithmic scale
+}
+
+// report collects the charts of a shootout run to render them into a single,
+// self-contained HTML page for sharing (no scripts, no external resources).
+type report struct {
+	Platform string
+	Started  time.Time
+	Charts   []chart
+}
+
+// add appends a chart to the report.
+func (r *report) add(c chart) {
+	r.Charts = append(r.Charts, c)
+}
+
+// write renders the report into an HTML file at path.
+func (r *report) write(path string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := reportTemplate.Execute(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"svg": func(c chart) template.HTML { return c.svg() },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>bufio.Copy shootout</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #333; }
+svg { display: block; margin: 1em 0 3em 0; }
+</style>
+</head>
+<body>
+<h1>bufio.Copy shootout</h1>
+<p>Platform: {{.Platform}}, run at {{.Started.Format "2006-01-02 15:04:05 MST"}}.</p>
+{{range .Charts}}<h2>{{.Title}}</h2>
+{{svg .}}
+{{end}}</body>
+</html>
+`))
+
+// svg renders the chart as an inline SVG image.
+func (c chart) svg() template.HTML {
+	const (
+		width, height = 960, 420
+		left, right   = 80, 260 // Room for the value ticks and the legend
+		top, bottom   = 20, 50  // Room for the label ticks and the axis title
+		ticks         = 5
+	)
+	plotW, plotH := float64(width-left-right), float64(height-top-bottom)
+
+	// Find the value range to plot, in log space if requested
+	scale := func(v float64) float64 { return v }
+	if c.LogY {
+		scale = func(v float64) float64 { return math.Log10(math.Max(v, 1e-9)) }
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range c.Series {
+		for _, v := range s.Values {
+			lo, hi = math.Min(lo, scale(v)), math.Max(hi, scale(v))
+		}
+	}
+	if c.LogY {
+		lo, hi = math.Floor(lo), math.Ceil(hi)
+	} else {
+		lo, hi = 0, hi*1.1
+	}
+	if math.IsInf(lo, 0) || hi <= lo {
+		lo, hi = 0, 1
+	}
+	x := func(i int) float64 {
+		if len(c.Labels) < 2 {
+			return left + plotW/2
+		}
+		return left + plotW*float64(i)/float64(len(c.Labels)-1)
+	}
+	y := func(v float64) float64 { return top + plotH*(1-(scale(v)-lo)/(hi-lo)) }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-size="12">`, width, height)
+
+	// Draw the value grid and ticks, one per decade on logarithmic scales
+	var (
+		grid   []float64
+		format = "%.4g"
+	)
+	if c.LogY {
+		format = "%g"
+		for v := lo; v <= hi; v++ {
+			grid = append(grid, math.Pow(10, v))
+		}
+	} else {
+		for i := 0; i <= ticks; i++ {
+			grid = append(grid, lo+(hi-lo)*float64(i)/ticks)
+		}
+	}
+	for _, v := range grid {
+		fmt.Fprintf(&b, `<line x1="%d" x2="%d" y1="%.1f" y2="%.1f" stroke="#ddd"/>`, left, width-right, y(v), y(v))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">`+format+`</text>`, left-6, y(v), v)
+	}
+	for i, label := range c.Labels {
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, x(i), height-bottom+18, template.HTMLEscapeString(label))
+	}
+	fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, left+plotW/2, height-8, template.HTMLEscapeString(c.XLabel))
+	fmt.Fprintf(&b, `<text transform="translate(16,%.1f) rotate(-90)" text-anchor="middle">%s</text>`, top+plotH/2, template.HTMLEscapeString(c.YLabel))
+	fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.0f" height="%.0f" fill="none" stroke="#999"/>`, left, top, plotW, plotH)
+
+	// Draw the series themselves, along with their legend
+	for i, s := range c.Series {
+		color := chartColors[i%len(chartColors)]
+
+		points := make([]string, len(s.Values))
+		for j, v := range s.Values {
+			points[j] = fmt.Sprintf("%.1f,%.1f", x(j), y(v))
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`, strings.Join(points, " "), color)
+		for j, v := range s.Values {
+			fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"><title>%s: %.4g</title></circle>`, x(j), y(v), color, template.HTMLEscapeString(s.Name), v)
+		}
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="12" height="12" fill="%s"/>`, width-right+16, top+i*20, color)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" dominant-baseline="middle">%s</text>`, width-right+34, top+i*20+6, template.HTMLEscapeString(s.Name))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
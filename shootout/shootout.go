@@ -1,14 +1,17 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/karalabe/bufioprop"
+	"github.com/karalabe/bufioprop/iotest"
 	"github.com/karalabe/bufioprop/shootout/augustoroman"
 	"github.com/karalabe/bufioprop/shootout/bakulshah"
 	"github.com/karalabe/bufioprop/shootout/egonelbre"
@@ -34,7 +37,21 @@ var contenders = []contender{
 		return io.Copy(dst, src)
 	}, ""},
 	// Second contender is the proposed bufio.Copy (currently at bufioprop.Copy)
-	{"[!] bufio.Copy", bufioprop.Copy, ""},
+	{"[!] bufio.Copy", func(dst io.Writer, src io.Reader, buffer int) (int64, error) {
+		return bufioprop.Copy(dst, src, buffer)
+	}, ""},
+	{"[!] bufio.Copy (level)", func(dst io.Writer, src io.Reader, buffer int) (int64, error) {
+		return bufioprop.Copy(dst, src, buffer, bufioprop.WithWakeStrategy(bufioprop.WakeLevel))
+	}, ""},
+	{"[!] bufio.Copy (double)", func(dst io.Writer, src io.Reader, buffer int) (int64, error) {
+		return bufioprop.Copy(dst, src, buffer, bufioprop.WithDoubleBuffer())
+	}, ""},
+	{"[!] bufio.Copy (chunked)", func(dst io.Writer, src io.Reader, buffer int) (int64, error) {
+		return bufioprop.Copy(dst, src, buffer, bufioprop.WithChunkPool(32*1024))
+	}, ""},
+	{"[!] bufio.Copy (pinned)", func(dst io.Writer, src io.Reader, buffer int) (int64, error) {
+		return bufioprop.Copy(dst, src, buffer, bufioprop.WithAffinity(0, runtime.NumCPU()-1))
+	}, ""},
 
 	// Other contenders written by mailing list contributions
 	{"rogerpeppe.Copy", rogerpeppe.Copy, ""},
@@ -48,10 +65,26 @@ var contenders = []contender{
 	{"augustoroman.Copy", augustoroman.Copy, ""},
 }
 
+var (
+	soakFlag = flag.Duration("soak", 0, "Run continuous copies for this long per contender to detect leaks (0 = shootout)")
+	runsFlag = flag.Int("runs", 5, "Number of runs of every throughput benchmark to derive the statistics from")
+	htmlFlag = flag.String("html", "", "Write a self-contained HTML report with charts into this file (empty = none)")
+)
+
 func main() {
+	flag.Parse()
+
 	// Run on multiple threads to catch race bugs
 	runtime.GOMAXPROCS(8)
 
+	// Report the platform, 32 bit runs can be done via GOARCH=386 go run .
+	fmt.Printf("Platform: %s/%s\n\n", runtime.GOOS, runtime.GOARCH)
+
+	html := &report{
+		Platform: fmt.Sprintf("%s/%s, %d CPUs", runtime.GOOS, runtime.GOARCH, runtime.NumCPU()),
+		Started:  time.Now(),
+	}
+
 	// Collect the shot out implementations
 	failed := make(map[string]struct{})
 
@@ -62,8 +95,20 @@ func main() {
 			failed[copier.Name] = struct{}{}
 		}
 	}
-	fmt.Println("------------------------------------------------\n")
+	fmt.Print("------------------------------------------------\n\n")
+
+	// If a soak test was requested, run it instead of the short shootout
+	if *soakFlag > 0 {
+		fmt.Println("Soak tests:")
 
+		data := random(1024 * 1024)
+		for _, copier := range contenders {
+			if _, ok := failed[copier.Name]; !ok {
+				soak(*soakFlag, data, copier)
+			}
+		}
+		return
+	}
 	// Run a batch of tests to make sure the function works
 	fmt.Println("High throughput tests:")
 
@@ -76,7 +121,19 @@ func main() {
 			}
 		}
 	}
-	fmt.Println("------------------------------------------------\n")
+	fmt.Print("------------------------------------------------\n\n")
+
+	// Check that source failures are reported consistently with io.Copy
+	fmt.Println("Error propagation tests:")
+
+	for _, copier := range contenders {
+		if _, ok := failed[copier.Name]; !ok {
+			if !testErrors(data, copier) {
+				failed[copier.Name] = struct{}{}
+			}
+		}
+	}
+	fmt.Print("------------------------------------------------\n\n")
 
 	// Simulate copying between various types of readers and writers
 	count = 32 * 1024 * 1024
@@ -126,6 +183,32 @@ func main() {
 		}
 	}
 
+	for _, proc := range procs {
+		runtime.GOMAXPROCS(proc)
+
+		fmt.Printf("\nLatency under load benchmarks (GOMAXPROCS = %d):\n", runtime.GOMAXPROCS(0))
+
+		percentiles := chart{
+			Title:  fmt.Sprintf("Latency under load (GOMAXPROCS = %d)", proc),
+			XLabel: "Percentile",
+			YLabel: "Latency (µs)",
+			Labels: []string{"p50", "p90", "p99", "p99.9", "max"},
+			LogY:   true,
+		}
+		for _, copier := range contenders {
+			if _, ok := failed[copier.Name]; !ok {
+				latencies := benchmarkLoadedLatency(100000, 64*1024*1024, data, copier)
+
+				line := series{Name: copier.Name}
+				for _, idx := range []int{len(latencies) / 2, len(latencies) * 9 / 10, len(latencies) * 99 / 100, len(latencies) * 999 / 1000, len(latencies) - 1} {
+					line.Values = append(line.Values, float64(latencies[idx])/float64(time.Microsecond))
+				}
+				percentiles.Series = append(percentiles.Series, line)
+			}
+		}
+		html.add(percentiles)
+	}
+
 	for _, proc := range procs {
 		runtime.GOMAXPROCS(proc)
 
@@ -133,7 +216,7 @@ func main() {
 
 		type Result struct {
 			Name    string
-			Results []Measurement
+			Results []Sample
 		}
 
 		results := make([]Result, 0, len(contenders))
@@ -144,7 +227,7 @@ func main() {
 			}
 		}
 
-		type formatter func(m Measurement) string
+		type formatter func(s Sample) string
 		table := func(title string, format formatter) {
 			table := tablewriter.NewWriter(os.Stdout)
 			header := []string{title}
@@ -162,15 +245,119 @@ func main() {
 			table.Render()
 		}
 
+		throughput := chart{
+			Title:  fmt.Sprintf("Throughput by buffer size (GOMAXPROCS = %d)", proc),
+			XLabel: "Buffer size (bytes)",
+			YLabel: "Throughput (MB/s)",
+		}
+		for _, buf := range buffers {
+			throughput.Labels = append(throughput.Labels, strconv.Itoa(buf))
+		}
+		for _, r := range results {
+			line := series{Name: r.Name}
+			for _, res := range r.Results {
+				mean, _ := meanStddev(res.Throughputs(count))
+				line.Values = append(line.Values, mean)
+			}
+			throughput.Series = append(throughput.Series, line)
+		}
+		html.add(throughput)
+
 		fmt.Println()
-		table("Throughput", func(m Measurement) string {
-			return fmt.Sprintf("%5.2f", m.Throughput(count))
+		table("Throughput (mean ± stddev)", func(s Sample) string {
+			mean, stddev := meanStddev(s.Throughputs(count))
+			return fmt.Sprintf("%8.2f ± %6.2f", mean, stddev)
 		})
 		fmt.Println()
 
-		table("Allocs/Bytes", func(m Measurement) string {
+		table("Allocs/Bytes", func(s Sample) string {
+			m := s.Best()
 			return fmt.Sprintf("(%8d / %8d)", m.Allocs, m.Bytes)
 		})
+		fmt.Println()
+
+		// Rank the contenders, marking which neighbours are statistically apart
+		fmt.Printf("Ranking ('>' significant at 95%%, '~' within noise, %d runs):\n", *runsFlag)
+		for i, buffer := range buffers {
+			ranked := make([]Result, len(results))
+			copy(ranked, results)
+
+			mean := func(r Result) float64 {
+				mean, _ := meanStddev(r.Results[i].Throughputs(count))
+				return mean
+			}
+			sort.SliceStable(ranked, func(a, b int) bool { return mean(ranked[a]) > mean(ranked[b]) })
+
+			line := fmt.Sprintf("%10d: %s", buffer, ranked[0].Name)
+			for j := 1; j < len(ranked); j++ {
+				sep := "~"
+				if significant(ranked[j-1].Results[i].Throughputs(count), ranked[j].Results[i].Throughputs(count)) {
+					sep = ">"
+				}
+				line += fmt.Sprintf(" %s %s", sep, ranked[j].Name)
+			}
+			fmt.Println(line)
+		}
+	}
+
+	// Sweep the thread counts, the scaling distinguishing the designs more than the peaks
+	sweep := []int{1, 2, 4, 8, 16}
+	buffer := 64 * 1024
+
+	fmt.Printf("\nScaling (%d CPUs, %d KB buffer) (%d MB):\n\n", runtime.NumCPU(), buffer/1024, count/1024/1024)
+
+	throughput := tablewriter.NewWriter(os.Stdout)
+	switches := tablewriter.NewWriter(os.Stdout)
+
+	scaling := chart{
+		Title:  fmt.Sprintf("Throughput scaling (%d KB buffer)", buffer/1024),
+		XLabel: "GOMAXPROCS",
+		YLabel: "Throughput (MB/s)",
+	}
+
+	var columns []string
+	for _, proc := range sweep {
+		columns = append(columns, strconv.Itoa(proc))
+	}
+	scaling.Labels = columns
+	throughput.SetHeader(append([]string{"Throughput (scaling)"}, columns...))
+	switches.SetHeader(append([]string{"Context switches"}, columns...))
+
+	for _, copier := range contenders {
+		if _, ok := failed[copier.Name]; !ok {
+			results := benchmarkScaling(count, data, sweep, buffer, copier)
+
+			speeds, counts := []string{copier.Name}, []string{copier.Name}
+			line := series{Name: copier.Name}
+
+			base, _ := meanStddev(results[0].Throughputs(count))
+			for _, res := range results {
+				mean, _ := meanStddev(res.Throughputs(count))
+				line.Values = append(line.Values, mean)
+				speeds = append(speeds, fmt.Sprintf("%8.2f (%4.2fx)", mean, mean/base))
+				if switches := res.Switches(); switches < 0 {
+					counts = append(counts, "n/a")
+				} else {
+					counts = append(counts, strconv.FormatInt(switches, 10))
+				}
+			}
+			throughput.Append(speeds)
+			switches.Append(counts)
+			scaling.Series = append(scaling.Series, line)
+		}
+	}
+	throughput.Render()
+	fmt.Println()
+	switches.Render()
+	html.add(scaling)
+
+	// Render all the charts into a shareable report if requested
+	if *htmlFlag != "" {
+		if err := html.write(*htmlFlag); err != nil {
+			fmt.Printf("\nFailed to write HTML report: %v\n", err)
+		} else {
+			fmt.Printf("\nHTML report written to %s\n", *htmlFlag)
+		}
 	}
 }
 
@@ -215,58 +402,13 @@ func burstyOutput() io.Writer {
 	return output(time.Second, 10*1000*1024)
 }
 
-// Input creates an unbuffered data source, filled at the specified rate
-// producing count bytes by reading the given source.
+// Input creates an unbuffered data source, made available at the specified rate
+// by reading the given source.
 func input(cycle time.Duration, chunk int, source io.Reader) io.Reader {
-	pr, pw := io.Pipe()
-
-	// Input generator that will produce data at a specified rate
-	go func() {
-		defer pw.Close()
-
-		buffer := make([]byte, chunk)
-		for {
-			// Make the next chunk available in the input stream
-			n, err := io.ReadFull(source, buffer)
-			if n > 0 {
-				if _, err := pw.Write(buffer[:n]); err != nil {
-					panic(err)
-				}
-			}
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				return
-			}
-			if err != nil {
-				panic(err)
-			}
-			// Sleep a while to simulate throughput
-			time.Sleep(cycle)
-		}
-	}()
-	return pr
+	return &iotest.Reader{R: source, Chunk: chunk, Delay: cycle}
 }
 
-// Input creates an unbuffered data sink, emptied at the specified rate.
+// Output creates an unbuffered data sink, emptied at the specified rate.
 func output(cycle time.Duration, chunk int) io.Writer {
-	pr, pw := io.Pipe()
-
-	// Output reader that will consume data at a specified rate
-	go func() {
-		defer pr.Close()
-
-		buffer := make([]byte, chunk)
-		for {
-			// Consume the next chunk from the output stream
-			_, err := io.ReadFull(pr, buffer)
-			if err == io.EOF {
-				return
-			}
-			if err != nil {
-				panic(err)
-			}
-			// Sleep a while to simulate throughput
-			time.Sleep(cycle)
-		}
-	}()
-	return pw
+	return &iotest.Writer{Chunk: chunk, Delay: cycle}
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// soak runs back to back copies through an implementation for a long duration,
+// periodically sampling the throughput, live heap and goroutine count, to detect
+// slow leaks and degradation hidden by the short benchmarks. It returns whether
+// the implementation completed all copies without leaking goroutines.
+func soak(duration time.Duration, data []byte, copier contender) bool {
+	interval := duration / 20
+	if interval < time.Second {
+		interval = time.Second
+	}
+	runtime.GC()
+	baseline := runtime.NumGoroutine()
+
+	// Keep copying until the soak period expires, alternating between buffer sizes
+	// which exercise the sleep/wake paths heavily and which saturate throughput
+	var (
+		count   = int64(64 * 1024 * 1024)
+		buffers = []int{333, 64*1024 - 177}
+		moved   int64
+		failure atomic.Value
+		stop    = make(chan struct{})
+		done    sync.WaitGroup
+	)
+	done.Add(1)
+	go func() {
+		defer done.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			n, err := copier.Copy(ioutil.Discard, dataReader(count, data), buffers[i%len(buffers)])
+			if err == nil && n != count {
+				err = fmt.Errorf("data length mismatch: have %d, want %d", n, count)
+			}
+			if err != nil {
+				failure.Store(err)
+				return
+			}
+			atomic.AddInt64(&moved, n)
+		}
+	}()
+	// Sample the statistics until the soak completes or a copy fails
+	var (
+		stats       runtime.MemStats
+		throughputs []float64
+		heaps       []uint64
+		last        int64
+		expire      = time.After(duration)
+		ticker      = time.NewTicker(interval)
+	)
+	defer ticker.Stop()
+
+	fmt.Printf("%20s: soaking for %v.\n", copier.Name, duration)
+	for soaking := true; soaking; {
+		select {
+		case <-expire:
+			soaking = false
+		case <-ticker.C:
+			now := atomic.LoadInt64(&moved)
+			runtime.ReadMemStats(&stats)
+
+			throughputs = append(throughputs, float64(now-last)/(1024*1024)/interval.Seconds())
+			heaps = append(heaps, stats.HeapInuse)
+			last = now
+
+			fmt.Printf("%20s: %10.2f mbps %9d B heap %5d goroutines\n", "", throughputs[len(throughputs)-1], stats.HeapInuse, runtime.NumGoroutine())
+		}
+		if failure.Load() != nil {
+			break
+		}
+	}
+	close(stop)
+	done.Wait()
+
+	if err := failure.Load(); err != nil {
+		fmt.Printf("%20s: copy failed: %v.\n", copier.Name, err)
+		return false
+	}
+	// Summarize the variance of the throughput and the growth of the resources
+	var mean, dev float64
+	for _, t := range throughputs {
+		mean += t
+	}
+	mean /= float64(len(throughputs))
+	for _, t := range throughputs {
+		dev += (t - mean) * (t - mean)
+	}
+	dev = math.Sqrt(dev / float64(len(throughputs)))
+
+	var growth int64
+	if len(heaps) > 1 {
+		growth = int64(heaps[len(heaps)-1]) - int64(heaps[0])
+	}
+	// Give any lingering goroutines a chance to terminate before checking leaks
+	leaked := 0
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+		if leaked = runtime.NumGoroutine() - baseline; leaked <= 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fmt.Printf("%20s: %10.2f mbps mean %8.2f%% stddev %9d B heap growth %5d leaked goroutines\n",
+		copier.Name, mean, 100*dev/mean, growth, leaked)
+
+	return leaked <= 0
+}
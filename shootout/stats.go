@@ -0,0 +1,93 @@
+package main
+
+import "math"
+
+// Sample is a set of repeated measurements of the same benchmark, to tell apart
+// real differences between contenders from the run to run noise.
+type Sample []Measurement
+
+// Throughputs returns the throughput of every run in the sample.
+func (s Sample) Throughputs(size int64) []float64 {
+	res := make([]float64, len(s))
+	for i, m := range s {
+		res[i] = m.Throughput(size)
+	}
+	return res
+}
+
+// Best returns the fastest run of the sample.
+func (s Sample) Best() Measurement {
+	best := s[0]
+	for _, m := range s[1:] {
+		if m.Duration < best.Duration {
+			best = m
+		}
+	}
+	return best
+}
+
+// Switches returns the mean number of context switches of the runs, or -1 if
+// they're unknown.
+func (s Sample) Switches() int64 {
+	var total int64
+	for _, m := range s {
+		if m.Switches < 0 {
+			return -1
+		}
+		total += m.Switches
+	}
+	return total / int64(len(s))
+}
+
+// meanStddev returns the mean and the (corrected) standard deviation of values.
+func meanStddev(values []float64) (mean, stddev float64) {
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	if len(values) < 2 {
+		return mean, 0
+	}
+	for _, v := range values {
+		stddev += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(stddev / float64(len(values)-1))
+}
+
+// tCritical are the two sided critical values of Student's t-distribution at 95%
+// confidence, indexed by the minimum degrees of freedom they apply from.
+var tCritical = []struct {
+	df    float64
+	value float64
+}{
+	{1, 12.706}, {2, 4.303}, {3, 3.182}, {4, 2.776}, {5, 2.571}, {6, 2.447}, {7, 2.365},
+	{8, 2.306}, {9, 2.262}, {10, 2.228}, {12, 2.179}, {15, 2.131}, {20, 2.086},
+	{30, 2.042}, {60, 2.000}, {120, 1.980}, {math.Inf(1), 1.960},
+}
+
+// significant runs Welch's t-test on two sets of values, reporting whether their
+// means differ at 95% confidence.
+func significant(a, b []float64) bool {
+	if len(a) < 2 || len(b) < 2 {
+		return false
+	}
+	meanA, stddevA := meanStddev(a)
+	meanB, stddevB := meanStddev(b)
+
+	varA, varB := stddevA*stddevA/float64(len(a)), stddevB*stddevB/float64(len(b))
+	if varA+varB == 0 {
+		return meanA != meanB
+	}
+	t := math.Abs(meanA-meanB) / math.Sqrt(varA+varB)
+	df := (varA + varB) * (varA + varB) / (varA*varA/float64(len(a)-1) + varB*varB/float64(len(b)-1))
+
+	// Pick the critical value of the closest tabulated degrees of freedom below
+	critical := tCritical[0].value
+	for _, entry := range tCritical {
+		if entry.df <= df {
+			critical = entry.value
+		}
+	}
+	return t > critical
+}
@@ -0,0 +1,13 @@
+package main
+
+import "syscall"
+
+// contextSwitches returns the number of voluntary and involuntary context switches
+// the process went through so far, or -1 if they're unobtainable.
+func contextSwitches() int64 {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return -1
+	}
+	return usage.Nvcsw + usage.Nivcsw
+}
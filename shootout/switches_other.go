@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// contextSwitches returns -1 as context switch counts are only collected on Linux.
+func contextSwitches() int64 {
+	return -1
+}
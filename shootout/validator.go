@@ -3,8 +3,11 @@ package main
 import (
 	"bytes"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"time"
 )
 
 // Test verifies that an implementation works correctly under high load.
@@ -37,3 +40,101 @@ func test(count int64, data []byte, copier contender) (result bool) {
 	fmt.Printf("%20s: test passed.\n", copier.Name)
 	return true
 }
+
+// errSource is the failure injected mid-stream into the source when validating
+// the error propagation of the implementations.
+var errSource = errors.New("shootout: injected source failure")
+
+// failingSource streams some data in small chunks, after which it fails, either
+// on a separate read or alongside the last chunk.
+type failingSource struct {
+	data  []byte // Data remaining to be streamed
+	eager bool   // Whether to return the failure along with the last chunk
+}
+
+func (r *failingSource) Read(b []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errSource
+	}
+	if len(b) > 4096 {
+		b = b[:4096]
+	}
+	n := copy(b, r.data)
+	r.data = r.data[n:]
+	if r.eager && len(r.data) == 0 {
+		return n, errSource
+	}
+	return n, nil
+}
+
+// slowSink hashes and counts the data it receives, pausing every now and again so
+// that the source fails while data is still in flight in the copier's buffer.
+type slowSink struct {
+	hash    hash.Hash // Hasher of the received data
+	written int64     // Number of bytes accepted from the copier
+	writes  int       // Number of writes, to pause on every few
+}
+
+func (w *slowSink) Write(b []byte) (int, error) {
+	if w.writes++; w.writes%16 == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	w.hash.Write(b)
+	w.written += int64(len(b))
+	return len(b), nil
+}
+
+// testErrors verifies that when the source fails mid-stream, an implementation
+// delivers all the data read before the failure, reports the number of bytes that
+// were actually written downstream (not the number read from the source), and
+// returns the original source error.
+func testErrors(data []byte, copier contender) bool {
+	want := sha256.Sum256(data)
+
+	for _, eager := range []bool{false, true} {
+		type result struct {
+			n     int64
+			err   error
+			panic bool
+		}
+		var (
+			sink = &slowSink{hash: sha256.New()}
+			done = make(chan result, 1)
+		)
+		go func() {
+			// Make sure a panic doesn't kill the shootout
+			defer func() {
+				if r := recover(); r != nil {
+					done <- result{panic: true}
+				}
+			}()
+			n, err := copier.Copy(sink, &failingSource{data: data, eager: eager}, 33333)
+			done <- result{n: n, err: err}
+		}()
+		var res result
+		select {
+		case res = <-done:
+		case <-time.After(10 * time.Second):
+			fmt.Printf("%20s: hung on source failure (eager %v).\n", copier.Name, eager)
+			return false
+		}
+		if res.panic {
+			fmt.Printf("%20s: panic.\n", copier.Name)
+			return false
+		}
+		if res.err != errSource {
+			fmt.Printf("%20s: error mismatch (eager %v): have %v, want %v.\n", copier.Name, eager, res.err, errSource)
+			return false
+		}
+		if res.n != sink.written {
+			fmt.Printf("%20s: count mismatch (eager %v): have %d, written downstream %d.\n", copier.Name, eager, res.n, sink.written)
+			return false
+		}
+		if sink.written != int64(len(data)) || !bytes.Equal(sink.hash.Sum(nil), want[:]) {
+			fmt.Printf("%20s: data before failure lost (eager %v): have %d bytes, want %d.\n", copier.Name, eager, sink.written, len(data))
+			return false
+		}
+	}
+	fmt.Printf("%20s: test passed.\n", copier.Name)
+	return true
+}
@@ -0,0 +1,19 @@
+package bufioprop
+
+// simHooks are injection points making the scheduling decisions of a pipe
+// deterministic, so that tests can reliably exercise the rare interleavings
+// (e.g. a side closing just as the other one goes to sleep) instead of relying
+// on timing luck. They are only ever set by tests, via an internal option.
+type simHooks struct {
+	noSpin bool // Skip the spin lock, always taking the park path
+
+	parkInput  func() // Invoked right before the writing side parks on a full buffer
+	parkOutput func() // Invoked right before the reading side parks on an empty buffer
+}
+
+// withSimHooks injects simulation hooks into a pipe or a copy.
+func withSimHooks(hooks *simHooks) Option {
+	return func(c *config) {
+		c.sim = hooks
+	}
+}
@@ -0,0 +1,86 @@
+package bufioprop
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// runTimeout runs a function, failing the test if it doesn't return in time.
+func runTimeout(t *testing.T, fn func()) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("operation stuck")
+	}
+}
+
+// Tests that a side going to sleep just as the other one makes progress is not
+// left sleeping (i.e. there are no lost wakeups), for all wake strategies.
+func TestSimProgressWhileParking(t *testing.T) {
+	for _, strategy := range []WakeStrategy{WakeEdge, WakeLevel} {
+		// Reader parking on an empty buffer while data is written
+		var w *PipeWriter
+		hooks := &simHooks{noSpin: true}
+		hooks.parkOutput = func() {
+			hooks.parkOutput = nil
+			w.Write([]byte{0x42})
+		}
+		r, w := Pipe(16, WithWakeStrategy(strategy), withSimHooks(hooks))
+
+		runTimeout(t, func() {
+			buf := make([]byte, 1)
+			if n, err := r.Read(buf); n != 1 || err != nil || buf[0] != 0x42 {
+				t.Errorf("%v: read mismatch: have (%d, %v, %x), want (1, nil, 42)", strategy, n, err, buf[0])
+			}
+		})
+		// Writer parking on a full buffer while data is read
+		hooks = &simHooks{noSpin: true}
+		hooks.parkInput = func() {
+			hooks.parkInput = nil
+			r.Read(make([]byte, 16))
+		}
+		r, w = Pipe(16, WithWakeStrategy(strategy), withSimHooks(hooks))
+
+		runTimeout(t, func() {
+			if n, err := w.Write(make([]byte, 32)); n != 32 || err != nil {
+				t.Errorf("%v: write mismatch: have (%d, %v), want (32, nil)", strategy, n, err)
+			}
+		})
+	}
+}
+
+// Tests that a side going to sleep just as the other one closes is woken up with
+// the correct error, for all wake strategies.
+func TestSimCloseWhileParking(t *testing.T) {
+	for _, strategy := range []WakeStrategy{WakeEdge, WakeLevel} {
+		// Reader parking on an empty buffer while the writer closes
+		var w *PipeWriter
+		hooks := &simHooks{noSpin: true}
+		hooks.parkOutput = func() { w.Close() }
+		r, w := Pipe(16, WithWakeStrategy(strategy), withSimHooks(hooks))
+
+		runTimeout(t, func() {
+			if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+				t.Errorf("%v: read error mismatch: have %v, want %v", strategy, err, io.EOF)
+			}
+		})
+		// Writer parking on a full buffer while the reader closes
+		hooks = &simHooks{noSpin: true}
+		hooks.parkInput = func() { r.Close() }
+		r, w = Pipe(16, WithWakeStrategy(strategy), withSimHooks(hooks))
+
+		runTimeout(t, func() {
+			if n, err := w.Write(make([]byte, 32)); n != 16 || err != ErrClosedPipe {
+				t.Errorf("%v: write mismatch: have (%d, %v), want (16, %v)", strategy, n, err, ErrClosedPipe)
+			}
+		})
+	}
+}
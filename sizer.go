@@ -0,0 +1,89 @@
+package bufioprop
+
+import (
+	"io"
+	"time"
+)
+
+// DefaultBufferSize is the buffer size pipes and copies are created with when
+// passed a buffer of 0. It matches the default capacity of Linux pipes: large
+// enough to amortize the syscalls of the endpoints and let them run decoupled,
+// small enough to stay cache friendly and cheap to allocate per copy.
+const DefaultBufferSize = 64 * 1024
+
+const (
+	minRecommendBuffer = 4 * 1024         // Smallest buffer recommended, one memory page
+	maxRecommendBuffer = 64 * 1024 * 1024 // Largest buffer recommended, beyond which memory is wasted
+)
+
+// A Sizer is a source which knows the number of bytes remaining in it, such as a
+// *bytes.Reader, *strings.Reader or *bytes.Buffer. Copies size their internal
+// buffer to never exceed the remaining length of such sources.
+type Sizer interface {
+	Len() int
+}
+
+// RecommendBuffer calculates a buffer size for a copy over a link of the given
+// bandwidth (in bytes per second) and round trip latency, based on the link's
+// bandwidth-delay product: the amount of data in flight needed to saturate it.
+//
+// The product is doubled, so that one half of the buffer can be filled while
+// the other is drained without either endpoint stalling, and rounded up to whole
+// memory pages. The result is clamped between 4KB and 64MB. If either parameter
+// is unknown (non-positive), DefaultBufferSize is returned.
+func RecommendBuffer(bandwidth int64, latency time.Duration) int {
+	if bandwidth <= 0 || latency <= 0 {
+		return DefaultBufferSize
+	}
+	bdp := 2 * float64(bandwidth) * latency.Seconds()
+	if bdp >= maxRecommendBuffer {
+		return maxRecommendBuffer
+	}
+	buffer := (int(bdp) + minRecommendBuffer - 1) / minRecommendBuffer * minRecommendBuffer
+	if buffer < minRecommendBuffer {
+		return minRecommendBuffer
+	}
+	return buffer
+}
+
+// bufferSize returns the requested buffer size, or the default if it's 0.
+func bufferSize(buffer int) int {
+	if buffer == 0 {
+		return DefaultBufferSize
+	}
+	return buffer
+}
+
+// copyBuffer caps the buffer size of a copy to the remaining length of its source,
+// if known, avoiding the allocation of large buffers for small payloads.
+func copyBuffer(src io.Reader, buffer int) int {
+	remaining, ok := sourceLen(src)
+	if !ok {
+		return buffer
+	}
+	return capBuffer(remaining, buffer)
+}
+
+// sourceLen returns the remaining length of a source, if it's known.
+func sourceLen(src io.Reader) (int64, bool) {
+	switch src := src.(type) {
+	case *io.LimitedReader:
+		return src.N, true
+	case Sizer:
+		return int64(src.Len()), true
+	default:
+		return 0, false
+	}
+}
+
+// capBuffer caps the buffer size to the remaining length of a source.
+func capBuffer(remaining int64, buffer int) int {
+	buffer = bufferSize(buffer)
+	if remaining < 1 {
+		remaining = 1 // pipes need some space to operate
+	}
+	if remaining < int64(buffer) {
+		return int(remaining)
+	}
+	return buffer
+}
@@ -0,0 +1,55 @@
+package bufioprop
+
+import "time"
+
+// SpinPolicy selects whether a side of a pipe waiting for the other one spins
+// for a while before parking.
+type SpinPolicy int
+
+const (
+	// SpinAdaptive spins only while the recent waits of the side were short enough
+	// for spinning to pay off, parking straight away when history says the wait
+	// will be long (e.g. rate limited endpoints), saving the burnt CPU.
+	SpinAdaptive SpinPolicy = iota
+
+	// SpinAlways spins before every park, regardless of how long waits last.
+	SpinAlways
+)
+
+// String implements fmt.Stringer.
+func (s SpinPolicy) String() string {
+	switch s {
+	case SpinAdaptive:
+		return "adaptive"
+	case SpinAlways:
+		return "always"
+	default:
+		return "unknown"
+	}
+}
+
+// spinWaitLimit is the average wait time above which an adaptive side of a pipe
+// stops spinning. It's well above the cost of a spin phase and of a park/wake
+// cycle, so waits that would end while spinning don't drive it above the limit.
+const spinWaitLimit = 50 * time.Microsecond
+
+// spinner tracks the wait times of a single side of a pipe, deciding whether it
+// should spin before parking. It's owned by that side, needing no syncing.
+type spinner struct {
+	adaptive bool          // Whether to skip spinning after long waits
+	average  time.Duration // Exponentially weighted moving average of the wait times
+}
+
+// spins returns the number of spin iterations to do before parking, out of the
+// maximum the pipe allows.
+func (s *spinner) spins(limit int) int {
+	if s.adaptive && s.average > spinWaitLimit {
+		return 0
+	}
+	return limit
+}
+
+// record accounts the duration of a finished wait into the history.
+func (s *spinner) record(wait time.Duration) {
+	s.average += (wait - s.average) / 8
+}
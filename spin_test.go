@@ -0,0 +1,63 @@
+package bufioprop
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that adaptive spinning stops after a history of long waits and resumes
+// once the waits get short again.
+func TestSpinnerAdaptive(t *testing.T) {
+	s := spinner{adaptive: true}
+	if spins := s.spins(16); spins != 16 {
+		t.Fatalf("fresh spinner spins mismatch: have %d, want %d", spins, 16)
+	}
+	for i := 0; i < 32; i++ {
+		s.record(time.Millisecond)
+	}
+	if spins := s.spins(16); spins != 0 {
+		t.Fatalf("long waits spins mismatch: have %d, want 0", spins)
+	}
+	for i := 0; i < 64; i++ {
+		s.record(time.Microsecond)
+	}
+	if spins := s.spins(16); spins != 16 {
+		t.Fatalf("short waits spins mismatch: have %d, want %d", spins, 16)
+	}
+	// Non adaptive spinners should always spin
+	s = spinner{}
+	for i := 0; i < 32; i++ {
+		s.record(time.Millisecond)
+	}
+	if spins := s.spins(16); spins != 16 {
+		t.Fatalf("unconditional spins mismatch: have %d, want %d", spins, 16)
+	}
+}
+
+// Tests that a pipe fed by a slow writer makes its reader park without spinning,
+// unless unconditional spinning was requested.
+func TestPipeSpinPolicy(t *testing.T) {
+	for _, policy := range []SpinPolicy{SpinAdaptive, SpinAlways} {
+		r, w := Pipe(1024, WithSpinPolicy(policy))
+		go func() {
+			for i := 0; i < 16; i++ {
+				time.Sleep(time.Millisecond)
+				w.Write([]byte{byte(i)})
+			}
+			w.Close()
+		}()
+		buf := make([]byte, 1)
+		for i := 0; i < 16; i++ {
+			if _, err := r.Read(buf); err != nil {
+				t.Fatalf("%v: read %d failed: %v", policy, i, err)
+			}
+		}
+		want := r.p.spin
+		if policy == SpinAdaptive {
+			want = 0
+		}
+		if spins := r.p.outSpin.spins(r.p.spin); spins != want {
+			t.Fatalf("%v: reader spins mismatch: have %d, want %d", policy, spins, want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Package spsc contains the synchronization machinery behind the two sides of a
+// bufioprop pipe, without the byte buffer parts, for building other single
+// producer, single consumer structures (e.g. frame queues) on top.
+//
+// Each side publishes its progress via a monotonic atomic counter, which only it
+// modifies. A side which cannot proceed waits on its Waiter until the other's
+// counter moves past the value it last observed, and the other side signals the
+// Waiter after every update of its counter:
+//
+//	// Consumer, waiting for frames
+//	for tail == head.Load() {
+//		if !notEmpty.Wait(&head, tail) {
+//			return errClosed
+//		}
+//	}
+//
+//	// Producer, after publishing a frame
+//	head.Add(1)
+//	notEmpty.Signal()
+package spsc
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSpin is the number of times a Waiter yields the processor by default,
+// before parking the waiting goroutine.
+const DefaultSpin = 16
+
+// Strategy selects how a parked goroutine is notified of the other side's
+// progress.
+type Strategy int
+
+const (
+	// Edge signals progress via a single-slot channel. Every signal posts a
+	// (non-blocking) notification, which the sleeper consumes upon waking. This
+	// is cheap on the signaling side, but may cause spurious wakeups.
+	Edge Strategy = iota
+
+	// Level parks the sleeper on a condition variable, which is rechecked
+	// against the progress counter before returning. Signals only take the lock
+	// if there is a sleeper, but a signal is more expensive than a channel post.
+	Level
+)
+
+// String implements fmt.Stringer.
+func (s Strategy) String() string {
+	switch s {
+	case Edge:
+		return "edge"
+	case Level:
+		return "level"
+	default:
+		return "unknown"
+	}
+}
+
+// A Waiter puts one side of a single producer, single consumer structure to
+// sleep until the other side makes progress. A Waiter must not be copied after
+// first use.
+type Waiter struct {
+	strategy Strategy // Signaling strategy of the waiter
+	spin     int      // Number of yields before parking
+
+	wake chan struct{} // Signaler for the edge sleeper, if it's asleep
+	quit chan struct{} // Quit channel for the edge sleeper, closed on Close
+
+	lock    sync.Mutex   // Lock protecting the level condition
+	cond    sync.Cond    // Condition variable for the level sleeper
+	waiting atomic.Int32 // Number of level sleepers, skipping the lock if none
+
+	closed atomic.Bool // Whether the waiter was closed
+}
+
+// NewWaiter creates a waiter implementing the requested signaling strategy,
+// yielding the processor spin times before parking a goroutine.
+func NewWaiter(strategy Strategy, spin int) *Waiter {
+	w := &Waiter{
+		strategy: strategy,
+		spin:     spin,
+		wake:     make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+	}
+	w.cond.L = &w.lock
+	return w
+}
+
+// Wait blocks until progress differs from seen, spinning for a while before
+// parking the calling goroutine. It returns whether progress was made, false
+// meaning that the waiter was closed meanwhile.
+func (w *Waiter) Wait(progress *atomic.Uint64, seen uint64) bool {
+	for i := 0; i < w.spin; i++ {
+		if progress.Load() != seen {
+			return true
+		}
+		if w.closed.Load() {
+			return false
+		}
+		runtime.Gosched()
+	}
+	if w.strategy == Level {
+		return w.parkLevel(progress, seen)
+	}
+	return w.parkEdge(progress, seen)
+}
+
+// parkEdge sleeps on the signal channel until progress differs from seen or the
+// waiter is closed. A signal posted while going to sleep is retained by the slot
+// of the channel, so it cannot be lost.
+func (w *Waiter) parkEdge(progress *atomic.Uint64, seen uint64) bool {
+	for progress.Load() == seen {
+		select {
+		case <-w.wake:
+		case <-w.quit:
+			return progress.Load() != seen
+		}
+	}
+	return true
+}
+
+// parkLevel sleeps on the condition variable until progress differs from seen or
+// the waiter is closed. The sleeper is registered before checking the progress,
+// and signalers check for sleepers after updating it, so one always sees the other.
+func (w *Waiter) parkLevel(progress *atomic.Uint64, seen uint64) bool {
+	w.lock.Lock()
+	w.waiting.Add(1)
+	for progress.Load() == seen && !w.closed.Load() {
+		w.cond.Wait()
+	}
+	w.waiting.Add(-1)
+	w.lock.Unlock()
+
+	return progress.Load() != seen
+}
+
+// Signal notifies the sleeper (if any) that progress was made. It must be called
+// after updating the progress counter.
+func (w *Waiter) Signal() {
+	if w.strategy == Level {
+		if w.waiting.Load() == 0 {
+			return
+		}
+		w.lock.Lock()
+		w.cond.Signal()
+		w.lock.Unlock()
+		return
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close wakes the sleeper (if any) and fails all subsequent waits which would
+// need to park. It is safe to call Close multiple times.
+func (w *Waiter) Close() {
+	if !w.closed.CompareAndSwap(false, true) {
+		return
+	}
+	close(w.quit)
+
+	w.lock.Lock()
+	w.cond.Broadcast()
+	w.lock.Unlock()
+}
@@ -0,0 +1,131 @@
+package spsc
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// queue is a fixed size frame queue built on top of a pair of waiters, the way
+// a reusing library would.
+type queue struct {
+	slots []int
+
+	head atomic.Uint64 // Number of frames pushed, modified by the producer
+	tail atomic.Uint64 // Number of frames popped, modified by the consumer
+
+	notFull  *Waiter // Waiter of the producer, signaled by the consumer
+	notEmpty *Waiter // Waiter of the consumer, signaled by the producer
+}
+
+func newQueue(size int, strategy Strategy, spin int) *queue {
+	return &queue{
+		slots:    make([]int, size),
+		notFull:  NewWaiter(strategy, spin),
+		notEmpty: NewWaiter(strategy, spin),
+	}
+}
+
+func (q *queue) push(v int) bool {
+	head := q.head.Load()
+	for head-q.tail.Load() == uint64(len(q.slots)) {
+		if !q.notFull.Wait(&q.tail, head-uint64(len(q.slots))) {
+			return false
+		}
+	}
+	q.slots[head%uint64(len(q.slots))] = v
+	q.head.Store(head + 1)
+	q.notEmpty.Signal()
+	return true
+}
+
+func (q *queue) pop() (int, bool) {
+	tail := q.tail.Load()
+	for tail == q.head.Load() {
+		if !q.notEmpty.Wait(&q.head, tail) {
+			return 0, false
+		}
+	}
+	v := q.slots[tail%uint64(len(q.slots))]
+	q.tail.Store(tail + 1)
+	q.notFull.Signal()
+	return v, true
+}
+
+// Tests that frames can be streamed through a queue built on the waiters without
+// losing any wakeups, for all strategies, with and without spinning.
+func TestQueue(t *testing.T) {
+	for _, strategy := range []Strategy{Edge, Level} {
+		for _, spin := range []int{0, DefaultSpin} {
+			q := newQueue(4, strategy, spin)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 100000; i++ {
+					if !q.push(i) {
+						t.Errorf("%v/%d: push %d failed", strategy, spin, i)
+						return
+					}
+				}
+			}()
+			for i := 0; i < 100000; i++ {
+				v, ok := q.pop()
+				if !ok || v != i {
+					t.Fatalf("%v/%d: pop mismatch: have (%d, %v), want (%d, true)", strategy, spin, v, ok, i)
+				}
+			}
+			<-done
+		}
+	}
+}
+
+// Tests that closing a waiter wakes up its sleeper, and that any further waits
+// without progress fail immediately.
+func TestClose(t *testing.T) {
+	for _, strategy := range []Strategy{Edge, Level} {
+		var (
+			w        = NewWaiter(strategy, 0)
+			progress atomic.Uint64
+			result   = make(chan bool, 1)
+		)
+		go func() { result <- w.Wait(&progress, 0) }()
+
+		time.Sleep(10 * time.Millisecond)
+		w.Close()
+		w.Close()
+
+		select {
+		case ok := <-result:
+			if ok {
+				t.Errorf("%v: wait succeeded on closed waiter", strategy)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v: sleeper not woken up", strategy)
+		}
+		if w.Wait(&progress, 0) {
+			t.Errorf("%v: wait succeeded on closed waiter", strategy)
+		}
+		progress.Add(1)
+		if !w.Wait(&progress, 0) {
+			t.Errorf("%v: wait failed despite progress", strategy)
+		}
+	}
+}
+
+func BenchmarkQueueEdge(b *testing.B)  { benchmarkQueue(Edge, b) }
+func BenchmarkQueueLevel(b *testing.B) { benchmarkQueue(Level, b) }
+
+// benchmarkQueue measures the latency of passing frames through a small queue,
+// which keeps both sides waiting on each other.
+func benchmarkQueue(strategy Strategy, b *testing.B) {
+	q := newQueue(16, strategy, DefaultSpin)
+	go func() {
+		for i := 0; i < b.N; i++ {
+			q.push(i)
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		q.pop()
+	}
+}
@@ -0,0 +1,110 @@
+package bufioprop
+
+// State is the lifecycle state of a pipe, as observed through its two halves.
+// The values are bit sets of the closed halves, so a pipe only ever moves from
+// StateOpen through one of the half closed states to StateDone.
+type State int
+
+const (
+	// StateOpen is the state of a pipe with both halves still open.
+	StateOpen State = 0
+
+	// StateWriterClosed is the state of a pipe whose writer was closed, but whose
+	// reader is still open (possibly still draining the buffered data).
+	StateWriterClosed State = 1
+
+	// StateReaderClosed is the state of a pipe whose reader was closed, but whose
+	// writer is still open (its writes failing, or being discarded).
+	StateReaderClosed State = 2
+
+	// StateDone is the state of a pipe with both halves closed.
+	StateDone State = StateWriterClosed | StateReaderClosed
+)
+
+// String implements fmt.Stringer.
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateWriterClosed:
+		return "writer closed"
+	case StateReaderClosed:
+		return "reader closed"
+	case StateDone:
+		return "done"
+	default:
+		return "unknown"
+	}
+}
+
+// State returns the current lifecycle state of the pipe. It's safe to call
+// concurrently with any other method.
+func (r *PipeReader) State() State {
+	return r.p.currentState()
+}
+
+// State returns the current lifecycle state of the pipe. It's safe to call
+// concurrently with any other method.
+func (w *PipeWriter) State() State {
+	return w.p.currentState()
+}
+
+// StateChanges subscribes to the lifecycle transitions of the pipe. The returned
+// channel first delivers the current state, then every later one in order, and
+// is closed after delivering StateDone. It's buffered to hold all the states the
+// pipe can go through, so the subscriber never holds back the closing halves and
+// may stop receiving at any point.
+func (r *PipeReader) StateChanges() <-chan State {
+	return r.p.subscribeState()
+}
+
+// StateChanges subscribes to the lifecycle transitions of the pipe. The returned
+// channel first delivers the current state, then every later one in order, and
+// is closed after delivering StateDone. It's buffered to hold all the states the
+// pipe can go through, so the subscriber never holds back the closing halves and
+// may stop receiving at any point.
+func (w *PipeWriter) StateChanges() <-chan State {
+	return w.p.subscribeState()
+}
+
+// currentState retrieves the last published state of the pipe.
+func (p *pipe) currentState() State {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	return p.state
+}
+
+// subscribeState creates a channel receiving the current and all later states.
+func (p *pipe) subscribeState() <-chan State {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	// Current state and at most two transitions fit without blocking
+	sub := make(chan State, 3)
+	sub <- p.state
+	if p.state == StateDone {
+		close(sub)
+	} else {
+		p.stateSubs = append(p.stateSubs, sub)
+	}
+	return sub
+}
+
+// publishState marks a half of the pipe closed, notifying the subscribers of the
+// resulting state. It must be called once per half, after it was closed.
+func (p *pipe) publishState(half State) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	p.state |= half
+	for _, sub := range p.stateSubs {
+		sub <- p.state
+		if p.state == StateDone {
+			close(sub)
+		}
+	}
+	if p.state == StateDone {
+		p.stateSubs = nil
+	}
+}
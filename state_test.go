@@ -0,0 +1,54 @@
+package bufioprop
+
+import "testing"
+
+// Tests that the lifecycle state of a pipe follows the closes of its halves, and
+// that subscribers receive every transition in order.
+func TestPipeState(t *testing.T) {
+	tests := []struct {
+		name   string
+		first  func(r *PipeReader, w *PipeWriter)
+		second func(r *PipeReader, w *PipeWriter)
+		half   State
+	}{
+		{"writer first", func(r *PipeReader, w *PipeWriter) { w.Close() }, func(r *PipeReader, w *PipeWriter) { r.Close() }, StateWriterClosed},
+		{"reader first", func(r *PipeReader, w *PipeWriter) { r.Close() }, func(r *PipeReader, w *PipeWriter) { w.Close() }, StateReaderClosed},
+	}
+	for _, tt := range tests {
+		r, w := Pipe(1024)
+
+		early := r.StateChanges()
+		if state := w.State(); state != StateOpen {
+			t.Fatalf("%s: initial state mismatch: have %v, want %v", tt.name, state, StateOpen)
+		}
+		tt.first(r, w)
+		tt.first(r, w) // repeated closes must not publish anything
+
+		middle := w.StateChanges()
+		if state := r.State(); state != tt.half {
+			t.Fatalf("%s: half closed state mismatch: have %v, want %v", tt.name, state, tt.half)
+		}
+		tt.second(r, w)
+
+		late := r.StateChanges()
+		if state := w.State(); state != StateDone {
+			t.Fatalf("%s: final state mismatch: have %v, want %v", tt.name, state, StateDone)
+		}
+		for i, want := range [][]State{{StateOpen, tt.half, StateDone}, {tt.half, StateDone}, {StateDone}} {
+			sub := []<-chan State{early, middle, late}[i]
+
+			var have []State
+			for state := range sub {
+				have = append(have, state)
+			}
+			if len(have) != len(want) {
+				t.Fatalf("%s: subscription %d mismatch: have %v, want %v", tt.name, i, have, want)
+			}
+			for j := range have {
+				if have[j] != want[j] {
+					t.Fatalf("%s: subscription %d mismatch: have %v, want %v", tt.name, i, have, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package bufioprop
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// Stats contains counters of notable events observed while moving data through
+// a pipe, mostly meant to help diagnose misbehaving endpoints. All fields are
+// updated atomically and may be read while the pipe is live.
+//
+// The stall durations tell which side of the pipe is the bottleneck: a reader
+// mostly waiting for data means a slow source, a writer mostly waiting for space
+// means a slow destination.
+type Stats struct {
+	ZeroReads   atomic.Uint64 // Source reads in ReadFrom returning no data and no error
+	EOFWithData atomic.Uint64 // Source reads in ReadFrom returning data alongside io.EOF
+	ErrWithData atomic.Uint64 // Source reads in ReadFrom returning data alongside a failure
+	ShortWrites atomic.Uint64 // Destination writes in WriteTo accepting less than given
+
+	WriteRetries atomic.Uint64 // Destination writes retried after transient failures, see WithWriteRetry
+	IdleReleases atomic.Uint64 // Buffer releases after idle periods, see WithIdleRelease
+
+	ReaderStall atomic.Int64 // Total nanoseconds the reading side waited for data
+	WriterStall atomic.Int64 // Total nanoseconds the writing side waited for free space
+}
+
+// sourceReads tracks the reads of a copy's source outside of a pipe's ReadFrom
+// (e.g. in the double buffered and chunked engines), applying the same empty read
+// limit and accounting the same events.
+type sourceReads struct {
+	stats *Stats // Counters to accumulate the read events into
+	limit int    // Consecutive empty reads tolerated (non-positive = unlimited)
+	empty int    // Consecutive empty reads seen so far
+}
+
+// track accounts a source read returning n bytes and err, returning the failure
+// to act upon: io.ErrNoProgress once the source stalled for too long, otherwise
+// err itself.
+func (s *sourceReads) track(n int, err error) error {
+	if n == 0 && err == nil {
+		s.stats.ZeroReads.Add(1)
+		if s.empty++; s.limit > 0 && s.empty >= s.limit {
+			return io.ErrNoProgress
+		}
+		return nil
+	}
+	s.empty = 0
+	if n > 0 && err != nil {
+		if err == io.EOF {
+			s.stats.EOFWithData.Add(1)
+		} else {
+			s.stats.ErrWithData.Add(1)
+		}
+	}
+	return err
+}
@@ -0,0 +1,196 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// pathologicalReader is a data source returning a few empty reads before each
+// chunk of data, and delivering the last chunk together with io.EOF.
+type pathologicalReader struct {
+	chunks [][]byte
+	empty  int
+}
+
+func (r *pathologicalReader) Read(b []byte) (int, error) {
+	if r.empty > 0 {
+		r.empty--
+		return 0, nil
+	}
+	r.empty = 2
+
+	n := copy(b, r.chunks[0])
+	if r.chunks[0] = r.chunks[0][n:]; len(r.chunks[0]) == 0 {
+		r.chunks = r.chunks[1:]
+	}
+	if len(r.chunks) == 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// shortWriter is a destination accepting only half of each write.
+type shortWriter struct{}
+
+func (shortWriter) Write(b []byte) (int, error) {
+	return len(b) / 2, nil
+}
+
+// Tests that pathological source and destination behavior is counted.
+func TestStats(t *testing.T) {
+	var stats Stats
+
+	src := &pathologicalReader{chunks: [][]byte{[]byte("hello"), []byte("world")}}
+	if _, err := Copy(ioutil.Discard, src, 128, WithStats(&stats)); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+	if n := stats.ZeroReads.Load(); n != 2 {
+		t.Errorf("zero read count mismatch: have %d, want %d", n, 2)
+	}
+	if n := stats.EOFWithData.Load(); n != 1 {
+		t.Errorf("EOF with data count mismatch: have %d, want %d", n, 1)
+	}
+	r, w := Pipe(128, WithStats(&stats))
+	go func() {
+		w.Write([]byte("hello world"))
+		w.Close()
+	}()
+	if _, err := r.WriteTo(shortWriter{}); !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("short write error mismatch: have %v, want %v", err, io.ErrShortWrite)
+	}
+	r.Close()
+
+	if n := r.Stats().ShortWrites.Load(); n != 1 {
+		t.Errorf("short write count mismatch: have %d, want %d", n, 1)
+	}
+}
+
+// stuckReader is a data source that never returns anything.
+type stuckReader struct {
+	reads int
+}
+
+func (r *stuckReader) Read(b []byte) (int, error) {
+	r.reads++
+	return 0, nil
+}
+
+// Tests that sources not making progress are aborted after the configured number
+// of consecutive empty reads.
+func TestEmptyReadLimit(t *testing.T) {
+	src := new(stuckReader)
+	if _, err := Copy(ioutil.Discard, src, 128, WithEmptyReadLimit(10)); err != io.ErrNoProgress {
+		t.Fatalf("error mismatch: have %v, want %v", err, io.ErrNoProgress)
+	}
+	if src.reads != 10 {
+		t.Errorf("read count mismatch: have %d, want %d", src.reads, 10)
+	}
+	// Ensure that sporadic empty reads don't trip the limit
+	patho := &pathologicalReader{chunks: [][]byte{[]byte("hello"), []byte("world")}}
+	if _, err := Copy(ioutil.Discard, patho, 128, WithEmptyReadLimit(3)); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+}
+
+// sleepyReader is a data source pausing before every read.
+type sleepyReader struct {
+	reads int
+	delay time.Duration
+}
+
+func (r *sleepyReader) Read(b []byte) (int, error) {
+	if r.reads == 0 {
+		return 0, io.EOF
+	}
+	r.reads--
+	time.Sleep(r.delay)
+	return copy(b, testData[:1024]), nil
+}
+
+// sleepyWriter is a data sink pausing before every write.
+type sleepyWriter struct {
+	delay time.Duration
+}
+
+func (w *sleepyWriter) Write(b []byte) (int, error) {
+	time.Sleep(w.delay)
+	return len(b), nil
+}
+
+// Tests that the stall durations blame the slow side of the pipe.
+func TestStatsStalls(t *testing.T) {
+	// Slow source, the reading side should be waiting for data
+	stats := new(Stats)
+	if _, err := Copy(ioutil.Discard, &sleepyReader{reads: 10, delay: 5 * time.Millisecond}, 4096, WithStats(stats)); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+	if stall := time.Duration(stats.ReaderStall.Load()); stall < 25*time.Millisecond {
+		t.Fatalf("reader stall too short: have %v, want >= %v", stall, 25*time.Millisecond)
+	}
+	if stats.WriterStall.Load() >= stats.ReaderStall.Load() {
+		t.Fatalf("writer stall exceeds reader's: %v >= %v", stats.WriterStall.Load(), stats.ReaderStall.Load())
+	}
+	// Slow sink, the writing side should be waiting for space
+	stats = new(Stats)
+	if _, err := Copy(&sleepyWriter{delay: 5 * time.Millisecond}, bytes.NewReader(testData[:64*1024]), 1024, WithStats(stats)); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+	if stall := time.Duration(stats.WriterStall.Load()); stall < 25*time.Millisecond {
+		t.Fatalf("writer stall too short: have %v, want >= %v", stall, 25*time.Millisecond)
+	}
+	if stats.ReaderStall.Load() >= stats.WriterStall.Load() {
+		t.Fatalf("reader stall exceeds writer's: %v >= %v", stats.ReaderStall.Load(), stats.WriterStall.Load())
+	}
+}
+
+// errDataReader is a source delivering its last chunk of data alongside a failure.
+type errDataReader struct {
+	data  []byte
+	chunk int
+	err   error
+}
+
+func (r *errDataReader) Read(b []byte) (int, error) {
+	if len(b) > r.chunk {
+		b = b[:r.chunk]
+	}
+	n := copy(b, r.data)
+	if r.data = r.data[n:]; len(r.data) == 0 {
+		return n, r.err
+	}
+	return n, nil
+}
+
+// Tests that data returned alongside a source failure is delivered downstream
+// before the failure is surfaced.
+func TestSourceErrorWithData(t *testing.T) {
+	var stats Stats
+	errSource := errors.New("connection reset")
+
+	// Copies should write out everything, returning the source failure
+	dst := new(bytes.Buffer)
+	n, err := Copy(dst, &errDataReader{data: testData[:10000], chunk: 3000, err: errSource}, 1024, WithStats(&stats))
+	if err != errSource {
+		t.Fatalf("copy error mismatch: have %v, want %v", err, errSource)
+	}
+	if n != 10000 || !bytes.Equal(dst.Bytes(), testData[:10000]) {
+		t.Fatalf("copied data mismatch: have %d bytes (reported %d), want %d", dst.Len(), n, 10000)
+	}
+	if n := stats.ErrWithData.Load(); n != 1 {
+		t.Errorf("error with data count mismatch: have %d, want %d", n, 1)
+	}
+	// Pipes should account the data and deliver it before the writer's failure
+	r, w := Pipe(16 * 1024)
+	go func() {
+		_, err := w.ReadFrom(&errDataReader{data: testData[:10000], chunk: 3000, err: errSource})
+		w.CloseWithError(err)
+	}()
+	have, err := io.ReadAll(r)
+	if err != errSource || !bytes.Equal(have, testData[:10000]) {
+		t.Fatalf("piped data mismatch: have (%d bytes, %v), want (%d bytes, %v)", len(have), err, 10000, errSource)
+	}
+}
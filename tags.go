@@ -0,0 +1,111 @@
+package bufioprop
+
+import (
+	"context"
+	"sync"
+)
+
+// TagCounts are the cumulative byte counts of all the pipes (and copies) labeled
+// with the same tag via WithTag.
+type TagCounts struct {
+	Written int64 // Bytes written into the tagged pipes (read from the copies' sources)
+	Read    int64 // Bytes read out of the tagged pipes (written into the copies' destinations)
+}
+
+// tagAccount aggregates the byte counts of the pipes sharing a tag. Live pipes are
+// sampled when queried, so accounting has no cost on the data path.
+type tagAccount struct {
+	done TagCounts          // Totals of the already terminated pipes
+	live map[*pipe]struct{} // Pipes still running under the tag
+}
+
+var (
+	tagAccounts = make(map[string]*tagAccount) // Accounts of all the tags seen so far
+	tagLock     sync.Mutex                     // Lock protecting the tag accounts
+)
+
+// tagKey is the context key the tag of CopyContext is stored under.
+type tagKey struct{}
+
+// ContextWithTag returns a copy of ctx carrying a tag to account the copies run
+// via CopyContext under, same as if WithTag was set. An explicit WithTag option
+// takes precedence over the context's tag.
+func ContextWithTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, tagKey{}, tag)
+}
+
+// attachTag starts accounting a new pipe under the given tag.
+func attachTag(tag string, p *pipe) {
+	tagLock.Lock()
+	defer tagLock.Unlock()
+
+	account, ok := tagAccounts[tag]
+	if !ok {
+		account = &tagAccount{live: make(map[*pipe]struct{})}
+		tagAccounts[tag] = account
+	}
+	account.live[p] = struct{}{}
+}
+
+// detachTag moves the final counts of a terminated pipe into its tag's totals.
+func detachTag(tag string, p *pipe) {
+	tagLock.Lock()
+	defer tagLock.Unlock()
+
+	// The account might have been forgotten and recreated in the meantime
+	account, ok := tagAccounts[tag]
+	if !ok {
+		return
+	}
+	if _, ok := account.live[p]; !ok {
+		return
+	}
+	delete(account.live, p)
+	account.done.Written += int64(p.head.Load())
+	account.done.Read += int64(p.tail.Load())
+}
+
+// counts sums the totals of the account with the current progress of its live
+// pipes. The caller must hold tagLock.
+func (a *tagAccount) counts() TagCounts {
+	counts := a.done
+	for p := range a.live {
+		counts.Written += int64(p.head.Load())
+		counts.Read += int64(p.tail.Load())
+	}
+	return counts
+}
+
+// Tagged returns the byte counts accumulated under a tag so far, including the
+// progress of the tagged pipes still running.
+func Tagged(tag string) TagCounts {
+	tagLock.Lock()
+	defer tagLock.Unlock()
+
+	if account, ok := tagAccounts[tag]; ok {
+		return account.counts()
+	}
+	return TagCounts{}
+}
+
+// AllTagged returns the byte counts of every tag seen so far, e.g. to export them
+// as per-tenant metrics.
+func AllTagged() map[string]TagCounts {
+	tagLock.Lock()
+	defer tagLock.Unlock()
+
+	all := make(map[string]TagCounts, len(tagAccounts))
+	for tag, account := range tagAccounts {
+		all[tag] = account.counts()
+	}
+	return all
+}
+
+// ForgetTag drops the account of a tag, resetting its counts, e.g. when a tenant
+// is removed. Pipes still running under the tag are not accounted anymore.
+func ForgetTag(tag string) {
+	tagLock.Lock()
+	defer tagLock.Unlock()
+
+	delete(tagAccounts, tag)
+}
@@ -0,0 +1,46 @@
+package bufioprop
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// Tests that the traffic of tagged pipes and copies is aggregated per tag, both
+// while running and after terminating.
+func TestTagged(t *testing.T) {
+	defer ForgetTag("tenant-a")
+	defer ForgetTag("tenant-b")
+
+	// Live pipes should be accounted as they progress
+	r, w := Pipe(1024, WithTag("tenant-a"))
+	w.Write(testData[:100])
+	r.Read(make([]byte, 60))
+
+	if have, want := Tagged("tenant-a"), (TagCounts{Written: 100, Read: 60}); have != want {
+		t.Fatalf("live counts mismatch: have %+v, want %+v", have, want)
+	}
+	r.Close()
+	w.Close()
+
+	// Copies should add to the totals of their tag, including via contexts
+	if _, err := Copy(new(bytes.Buffer), bytes.NewReader(testData[:1000]), 1024, WithTag("tenant-a")); err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+	ctx := ContextWithTag(context.Background(), "tenant-b")
+	if _, err := CopyContext(ctx, new(bytes.Buffer), bytes.NewReader(testData[:500]), 1024); err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+	all := AllTagged()
+	if have, want := all["tenant-a"], (TagCounts{Written: 1100, Read: 1060}); have != want {
+		t.Fatalf("tenant-a counts mismatch: have %+v, want %+v", have, want)
+	}
+	if have, want := all["tenant-b"], (TagCounts{Written: 500, Read: 500}); have != want {
+		t.Fatalf("tenant-b counts mismatch: have %+v, want %+v", have, want)
+	}
+	// Forgotten tags should start over
+	ForgetTag("tenant-a")
+	if have := Tagged("tenant-a"); have != (TagCounts{}) {
+		t.Fatalf("forgotten counts mismatch: have %+v, want zero", have)
+	}
+}
@@ -0,0 +1,99 @@
+// Package tarstream produces tar archives into buffered pipes on a background
+// goroutine, letting the caller consume the archive as a plain stream (e.g. to
+// upload it) while the filesystem is still being walked.
+package tarstream
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/karalabe/bufioprop"
+)
+
+// Stream runs fn on a new goroutine to produce a tar archive into a buffered pipe
+// of the given size, returning the reading end of the pipe. The archive is closed
+// after fn returns successfully.
+//
+// Any error returned by fn (or the archive's finalization) is reported by the
+// reader once the data produced before it is consumed. Closing the reader early
+// aborts the production, failing the writes issued by fn.
+func Stream(buffer int, fn func(tw *tar.Writer) error) *bufioprop.PipeReader {
+	pr, pw := bufioprop.Pipe(buffer)
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := fn(tw)
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// Dir archives the directory tree rooted at root into a tar stream, produced into
+// a buffered pipe of the given size. Entry names are relative to root, using
+// forward slashes. Directories, regular files and symbolic links are archived
+// (the latter without being followed); other file types are skipped.
+func Dir(root string, buffer int) *bufioprop.PipeReader {
+	return Stream(buffer, func(tw *tar.Writer) error {
+		return AddDir(tw, root)
+	})
+}
+
+// AddDir appends the directory tree rooted at root into an archive, allowing it
+// to be combined with other entries in a custom Stream.
+func AddDir(tw *tar.Writer, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// Assemble the header of the entry, skipping unsupported file types
+		var link string
+		switch mode := info.Mode(); {
+		case mode.IsDir(), mode.IsRegular():
+		case mode&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		// Stream the contents of regular files into the archive
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
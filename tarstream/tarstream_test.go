@@ -0,0 +1,133 @@
+package tarstream
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/karalabe/bufioprop"
+)
+
+// Tests that a directory tree is archived with its structure and contents intact.
+func TestDir(t *testing.T) {
+	root := t.TempDir()
+
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(0)).Read(data)
+
+	files := map[string][]byte{
+		"empty":         nil,
+		"small":         []byte("hello world"),
+		"sub/large":     data,
+		"sub/deep/leaf": data[:3333],
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := ioutil.WriteFile(path, content, 0o644); err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+	}
+	links := runtime.GOOS != "windows"
+	if links {
+		if err := os.Symlink("small", filepath.Join(root, "link")); err != nil {
+			t.Fatalf("failed to create symlink: %v", err)
+		}
+	}
+	// Consume the archive and ensure every entry arrived
+	r := Dir(root, 64*1024)
+	defer r.Close()
+
+	dirs := make(map[string]bool)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read archive: %v", err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			dirs[hdr.Name] = true
+		case tar.TypeSymlink:
+			if hdr.Name != "link" || hdr.Linkname != "small" {
+				t.Errorf("symlink mismatch: have %s -> %s, want link -> small", hdr.Name, hdr.Linkname)
+			}
+			links = false
+		case tar.TypeReg:
+			want, ok := files[hdr.Name]
+			if !ok {
+				t.Fatalf("unexpected file in archive: %s", hdr.Name)
+			}
+			have, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", hdr.Name, err)
+			}
+			if !bytes.Equal(have, want) {
+				t.Fatalf("%s: content mismatch: have %d bytes, want %d", hdr.Name, len(have), len(want))
+			}
+			delete(files, hdr.Name)
+		default:
+			t.Fatalf("unexpected entry type %c for %s", hdr.Typeflag, hdr.Name)
+		}
+	}
+	if len(files) > 0 {
+		t.Errorf("files missing from archive: %v", files)
+	}
+	if links {
+		t.Errorf("symlink missing from archive")
+	}
+	for _, dir := range []string{"sub/", "sub/deep/"} {
+		if !dirs[dir] {
+			t.Errorf("directory missing from archive: %s", dir)
+		}
+	}
+}
+
+// Tests that production failures are reported to the consumer, and that closing
+// the consumer aborts the production.
+func TestStreamFailures(t *testing.T) {
+	fail := errors.New("producer failure")
+	r := Stream(1024, func(tw *tar.Writer) error {
+		if err := tw.WriteHeader(&tar.Header{Name: "file", Mode: 0o644, Size: 5}); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte("hello")); err != nil {
+			return err
+		}
+		return fail
+	})
+	if _, err := ioutil.ReadAll(r); err != fail {
+		t.Fatalf("producer error mismatch: have %v, want %v", err, fail)
+	}
+	r.Close()
+
+	// Abort a producer which would never stop on its own
+	errc := make(chan error, 1)
+	r = Stream(1024, func(tw *tar.Writer) error {
+		for {
+			if err := tw.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+				errc <- err
+				return err
+			}
+		}
+	})
+	if _, err := io.ReadFull(r, make([]byte, 4096)); err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+	r.Close()
+	if err := <-errc; err != bufioprop.ErrClosedPipe {
+		t.Fatalf("aborted producer error mismatch: have %v, want %v", err, bufioprop.ErrClosedPipe)
+	}
+}
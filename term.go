@@ -0,0 +1,47 @@
+package bufioprop
+
+import "io"
+
+// A termination is the terminal state of a pipe, recorded by whichever half is
+// closed first. Later closes don't override it, so it tells why the pipe died.
+type termination struct {
+	err    error // Error the first half was closed with (never nil)
+	reader bool  // Whether the reader half was the one closed first
+}
+
+// terminate records the terminal state of the pipe, unless already terminated.
+// The writer's plain close is recorded as io.EOF, the reader's as ErrClosedPipe.
+func (p *pipe) terminate(err error, reader bool) {
+	if err == nil {
+		if reader {
+			err = ErrClosedPipe
+		} else {
+			err = io.EOF
+		}
+	}
+	p.term.CompareAndSwap(nil, &termination{err: err, reader: reader})
+}
+
+// termErr returns the error the pipe was terminated with, or nil if it's live.
+func (p *pipe) termErr() error {
+	if term := p.term.Load(); term != nil {
+		return term.err
+	}
+	return nil
+}
+
+// Err returns the error the pipe was terminated with, or nil while both halves
+// are still open. The first close decides it: io.EOF if the writer was closed
+// normally, ErrClosedPipe if the reader was, otherwise the error passed to the
+// first CloseWithError. It's safe to call concurrently with any other method.
+func (r *PipeReader) Err() error {
+	return r.p.termErr()
+}
+
+// Err returns the error the pipe was terminated with, or nil while both halves
+// are still open. The first close decides it: io.EOF if the writer was closed
+// normally, ErrClosedPipe if the reader was, otherwise the error passed to the
+// first CloseWithError. It's safe to call concurrently with any other method.
+func (w *PipeWriter) Err() error {
+	return w.p.termErr()
+}
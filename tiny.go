@@ -0,0 +1,99 @@
+package bufioprop
+
+import (
+	"io"
+	"runtime/debug"
+)
+
+// tinyCopyLimit is the maximum remaining length of a Sizer source for Copy to move
+// it synchronously, below which the goroutine and pipe setup of a buffered copy
+// costs more than the decoupling of the endpoints is worth.
+const tinyCopyLimit = 4 * 1024
+
+// tinySource returns the remaining length of src if it's small enough to copy it
+// synchronously, and the configured options don't depend on a live pipe.
+func tinySource(src io.Reader, c *config) (int, bool) {
+	sizer, ok := src.(Sizer)
+	if !ok {
+		return 0, false
+	}
+	size := sizer.Len()
+	if size > tinyCopyLimit {
+		return 0, false
+	}
+	// Options throttling, reshaping or observing the pipe need the full machinery
+	if c.sched != nil || c.budget != nil || c.block > 0 || c.retry != nil || c.report != nil || c.meter != nil ||
+		c.cancel != nil || c.sim != nil || c.name != "" || c.tag != "" || c.wipe || c.flushIdle || c.flushDelim >= 0 {
+		return 0, false
+	}
+	return size, true
+}
+
+// copyTiny copies a small source into dst on the calling goroutine, reading it in
+// full before writing it out. The semantics match those of a buffered copy: data
+// returned alongside a source failure is delivered before the failure, and panics
+// of the source are returned as a *PanicError.
+func copyTiny(dst io.Writer, src io.Reader, size int, buffer int, c *config) (written int64, err error) {
+	defer closeOwned(dst, src, c, &err)
+
+	// Reject the same buffer sizes as a buffered copy would, even if unused
+	if err := checkBuffer(capBuffer(int64(size), buffer)); err != nil {
+		return 0, err
+	}
+	data, errIn := readTiny(src, size, c)
+
+	// Push the data out, sharing the short write handling of pipes
+	if len(data) > 0 {
+		p := &pipe{stats: c.stats, shortRetries: c.shortRetries, writeRetry: c.writeRetry}
+
+		n, errOut := p.writeOut(dst, data)
+		if written = int64(n); errOut != nil {
+			return written, c.filterErr(SideWrite, errOut)
+		}
+	}
+	if errIn != nil {
+		return written, c.filterErr(SideRead, errIn)
+	}
+	return written, c.filterErr(SideWrite, finalizeOut(dst, c))
+}
+
+// readTiny reads a small source until EOF, guarding against it not progressing
+// and converting any panic into an error.
+func readTiny(src io.Reader, size int, c *config) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	// Allocate an extra byte, so a well behaved source reports EOF without growing
+	data = make([]byte, 0, size+1)
+	for empty := 0; ; {
+		if len(data) == cap(data) {
+			data = append(data, 0)[:len(data)]
+		}
+		nr, err := src.Read(data[len(data):cap(data)])
+		data = data[:len(data)+nr]
+
+		if nr == 0 && err == nil {
+			c.stats.ZeroReads.Add(1)
+			if empty++; c.emptyReads > 0 && empty >= c.emptyReads {
+				return data, io.ErrNoProgress
+			}
+		} else {
+			empty = 0
+		}
+		if nr > 0 && err != nil {
+			if err == io.EOF {
+				c.stats.EOFWithData.Add(1)
+			} else {
+				c.stats.ErrWithData.Add(1)
+			}
+		}
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return data, err
+		}
+	}
+}
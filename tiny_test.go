@@ -0,0 +1,97 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"runtime/debug"
+	"testing"
+)
+
+// stackReader is a Sizer source recording whether it was read from the goroutine
+// of the test calling the copy.
+type stackReader struct {
+	*bytes.Reader
+	inline bool
+}
+
+func (r *stackReader) Read(b []byte) (int, error) {
+	r.inline = bytes.Contains(debug.Stack(), []byte("TestCopyTiny"))
+	return r.Reader.Read(b)
+}
+
+// Tests that small sized sources are copied synchronously, and larger ones (or
+// ones with pipe dependent options) through the buffered pipe.
+func TestCopyTiny(t *testing.T) {
+	tests := []struct {
+		size   int
+		opts   []Option
+		inline bool
+	}{
+		{0, nil, true},
+		{1024, nil, true},
+		{tinyCopyLimit, []Option{WithStats(new(Stats))}, true},
+		{tinyCopyLimit + 1, nil, false},
+		{1024, []Option{WithName("tiny")}, false},
+		{1024, []Option{WithBudget(NewBufferBudget(4096, false))}, false},
+	}
+	for i, tt := range tests {
+		src := &stackReader{Reader: bytes.NewReader(testData[:tt.size])}
+		out := new(bytes.Buffer)
+
+		n, err := Copy(out, src, 64*1024, tt.opts...)
+		if err != nil {
+			t.Fatalf("test %d: failed to copy: %v", i, err)
+		}
+		if n != int64(tt.size) || !bytes.Equal(out.Bytes(), testData[:tt.size]) {
+			t.Fatalf("test %d: data mismatch: have %d bytes (reported %d), want %d", i, out.Len(), n, tt.size)
+		}
+		if src.inline != tt.inline {
+			t.Errorf("test %d: synchronous mismatch: have %v, want %v", i, src.inline, tt.inline)
+		}
+	}
+}
+
+// Tests that synchronous copies report failures the same way buffered ones do.
+func TestCopyTinyFailures(t *testing.T) {
+	// Data returned alongside a source failure is delivered first
+	fail := errors.New("source failure")
+	src := &struct {
+		io.Reader
+		Sizer
+	}{&errDataReader{data: testData[:100], chunk: 30, err: fail}, bytes.NewReader(testData[:100])}
+
+	out := new(bytes.Buffer)
+	if n, err := Copy(out, src, 1024); n != 100 || err != fail || !bytes.Equal(out.Bytes(), testData[:100]) {
+		t.Fatalf("source failure mismatch: have (%d, %v), want (100, %v)", n, err, fail)
+	}
+	// Panics of the source are converted into errors
+	panicky := &struct {
+		io.Reader
+		Sizer
+	}{&panickingReader{left: 10}, bytes.NewReader(nil)}
+
+	var perr *PanicError
+	if _, err := Copy(ioutil.Discard, panicky, 1024); !errors.As(err, &perr) {
+		t.Fatalf("panic error mismatch: have %v, want *PanicError", err)
+	}
+	// Destinations failures and invalid buffers are surfaced
+	if _, err := Copy(&failingWriter{limit: 10, err: fail}, bytes.NewReader(testData[:100]), 1024); err != fail {
+		t.Fatalf("destination failure mismatch: have %v, want %v", err, fail)
+	}
+	if _, err := Copy(ioutil.Discard, bytes.NewReader(testData[:100]), -1); err != ErrInvalidBuffer {
+		t.Fatalf("buffer error mismatch: have %v, want %v", err, ErrInvalidBuffer)
+	}
+}
+
+// Benchmarks tiny copies, dominated by the setup costs.
+func BenchmarkCopyTiny1KB(b *testing.B) {
+	data := testData[:1024]
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Copy(ioutil.Discard, bytes.NewReader(data), 64*1024)
+	}
+}
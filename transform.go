@@ -0,0 +1,100 @@
+package bufioprop
+
+import "io"
+
+// A TransformFunc converts a stream of bytes on the fly while it's moved from a
+// pipe's internal buffer into the destination writer.
+//
+// The function receives a scratch output buffer dst and a contiguous view src
+// of the buffered input, returning the number of bytes produced into dst and
+// the number consumed from src. Any input not consumed will be presented again
+// in the next invocation, so if dst fills up, the transform should simply stop
+// and report how far it got. The transform must make progress on every call;
+// lookahead across invocations needs to be buffered internally.
+//
+// When the input is exhausted, the transform is invoked with an empty src to
+// flush any internally held state, repeatedly, until it produces no more output.
+type TransformFunc func(dst, src []byte) (nDst, nSrc int, err error)
+
+// CopyFunc copies from src to dst until either EOF is reached on src or an error
+// occurs, passing all data through the transform function. It returns the number
+// of transformed bytes written into dst and the first error encountered.
+//
+// The transform runs on the consumer goroutine of the copy, so no additional
+// goroutine or pipe is needed for simple byte-level conversions.
+func CopyFunc(dst io.Writer, src io.Reader, buffer int, transform TransformFunc, opts ...Option) (written int64, err error) {
+	c := newConfig(opts)
+	return copyPipe(dst, src, buffer, c, func(pr *PipeReader) (int64, error) {
+		scratch := make([]byte, transformBuffer(buffer))
+		return pr.p.transformTo(dst, transform, scratch)
+	})
+}
+
+// transformBuffer calculates the size of the scratch buffer the transformations
+// are written into before passing them on to the destination.
+func transformBuffer(buffer int) int {
+	buffer = bufferSize(buffer)
+	if buffer > 32*1024 {
+		return 32 * 1024
+	}
+	return buffer
+}
+
+// TransformTo keeps pushing data through the transformation function and into
+// the writer until the source is closed or fails.
+func (p *pipe) transformTo(w io.Writer, fn TransformFunc, scratch []byte) (written int64, err error) {
+	p.flushInto(w)
+	for {
+		// Wait until some data becomes available
+		safeFree, err := p.outputWait()
+		if err != nil {
+			if err == io.EOF {
+				return p.transformFlush(w, fn, scratch, written)
+			}
+			return written, err
+		}
+		// Transform all the contiguous data and push it into the writer
+		limit := p.outPos + p.size - safeFree
+		if limit > p.size {
+			limit = p.size
+		}
+		for src := p.buffer[p.outPos:limit]; len(src) > 0; {
+			nDst, nSrc, err := fn(scratch, src)
+			if nDst > 0 {
+				nw, err := p.writeOut(w, scratch[:nDst])
+				written += int64(nw)
+				if err != nil {
+					return written, err
+				}
+			}
+			if nSrc > 0 {
+				p.outputAdvance(nSrc)
+				src = src[nSrc:]
+			}
+			if err != nil {
+				return written, err
+			}
+			if nDst == 0 && nSrc == 0 {
+				return written, io.ErrNoProgress
+			}
+		}
+	}
+}
+
+// TransformFlush drains any internally held state of the transformation function
+// after the input stream has been exhausted.
+func (p *pipe) transformFlush(w io.Writer, fn TransformFunc, scratch []byte, written int64) (int64, error) {
+	for {
+		nDst, _, err := fn(scratch, nil)
+		if nDst > 0 {
+			nw, err := p.writeOut(w, scratch[:nDst])
+			written += int64(nw)
+			if err != nil {
+				return written, err
+			}
+		}
+		if err != nil || nDst == 0 {
+			return written, err
+		}
+	}
+}
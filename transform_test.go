@@ -0,0 +1,71 @@
+package bufioprop
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// xorTransform creates a transformation flipping all bits with the given mask.
+func xorTransform(mask byte) TransformFunc {
+	return func(dst, src []byte) (int, int, error) {
+		n := copy(dst, src)
+		for i := 0; i < n; i++ {
+			dst[i] ^= mask
+		}
+		return n, n, nil
+	}
+}
+
+// Tests that a stream transformation is applied to all the data.
+func TestCopyFunc(t *testing.T) {
+	data := testData[:1024*1024]
+
+	enc := new(bytes.Buffer)
+	if n, err := CopyFunc(enc, bytes.NewReader(data), 3333, xorTransform(0x5a)); err != nil {
+		t.Fatalf("failed to encode data: %v", err)
+	} else if int(n) != len(data) {
+		t.Fatalf("encoded length mismatch: have %d, want %d", n, len(data))
+	}
+	dec := new(bytes.Buffer)
+	if _, err := CopyFunc(dec, enc, 4444, xorTransform(0x5a)); err != nil {
+		t.Fatalf("failed to decode data: %v", err)
+	}
+	if !bytes.Equal(dec.Bytes(), data) {
+		t.Fatalf("round trip data mismatch")
+	}
+}
+
+// Tests that the transform is given a chance to flush its state at the end.
+func TestCopyFuncFlush(t *testing.T) {
+	flushed := false
+	trailer := func(dst, src []byte) (int, int, error) {
+		if len(src) == 0 {
+			if flushed {
+				return 0, 0, nil
+			}
+			flushed = true
+			return copy(dst, "!"), 0, nil
+		}
+		n := copy(dst, src)
+		return n, n, nil
+	}
+	out := new(bytes.Buffer)
+	if _, err := CopyFunc(out, bytes.NewReader([]byte("hello")), 128, trailer); err != nil {
+		t.Fatalf("failed to copy data: %v", err)
+	}
+	if out.String() != "hello!" {
+		t.Fatalf("flushed output mismatch: have %q, want %q", out.String(), "hello!")
+	}
+}
+
+// Tests that transformation failures abort the copy.
+func TestCopyFuncError(t *testing.T) {
+	fail := errors.New("transform failed")
+	broken := func(dst, src []byte) (int, int, error) {
+		return 0, 0, fail
+	}
+	if _, err := CopyFunc(new(bytes.Buffer), bytes.NewReader(testData), 1024, broken); err != fail {
+		t.Fatalf("error mismatch: have %v, want %v", err, fail)
+	}
+}
@@ -0,0 +1,133 @@
+package bufioprop
+
+// Available returns the number of bytes that can currently be written into the
+// pipe without blocking, or 0 if the pipe is closed or the writer is paused. As
+// the reader concurrently frees up space, the value is only a lower bound by the
+// time it's used.
+func (w *PipeWriter) Available() int {
+	if closed(w.p.inQuit) || closed(w.p.outQuit) || w.p.inPause.paused.Load() {
+		return 0
+	}
+	return int(w.p.freeSpace())
+}
+
+// Len returns the number of bytes written into the pipe but not yet read out of
+// it. As the reader concurrently consumes data, the value is only an upper bound
+// by the time it's used.
+func (w *PipeWriter) Len() int {
+	return int(w.p.size - w.p.freeSpace())
+}
+
+// Cap returns the size of the pipe's internal buffer, the largest chunk a single
+// write can place into the pipe at once. Producers can use it to size the frames
+// they generate, so that a whole frame fits once the reader catches up.
+func (w *PipeWriter) Cap() int {
+	return int(w.p.size)
+}
+
+// TryWrite writes as much of data into the pipe as fits without blocking,
+// returning the number of bytes written and whether all of data was accepted.
+// It suits event-loop style producers, which need to queue the remainder
+// elsewhere instead of parking when the buffer is full.
+//
+// If the pipe is closed, nothing is written; the failure can be retrieved via a
+// subsequent Write. Note, a pipe joined to a bandwidth Scheduler may still be
+// throttled to its share after the data is written.
+func (w *PipeWriter) TryWrite(data []byte) (n int, ok bool) {
+	w.p.inOwner.acquire("TryWrite")
+	defer w.p.inOwner.release()
+
+	return w.p.tryWrite(data)
+}
+
+// TryWrite fills the internal buffer with as much data as fits, without waiting
+// for any space to be freed up.
+func (p *pipe) tryWrite(b []byte) (int, bool) {
+	if p.reserving {
+		return 0, false
+	}
+	if p.discarding() {
+		return len(b), true
+	}
+	if closed(p.inQuit) || closed(p.outQuit) || p.inPause.paused.Load() {
+		return 0, false
+	}
+	p.wakeBuffer()
+	defer p.sleepBuffer()
+
+	var written int
+	for safeFree := p.freeSpace(); len(b) > 0 && safeFree > 0; {
+		// Fill the buffer either till the reader position, or the end
+		limit := p.inPos + safeFree
+		if limit > p.size {
+			limit = p.size
+		}
+		if limit > p.inPos+int32(len(b)) {
+			limit = p.inPos + int32(len(b))
+		}
+		nr := copy(p.buffer[p.inPos:limit], b)
+		b, written, safeFree = b[nr:], written+nr, safeFree-int32(nr)
+
+		// Update the pipe input state and continue with any wrapped segment
+		p.inputAdvance(nr)
+	}
+	return written, len(b) == 0
+}
+
+// TryRead reads any data readily available in the pipe without blocking. If the
+// buffer is empty but the writer is still live, it returns immediately with ok
+// set to false. Otherwise ok is true and the results match those of Read, with
+// io.EOF (or the writer's close error) reported once all the data is consumed.
+//
+// It suits pollers integrating the pipe into select based state machines, which
+// cannot afford to park in a blocking Read.
+func (r *PipeReader) TryRead(data []byte) (n int, ok bool, err error) {
+	r.p.outOwner.acquire("TryRead")
+	defer r.p.outOwner.release()
+
+	r.p.release()
+	return r.p.tryRead(data)
+}
+
+// TryRead retrieves as much data from the internal buffer as available, without
+// waiting for any to arrive.
+func (p *pipe) tryRead(b []byte) (int, bool, error) {
+	if closed(p.outQuit) {
+		return 0, true, ErrClosedPipe
+	}
+	if p.outPause.paused.Load() {
+		return 0, false, nil
+	}
+	if p.aborted.Load() {
+		p.outputClose(nil)
+		return 0, true, p.termErr()
+	}
+	safeFree := p.freeSpace()
+	if safeFree == p.size {
+		// Nothing buffered, check whether anything more may arrive
+		if !closed(p.inQuit) {
+			return 0, false, nil
+		}
+		if safeFree = p.freeSpace(); safeFree == p.size {
+			p.outputClose(nil)
+			return 0, true, p.termErr()
+		}
+	}
+	var read int
+	for avail := p.size - safeFree; len(b) > 0 && avail > 0; {
+		// Retrieve either till the writer position, or the end
+		limit := p.outPos + avail
+		if limit > p.size {
+			limit = p.size
+		}
+		if limit > p.outPos+int32(len(b)) {
+			limit = p.outPos + int32(len(b))
+		}
+		nr := copy(b, p.buffer[p.outPos:limit])
+		b, read, avail = b[nr:], read+nr, avail-int32(nr)
+
+		// Update the pipe output state and continue with any wrapped segment
+		p.outputAdvance(nr)
+	}
+	return read, true, nil
+}
@@ -0,0 +1,349 @@
+package bufioprop
+
+import (
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// Linux io_uring constants used by the pipe's file backend (kernel 5.6+).
+const (
+	sysIOUringSetup = 425
+	sysIOUringEnter = 426
+
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+
+	uringFeatSingleMmap = 1 << 0
+	uringFeatRWCurPos   = 1 << 3
+
+	uringEnterGetEvents = 1 << 0
+
+	uringOpRead  = 22
+	uringOpWrite = 23
+
+	uringSQELink = 1 << 2
+
+	uringEntries = 4 // At most two ring segments are in flight at once
+)
+
+// errUringUnsupported is returned if the kernel's io_uring lacks the features
+// needed by the pipe backend.
+var errUringUnsupported = errors.New("bufio: io_uring not supported")
+
+// uringParams is the kernel's struct io_uring_params.
+type uringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFd         uint32
+	resv         [3]uint32
+	sqOff        uringSQOffsets
+	cqOff        uringCQOffsets
+}
+
+// uringSQOffsets is the kernel's struct io_sqring_offsets.
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+// uringCQOffsets is the kernel's struct io_cqring_offsets.
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+// uringSQE is the kernel's struct io_uring_sqe.
+type uringSQE struct {
+	opcode   uint8
+	flags    uint8
+	ioprio   uint16
+	fd       int32
+	off      uint64
+	addr     uint64
+	len      uint32
+	rwFlags  uint32
+	userData uint64
+	pad      [3]uint64
+}
+
+// uringCQE is the kernel's struct io_uring_cqe.
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// A uring is a minimal io_uring instance, submitting batches of linked reads or
+// writes and waiting for all of them to complete.
+type uring struct {
+	fd int
+
+	sqRing []byte // Submission queue ring memory
+	cqRing []byte // Completion queue ring memory (may alias sqRing)
+	sqeMem []byte // Submission queue entry memory
+
+	sqTail  *uint32
+	sqMask  uint32
+	sqArray unsafe.Pointer
+	sqes    unsafe.Pointer
+
+	cqHead *uint32
+	cqTail *uint32
+	cqMask uint32
+	cqes   unsafe.Pointer
+}
+
+// newUring sets up a new io_uring instance, mapping its queues into memory.
+func newUring() (*uring, error) {
+	var params uringParams
+	fd, _, errno := syscall.Syscall(sysIOUringSetup, uringEntries, uintptr(unsafe.Pointer(&params)), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	u := &uring{fd: int(fd)}
+	if params.features&uringFeatRWCurPos == 0 {
+		u.close()
+		return nil, errUringUnsupported
+	}
+	// Map the submission and completion queues
+	sqSize := int(params.sqOff.array + params.sqEntries*4)
+	cqSize := int(params.cqOff.cqes + params.cqEntries*uint32(unsafe.Sizeof(uringCQE{})))
+	if params.features&uringFeatSingleMmap != 0 && cqSize > sqSize {
+		sqSize = cqSize
+	}
+	var err error
+	if u.sqRing, err = syscall.Mmap(u.fd, uringOffSQRing, sqSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE); err != nil {
+		u.close()
+		return nil, err
+	}
+	u.cqRing = u.sqRing
+	if params.features&uringFeatSingleMmap == 0 {
+		if u.cqRing, err = syscall.Mmap(u.fd, uringOffCQRing, cqSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE); err != nil {
+			u.close()
+			return nil, err
+		}
+	}
+	sqeSize := int(params.sqEntries) * int(unsafe.Sizeof(uringSQE{}))
+	if u.sqeMem, err = syscall.Mmap(u.fd, uringOffSQEs, sqeSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE); err != nil {
+		u.close()
+		return nil, err
+	}
+	// Resolve all the ring fields from their offsets
+	u.sqTail = (*uint32)(unsafe.Pointer(&u.sqRing[params.sqOff.tail]))
+	u.sqMask = *(*uint32)(unsafe.Pointer(&u.sqRing[params.sqOff.ringMask]))
+	u.sqArray = unsafe.Pointer(&u.sqRing[params.sqOff.array])
+	u.sqes = unsafe.Pointer(&u.sqeMem[0])
+
+	u.cqHead = (*uint32)(unsafe.Pointer(&u.cqRing[params.cqOff.head]))
+	u.cqTail = (*uint32)(unsafe.Pointer(&u.cqRing[params.cqOff.tail]))
+	u.cqMask = *(*uint32)(unsafe.Pointer(&u.cqRing[params.cqOff.ringMask]))
+	u.cqes = unsafe.Pointer(&u.cqRing[params.cqOff.cqes])
+
+	return u, nil
+}
+
+// close unmaps the queues and releases the io_uring instance.
+func (u *uring) close() {
+	if u.sqeMem != nil {
+		syscall.Munmap(u.sqeMem)
+	}
+	if u.cqRing != nil && &u.cqRing[0] != &u.sqRing[0] {
+		syscall.Munmap(u.cqRing)
+	}
+	if u.sqRing != nil {
+		syscall.Munmap(u.sqRing)
+	}
+	syscall.Close(u.fd)
+}
+
+// transfer submits a linked chain of reads or writes on the file descriptor at
+// its current position, one for each non-empty segment, waiting for all to
+// complete. The results are the kernel's return values (bytes or -errno); if an
+// operation came up short, the rest of the chain is cancelled.
+func (u *uring) transfer(opcode uint8, fd uintptr, segments [2][]byte) (results [2]int32, err error) {
+	tail := atomic.LoadUint32(u.sqTail)
+
+	count := 0
+	for _, seg := range segments {
+		if len(seg) == 0 {
+			break
+		}
+		index := tail & u.sqMask
+		sqe := (*uringSQE)(unsafe.Add(u.sqes, uintptr(index)*unsafe.Sizeof(uringSQE{})))
+		*sqe = uringSQE{
+			opcode:   opcode,
+			fd:       int32(fd),
+			off:      ^uint64(0), // current file position
+			addr:     uint64(uintptr(unsafe.Pointer(&seg[0]))),
+			len:      uint32(len(seg)),
+			userData: uint64(count),
+		}
+		*(*uint32)(unsafe.Add(u.sqArray, uintptr(index)*4)) = index
+		tail++
+		count++
+	}
+	if count == 2 {
+		sqe := (*uringSQE)(unsafe.Add(u.sqes, uintptr((tail-2)&u.sqMask)*unsafe.Sizeof(uringSQE{})))
+		sqe.flags = uringSQELink
+	}
+	atomic.StoreUint32(u.sqTail, tail)
+
+	// Submit the chain and wait for all of it to complete
+	submit := count
+	for done := 0; done < count; {
+		n, _, errno := syscall.Syscall6(sysIOUringEnter, uintptr(u.fd), uintptr(submit), uintptr(count-done), uringEnterGetEvents, 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return results, errno
+		}
+		submit -= int(n)
+
+		head, ctail := atomic.LoadUint32(u.cqHead), atomic.LoadUint32(u.cqTail)
+		for ; head != ctail; head++ {
+			cqe := (*uringCQE)(unsafe.Add(u.cqes, uintptr(head&u.cqMask)*unsafe.Sizeof(uringCQE{})))
+			results[cqe.userData] = cqe.res
+			done++
+		}
+		atomic.StoreUint32(u.cqHead, head)
+	}
+	runtime.KeepAlive(segments)
+	return results, nil
+}
+
+// regularFile reports whether f is a regular file, the only kind the io_uring
+// backend handles. Pipes, FIFOs and sockets are left to the runtime poller, as
+// their transfers may block indefinitely, and must stay interruptible by the
+// deadlines cancellation relies on (which f.Fd would disable by switching the
+// descriptor into blocking mode).
+func regularFile(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode().IsRegular()
+}
+
+// readFromFile keeps fetching data from a file into the internal buffer via
+// io_uring, reading both free segments of a wrapped buffer in a single syscall.
+// If io_uring is unavailable or f is not a regular file, handled is false and
+// nothing was read.
+func (p *pipe) readFromFile(f *os.File) (read int64, err error, handled bool) {
+	if !regularFile(f) {
+		return 0, nil, false
+	}
+	u, err := newUring()
+	if err != nil {
+		return 0, nil, false
+	}
+	defer u.close()
+	defer runtime.KeepAlive(f)
+
+	fd := f.Fd()
+	for {
+		// Wait until some space frees up
+		safeFree, err := p.inputWait()
+		if err != nil {
+			return read, err, true
+		}
+		var segments [2][]byte
+		if limit := p.inPos + safeFree; limit <= p.size {
+			segments[0] = p.buffer[p.inPos:limit]
+		} else {
+			segments[0], segments[1] = p.buffer[p.inPos:], p.buffer[:limit-p.size]
+		}
+		results, err := u.transfer(uringOpRead, fd, segments)
+		if err != nil {
+			return read, err, true
+		}
+		// Advance over the read data, stopping at the first short read
+		for i, seg := range segments {
+			if len(seg) == 0 {
+				break
+			}
+			res := results[i]
+			if res < 0 {
+				if i > 0 && syscall.Errno(-res) == syscall.ECANCELED {
+					break
+				}
+				return read, syscall.Errno(-res), true
+			}
+			if res == 0 {
+				return read, nil, true // end of file
+			}
+			read += int64(res)
+			p.inputAdvance(int(res))
+			if int(res) < len(seg) {
+				break
+			}
+		}
+	}
+}
+
+// writeChunksFile pushes the contiguous segments of the internal buffer into a
+// file via io_uring, writing both segments of a wrapped buffer in a single call.
+// If io_uring is unavailable or f is not a regular file, handled is false and
+// nothing was written.
+func (p *pipe) writeChunksFile(f *os.File) (written int64, err error, handled bool) {
+	if !regularFile(f) {
+		return 0, nil, false
+	}
+	u, err := newUring()
+	if err != nil {
+		return 0, nil, false
+	}
+	defer u.close()
+	defer runtime.KeepAlive(f)
+
+	fd := f.Fd()
+	for {
+		// Wait until some data becomes available
+		safeFree, err := p.outputWait()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return written, err, true
+		}
+		var segments [2][]byte
+		if limit := p.outPos + p.size - safeFree; limit <= p.size {
+			segments[0] = p.buffer[p.outPos:limit]
+		} else {
+			segments[0], segments[1] = p.buffer[p.outPos:], p.buffer[:limit-p.size]
+		}
+		results, err := u.transfer(uringOpWrite, fd, segments)
+		if err != nil {
+			return written, err, true
+		}
+		// Advance over the written data, stopping at the first short write
+		for i, seg := range segments {
+			if len(seg) == 0 {
+				break
+			}
+			res := results[i]
+			if res < 0 {
+				if i > 0 && syscall.Errno(-res) == syscall.ECANCELED {
+					break
+				}
+				return written, syscall.Errno(-res), true
+			}
+			written += int64(res)
+			p.outputAdvance(int(res))
+			if int(res) < len(seg) {
+				p.stats.ShortWrites.Add(1)
+				if res == 0 {
+					return written, &ShortWriteError{Written: 0, Wanted: len(seg)}, true
+				}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package bufioprop
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Tests that file to file copies through the io_uring backend work, including
+// all the buffer wraparound cases.
+func TestCopyIOUring(t *testing.T) {
+	u, err := newUring()
+	if err != nil {
+		t.Skipf("io_uring unavailable: %v", err)
+	}
+	u.close()
+
+	dir := t.TempDir()
+	data := testData[:4*1024*1024+13]
+
+	srcPath, dstPath := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := ioutil.WriteFile(srcPath, data, 0600); err != nil {
+		t.Fatalf("failed to create source file: %v", err)
+	}
+	for _, buffer := range []int{3333, 65536, 333333} {
+		src, err := os.Open(srcPath)
+		if err != nil {
+			t.Fatalf("failed to open source file: %v", err)
+		}
+		dst, err := os.Create(dstPath)
+		if err != nil {
+			t.Fatalf("failed to create destination file: %v", err)
+		}
+		n, err := Copy(dst, src, buffer, WithIOUring())
+		src.Close()
+		dst.Close()
+
+		if err != nil {
+			t.Fatalf("buffer %d: failed to copy data: %v", buffer, err)
+		}
+		if int(n) != len(data) {
+			t.Fatalf("buffer %d: data length mismatch: have %d, want %d", buffer, n, len(data))
+		}
+		copied, err := ioutil.ReadFile(dstPath)
+		if err != nil {
+			t.Fatalf("failed to read destination file: %v", err)
+		}
+		if !bytes.Equal(copied, data) {
+			t.Fatalf("buffer %d: data mismatch", buffer)
+		}
+	}
+}
+
+// Tests that non-regular files (e.g. pipes) bypass the io_uring backend, staying
+// interruptible by cancellation.
+func TestCopyIOUringPipeCancel(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create os pipe: %v", err)
+	}
+	defer pw.Close()
+	defer pr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := CopyContext(ctx, ioutil.Discard, pr, 4096, WithIOUring())
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("canceled copy stuck reading the pipe")
+	}
+}
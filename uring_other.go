@@ -0,0 +1,15 @@
+//go:build !linux
+
+package bufioprop
+
+import "os"
+
+// readFromFile is the io_uring file reader, unavailable on this platform.
+func (p *pipe) readFromFile(f *os.File) (read int64, err error, handled bool) {
+	return 0, nil, false
+}
+
+// writeChunksFile is the io_uring file writer, unavailable on this platform.
+func (p *pipe) writeChunksFile(f *os.File) (written int64, err error, handled bool) {
+	return 0, nil, false
+}
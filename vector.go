@@ -0,0 +1,58 @@
+package bufioprop
+
+import (
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+// vectorConn returns the raw connection of endpoints known to be plain file
+// descriptors, which are safe to drive via vectored syscalls directly.
+func vectorConn(endpoint interface{}) syscall.RawConn {
+	var (
+		rc  syscall.RawConn
+		err error
+	)
+	switch e := endpoint.(type) {
+	case *os.File:
+		rc, err = e.SyscallConn()
+	case *net.TCPConn:
+		rc, err = e.SyscallConn()
+	case *net.UnixConn:
+		rc, err = e.SyscallConn()
+	default:
+		return nil
+	}
+	if err != nil {
+		return nil
+	}
+	return rc
+}
+
+// writeVector writes the two segments of a wrapped buffer into w with a single
+// vectored call if w supports it. If it doesn't, ok is false and nothing was
+// written.
+func writeVector(w io.Writer, first, second []byte) (n int, err error, ok bool) {
+	switch w.(type) {
+	case *net.TCPConn, *net.UnixConn:
+		// Network connections support writev on all platforms via net.Buffers
+		buffers := net.Buffers{first, second}
+		nw, err := buffers.WriteTo(w)
+		return int(nw), err, true
+	}
+	if rc := vectorConn(w); rc != nil {
+		return writev(rc, first, second)
+	}
+	return 0, nil, false
+}
+
+// readVector reads from r into the two segments of a wrapped buffer with a single
+// vectored call if r supports it. An io.EOF is returned if the source ran dry.
+// If r doesn't support vectored reads, ok is false and nothing was read.
+func readVector(r io.Reader, first, second []byte) (n int, err error, ok bool) {
+	if rc := vectorConn(r); rc != nil {
+		return readv(rc, first, second)
+	}
+	return 0, nil, false
+}
@@ -0,0 +1,62 @@
+package bufioprop
+
+import (
+	"io"
+	"syscall"
+	"unsafe"
+)
+
+// writev writes two segments into a raw connection via a single writev syscall.
+func writev(rc syscall.RawConn, first, second []byte) (n int, err error, ok bool) {
+	iovecs := iovecPair(first, second)
+	cerr := rc.Write(func(fd uintptr) bool {
+		r, _, errno := syscall.Syscall(syscall.SYS_WRITEV, fd, uintptr(unsafe.Pointer(&iovecs[0])), 2)
+		if errno == syscall.EAGAIN {
+			return false // wait for the poller
+		}
+		if errno == syscall.EINTR {
+			return false
+		}
+		if errno != 0 {
+			err = errno
+			return true
+		}
+		n = int(r)
+		return true
+	})
+	if err == nil {
+		err = cerr
+	}
+	return n, err, true
+}
+
+// readv reads from a raw connection into two segments via a single readv syscall.
+func readv(rc syscall.RawConn, first, second []byte) (n int, err error, ok bool) {
+	iovecs := iovecPair(first, second)
+	cerr := rc.Read(func(fd uintptr) bool {
+		r, _, errno := syscall.Syscall(syscall.SYS_READV, fd, uintptr(unsafe.Pointer(&iovecs[0])), 2)
+		if errno == syscall.EAGAIN || errno == syscall.EINTR {
+			return false // wait for the poller or retry
+		}
+		if errno != 0 {
+			err = errno
+			return true
+		}
+		if n = int(r); n == 0 {
+			err = io.EOF
+		}
+		return true
+	})
+	if err == nil {
+		err = cerr
+	}
+	return n, err, true
+}
+
+// iovecPair assembles the syscall descriptors of two memory segments.
+func iovecPair(first, second []byte) [2]syscall.Iovec {
+	iovecs := [2]syscall.Iovec{{Base: &first[0]}, {Base: &second[0]}}
+	iovecs[0].SetLen(len(first))
+	iovecs[1].SetLen(len(second))
+	return iovecs
+}
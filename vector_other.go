@@ -0,0 +1,15 @@
+//go:build !linux
+
+package bufioprop
+
+import "syscall"
+
+// writev is the vectored file writer, unavailable on this platform.
+func writev(rc syscall.RawConn, first, second []byte) (n int, err error, ok bool) {
+	return 0, nil, false
+}
+
+// readv is the vectored file reader, unavailable on this platform.
+func readv(rc syscall.RawConn, first, second []byte) (n int, err error, ok bool) {
+	return 0, nil, false
+}
@@ -0,0 +1,87 @@
+package bufioprop
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that copying between file descriptors, where the wrapped buffer segments
+// are transferred via vectored I/O, works.
+func TestCopyVectoredFiles(t *testing.T) {
+	dir := t.TempDir()
+	data := testData[:4*1024*1024+13]
+
+	srcPath, dstPath := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := ioutil.WriteFile(srcPath, data, 0600); err != nil {
+		t.Fatalf("failed to create source file: %v", err)
+	}
+	for _, buffer := range []int{3333, 333333} {
+		src, _ := os.Open(srcPath)
+		dst, _ := os.Create(dstPath)
+
+		n, err := Copy(dst, src, buffer)
+		src.Close()
+		dst.Close()
+
+		if err != nil || int(n) != len(data) {
+			t.Fatalf("buffer %d: copy failed: n %d, err %v", buffer, n, err)
+		}
+		if copied, _ := ioutil.ReadFile(dstPath); !bytes.Equal(copied, data) {
+			t.Fatalf("buffer %d: data mismatch", buffer)
+		}
+	}
+}
+
+// Tests that copying between network connections, where the wrapped buffer
+// segments are transferred via vectored I/O, works.
+func TestCopyVectoredConns(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	data := testData[:4*1024*1024+13]
+
+	// Connect a source and a sink to the listener
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			return
+		}
+		conn.Write(data)
+		conn.Close()
+	}()
+	src, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept source: %v", err)
+	}
+	defer src.Close()
+
+	sink := make(chan []byte)
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			sink <- nil
+			return
+		}
+		blob, _ := ioutil.ReadAll(conn)
+		sink <- blob
+	}()
+	dst, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept destination: %v", err)
+	}
+	if n, err := Copy(dst, src, 3333); err != nil || int(n) != len(data) {
+		t.Fatalf("copy failed: n %d, err %v", n, err)
+	}
+	dst.Close()
+
+	if !bytes.Equal(<-sink, data) {
+		t.Fatalf("data mismatch")
+	}
+}
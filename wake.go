@@ -0,0 +1,51 @@
+package bufioprop
+
+import "github.com/karalabe/bufioprop/spsc"
+
+// WakeStrategy selects how a sleeping side of a pipe is notified of progress
+// made by the other side.
+type WakeStrategy int
+
+const (
+	// WakeEdge signals progress via single-slot channels. Every advance posts a
+	// (non-blocking) notification, which the sleeper consumes upon waking. This
+	// is cheap on the signaling side, but may cause spurious wakeups.
+	WakeEdge WakeStrategy = iota
+
+	// WakeLevel parks the sleeper on a condition variable, which is rechecked
+	// against the buffer state before returning. Advances only take the lock if
+	// there is a sleeper, but a signal is more expensive than a channel post.
+	WakeLevel
+)
+
+// String implements fmt.Stringer.
+func (s WakeStrategy) String() string {
+	switch s {
+	case WakeEdge:
+		return "edge"
+	case WakeLevel:
+		return "level"
+	default:
+		return "unknown"
+	}
+}
+
+// newWaker creates a waiter implementing the requested signaling strategy. The
+// pipe does its own spinning before parking, accounting stalls and running the
+// simulation hooks in between, so the waiter itself parks straight away.
+func newWaker(strategy WakeStrategy) *spsc.Waiter {
+	if strategy == WakeLevel {
+		return spsc.NewWaiter(spsc.Level, 0)
+	}
+	return spsc.NewWaiter(spsc.Edge, 0)
+}
+
+// closed checks whether a quit channel has already been closed.
+func closed(quit <-chan struct{}) bool {
+	select {
+	case <-quit:
+		return true
+	default:
+		return false
+	}
+}
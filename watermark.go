@@ -0,0 +1,45 @@
+package bufioprop
+
+import "time"
+
+// inputWaitMark throttles the ReadFrom producer between the configured watermarks.
+// Once the buffer's occupancy reaches the high mark, it waits until the reader
+// drains it down to the low mark. It returns the free space the producer may fill
+// without exceeding the high mark.
+func (p *pipe) inputWaitMark(safeFree int32) (int32, error) {
+	if p.size-safeFree >= p.highMark {
+		start := time.Now()
+		p.flushOutputSignal()
+		for {
+			safeFree = p.freeSpace()
+			if p.size-safeFree <= p.lowMark {
+				break
+			}
+			p.inWake.Wait(&p.tail, p.head.Load()-uint64(p.size-safeFree))
+			if closed(p.outQuit) || closed(p.inQuit) {
+				p.stats.WriterStall.Add(int64(time.Since(start)))
+				return safeFree, ErrClosedPipe
+			}
+		}
+		p.stats.WriterStall.Add(int64(time.Since(start)))
+	}
+	return safeFree - (p.size - p.highMark), nil
+}
+
+// watermarks sanitizes the user configured watermarks to the buffer size,
+// returning zeroes if throttling is disabled.
+func watermarks(low, high int, size int32) (int32, int32) {
+	if high <= 0 {
+		return 0, 0
+	}
+	if high > int(size) {
+		high = int(size)
+	}
+	if low < 0 {
+		low = 0
+	}
+	if low >= high {
+		low = high - 1
+	}
+	return int32(low), int32(high)
+}
@@ -0,0 +1,70 @@
+package bufioprop
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// markedReader is a source checking that the pipe it's feeding is only read into
+// between the watermarks.
+type markedReader struct {
+	t    *testing.T
+	p    *pipe
+	data []byte
+
+	low, high int
+	full      bool // Whether the last read filled the buffer up to the high mark
+	fills     int  // Number of times the buffer was filled up to the high mark
+}
+
+func (r *markedReader) Read(b []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	used := int(r.p.size - r.p.freeSpace())
+	if used+len(b) > r.high {
+		r.t.Errorf("read beyond high mark: %d buffered, %d requested, high %d", used, len(b), r.high)
+	}
+	if r.full && used > r.low {
+		r.t.Errorf("read resumed above low mark: %d buffered, low %d", used, r.low)
+	}
+	if len(b) > 7 {
+		b = b[:7]
+	}
+	n := copy(b, r.data)
+	r.data = r.data[n:]
+	if r.full = used+n >= r.high; r.full {
+		r.fills++
+	}
+	return n, nil
+}
+
+// Tests that the ReadFrom producer is throttled between the watermarks.
+func TestPipeWatermarks(t *testing.T) {
+	r, w := Pipe(100, WithWatermarks(20, 50))
+	src := &markedReader{t: t, p: r.p, data: testData[:10000], low: 20, high: 50}
+
+	go func() {
+		w.ReadFrom(src)
+		w.Close()
+	}()
+	// Consume slowly so that the producer repeatedly hits the high mark
+	have := new(bytes.Buffer)
+	buf := make([]byte, 13)
+	for {
+		n, err := r.Read(buf)
+		have.Write(buf[:n])
+		if err != nil {
+			break
+		}
+		time.Sleep(10 * time.Microsecond)
+	}
+	if !bytes.Equal(have.Bytes(), testData[:10000]) {
+		t.Fatalf("data mismatch: have %d bytes, want %d", have.Len(), 10000)
+	}
+	if src.fills == 0 {
+		t.Fatalf("producer never reached the high mark")
+	}
+}
@@ -0,0 +1,20 @@
+package bufioprop
+
+// wipeConsumed zeroes the count bytes at the reader's position in the internal
+// buffer, wrapping around the end of the ring if needed.
+func (p *pipe) wipeConsumed(count int) {
+	end := int(p.outPos) + count
+	if end <= int(p.size) {
+		wipe(p.buffer[p.outPos:end])
+		return
+	}
+	wipe(p.buffer[p.outPos:])
+	wipe(p.buffer[:end-int(p.size)])
+}
+
+// wipe zeroes out the contents of a byte slice.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
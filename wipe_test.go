@@ -0,0 +1,50 @@
+package bufioprop
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Tests that pipes with secure wiping zero out consumed data, also across the end
+// of the ring, and everything left unread once closed.
+func TestSecureWipe(t *testing.T) {
+	buf := make([]byte, 16)
+	r, w := PipeWithBuffer(buf, WithSecureWipe())
+
+	// Consume part of the data, only that should be wiped
+	w.Write([]byte("0123456789abc"))
+	r.Read(make([]byte, 10))
+	if want := []byte("\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00abc\x00\x00\x00"); !bytes.Equal(buf, want) {
+		t.Fatalf("partial consumption mismatch: have %q, want %q", buf, want)
+	}
+	// Wrap the data around the end of the ring and consume it in one go
+	w.Write([]byte("defgh"))
+	if n, _ := r.Read(make([]byte, 16)); n != 6 {
+		t.Fatalf("read length mismatch: have %d, want %d", n, 6)
+	}
+	r.Read(make([]byte, 16))
+	if !bytes.Equal(buf, make([]byte, 16)) {
+		t.Fatalf("wrapped consumption mismatch: have %q, want all zeroes", buf)
+	}
+	// Leave some data unread and ensure closing wipes it
+	w.Write([]byte("secret"))
+	r.Close()
+	w.Close()
+
+	if !bytes.Equal(buf, make([]byte, 16)) {
+		t.Fatalf("closed pipe mismatch: have %q, want all zeroes", buf)
+	}
+}
+
+// Tests that copies with secure wiping deliver the data intact.
+func TestSecureWipeCopy(t *testing.T) {
+	for _, size := range []int{100, 1024 * 1024} {
+		out := new(bytes.Buffer)
+		if _, err := Copy(out, bytes.NewReader(testData[:size]), 4096, WithSecureWipe()); err != nil {
+			t.Fatalf("size %d: failed to copy: %v", size, err)
+		}
+		if !bytes.Equal(out.Bytes(), testData[:size]) {
+			t.Fatalf("size %d: copied data mismatch", size)
+		}
+	}
+}